@@ -0,0 +1,190 @@
+package admin
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+// maxModuleSize is the largest Wasm module that can be uploaded.
+const maxModuleSize = 64 << 20
+
+// wasmMagic is the preamble of every Wasm binary.
+var wasmMagic = []byte("\x00asm")
+
+// Router serves the admin API for a Store.
+type Router struct {
+	logger zerolog.Logger
+	store  *Store
+}
+
+// PutModuleResponse is returned after a module has been uploaded.
+type PutModuleResponse struct {
+	Version int64          `json:"version"`
+	Module  *tenant.Module `json:"module"`
+}
+
+// DeleteModuleResponse is returned after a module has been deleted.
+type DeleteModuleResponse struct {
+	Version int64 `json:"version"`
+}
+
+// RefsResponse lists the refs of a module.
+type RefsResponse struct {
+	Refs []string `json:"refs"`
+}
+
+// NewRouter creates a new echo handler struct that has a logger and an underlying store.
+func NewRouter(logger zerolog.Logger, store *Store) *Router {
+	return &Router{
+		logger: logger.With().Str("module", "admin-router").Logger(),
+		store:  store,
+	}
+}
+
+// Attach takes a prefix and an echo instance to attach the routes onto, along with any middlewares that should apply
+// to them. The prefix can either be empty, or start with a / character. It will attach the following routes to the
+// passed in echo handler:
+// - GET /<prefix>/tenants/:ident/versions
+// - POST /<prefix>/tenants/:ident/namespaces/:namespace/modules/:name
+// - DELETE /<prefix>/tenants/:ident/namespaces/:namespace/modules/:name
+// - GET /<prefix>/tenants/:ident/namespaces/:namespace/modules/:name/refs
+//
+// If the prefix is not empty and does not start with a / character, it returns an error.
+func (r *Router) Attach(prefix string, e *echo.Echo, middlewares ...echo.MiddlewareFunc) error {
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	if !strings.HasPrefix(prefix, "/") {
+		return errors.New("prefix must start with a / character")
+	}
+
+	v1 := e.Group(prefix, middlewares...)
+	v1.GET("/tenants/:ident/versions", r.VersionsHandler())
+	v1.POST("/tenants/:ident/namespaces/:namespace/modules/:name", r.PutModuleHandler())
+	v1.DELETE("/tenants/:ident/namespaces/:namespace/modules/:name", r.DeleteModuleHandler())
+	v1.GET("/tenants/:ident/namespaces/:namespace/modules/:name/refs", r.RefsHandler())
+
+	return nil
+}
+
+// PutModuleHandler uploads the Wasm in the request body as a module. The module's language and the API version it was
+// built with can be passed as the lang and apiVersion query params.
+func (r *Router) PutModuleHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ident := readIdent(c)
+		namespace := c.Param("namespace")
+		name := c.Param("name")
+
+		ll := r.logger.With().
+			Str("ident", ident).
+			Str("namespace", namespace).
+			Str("name", name).
+			Logger()
+
+		wasm, err := io.ReadAll(io.LimitReader(c.Request().Body, maxModuleSize+1))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(errors.Wrap(err, "io.ReadAll"))
+		}
+
+		if len(wasm) > maxModuleSize {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "module is too large")
+		}
+
+		if !bytes.HasPrefix(wasm, wasmMagic) {
+			return echo.NewHTTPError(http.StatusBadRequest, "request body is not a Wasm module")
+		}
+
+		mod, version, err := r.store.PutModule(ident, namespace, name, c.QueryParam("lang"), c.QueryParam("apiVersion"), wasm)
+		if err != nil {
+			if common.IsError(err, common.ErrInvalid) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(errors.Wrap(err, "r.store.PutModule"))
+		}
+
+		ll.Info().Str("ref", mod.Ref).Int64("version", version).Msg("module uploaded")
+
+		return c.JSON(http.StatusCreated, PutModuleResponse{Version: version, Module: mod})
+	}
+}
+
+// DeleteModuleHandler deletes a module, unless a workflow still uses it.
+func (r *Router) DeleteModuleHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ident := readIdent(c)
+		namespace := c.Param("namespace")
+		name := c.Param("name")
+
+		version, err := r.store.DeleteModule(ident, namespace, name)
+		if err != nil {
+			if common.IsError(err, common.ErrNotExists) {
+				return echo.NewHTTPError(http.StatusNotFound, "module not found").SetInternal(err)
+			} else if errors.Is(err, ErrModuleInUse) {
+				return echo.NewHTTPError(http.StatusConflict, err.Error()).SetInternal(err)
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(errors.Wrap(err, "r.store.DeleteModule"))
+		}
+
+		r.logger.Info().
+			Str("ident", ident).
+			Str("namespace", namespace).
+			Str("name", name).
+			Int64("version", version).
+			Msg("module deleted")
+
+		return c.JSON(http.StatusOK, DeleteModuleResponse{Version: version})
+	}
+}
+
+// VersionsHandler lists a tenant's versions.
+func (r *Router) VersionsHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		versions, err := r.store.Versions(readIdent(c))
+		if err != nil {
+			if common.IsError(err, common.ErrNotExists) {
+				return echo.NewHTTPError(http.StatusNotFound, "tenant not found").SetInternal(err)
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(errors.Wrap(err, "r.store.Versions"))
+		}
+
+		return c.JSON(http.StatusOK, versions)
+	}
+}
+
+// RefsHandler lists the refs that a module has had.
+func (r *Router) RefsHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		refs, err := r.store.Refs(readIdent(c), c.Param("namespace"), c.Param("name"))
+		if err != nil {
+			if common.IsError(err, common.ErrNotExists) {
+				return echo.NewHTTPError(http.StatusNotFound, "module not found").SetInternal(err)
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(errors.Wrap(err, "r.store.Refs"))
+		}
+
+		return c.JSON(http.StatusOK, RefsResponse{Refs: refs})
+	}
+}
+
+// readIdent prefers the tenant ident set by the authorization middleware over the one in the path.
+func readIdent(c echo.Context) string {
+	if ident, ok := c.Get("ident").(string); ok && ident != "" {
+		return ident
+	}
+
+	return c.Param("ident")
+}
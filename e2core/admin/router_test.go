@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/system"
+)
+
+// testAuthorizer lets the token "admin" manage the test tenant, and the token "executor" only execute its modules.
+type testAuthorizer struct{}
+
+func (testAuthorizer) Authorize(token system.Credential, identifier, _, _ string) (*auth.TenantInfo, error) {
+	if token == nil || identifier != testIdent {
+		return nil, common.Error(common.ErrAccess, "access denied")
+	}
+
+	switch token.Value() {
+	case "admin":
+		return &auth.TenantInfo{ID: testIdent}, nil
+	case "executor":
+		return &auth.TenantInfo{ID: testIdent, Scopes: auth.Scopes{auth.OpExecute}}, nil
+	}
+
+	return nil, common.Error(common.ErrAccess, "access denied")
+}
+
+func newTestRouter(t *testing.T) *echo.Echo {
+	e := echo.New()
+
+	err := NewRouter(zerolog.Nop(), startStore(t, t.TempDir())).
+		Attach("/admin/v1", e, auth.AuthorizationMiddleware(testAuthorizer{}, nil, auth.OpAdmin))
+	require.NoError(t, err)
+
+	return e
+}
+
+func serve(e *echo.Echo, method, path, token string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestRouter(t *testing.T) {
+	e := newTestRouter(t)
+
+	module := "/admin/v1/tenants/" + testIdent + "/namespaces/default/modules/hello"
+	versions := "/admin/v1/tenants/" + testIdent + "/versions"
+
+	t.Run("upload", func(t *testing.T) {
+		rec := serve(e, http.MethodPost, module+"?lang=rust", "admin", wasmV1)
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		resp := PutModuleResponse{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, int64(1), resp.Version)
+		assert.Equal(t, "rust", resp.Module.Lang)
+
+		rec = serve(e, http.MethodPost, module, "admin", []byte("not wasm"))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec := serve(e, http.MethodGet, versions, "admin", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := []VersionSummary{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		require.Len(t, resp, 1)
+		require.Len(t, resp[0].Modules, 1)
+		assert.Equal(t, "hello", resp[0].Modules[0].Name)
+
+		rec = serve(e, http.MethodGet, module+"/refs", "admin", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		rec := serve(e, http.MethodDelete, module, "admin", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := DeleteModuleResponse{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, int64(2), resp.Version)
+
+		rec = serve(e, http.MethodDelete, module, "admin", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestRouter_Unauthorized(t *testing.T) {
+	e := newTestRouter(t)
+
+	module := "/admin/v1/tenants/" + testIdent + "/namespaces/default/modules/hello"
+	other := "/admin/v1/tenants/com.suborbital.other/namespaces/default/modules/hello"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"upload without a token", http.MethodPost, module, "", http.StatusUnauthorized},
+		{"upload with an unknown token", http.MethodPost, module, "forged", http.StatusUnauthorized},
+		{"upload to another tenant", http.MethodPost, other, "admin", http.StatusUnauthorized},
+		{"upload without the admin scope", http.MethodPost, module, "executor", http.StatusForbidden},
+		{"list without a token", http.MethodGet, "/admin/v1/tenants/" + testIdent + "/versions", "", http.StatusUnauthorized},
+		{"list without the admin scope", http.MethodGet, "/admin/v1/tenants/" + testIdent + "/versions", "executor", http.StatusForbidden},
+		{"delete without a token", http.MethodDelete, module, "", http.StatusUnauthorized},
+		{"delete without the admin scope", http.MethodDelete, module, "executor", http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(e, tc.method, tc.path, tc.token, wasmV1)
+			assert.Equal(t, tc.want, rec.Code)
+		})
+	}
+
+	// nothing was uploaded by the rejected requests.
+	rec := serve(e, http.MethodGet, "/admin/v1/tenants/"+testIdent+"/versions", "admin", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
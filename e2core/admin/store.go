@@ -0,0 +1,796 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/bundle"
+	"github.com/suborbital/systemspec/capabilities"
+	"github.com/suborbital/systemspec/fqmn"
+	"github.com/suborbital/systemspec/system"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const (
+	tenantsDir  = "tenants"
+	modulesDir  = "modules"
+	versionExt  = ".json"
+	metadataExt = ".metadata.json"
+	wasmExt     = ".wasm"
+	specVersion = 1
+)
+
+// ErrModuleInUse is returned when deleting a module that a workflow still references.
+var ErrModuleInUse = errors.New("module is referenced by a workflow")
+
+// Store is a system.Source that keeps tenant configs and their modules on local disk, so that they can be changed
+// through the admin API rather than by rebuilding the bundle. Every change creates a new tenant version, and every
+// version is kept so that modules referenced by an older version can still be fetched.
+//
+// The directory layout is:
+//
+//	<path>/tenants/<ident>/<version>.json
+//	<path>/tenants/<ident>/<version>.metadata.json
+//	<path>/modules/<ref>.wasm
+type Store struct {
+	path       string
+	bundlePath string
+
+	// tenants maps each tenant's ident to all of its versions.
+	tenants map[string]map[int64]*tenant.Config
+	// metadata maps each tenant's ident to the module metadata of all of its versions that have any.
+	metadata map[string]map[int64]metadata.Tenant
+	lock     sync.RWMutex
+}
+
+// VersionSummary describes a single version of a tenant.
+type VersionSummary struct {
+	Version int64           `json:"version"`
+	Modules []ModuleSummary `json:"modules"`
+}
+
+// ModuleSummary describes a module within a tenant version.
+type ModuleSummary struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Ref       string `json:"ref"`
+	FQMN      string `json:"fqmn"`
+}
+
+// NewStore creates a Store rooted at path. If the store is empty when it is started, it is seeded with the contents of
+// the bundle at bundlePath, if there is one.
+func NewStore(path, bundlePath string) (*Store, error) {
+	if path == "" {
+		return nil, common.InvalidArgument("admin store requires a directory")
+	}
+
+	s := &Store{
+		path:       path,
+		bundlePath: bundlePath,
+		tenants:    map[string]map[int64]*tenant.Config{},
+		metadata:   map[string]map[int64]metadata.Tenant{},
+		lock:       sync.RWMutex{},
+	}
+
+	return s, nil
+}
+
+// Start loads the store from disk.
+func (s *Store) Start() error {
+	for _, dir := range []string{tenantsDir, modulesDir} {
+		if err := os.MkdirAll(filepath.Join(s.path, dir), 0700); err != nil {
+			return errors.Wrap(err, "os.MkdirAll")
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.load(); err != nil {
+		return errors.Wrap(err, "failed to load")
+	}
+
+	if len(s.tenants) > 0 || s.bundlePath == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(s.bundlePath); err != nil {
+		// there's nothing to seed the store with, tenants will be created as modules are uploaded.
+		return nil
+	}
+
+	if err := s.importBundle(); err != nil {
+		return errors.Wrap(err, "failed to importBundle")
+	}
+
+	return nil
+}
+
+// State returns the state of the entire system. The system version is the sum of every tenant's latest version, which
+// increases every time a tenant changes.
+func (s *Store) State() (*system.State, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return &system.State{SystemVersion: s.systemVersion()}, nil
+}
+
+// Overview gets the overview for the entire system.
+func (s *Store) Overview() (*system.Overview, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	idents := map[string]int64{}
+	for ident, versions := range s.tenants {
+		idents[ident] = latestVersion(versions)
+	}
+
+	ovv := &system.Overview{
+		State: system.State{
+			SystemVersion: s.systemVersion(),
+		},
+		TenantRefs: system.References{
+			Identifiers: idents,
+		},
+	}
+
+	return ovv, nil
+}
+
+// TenantOverview returns the latest version of a tenant.
+func (s *Store) TenantOverview(ident string) (*system.TenantOverview, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	config := s.latest(ident)
+	if config == nil {
+		return nil, system.ErrTenantNotFound
+	}
+
+	ovv := &system.TenantOverview{
+		Identifier: ident,
+		Version:    config.TenantVersion,
+		Config:     config,
+	}
+
+	return ovv, nil
+}
+
+// GetModule searches every version of the tenant for the requested module, newest first, and returns it along with
+// its Wasm, otherwise system.ErrModuleNotFound.
+func (s *Store) GetModule(FQMN string) (*tenant.Module, error) {
+	parsed, err := fqmn.Parse(FQMN)
+	if err != nil {
+		return nil, errors.Wrap(system.ErrModuleNotFound, err.Error())
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	versions := s.tenants[parsed.Tenant]
+
+	for _, version := range sortedVersions(versions) {
+		for _, mod := range versions[version].Modules {
+			if mod.Namespace != parsed.Namespace || mod.Name != parsed.Name {
+				continue
+			}
+
+			if parsed.Ref != "" && mod.Ref != parsed.Ref {
+				continue
+			}
+
+			data, err := os.ReadFile(s.wasmPath(mod.Ref))
+			if err != nil {
+				return nil, errors.Wrap(err, "os.ReadFile")
+			}
+
+			mod.WasmRef = tenant.NewWasmModuleRef(mod.Name, mod.FQMN, data)
+
+			return &mod, nil
+		}
+	}
+
+	return nil, system.ErrModuleNotFound
+}
+
+// Workflows returns the workflows for a namespace at the given tenant version.
+func (s *Store) Workflows(ident, namespace string, version int64) ([]tenant.Workflow, error) {
+	ns, err := s.namespace(ident, namespace, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.Workflows, nil
+}
+
+// Connections returns the connections for a namespace at the given tenant version.
+func (s *Store) Connections(ident, namespace string, version int64) ([]tenant.Connection, error) {
+	ns, err := s.namespace(ident, namespace, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return ns.Connections, nil
+}
+
+// Authentication returns the authentication for a namespace at the given tenant version.
+func (s *Store) Authentication(ident, namespace string, version int64) (*tenant.Authentication, error) {
+	ns, err := s.namespace(ident, namespace, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if ns.Authentication == nil {
+		return nil, system.ErrTenantNotFound
+	}
+
+	return ns.Authentication, nil
+}
+
+// Capabilities returns the capabilities for a namespace at the given tenant version, or the default capabilities if
+// none are configured.
+func (s *Store) Capabilities(ident, namespace string, version int64) (*capabilities.CapabilityConfig, error) {
+	defaultConfig := capabilities.DefaultCapabilityConfig()
+
+	ns, err := s.namespace(ident, namespace, version)
+	if err != nil || ns.Capabilities == nil {
+		return &defaultConfig, nil
+	}
+
+	return ns.Capabilities, nil
+}
+
+// ModuleMetadata returns the module metadata of the given tenant version, or of the latest version if it does not
+// exist.
+func (s *Store) ModuleMetadata(ident string, version int64) (metadata.Tenant, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	versions, exists := s.tenants[ident]
+	if !exists {
+		return nil, system.ErrTenantNotFound
+	}
+
+	if _, exists := versions[version]; !exists {
+		version = latestVersion(versions)
+	}
+
+	return s.metadataCopy(ident, version), nil
+}
+
+// PutModule stores the Wasm for a module and adds it to the tenant's config, or replaces the module's ref if it
+// already exists, creating a new tenant version. The tenant and namespace are created if needed. Uploading the same
+// Wasm as the current ref is a no-op.
+func (s *Store) PutModule(ident, namespace, name, lang, apiVersion string, wasm []byte) (*tenant.Module, int64, error) {
+	if err := validateParts(ident, namespace, name); err != nil {
+		return nil, 0, err
+	}
+
+	sum := sha256.Sum256(wasm)
+	ref := hex.EncodeToString(sum[:])
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	config := s.current(ident)
+	md := s.metadataCopy(ident, config.TenantVersion)
+
+	FQMN, err := config.FQMNForFunc(namespace, name, ref)
+	if err != nil {
+		return nil, 0, common.InvalidArgument("invalid module name: %s", err.Error())
+	}
+
+	mod := tenant.Module{
+		Name:       name,
+		Namespace:  namespace,
+		Lang:       lang,
+		Ref:        ref,
+		APIVersion: apiVersion,
+		FQMN:       FQMN,
+		Revisions:  []tenant.ModuleRevision{},
+	}
+
+	existing := findModule(config, namespace, name)
+	if existing != -1 {
+		prev := config.Modules[existing]
+		if prev.Ref == ref {
+			return &prev, config.TenantVersion, nil
+		}
+
+		mod.Revisions = append(prev.Revisions, tenant.ModuleRevision{Ref: prev.Ref})
+		config.Modules[existing] = mod
+	} else {
+		config.Modules = append(config.Modules, mod)
+	}
+
+	ensureNamespace(config, namespace)
+
+	if err := s.writeWasm(ref, wasm); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to writeWasm")
+	}
+
+	config.TenantVersion++
+
+	if err := s.save(config, md); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to save")
+	}
+
+	return &mod, config.TenantVersion, nil
+}
+
+// DeleteModule removes a module from the tenant's config, creating a new tenant version. The module's Wasm is kept
+// since older versions still reference it.
+func (s *Store) DeleteModule(ident, namespace, name string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	config := s.latest(ident)
+	if config == nil {
+		return 0, common.DoesNotExistError("tenant %s", ident)
+	}
+
+	existing := findModule(config, namespace, name)
+	if existing == -1 {
+		return 0, common.DoesNotExistError("module %s/%s", namespace, name)
+	}
+
+	if wfl := referencingWorkflow(config, namespace, name); wfl != "" {
+		return 0, errors.Wrapf(ErrModuleInUse, "workflow %s", wfl)
+	}
+
+	md := s.metadataCopy(ident, config.TenantVersion)
+	delete(md, metadata.Key(namespace, name))
+
+	config.Modules = append(config.Modules[:existing], config.Modules[existing+1:]...)
+	config.TenantVersion++
+
+	if err := s.save(config, md); err != nil {
+		return 0, errors.Wrap(err, "failed to save")
+	}
+
+	return config.TenantVersion, nil
+}
+
+// Versions lists every version of a tenant along with the modules it contained, newest first.
+func (s *Store) Versions(ident string) ([]VersionSummary, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	versions, exists := s.tenants[ident]
+	if !exists {
+		return nil, common.DoesNotExistError("tenant %s", ident)
+	}
+
+	summaries := make([]VersionSummary, 0, len(versions))
+
+	for _, version := range sortedVersions(versions) {
+		summary := VersionSummary{
+			Version: version,
+			Modules: make([]ModuleSummary, len(versions[version].Modules)),
+		}
+
+		for i, mod := range versions[version].Modules {
+			summary.Modules[i] = ModuleSummary{
+				Namespace: mod.Namespace,
+				Name:      mod.Name,
+				Ref:       mod.Ref,
+				FQMN:      mod.FQMN,
+			}
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// Refs lists every ref that a module has had, the current one first.
+func (s *Store) Refs(ident, namespace, name string) ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	config := s.latest(ident)
+	if config == nil {
+		return nil, common.DoesNotExistError("tenant %s", ident)
+	}
+
+	existing := findModule(config, namespace, name)
+	if existing == -1 {
+		return nil, common.DoesNotExistError("module %s/%s", namespace, name)
+	}
+
+	mod := config.Modules[existing]
+
+	refs := []string{mod.Ref}
+	for i := len(mod.Revisions) - 1; i >= 0; i-- {
+		refs = append(refs, mod.Revisions[i].Ref)
+	}
+
+	return refs, nil
+}
+
+// namespace returns a copy of the namespace config at the given tenant version, or the latest version if it does not
+// exist.
+func (s *Store) namespace(ident, namespace string, version int64) (*tenant.NamespaceConfig, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stored, exists := s.tenants[ident][version]
+	if !exists {
+		stored = s.tenants[ident][latestVersion(s.tenants[ident])]
+	}
+
+	if stored == nil {
+		return nil, system.ErrTenantNotFound
+	}
+
+	config, err := cloneConfig(stored)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to cloneConfig")
+	}
+
+	if namespace == fqmn.NamespaceDefault {
+		return &config.DefaultNamespace, nil
+	}
+
+	for i := range config.Namespaces {
+		if config.Namespaces[i].Name == namespace {
+			return &config.Namespaces[i], nil
+		}
+	}
+
+	return nil, system.ErrNamespaceNotFound
+}
+
+// latest returns a copy of the tenant's latest version, or nil if the tenant does not exist. The lock must be held.
+func (s *Store) latest(ident string) *tenant.Config {
+	versions, exists := s.tenants[ident]
+	if !exists {
+		return nil
+	}
+
+	config, err := cloneConfig(versions[latestVersion(versions)])
+	if err != nil {
+		return nil
+	}
+
+	return config
+}
+
+// current returns a copy of the tenant's latest version, or a new tenant config if the tenant does not exist. The lock
+// must be held.
+func (s *Store) current(ident string) *tenant.Config {
+	config := s.latest(ident)
+	if config == nil {
+		config = &tenant.Config{
+			Identifier:  ident,
+			SpecVersion: specVersion,
+			DefaultNamespace: tenant.NamespaceConfig{
+				Name: fqmn.NamespaceDefault,
+			},
+			Namespaces: []tenant.NamespaceConfig{},
+			Modules:    []tenant.Module{},
+		}
+	}
+
+	return config
+}
+
+// systemVersion returns the sum of every tenant's latest version. The lock must be held.
+func (s *Store) systemVersion() int64 {
+	var version int64
+	for _, versions := range s.tenants {
+		version += latestVersion(versions)
+	}
+
+	return version
+}
+
+// metadataCopy returns a copy of the module metadata of a tenant version, which is empty if it has none. The lock must
+// be held.
+func (s *Store) metadataCopy(ident string, version int64) metadata.Tenant {
+	md := metadata.Tenant{}
+	for key, mod := range s.metadata[ident][version] {
+		md[key] = mod
+	}
+
+	return md
+}
+
+// save writes a tenant version and its module metadata to disk and adds them to the store. The lock must be held.
+func (s *Store) save(config *tenant.Config, md metadata.Tenant) error {
+	dir := filepath.Join(s.path, tenantsDir, config.Identifier)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "os.MkdirAll")
+	}
+
+	// the Wasm is stored separately, so make sure it doesn't end up in the config too.
+	for i := range config.Modules {
+		config.Modules[i].WasmRef = nil
+	}
+
+	configJSON, err := config.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "config.Marshal")
+	}
+
+	// the metadata is written first, so that a version is never loaded without it.
+	if len(md) > 0 {
+		mdJSON, err := json.Marshal(md)
+		if err != nil {
+			return errors.Wrap(err, "json.Marshal")
+		}
+
+		if err := writeFile(filepath.Join(dir, fmt.Sprintf("%d%s", config.TenantVersion, metadataExt)), mdJSON); err != nil {
+			return errors.Wrap(err, "failed to writeFile")
+		}
+	}
+
+	if err := writeFile(filepath.Join(dir, fmt.Sprintf("%d%s", config.TenantVersion, versionExt)), configJSON); err != nil {
+		return errors.Wrap(err, "failed to writeFile")
+	}
+
+	s.add(config, md)
+
+	return nil
+}
+
+// add adds a tenant version and its module metadata to the store. The lock must be held.
+func (s *Store) add(config *tenant.Config, md metadata.Tenant) {
+	if _, exists := s.tenants[config.Identifier]; !exists {
+		s.tenants[config.Identifier] = map[int64]*tenant.Config{}
+		s.metadata[config.Identifier] = map[int64]metadata.Tenant{}
+	}
+
+	s.tenants[config.Identifier][config.TenantVersion] = config
+
+	if len(md) > 0 {
+		s.metadata[config.Identifier][config.TenantVersion] = md
+	}
+}
+
+// load reads every tenant version from disk. The lock must be held.
+func (s *Store) load() error {
+	idents, err := os.ReadDir(filepath.Join(s.path, tenantsDir))
+	if err != nil {
+		return errors.Wrap(err, "os.ReadDir")
+	}
+
+	for _, ident := range idents {
+		if !ident.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(s.path, tenantsDir, ident.Name())
+
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return errors.Wrap(err, "os.ReadDir")
+		}
+
+		for _, file := range files {
+			if !strings.HasSuffix(file.Name(), versionExt) {
+				continue
+			}
+
+			version := strings.TrimSuffix(file.Name(), versionExt)
+			if _, err := strconv.ParseInt(version, 10, 64); err != nil {
+				continue
+			}
+
+			configJSON, err := os.ReadFile(filepath.Join(dir, file.Name()))
+			if err != nil {
+				return errors.Wrap(err, "os.ReadFile")
+			}
+
+			config := &tenant.Config{}
+			if err := config.Unmarshal(configJSON); err != nil {
+				return errors.Wrapf(err, "config.Unmarshal %s", file.Name())
+			}
+
+			md := metadata.Tenant{}
+
+			mdJSON, err := os.ReadFile(filepath.Join(dir, version+metadataExt))
+			if err == nil {
+				if err := json.Unmarshal(mdJSON, &md); err != nil {
+					return errors.Wrapf(err, "json.Unmarshal %s", version+metadataExt)
+				}
+			} else if !os.IsNotExist(err) {
+				return errors.Wrap(err, "os.ReadFile")
+			}
+
+			s.add(config, md)
+		}
+	}
+
+	return nil
+}
+
+// importBundle seeds the store with the bundle's tenant config and modules. The lock must be held.
+func (s *Store) importBundle() error {
+	bdl, err := bundle.Read(s.bundlePath)
+	if err != nil {
+		return errors.Wrap(err, "bundle.Read")
+	}
+
+	config := bdl.TenantConfig
+
+	md, err := metadata.ReadBundle(s.bundlePath)
+	if err != nil {
+		return errors.Wrap(err, "metadata.ReadBundle")
+	}
+
+	if err := validateParts(config.Identifier, fqmn.NamespaceDefault, "bundle"); err != nil {
+		return err
+	}
+
+	for _, mod := range config.Modules {
+		if mod.WasmRef == nil {
+			continue
+		}
+
+		if err := s.writeWasm(mod.Ref, mod.WasmRef.Data); err != nil {
+			return errors.Wrap(err, "failed to writeWasm")
+		}
+	}
+
+	if config.TenantVersion == 0 {
+		config.TenantVersion = 1
+	}
+
+	if err := s.save(config, md); err != nil {
+		return errors.Wrap(err, "failed to save")
+	}
+
+	return nil
+}
+
+// writeWasm stores the Wasm for a ref, unless it's already stored.
+func (s *Store) writeWasm(ref string, wasm []byte) error {
+	if ref == "" || strings.ContainsAny(ref, `/\.`) {
+		return common.InvalidArgument("invalid module ref %q", ref)
+	}
+
+	path := s.wasmPath(ref)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	return writeFile(path, wasm)
+}
+
+func (s *Store) wasmPath(ref string) string {
+	return filepath.Join(s.path, modulesDir, ref+wasmExt)
+}
+
+// writeFile writes to a temporary file first so that readers never see a partially written file.
+func writeFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrap(err, "os.WriteFile")
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "os.Rename")
+	}
+
+	return nil
+}
+
+// validateParts ensures that the parts of a module's name are safe to use in FQMNs and file paths.
+func validateParts(ident, namespace, name string) error {
+	for _, part := range []string{ident, namespace, name} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\@`) {
+			return common.InvalidArgument("invalid name %q", part)
+		}
+	}
+
+	return nil
+}
+
+func findModule(config *tenant.Config, namespace, name string) int {
+	for i, mod := range config.Modules {
+		if mod.Namespace == namespace && mod.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ensureNamespace adds a config for the namespace if the tenant does not have one yet.
+func ensureNamespace(config *tenant.Config, namespace string) {
+	if namespace == fqmn.NamespaceDefault {
+		return
+	}
+
+	for _, ns := range config.Namespaces {
+		if ns.Name == namespace {
+			return
+		}
+	}
+
+	config.Namespaces = append(config.Namespaces, tenant.NamespaceConfig{Name: namespace})
+}
+
+// referencingWorkflow returns the name of the first workflow that has a step referencing the module.
+func referencingWorkflow(config *tenant.Config, namespace, name string) string {
+	references := func(ref string) bool {
+		parsed, err := fqmn.Parse(ref)
+		if err != nil {
+			return false
+		}
+
+		return parsed.Namespace == namespace && parsed.Name == name
+	}
+
+	namespaces := append([]tenant.NamespaceConfig{config.DefaultNamespace}, config.Namespaces...)
+
+	for _, ns := range namespaces {
+		for _, wfl := range ns.Workflows {
+			for _, step := range wfl.Steps {
+				if references(step.FQMN) {
+					return wfl.Name
+				}
+
+				for _, ref := range step.Group {
+					if references(ref) {
+						return wfl.Name
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// cloneConfig deep copies a config so that changes to it are not visible to readers of the stored version.
+func cloneConfig(config *tenant.Config) (*tenant.Config, error) {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+
+	clone := &tenant.Config{}
+	if err := json.Unmarshal(configJSON, clone); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return clone, nil
+}
+
+func latestVersion(versions map[int64]*tenant.Config) int64 {
+	var latest int64
+	for version := range versions {
+		if version > latest {
+			latest = version
+		}
+	}
+
+	return latest
+}
+
+// sortedVersions returns the versions newest first.
+func sortedVersions(versions map[int64]*tenant.Config) []int64 {
+	sorted := make([]int64, 0, len(versions))
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	return sorted
+}
@@ -0,0 +1,245 @@
+package admin
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/system"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const testIdent = "com.suborbital.test"
+
+var (
+	wasmV1 = []byte("\x00asm\x01\x00\x00\x00")
+	wasmV2 = []byte("\x00asm\x01\x00\x00\x00\x00")
+)
+
+func startStore(t *testing.T, dir string) *Store {
+	t.Helper()
+
+	s, err := NewStore(dir, "")
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+
+	return s
+}
+
+func TestStorePutModule(t *testing.T) {
+	s := startStore(t, t.TempDir())
+
+	mod, version, err := s.PutModule(testIdent, "default", "hello", "rust", "0.1.0", wasmV1)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), version)
+	assert.Equal(t, "rust", mod.Lang)
+	assert.Contains(t, mod.FQMN, "fqmn://com.suborbital.test/default/hello@")
+
+	state, err := s.State()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), state.SystemVersion)
+
+	ovv, err := s.TenantOverview(testIdent)
+	require.NoError(t, err)
+	require.Len(t, ovv.Config.Modules, 1)
+	assert.Nil(t, ovv.Config.Modules[0].WasmRef)
+
+	fetched, err := s.GetModule(mod.FQMN)
+	require.NoError(t, err)
+	require.NotNil(t, fetched.WasmRef)
+	assert.Equal(t, wasmV1, fetched.WasmRef.Data)
+
+	t.Run("same Wasm does not create a version", func(t *testing.T) {
+		_, version, err := s.PutModule(testIdent, "default", "hello", "rust", "0.1.0", wasmV1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), version)
+	})
+
+	t.Run("new namespace is created", func(t *testing.T) {
+		_, version, err := s.PutModule(testIdent, "api", "users", "tinygo", "", wasmV1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), version)
+
+		_, err = s.Workflows(testIdent, "api", version)
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid names are rejected", func(t *testing.T) {
+		_, _, err := s.PutModule(testIdent, "default", "../hello", "rust", "", wasmV1)
+		assert.True(t, common.IsError(err, common.ErrInvalid))
+	})
+}
+
+func TestStoreVersions(t *testing.T) {
+	dir := t.TempDir()
+	s := startStore(t, dir)
+
+	first, _, err := s.PutModule(testIdent, "default", "hello", "rust", "", wasmV1)
+	require.NoError(t, err)
+
+	second, version, err := s.PutModule(testIdent, "default", "hello", "rust", "", wasmV2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, []tenant.ModuleRevision{{Ref: first.Ref}}, second.Revisions)
+
+	refs, err := s.Refs(testIdent, "default", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, []string{second.Ref, first.Ref}, refs)
+
+	versions, err := s.Versions(testIdent)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, int64(2), versions[0].Version)
+	assert.Equal(t, second.Ref, versions[0].Modules[0].Ref)
+	assert.Equal(t, first.Ref, versions[1].Modules[0].Ref)
+
+	// sats that are still running the previous ref need to be able to fetch it.
+	old, err := s.GetModule(first.FQMN)
+	require.NoError(t, err)
+	assert.Equal(t, wasmV1, old.WasmRef.Data)
+
+	// everything survives a restart.
+	reloaded := startStore(t, dir)
+
+	reloadedVersions, err := reloaded.Versions(testIdent)
+	require.NoError(t, err)
+	assert.Equal(t, versions, reloadedVersions)
+}
+
+func TestStoreDeleteModule(t *testing.T) {
+	dir := t.TempDir()
+
+	config := &tenant.Config{
+		Identifier:    testIdent,
+		TenantVersion: 1,
+		DefaultNamespace: tenant.NamespaceConfig{
+			Name: "default",
+			Workflows: []tenant.Workflow{
+				{Name: "greet", Steps: []tenant.WorkflowStep{{Group: []string{"/name/default/hello"}}}},
+			},
+		},
+		Modules: []tenant.Module{
+			{Name: "hello", Namespace: "default", Ref: "aaa"},
+			{Name: "goodbye", Namespace: "default", Ref: "bbb"},
+		},
+	}
+
+	configJSON, err := config.Marshal()
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, tenantsDir, testIdent), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tenantsDir, testIdent, "1.json"), configJSON, 0600))
+
+	s := startStore(t, dir)
+
+	version, err := s.DeleteModule(testIdent, "default", "goodbye")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	ovv, err := s.TenantOverview(testIdent)
+	require.NoError(t, err)
+	require.Len(t, ovv.Config.Modules, 1)
+	assert.Equal(t, "hello", ovv.Config.Modules[0].Name)
+
+	_, err = s.DeleteModule(testIdent, "default", "goodbye")
+	assert.True(t, common.IsError(err, common.ErrNotExists))
+
+	_, err = s.DeleteModule(testIdent, "default", "hello")
+	assert.ErrorIs(t, err, ErrModuleInUse)
+
+	_, err = s.DeleteModule("com.suborbital.missing", "default", "hello")
+	assert.True(t, common.IsError(err, common.ErrNotExists))
+
+	_, err = s.TenantOverview("com.suborbital.missing")
+	assert.ErrorIs(t, err, system.ErrTenantNotFound)
+}
+
+func TestStoreNamespace_ReturnsCopy(t *testing.T) {
+	s := startStore(t, t.TempDir())
+
+	_, version, err := s.PutModule(testIdent, "api", "users", "rust", "", wasmV1)
+	require.NoError(t, err)
+
+	require.NoError(t, s.save(&tenant.Config{
+		Identifier:    testIdent,
+		TenantVersion: version + 1,
+		Namespaces: []tenant.NamespaceConfig{
+			{Name: "api", Workflows: []tenant.Workflow{{Name: "list", Steps: []tenant.WorkflowStep{{FQMN: "/name/api/users"}}}}},
+		},
+	}, nil))
+
+	workflows, err := s.Workflows(testIdent, "api", version+1)
+	require.NoError(t, err)
+	require.Len(t, workflows, 1)
+
+	workflows[0].Name = "changed"
+
+	workflows, err = s.Workflows(testIdent, "api", version+1)
+	require.NoError(t, err)
+	assert.Equal(t, "list", workflows[0].Name)
+}
+
+func TestStoreModuleMetadata(t *testing.T) {
+	dir := t.TempDir()
+	bundlePath := filepath.Join(t.TempDir(), "modules.wasm.zip")
+
+	file, err := os.Create(bundlePath)
+	require.NoError(t, err)
+
+	w := zip.NewWriter(file)
+
+	f, err := w.Create("tenant.json")
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte(`{
+		"identifier": "com.suborbital.test",
+		"tenantVersion": 1,
+		"defaultNamespace": {"name": "default"},
+		"modules": [{"name": "slow", "namespace": "default", "ref": "slow", "metadata": {"timeout": "1m"}}]
+	}`))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	require.NoError(t, file.Close())
+
+	s, err := NewStore(dir, bundlePath)
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+
+	slow := metadata.Module{Timeout: metadata.Duration(time.Minute)}
+
+	md, err := s.ModuleMetadata(testIdent, 1)
+	require.NoError(t, err)
+	assert.Equal(t, slow, md.Module("default", "slow"))
+
+	// changes to the returned metadata must not reach the store.
+	delete(md, metadata.Key("default", "slow"))
+
+	_, version, err := s.PutModule(testIdent, "default", "hello", "rust", "", wasmV1)
+	require.NoError(t, err)
+
+	// the metadata is carried over to new versions, and kept on disk.
+	reopened := startStore(t, dir)
+
+	md, err = reopened.ModuleMetadata(testIdent, version)
+	require.NoError(t, err)
+	assert.Equal(t, slow, md.Module("default", "slow"))
+
+	version, err = reopened.DeleteModule(testIdent, "default", "slow")
+	require.NoError(t, err)
+
+	md, err = reopened.ModuleMetadata(testIdent, version)
+	require.NoError(t, err)
+	assert.Empty(t, md)
+
+	_, err = reopened.ModuleMetadata("com.suborbital.other", 1)
+	assert.ErrorIs(t, err, system.ErrTenantNotFound)
+}
@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/e2core/foundation/scheduler"
+)
+
+const (
+	StoreTypeMemory = "memory"
+	StoreTypeDisk   = "disk"
+	StoreTypeNone   = "none"
+
+	// DefaultLimit is how many entries a query returns if it does not say.
+	DefaultLimit = 100
+	// MaxLimit is the most entries a query can return.
+	MaxLimit = 1000
+)
+
+// Entry records a single execution of a module or a workflow. FQMN is set for the execution of a single module, and
+// Steps holds the FQMN of every module of a workflow. Status is the HTTP status that the execution resulted in. Input
+// and Output are only kept if payloads are recorded, and are cut short to the configured size.
+type Entry struct {
+	RequestID  string            `json:"requestId"`
+	Ident      string            `json:"ident"`
+	Namespace  string            `json:"namespace"`
+	FQMN       string            `json:"fqmn,omitempty"`
+	Steps      []string          `json:"steps,omitempty"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	StartedAt  time.Time         `json:"startedAt"`
+	DurationMS int64             `json:"durationMs"`
+	Status     int               `json:"status"`
+	RunErr     *scheduler.RunErr `json:"runErr,omitempty"`
+	ExecErr    string            `json:"execErr,omitempty"`
+	InputSize  int               `json:"inputSize"`
+	OutputSize int               `json:"outputSize"`
+	Input      []byte            `json:"input,omitempty"`
+	Output     []byte            `json:"output,omitempty"`
+}
+
+// Query selects entries. Ident must be set. FQMN matches an entry's FQMN or any of its steps, and Status is either an
+// exact status code such as 404 or a class such as 5xx. Entries are returned newest first, up to Limit of them.
+type Query struct {
+	Ident  string
+	FQMN   string
+	Status string
+	Since  time.Time
+	Limit  int
+}
+
+// Log stores execution entries and answers queries about them.
+type Log interface {
+	// Add records an entry.
+	Add(entry Entry) error
+	// Query returns the entries matching the query, newest first.
+	Query(q Query) ([]Entry, error)
+	// Prune removes the entries of executions started before the given time.
+	Prune(before time.Time) error
+	// Close writes out the entries that have been added and releases the log's resources.
+	Close() error
+}
+
+// FromOptions creates the Log configured by E2CORE_AUDIT_STORE, or returns nil if recording is turned off.
+func FromOptions(opts *options.Options) (Log, error) {
+	config := opts.AuditConfig
+
+	switch config.Store {
+	case StoreTypeMemory, "":
+		return NewRingLog(config.Capacity), nil
+	case StoreTypeDisk:
+		l, err := NewDiskLog(config.Path)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewDiskLog")
+		}
+
+		return l, nil
+	case StoreTypeNone:
+		return nil, nil
+	}
+
+	return nil, errors.Errorf("unknown audit store type %q", config.Store)
+}
+
+// Validate checks the query and fills in its defaults.
+func (q *Query) Validate() error {
+	if q.Ident == "" {
+		return common.InvalidArgument("ident must be set")
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	} else if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+
+	if q.Status != "" {
+		if _, _, err := statusRange(q.Status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches returns true if the entry is selected by the query.
+func (q *Query) Matches(e *Entry) bool {
+	if e.Ident != q.Ident || e.StartedAt.Before(q.Since) {
+		return false
+	}
+
+	if q.FQMN != "" && e.FQMN != q.FQMN && !contains(e.Steps, q.FQMN) {
+		return false
+	}
+
+	if q.Status != "" {
+		low, high, err := statusRange(q.Status)
+		if err != nil || e.Status < low || e.Status > high {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Truncate returns at most max bytes of payload.
+func Truncate(payload []byte, max int) []byte {
+	if len(payload) <= max {
+		return payload
+	}
+
+	return payload[:max]
+}
+
+// statusRange returns the lowest and highest status code matched by an exact code or a class such as 4xx.
+func statusRange(status string) (int, int, error) {
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+		class, err := strconv.Atoi(status[:1])
+		if err == nil && class >= 1 && class <= 5 {
+			return class * 100, class*100 + 99, nil
+		}
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, common.InvalidArgument("status must be a status code or a class such as 5xx, got %q", status)
+	}
+
+	return code, code, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
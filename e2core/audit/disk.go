@@ -0,0 +1,384 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+const (
+	logFilePrefix = "executions-"
+	logFileExt    = ".ndjson"
+	logFileLayout = "2006010215"
+
+	// maxLineSize is the longest entry that can be read back, which leaves plenty of room for recorded payloads.
+	maxLineSize = 16 << 20
+
+	// queueSize is how many entries may wait to be written before Add starts refusing them.
+	queueSize = 1024
+)
+
+var (
+	// ErrQueueFull is returned by DiskLog.Add when entries are added faster than they can be written.
+	ErrQueueFull = errors.New("audit log write queue is full")
+
+	// ErrClosed is returned by DiskLog.Add once the log has been closed.
+	ErrClosed = errors.New("audit log is closed")
+)
+
+// DiskLog is a Log that appends entries as JSON lines to a file per hour in a directory. Pruning removes whole files,
+// so entries are kept for up to an hour longer than asked. Entries are written in the background so that adding one
+// does not wait on the disk, and the file that was last written to is kept open.
+type DiskLog struct {
+	dir string
+
+	// queue holds the entries waiting to be written, along with requests to flush them.
+	queue     chan diskOp
+	queueLock sync.RWMutex
+	closed    bool
+	done      chan struct{}
+
+	// fileLock guards the open file, which Prune may remove. Neither Add nor Query take it.
+	fileLock sync.Mutex
+	file     *os.File
+	fileHour time.Time
+	writer   *bufio.Writer
+
+	// writeErr is the last error from writing entries, which the next call to Add returns.
+	writeErr error
+	errLock  sync.Mutex
+}
+
+// diskOp is either an entry to write, or a request to flush the entries queued before it.
+type diskOp struct {
+	entry   Entry
+	flushed chan struct{}
+}
+
+// NewDiskLog creates a DiskLog rooted at dir, creating the directory if needed, and starts writing entries to it.
+func NewDiskLog(dir string) (*DiskLog, error) {
+	if dir == "" {
+		return nil, common.InvalidArgument("disk audit log requires a directory")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "os.MkdirAll")
+	}
+
+	d := &DiskLog{
+		dir:   dir,
+		queue: make(chan diskOp, queueSize),
+		done:  make(chan struct{}),
+	}
+
+	go d.write()
+
+	return d, nil
+}
+
+// Add queues the entry to be appended to the file for the hour it started in. If an earlier entry could not be
+// written, that error is returned.
+func (d *DiskLog) Add(entry Entry) error {
+	d.queueLock.RLock()
+	defer d.queueLock.RUnlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	select {
+	case d.queue <- diskOp{entry: entry}:
+	default:
+		return ErrQueueFull
+	}
+
+	d.errLock.Lock()
+	defer d.errLock.Unlock()
+
+	err := d.writeErr
+	d.writeErr = nil
+
+	return errors.Wrap(err, "failed to write an earlier entry")
+}
+
+// Close writes out the queued entries and closes the file. Entries that are added afterwards are refused.
+func (d *DiskLog) Close() error {
+	d.queueLock.Lock()
+
+	if d.closed {
+		d.queueLock.Unlock()
+		return nil
+	}
+
+	d.closed = true
+	close(d.queue)
+	d.queueLock.Unlock()
+
+	<-d.done
+
+	d.errLock.Lock()
+	defer d.errLock.Unlock()
+
+	return d.writeErr
+}
+
+// write appends the queued entries until the log is closed, flushing them whenever the queue runs empty.
+func (d *DiskLog) write() {
+	defer close(d.done)
+
+	for op := range d.queue {
+		d.fileLock.Lock()
+
+		if op.flushed == nil {
+			d.failed(d.append(op.entry))
+		}
+
+		if op.flushed != nil || len(d.queue) == 0 {
+			d.failed(d.flushFile())
+		}
+
+		d.fileLock.Unlock()
+
+		if op.flushed != nil {
+			close(op.flushed)
+		}
+	}
+
+	d.fileLock.Lock()
+	defer d.fileLock.Unlock()
+
+	d.failed(d.closeFile())
+}
+
+// failed keeps err, if there is one, for Add to return.
+func (d *DiskLog) failed(err error) {
+	if err == nil {
+		return
+	}
+
+	d.errLock.Lock()
+	defer d.errLock.Unlock()
+
+	d.writeErr = err
+}
+
+// append writes the entry to the file for the hour it started in, switching files if needed. The file lock must be
+// held.
+func (d *DiskLog) append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	hour := entry.StartedAt.UTC().Truncate(time.Hour)
+
+	if d.file == nil || !hour.Equal(d.fileHour) {
+		if err := d.closeFile(); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(d.pathFor(hour), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.Wrap(err, "os.OpenFile")
+		}
+
+		d.file = f
+		d.fileHour = hour
+		d.writer = bufio.NewWriter(f)
+	}
+
+	if _, err := d.writer.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "writer.Write")
+	}
+
+	return nil
+}
+
+// flushFile writes the buffered entries to the open file, if there is one. The file lock must be held.
+func (d *DiskLog) flushFile() error {
+	if d.file == nil {
+		return nil
+	}
+
+	return errors.Wrap(d.writer.Flush(), "writer.Flush")
+}
+
+// closeFile flushes and closes the open file, if there is one. The file lock must be held.
+func (d *DiskLog) closeFile() error {
+	if d.file == nil {
+		return nil
+	}
+
+	flushErr := d.flushFile()
+	closeErr := d.file.Close()
+
+	d.file = nil
+	d.writer = nil
+
+	if flushErr != nil {
+		return flushErr
+	}
+
+	return errors.Wrap(closeErr, "file.Close")
+}
+
+// flush waits for the entries that have been added so far to be written.
+func (d *DiskLog) flush() {
+	flushed := make(chan struct{})
+
+	d.queueLock.RLock()
+
+	if d.closed {
+		d.queueLock.RUnlock()
+		return
+	}
+
+	d.queue <- diskOp{flushed: flushed}
+	d.queueLock.RUnlock()
+
+	<-flushed
+}
+
+// Query returns the entries matching the query, newest first.
+func (d *DiskLog) Query(q Query) ([]Entry, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the entries added before the query are written out, and the files are then read without holding up the writer.
+	d.flush()
+
+	hours, err := d.hours()
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]Entry, 0)
+
+	for i := len(hours) - 1; i >= 0 && len(found) < q.Limit; i-- {
+		if hours[i].Add(time.Hour).Before(q.Since) {
+			break
+		}
+
+		entries, err := d.read(hours[i])
+		if err != nil {
+			return nil, err
+		}
+
+		// entries are appended as they complete, so the newest are at the end of the file.
+		for j := len(entries) - 1; j >= 0 && len(found) < q.Limit; j-- {
+			if q.Matches(&entries[j]) {
+				found = append(found, entries[j])
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// Prune removes the files of the hours that ended before the given time, closing the open file first if it is one of
+// them.
+func (d *DiskLog) Prune(before time.Time) error {
+	d.fileLock.Lock()
+	defer d.fileLock.Unlock()
+
+	hours, err := d.hours()
+	if err != nil {
+		return err
+	}
+
+	for _, hour := range hours {
+		if hour.Add(time.Hour).After(before) {
+			break
+		}
+
+		if d.file != nil && hour.Equal(d.fileHour) {
+			if err := d.closeFile(); err != nil {
+				return err
+			}
+		}
+
+		if err := os.Remove(d.pathFor(hour)); err != nil {
+			return errors.Wrap(err, "os.Remove")
+		}
+	}
+
+	return nil
+}
+
+// hours returns the hours that have a file, oldest first.
+func (d *DiskLog) hours() ([]time.Time, error) {
+	files, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadDir")
+	}
+
+	var hours []time.Time
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, logFilePrefix) || !strings.HasSuffix(name, logFileExt) {
+			continue
+		}
+
+		hour, err := time.Parse(logFileLayout, strings.TrimSuffix(strings.TrimPrefix(name, logFilePrefix), logFileExt))
+		if err != nil {
+			continue
+		}
+
+		hours = append(hours, hour)
+	}
+
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+
+	return hours, nil
+}
+
+// read returns the entries in the file for the hour, skipping lines that cannot be parsed, such as one that is still
+// being written. A file that has been pruned since the hours were listed has no entries.
+func (d *DiskLog) read(hour time.Time) ([]Entry, error) {
+	f, err := os.Open(d.pathFor(hour))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "os.Open")
+	}
+
+	defer f.Close()
+
+	var entries []Entry
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+
+	for scanner.Scan() {
+		entry := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanner.Err")
+	}
+
+	return entries, nil
+}
+
+func (d *DiskLog) pathFor(t time.Time) string {
+	return filepath.Join(d.dir, logFilePrefix+t.UTC().Format(logFileLayout)+logFileExt)
+}
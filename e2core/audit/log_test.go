@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/e2core/foundation/scheduler"
+)
+
+func TestLogs(t *testing.T) {
+	disk, err := NewDiskLog(t.TempDir())
+	require.NoError(t, err)
+
+	defer disk.Close()
+
+	logs := map[string]Log{
+		"memory": NewRingLog(10),
+		"disk":   disk,
+	}
+
+	start := time.Now().Add(-2 * time.Hour)
+
+	for name, log := range logs {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, log.Add(Entry{RequestID: "old", Ident: "com.suborbital.app", FQMN: "fqmn://com.suborbital.app/default/hello@v1", Status: 200, StartedAt: start}))
+			require.NoError(t, log.Add(Entry{RequestID: "other", Ident: "com.suborbital.other", FQMN: "fqmn://com.suborbital.other/default/hello@v1", Status: 200, StartedAt: start.Add(time.Hour)}))
+			require.NoError(t, log.Add(Entry{
+				RequestID: "failed",
+				Ident:     "com.suborbital.app",
+				Steps:     []string{"fqmn://com.suborbital.app/default/hello@v1", "fqmn://com.suborbital.app/default/bye@v1"},
+				Status:    401,
+				RunErr:    &scheduler.RunErr{Code: 401, Message: "don't go there"},
+				StartedAt: start.Add(2 * time.Hour),
+			}))
+
+			found, err := log.Query(Query{Ident: "com.suborbital.app"})
+			require.NoError(t, err)
+			require.Len(t, found, 2)
+			assert.Equal(t, "failed", found[0].RequestID, "newest first")
+			assert.Equal(t, 401, found[0].RunErr.Code)
+
+			found, err = log.Query(Query{Ident: "com.suborbital.app", FQMN: "fqmn://com.suborbital.app/default/bye@v1"})
+			require.NoError(t, err)
+			require.Len(t, found, 1)
+			assert.Equal(t, "failed", found[0].RequestID)
+
+			found, err = log.Query(Query{Ident: "com.suborbital.app", Status: "2xx"})
+			require.NoError(t, err)
+			require.Len(t, found, 1)
+			assert.Equal(t, "old", found[0].RequestID)
+
+			found, err = log.Query(Query{Ident: "com.suborbital.app", Limit: 1})
+			require.NoError(t, err)
+			assert.Len(t, found, 1)
+
+			_, err = log.Query(Query{})
+			assert.True(t, common.IsError(err, common.ErrInvalid))
+
+			require.NoError(t, log.Prune(start.Add(90*time.Minute)))
+
+			found, err = log.Query(Query{Ident: "com.suborbital.app"})
+			require.NoError(t, err)
+			require.Len(t, found, 1)
+			assert.Equal(t, "failed", found[0].RequestID)
+		})
+	}
+}
+
+func TestRingLog_Overwrites(t *testing.T) {
+	log := NewRingLog(2)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, log.Add(Entry{RequestID: id, Ident: "com.suborbital.app", StartedAt: time.Now()}))
+	}
+
+	found, err := log.Query(Query{Ident: "com.suborbital.app"})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, "c", found[0].RequestID)
+	assert.Equal(t, "b", found[1].RequestID)
+}
+
+func TestDiskLog_KeepsFileOpen(t *testing.T) {
+	disk, err := NewDiskLog(t.TempDir())
+	require.NoError(t, err)
+
+	defer disk.Close()
+
+	now := time.Now()
+
+	require.NoError(t, disk.Add(Entry{RequestID: "first", Ident: "com.suborbital.app", StartedAt: now}))
+
+	found, err := disk.Query(Query{Ident: "com.suborbital.app"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	disk.fileLock.Lock()
+	open := disk.file
+	disk.fileLock.Unlock()
+
+	require.NotNil(t, open, "the file of the current hour stays open")
+
+	// pruning the open file closes it, and the next entry opens a new one.
+	require.NoError(t, disk.Prune(now.Add(2*time.Hour)))
+	require.NoError(t, disk.Add(Entry{RequestID: "second", Ident: "com.suborbital.app", StartedAt: now}))
+
+	found, err = disk.Query(Query{Ident: "com.suborbital.app"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "second", found[0].RequestID)
+}
+
+func TestDiskLog_Close(t *testing.T) {
+	dir := t.TempDir()
+
+	disk, err := NewDiskLog(dir)
+	require.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, disk.Add(Entry{RequestID: id, Ident: "com.suborbital.app", StartedAt: time.Now()}))
+	}
+
+	require.NoError(t, disk.Close())
+	assert.ErrorIs(t, disk.Add(Entry{RequestID: "late", Ident: "com.suborbital.app", StartedAt: time.Now()}), ErrClosed)
+	assert.NoError(t, disk.Close())
+
+	// the queued entries were written out before the log closed.
+	reopened, err := NewDiskLog(dir)
+	require.NoError(t, err)
+
+	defer reopened.Close()
+
+	found, err := reopened.Query(Query{Ident: "com.suborbital.app"})
+	require.NoError(t, err)
+	assert.Len(t, found, 3)
+}
+
+func TestStatusRange(t *testing.T) {
+	tests := []struct {
+		status    string
+		low, high int
+		valid     bool
+	}{
+		{status: "404", low: 404, high: 404, valid: true},
+		{status: "5xx", low: 500, high: 599, valid: true},
+		{status: "2XX", low: 200, high: 299, valid: true},
+		{status: "9xx"},
+		{status: "42"},
+		{status: "ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			low, high, err := statusRange(tt.status)
+			if !tt.valid {
+				assert.True(t, common.IsError(err, common.ErrInvalid))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.low, low)
+			assert.Equal(t, tt.high, high)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultCapacity is how many entries a RingLog keeps if no capacity is given.
+const defaultCapacity = 10000
+
+// RingLog is a Log that keeps the most recent entries in memory, overwriting the oldest once it is full. Entries do
+// not survive a restart.
+type RingLog struct {
+	entries []Entry
+	next    int
+	full    bool
+	lock    sync.RWMutex
+}
+
+// NewRingLog creates a RingLog that keeps up to capacity entries.
+func NewRingLog(capacity int) *RingLog {
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+
+	return &RingLog{
+		entries: make([]Entry, capacity),
+	}
+}
+
+// Add records the entry, overwriting the oldest one if the log is full.
+func (r *RingLog) Add(entry Entry) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+
+	if r.next == 0 {
+		r.full = true
+	}
+
+	return nil
+}
+
+// Query returns the entries matching the query, newest first.
+func (r *RingLog) Query(q Query) ([]Entry, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	found := make([]Entry, 0)
+
+	for i := 0; i < r.len() && len(found) < q.Limit; i++ {
+		// walk backwards from the newest entry.
+		e := &r.entries[(r.next-1-i+len(r.entries))%len(r.entries)]
+
+		if q.Matches(e) {
+			found = append(found, *e)
+		}
+	}
+
+	return found, nil
+}
+
+// Prune removes the entries of executions started before the given time.
+func (r *RingLog) Prune(before time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	kept := make([]Entry, 0, r.len())
+
+	for i := r.len(); i > 0; i-- {
+		e := r.entries[(r.next-i+len(r.entries))%len(r.entries)]
+
+		if !e.StartedAt.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+
+	entries := make([]Entry, len(r.entries))
+	copy(entries, kept)
+
+	r.entries = entries
+	r.next = len(kept) % len(entries)
+	r.full = len(kept) == len(entries)
+
+	return nil
+}
+
+// Close does nothing, since the entries are only held in memory.
+func (r *RingLog) Close() error {
+	return nil
+}
+
+// len returns how many entries are held. The lock must be held.
+func (r *RingLog) len() int {
+	if r.full {
+		return len(r.entries)
+	}
+
+	return r.next
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -17,15 +16,21 @@ import (
 )
 
 type TenantInfo struct {
-	AuthorizedParty string `json:"authorized_party"`
-	Environment     string `json:"environment"`
-	ID              string `json:"id"`
-	Name            string `json:"name"`
+	AuthorizedParty string `json:"authorized_party" yaml:"authorized_party"`
+	Environment     string `json:"environment" yaml:"environment"`
+	ID              string `json:"id" yaml:"id"`
+	Name            string `json:"name" yaml:"name"`
+	// Scopes limit what the credentials can do within the tenant. They are not limited when there are none.
+	Scopes Scopes `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+
+	// expires is when the credentials that the tenant was authorized with stop being valid, if they say.
+	expires time.Time
 }
 
-func AuthorizationMiddleware(opts *options.Options) echo.MiddlewareFunc {
-	authorizer := NewApiAuthClient(opts)
-
+// AuthorizationMiddleware authorizes the request's token for the ident, namespace and name path params with the
+// authorizer, checks that its scopes and those from local (which may be nil) allow one of the operations, and sets
+// the ident of the tenant that it belongs to in the context. Without operations, any valid token is let through.
+func AuthorizationMiddleware(authorizer Authorizer, local ScopeSource, operations ...string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			identifier := c.Param("ident")
@@ -37,6 +42,15 @@ func AuthorizationMiddleware(opts *options.Options) echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized).SetInternal(err)
 			}
 
+			var localScopes Scopes
+			if local != nil {
+				localScopes = local(tntInfo)
+			}
+
+			if err := CheckScopes(tntInfo, localScopes, operations, namespace, name); err != nil {
+				return echo.NewHTTPError(http.StatusForbidden, err.Error()).SetInternal(err)
+			}
+
 			c.Set("ident", tntInfo.ID)
 
 			return next(c)
@@ -51,7 +65,7 @@ func NewApiAuthClient(opts *options.Options) *AuthzClient {
 			Transport: http.DefaultTransport,
 		},
 		location: opts.ControlPlane + "/environment/v1/tenant/",
-		cache:    NewAuthorizationCache(opts.AuthCacheTTL),
+		cache:    NewAuthorizationCache(opts.AuthCacheTTL, opts.AuthConfig),
 	}
 }
 
@@ -66,11 +80,16 @@ func (client *AuthzClient) Authorize(token system.Credential, identifier, namesp
 		return nil, common.Error(common.ErrAccess, "no credentials provided")
 	}
 
-	key := filepath.Join(identifier, namespace, name, token.Value())
+	key := cacheKey{identifier: identifier, namespace: namespace, name: name, token: token.Value()}
 
 	return client.cache.Get(key, client.loadAuth(token, identifier))
 }
 
+// Cache returns the cache of the client's decisions.
+func (client *AuthzClient) Cache() *AuthorizationCache {
+	return client.cache
+}
+
 func (client *AuthzClient) loadAuth(token system.Credential, identifier string) func() (*TenantInfo, error) {
 	return func() (*TenantInfo, error) {
 		ctx, cxl := context.WithTimeout(context.Background(), 10*time.Second)
@@ -134,6 +153,8 @@ func (a AccessToken) String() string {
 	return fmt.Sprintf("%s %s", a.scheme, a.value)
 }
 
+// ExtractAccessToken returns the credential in the Authorization header. A value without a scheme, such as a bare
+// API key, is taken to be a Bearer token.
 func ExtractAccessToken(header http.Header) system.Credential {
 	authInfo := header.Get(http.CanonicalHeaderKey("Authorization"))
 	if authInfo == "" {
@@ -141,6 +162,10 @@ func ExtractAccessToken(header http.Header) system.Credential {
 	}
 
 	splitAt := strings.Index(authInfo, " ")
+	if splitAt < 0 {
+		return NewAccessToken(authInfo)
+	}
+
 	if splitAt == 0 {
 		return nil
 	}
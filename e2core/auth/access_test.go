@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractAccessToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		wantScheme string
+		wantValue  string
+	}{
+		{name: "scheme and value", header: "Bearer token", wantScheme: "Bearer", wantValue: "token"},
+		{name: "bare value", header: "apikey", wantScheme: "Bearer", wantValue: "apikey"},
+		{name: "missing scheme", header: " token"},
+		{name: "no header"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.header != "" {
+				header.Set("Authorization", tc.header)
+			}
+
+			token := ExtractAccessToken(header)
+			if tc.wantValue == "" {
+				assert.Nil(t, token)
+				return
+			}
+
+			require.NotNil(t, token)
+			assert.Equal(t, tc.wantScheme, token.Scheme())
+			assert.Equal(t, tc.wantValue, token.Value())
+		})
+	}
+}
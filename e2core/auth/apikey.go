@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/system"
+)
+
+const hashPrefix = "sha256:"
+
+// APIKey grants a token access to a tenant. Only the SHA-256 hash of the token is stored, as hex with an optional
+// "sha256:" prefix. Namespaces and Modules restrict which namespaces and modules (or workflows) the token can execute;
+// leaving them empty allows all of them. The tenant's scopes can limit the token further.
+type APIKey struct {
+	Hash       string     `yaml:"hash" json:"hash"`
+	Tenant     TenantInfo `yaml:"tenant" json:"tenant"`
+	Namespaces []string   `yaml:"namespaces,omitempty" json:"namespaces,omitempty"`
+	Modules    []string   `yaml:"modules,omitempty" json:"modules,omitempty"`
+}
+
+// APIKeys is an Authorizer that checks tokens against a static set of API keys.
+type APIKeys struct {
+	keys map[string]APIKey
+}
+
+type apiKeysFile struct {
+	Keys []APIKey `yaml:"keys" json:"keys"`
+}
+
+// LoadAPIKeys reads a YAML (or JSON) file of API keys.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	if path == "" {
+		return nil, common.InvalidArgument("the apikey auth mode requires a keys file")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile")
+	}
+
+	file := apiKeysFile{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(err, "yaml.Unmarshal")
+	}
+
+	return NewAPIKeys(file.Keys)
+}
+
+// NewAPIKeys creates an APIKeys from the given keys, which must each have a distinct hash and a tenant ID.
+func NewAPIKeys(keys []APIKey) (*APIKeys, error) {
+	a := &APIKeys{keys: map[string]APIKey{}}
+
+	for i, key := range keys {
+		hash := strings.ToLower(strings.TrimPrefix(key.Hash, hashPrefix))
+
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("key %d: hash must be a hex encoded SHA-256 hash", i)
+		}
+
+		if key.Tenant.ID == "" {
+			return nil, fmt.Errorf("key %d: tenant id must be set", i)
+		}
+
+		for _, scope := range key.Tenant.Scopes {
+			if err := ValidateScope(scope); err != nil {
+				return nil, errors.Wrapf(err, "key %d", i)
+			}
+		}
+
+		if _, exists := a.keys[hash]; exists {
+			return nil, fmt.Errorf("key %d: hash is used by an earlier key", i)
+		}
+
+		a.keys[hash] = key
+	}
+
+	return a, nil
+}
+
+// HashAPIKey returns the hash of a token, as it is stored in a keys file.
+func HashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Authorize returns the tenant of the key that the token belongs to, if the key grants access to identifier and to
+// namespace and name where they are given.
+func (a *APIKeys) Authorize(token system.Credential, identifier, namespace, name string) (*TenantInfo, error) {
+	if token == nil {
+		return nil, common.Error(common.ErrAccess, "no credentials provided")
+	}
+
+	key, exists := a.keys[strings.TrimPrefix(HashAPIKey(token.Value()), hashPrefix)]
+	if !exists {
+		return nil, common.Error(common.ErrAccess, "unknown API key")
+	}
+
+	if key.Tenant.ID != identifier {
+		return nil, common.Error(common.ErrAccess, "API key does not grant access to %s", identifier)
+	}
+
+	if namespace != "" && !allowed(key.Namespaces, namespace) {
+		return nil, common.Error(common.ErrAccess, "API key does not grant access to namespace %s", namespace)
+	}
+
+	if name != "" && !allowed(key.Modules, name) {
+		return nil, common.Error(common.ErrAccess, "API key does not grant access to %s", name)
+	}
+
+	tenant := key.Tenant
+
+	return &tenant, nil
+}
+
+// allowed returns true if the list is empty or contains the value.
+func allowed(list []string, value string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+func TestAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+keys:
+  - hash: `+HashAPIKey("all-access")+`
+    tenant:
+      id: com.suborbital.app
+      name: app
+  - hash: `+HashAPIKey("hello-only")[len(hashPrefix):]+`
+    tenant:
+      id: com.suborbital.app
+    namespaces: [default]
+    modules: [hello]
+`), 0600))
+
+	keys, err := LoadAPIKeys(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		token      string
+		identifier string
+		namespace  string
+		module     string
+		allowed    bool
+	}{
+		{"any module", "all-access", "com.suborbital.app", "other", "bye", true},
+		{"tenant scoped route", "all-access", "com.suborbital.app", "", "", true},
+		{"other tenant", "all-access", "com.suborbital.other", "default", "hello", false},
+		{"allowed module", "hello-only", "com.suborbital.app", "default", "hello", true},
+		{"other module", "hello-only", "com.suborbital.app", "default", "bye", false},
+		{"other namespace", "hello-only", "com.suborbital.app", "other", "hello", false},
+		{"unknown key", "guess", "com.suborbital.app", "default", "hello", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := keys.Authorize(NewAccessToken(tc.token), tc.identifier, tc.namespace, tc.module)
+			if !tc.allowed {
+				assert.True(t, common.IsError(err, common.ErrAccess))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "com.suborbital.app", info.ID)
+		})
+	}
+
+	_, err = keys.Authorize(nil, "com.suborbital.app", "default", "hello")
+	assert.True(t, common.IsError(err, common.ErrAccess))
+}
+
+func TestNewAPIKeys_Invalid(t *testing.T) {
+	tenant := TenantInfo{ID: "com.suborbital.app"}
+
+	tests := map[string][]APIKey{
+		"not a hash":     {{Hash: "secret", Tenant: tenant}},
+		"no tenant":      {{Hash: HashAPIKey("token")}},
+		"duplicate hash": {{Hash: HashAPIKey("token"), Tenant: tenant}, {Hash: HashAPIKey("token"), Tenant: tenant}},
+	}
+
+	for name, keys := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewAPIKeys(keys)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFromOptions(t *testing.T) {
+	authorizer, err := FromOptions(&options.Options{}, zerolog.Nop())
+	require.NoError(t, err)
+	assert.IsType(t, &AuthzClient{}, authorizer)
+
+	authorizer, err = FromOptions(&options.Options{AuthConfig: options.AuthConfig{Mode: ModeDisabled}}, zerolog.Nop())
+	require.NoError(t, err)
+
+	info, err := authorizer.Authorize(nil, "com.suborbital.app", "default", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "com.suborbital.app", info.ID)
+
+	_, err = FromOptions(&options.Options{AuthConfig: options.AuthConfig{Mode: ModeAPIKey}}, zerolog.Nop())
+	assert.Error(t, err)
+
+	_, err = FromOptions(&options.Options{AuthConfig: options.AuthConfig{Mode: "magic"}}, zerolog.Nop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/systemspec/system"
+)
+
+const (
+	ModeRemote   = "remote"
+	ModeAPIKey   = "apikey"
+	ModeJWT      = "jwt"
+	ModeDisabled = "disabled"
+)
+
+// Authorizer decides whether a token grants access to the module or workflow identifier/namespace/name, and returns
+// the tenant that it belongs to. namespace and name are empty for routes that are scoped to a whole tenant. Errors that
+// deny access wrap common.ErrAccess.
+type Authorizer interface {
+	Authorize(token system.Credential, identifier, namespace, name string) (*TenantInfo, error)
+}
+
+// CachingAuthorizer is an Authorizer that caches its decisions.
+type CachingAuthorizer interface {
+	Authorizer
+	Cache() *AuthorizationCache
+}
+
+// FromOptions creates the Authorizer selected by E2CORE_AUTH_MODE.
+func FromOptions(opts *options.Options, log zerolog.Logger) (Authorizer, error) {
+	switch opts.AuthConfig.Mode {
+	case ModeRemote, "":
+		return NewApiAuthClient(opts), nil
+	case ModeAPIKey:
+		keys, err := LoadAPIKeys(opts.AuthConfig.KeysPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "LoadAPIKeys %s", opts.AuthConfig.KeysPath)
+		}
+
+		return keys, nil
+	case ModeJWT:
+		authorizer, err := NewJWTAuthorizer(opts.AuthConfig, opts.AuthCacheTTL, log)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewJWTAuthorizer")
+		}
+
+		return authorizer, nil
+	case ModeDisabled:
+		return DisabledAuthorizer{}, nil
+	}
+
+	return nil, errors.Errorf("unknown auth mode %q", opts.AuthConfig.Mode)
+}
+
+// DisabledAuthorizer lets every request through, with or without a token, as the tenant named in the request.
+type DisabledAuthorizer struct{}
+
+func (DisabledAuthorizer) Authorize(_ system.Credential, identifier, _, _ string) (*TenantInfo, error) {
+	return &TenantInfo{ID: identifier, Name: identifier}, nil
+}
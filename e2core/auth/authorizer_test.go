@@ -12,6 +12,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/suborbital/e2core/e2core/options"
 	"github.com/suborbital/e2core/foundation/common"
 )
 
@@ -96,7 +97,7 @@ func TestAuthorizerCache_ConcurrentRequests(t *testing.T) {
 		authorizer := &AuthzClient{
 			httpClient: svr.Client(),
 			location:   svr.URL + "/environment/v1/tenant/",
-			cache:      newAuthorizationCache(common.StableTime(time.Now()), 10*time.Minute),
+			cache:      newAuthorizationCache(common.StableTime(time.Now()), 10*time.Minute, options.AuthConfig{}),
 		}
 
 		var err error
@@ -267,7 +268,7 @@ func TestAuthorizerCache(t *testing.T) {
 		authorizer := &AuthzClient{
 			httpClient: svr.Client(),
 			location:   svr.URL + "/api/v2/tenant/",
-			cache:      newAuthorizationCache(common.StableTime(time.Now()), 10*time.Minute),
+			cache:      newAuthorizationCache(common.StableTime(time.Now()), 10*time.Minute, options.AuthConfig{}),
 		}
 
 		var err error
@@ -323,7 +324,7 @@ func TestAuthorizerCache_ExpiringEntry(t *testing.T) {
 
 		clock := common.StableTime(time.Now())
 
-		authzCache := newAuthorizationCache(clock, 10*time.Minute)
+		authzCache := newAuthorizationCache(clock, 10*time.Minute, options.AuthConfig{})
 		authzCache.clock = clock
 
 		authorizer := &AuthzClient{
@@ -1,79 +1,305 @@
 package auth
 
 import (
+	"container/list"
+	"sync"
 	"time"
 
+	"github.com/suborbital/e2core/e2core/metrics"
+	"github.com/suborbital/e2core/e2core/options"
 	"github.com/suborbital/e2core/foundation/common"
 )
 
+// defaultCacheSize is how many decisions are kept if the config does not say.
+const defaultCacheSize = 10000
+
 // NewAuthorizationCache creates a new AuthorizationCache
-func NewAuthorizationCache(ttl time.Duration) *AuthorizationCache {
-	return newAuthorizationCache(common.SystemTime(), ttl)
+func NewAuthorizationCache(ttl time.Duration, config options.AuthConfig) *AuthorizationCache {
+	return newAuthorizationCache(common.SystemTime(), ttl, config)
 }
 
 // NewAuthorizationCache creates a new AuthorizationCache
-func newAuthorizationCache(clock common.Clock, ttl time.Duration) *AuthorizationCache {
-	store := common.NewTreeStore[*expiringContext]()
-	cache := common.NewLoadingCache[*expiringContext](store)
+func newAuthorizationCache(clock common.Clock, ttl time.Duration, config options.AuthConfig) *AuthorizationCache {
+	size := config.CacheSize
+	if size <= 0 {
+		size = defaultCacheSize
+	}
 
 	return &AuthorizationCache{
-		clock: clock,
-		ttl:   ttl,
-		cache: cache,
+		clock:        clock,
+		ttl:          ttl,
+		deniedTTL:    config.CacheDeniedTTL,
+		refreshAhead: config.CacheRefreshAhead,
+		size:         size,
+		entries:      map[cacheKey]*cacheEntry{},
+		tenants:      map[string]*TenantCacheStats{},
+		lru:          list.New(),
 	}
 }
 
-// AuthorizationCache caches authorization successful policy decisions for up to 10 minutes.
+// AuthorizationCache caches authorization decisions. Successful ones are kept for ttl, or until the credentials expire
+// if that is sooner, and denials for deniedTTL, or not at all if it is zero. Other failures, such as the authorization
+// service being unreachable, are never kept. Once a successful decision is within refreshAhead of expiring, it is
+// loaded again in the background while the current one keeps being used. At most size decisions are kept, the least
+// recently used being evicted first. Concurrent requests for a decision that is being loaded wait for it.
 type AuthorizationCache struct {
-	clock common.Clock
-	ttl   time.Duration
-	cache *common.LoadingCache[*expiringContext]
+	clock        common.Clock
+	ttl          time.Duration
+	deniedTTL    time.Duration
+	refreshAhead time.Duration
+	size         int
+
+	entries map[cacheKey]*cacheEntry
+	tenants map[string]*TenantCacheStats
+	lru     *list.List
+	stats   CacheStats
+	lock    sync.Mutex
+}
+
+// CacheStats counts the lookups of an AuthorizationCache and the entries that it evicted to stay within its size.
+type CacheStats struct {
+	Entries   int    `json:"entries"`
+	Size      int    `json:"size"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// TenantCacheStats counts the cached decisions of a single tenant and their lookups. The counts start over once none of
+// the tenant's decisions are cached.
+type TenantCacheStats struct {
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+type cacheKey struct {
+	identifier string
+	namespace  string
+	name       string
+	token      string
 }
 
-// Get fetches a cached result if present; otherwise it executes newFunc to obtain the result.
-func (cache AuthorizationCache) Get(key string, newFunc func() (*TenantInfo, error)) (*TenantInfo, error) {
-	// register newFunc if not previously known
-	if !cache.cache.Check(key) {
-		_ = cache.cache.Put(key, cache.loadingFunc(newFunc))
+// cacheEntry holds a decision. done is closed once it has first loaded, and the entry must not be read before then.
+type cacheEntry struct {
+	key        cacheKey
+	elem       *list.Element
+	done       chan struct{}
+	info       *TenantInfo
+	err        error
+	exp        time.Time
+	refreshing bool
+}
+
+// Get fetches a cached result if present; otherwise it executes load to obtain the result.
+func (cache *AuthorizationCache) Get(key cacheKey, load func() (*TenantInfo, error)) (*TenantInfo, error) {
+	cache.lock.Lock()
+
+	if entry, exists := cache.entries[key]; exists {
+		select {
+		case <-entry.done:
+			if cache.clock.Now().Before(entry.exp) {
+				cache.lru.MoveToFront(entry.elem)
+				cache.refreshIfDue(entry, load)
+				cache.hit(key)
+
+				info, err := entry.info, entry.err
+				cache.lock.Unlock()
+
+				return info, err
+			}
+
+			// expired, so load it again below.
+			cache.remove(entry)
+		default:
+			cache.lru.MoveToFront(entry.elem)
+			cache.hit(key)
+			cache.lock.Unlock()
+
+			// wait for the request that is loading it.
+			<-entry.done
+
+			cache.lock.Lock()
+			defer cache.lock.Unlock()
+
+			return entry.info, entry.err
+		}
 	}
 
-	// return promptly if entry is found and valid
-	entry := cache.cache.Get(key)
-	if entry.Value != nil {
-		if entry.Value.exp.After(cache.clock.Now()) {
-			return entry.Value.ctx, entry.Error
+	entry := cache.add(key)
+	cache.miss(key)
+	cache.lock.Unlock()
+
+	info, err := load()
+
+	cache.lock.Lock()
+	cache.complete(entry, info, err)
+	cache.lock.Unlock()
+
+	close(entry.done)
+
+	return info, err
+}
+
+// Purge removes the decisions for the tenant, or only those for the token within the tenant if it is not empty, and
+// returns how many were removed.
+func (cache *AuthorizationCache) Purge(identifier, token string) int {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	purged := 0
+
+	for key, entry := range cache.entries {
+		if key.identifier == identifier && (token == "" || key.token == token) {
+			cache.remove(entry)
+			purged++
 		}
-		// entry found but expired, refresh and await result
-		_ = cache.cache.Refresh(key)
-		entry = cache.cache.Get(key)
 	}
 
-	if entry.Error != nil {
-		// reset entry state so subsequent requests run
-		cache.cache.Replace(key, cache.loadingFunc(newFunc))
-		return nil, entry.Error
+	return purged
+}
+
+// Stats returns the cache's statistics.
+func (cache *AuthorizationCache) Stats() CacheStats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	stats := cache.stats
+	stats.Entries = len(cache.entries)
+	stats.Size = cache.size
+
+	return stats
+}
+
+// TenantStats returns the statistics of the tenant's decisions.
+func (cache *AuthorizationCache) TenantStats(identifier string) TenantCacheStats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if stats, exists := cache.tenants[identifier]; exists {
+		return *stats
 	}
 
-	return entry.Value.ctx, entry.Error
+	return TenantCacheStats{}
 }
 
-// loadingFun wraps a loader func with an expiringContext loader
-func (cache AuthorizationCache) loadingFunc(inner func() (*TenantInfo, error)) func() (*expiringContext, error) {
-	return func() (*expiringContext, error) {
-		ctx, err := inner()
-		if err != nil {
-			return nil, err
+// add creates a pending entry for key, evicting the least recently used entry if the cache is full. The lock must be
+// held.
+func (cache *AuthorizationCache) add(key cacheKey) *cacheEntry {
+	for len(cache.entries) >= cache.size {
+		oldest := cache.lru.Back().Value.(*cacheEntry)
+		cache.remove(oldest)
+
+		cache.stats.Evictions++
+		metrics.AuthCacheEviction()
+	}
+
+	entry := &cacheEntry{key: key, done: make(chan struct{})}
+	entry.elem = cache.lru.PushFront(entry)
+	cache.entries[key] = entry
+
+	tenant, exists := cache.tenants[key.identifier]
+	if !exists {
+		tenant = &TenantCacheStats{}
+		cache.tenants[key.identifier] = tenant
+	}
+
+	tenant.Entries++
+
+	return entry
+}
+
+// remove drops the entry. Requests that are waiting for it still get its result. The lock must be held.
+func (cache *AuthorizationCache) remove(entry *cacheEntry) {
+	if cache.entries[entry.key] != entry {
+		return
+	}
+
+	delete(cache.entries, entry.key)
+	cache.lru.Remove(entry.elem)
+
+	// the tenants are only kept while they have decisions, so that they are bounded by the size of the cache.
+	if tenant := cache.tenants[entry.key.identifier]; tenant != nil {
+		tenant.Entries--
+
+		if tenant.Entries == 0 {
+			delete(cache.tenants, entry.key.identifier)
 		}
+	}
+}
+
+// complete stores the result of loading the entry, and drops the entry if the result is not to be kept. The lock must
+// be held.
+func (cache *AuthorizationCache) complete(entry *cacheEntry, info *TenantInfo, err error) {
+	entry.info, entry.err = info, err
 
-		return &expiringContext{
-			exp: cache.clock.In(cache.ttl),
-			ctx: ctx,
-		}, nil
+	switch {
+	case err == nil:
+		entry.exp = cache.expiry(info)
+	case common.IsError(err, common.ErrAccess) && cache.deniedTTL > 0:
+		entry.exp = cache.clock.In(cache.deniedTTL)
+	default:
+		cache.remove(entry)
 	}
 }
 
-// expiringContext wraps a value with an expiry
-type expiringContext struct {
-	exp time.Time
-	ctx *TenantInfo
+// refreshIfDue loads a successful decision again in the background once it is within refreshAhead of expiring. A
+// refresh that is denied replaces the decision, but one that fails otherwise keeps it until it expires. The lock must
+// be held.
+func (cache *AuthorizationCache) refreshIfDue(entry *cacheEntry, load func() (*TenantInfo, error)) {
+	if cache.refreshAhead <= 0 || entry.err != nil || entry.refreshing || cache.clock.In(cache.refreshAhead).Before(entry.exp) {
+		return
+	}
+
+	entry.refreshing = true
+
+	go func() {
+		info, err := load()
+
+		cache.lock.Lock()
+		defer cache.lock.Unlock()
+
+		entry.refreshing = false
+
+		if cache.entries[entry.key] != entry {
+			return
+		}
+
+		switch {
+		case err == nil:
+			entry.info = info
+			entry.exp = cache.expiry(info)
+		case common.IsError(err, common.ErrAccess):
+			entry.info = nil
+			cache.complete(entry, nil, err)
+		}
+	}()
+}
+
+// expiry returns when a successful decision expires.
+func (cache *AuthorizationCache) expiry(info *TenantInfo) time.Time {
+	exp := cache.clock.In(cache.ttl)
+	if !info.expires.IsZero() && info.expires.Before(exp) {
+		exp = info.expires
+	}
+
+	return exp
+}
+
+func (cache *AuthorizationCache) hit(key cacheKey) {
+	cache.stats.Hits++
+	metrics.AuthCacheHit()
+
+	if tenant := cache.tenants[key.identifier]; tenant != nil {
+		tenant.Hits++
+	}
+}
+
+func (cache *AuthorizationCache) miss(key cacheKey) {
+	cache.stats.Misses++
+	metrics.AuthCacheMiss()
+
+	if tenant := cache.tenants[key.identifier]; tenant != nil {
+		tenant.Misses++
+	}
 }
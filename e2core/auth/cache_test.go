@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+func testCacheKey(identifier, token string) cacheKey {
+	return cacheKey{identifier: identifier, namespace: "default", name: "hello", token: token}
+}
+
+func TestAuthorizationCache_Evicts(t *testing.T) {
+	cache := newAuthorizationCache(common.StableTime(time.Now()), time.Minute, options.AuthConfig{CacheSize: 2})
+
+	loads := 0
+	load := func() (*TenantInfo, error) {
+		loads++
+		return &TenantInfo{ID: "com.suborbital.app"}, nil
+	}
+
+	for _, token := range []string{"a", "b", "a", "c"} {
+		_, err := cache.Get(testCacheKey("com.suborbital.app", token), load)
+		require.NoError(t, err)
+	}
+
+	// b was used least recently, so it made room for c.
+	_, err := cache.Get(testCacheKey("com.suborbital.app", "a"), load)
+	require.NoError(t, err)
+	assert.Equal(t, 3, loads)
+
+	_, err = cache.Get(testCacheKey("com.suborbital.app", "b"), load)
+	require.NoError(t, err)
+	assert.Equal(t, 4, loads)
+
+	stats := cache.Stats()
+	assert.Equal(t, CacheStats{Entries: 2, Size: 2, Hits: 2, Misses: 4, Evictions: 2}, stats)
+	assert.Equal(t, TenantCacheStats{Entries: 2, Hits: 2, Misses: 4}, cache.TenantStats("com.suborbital.app"))
+}
+
+func TestAuthorizationCache_Denied(t *testing.T) {
+	clock := common.StableTime(time.Now())
+	cache := newAuthorizationCache(clock, time.Minute, options.AuthConfig{CacheDeniedTTL: 10 * time.Second})
+
+	loads := 0
+	denied := func() (*TenantInfo, error) {
+		loads++
+		return nil, common.Error(common.ErrAccess, "non-200 response 401 for authorization service")
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := cache.Get(testCacheKey("com.suborbital.app", "denied"), denied)
+		assert.True(t, common.IsError(err, common.ErrAccess))
+	}
+
+	assert.Equal(t, 1, loads)
+
+	clock.Tick(11 * time.Second)
+
+	_, err := cache.Get(testCacheKey("com.suborbital.app", "denied"), denied)
+	assert.True(t, common.IsError(err, common.ErrAccess))
+	assert.Equal(t, 2, loads)
+
+	// failures other than denials mean nothing about the token, so they are not kept.
+	unreachable := func() (*TenantInfo, error) {
+		loads++
+		return nil, errors.New("connection refused")
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = cache.Get(testCacheKey("com.suborbital.app", "unreachable"), unreachable)
+		assert.Error(t, err)
+	}
+
+	assert.Equal(t, 4, loads)
+}
+
+func TestAuthorizationCache_RefreshAhead(t *testing.T) {
+	clock := common.StableTime(time.Now())
+	cache := newAuthorizationCache(clock, time.Minute, options.AuthConfig{CacheRefreshAhead: 10 * time.Second})
+
+	var loads atomic.Int32
+	revoked := atomic.Bool{}
+
+	load := func() (*TenantInfo, error) {
+		loads.Add(1)
+
+		if revoked.Load() {
+			return nil, common.Error(common.ErrAccess, "revoked")
+		}
+
+		return &TenantInfo{ID: "com.suborbital.app", Name: "v" + string(rune('0'+loads.Load()))}, nil
+	}
+
+	key := testCacheKey("com.suborbital.app", "token")
+
+	info, err := cache.Get(key, load)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", info.Name)
+
+	clock.Tick(55 * time.Second)
+
+	// the current decision is used while it is loaded again.
+	info, err = cache.Get(key, load)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", info.Name)
+
+	require.Eventually(t, func() bool {
+		info, err := cache.Get(key, load)
+		return err == nil && info.Name == "v2"
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, int32(2), loads.Load())
+
+	// a refresh that is denied replaces the decision.
+	revoked.Store(true)
+	clock.Tick(55 * time.Second)
+
+	_, err = cache.Get(key, load)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := cache.Get(key, load)
+		return common.IsError(err, common.ErrAccess)
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestAuthorizationCache_Purge(t *testing.T) {
+	cache := newAuthorizationCache(common.StableTime(time.Now()), time.Minute, options.AuthConfig{})
+
+	load := func() (*TenantInfo, error) { return &TenantInfo{ID: "com.suborbital.app"}, nil }
+
+	for _, key := range []cacheKey{
+		testCacheKey("com.suborbital.app", "a"),
+		testCacheKey("com.suborbital.app", "b"),
+		{identifier: "com.suborbital.app", namespace: "other", name: "bye", token: "a"},
+		testCacheKey("com.suborbital.other", "a"),
+	} {
+		_, err := cache.Get(key, load)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 2, cache.Purge("com.suborbital.app", "a"))
+	assert.Equal(t, 2, cache.Stats().Entries)
+
+	assert.Equal(t, 1, cache.Purge("com.suborbital.app", ""))
+	assert.Equal(t, 0, cache.Purge("com.suborbital.app", ""))
+	assert.Equal(t, 1, cache.Stats().Entries)
+
+	assert.Equal(t, TenantCacheStats{}, cache.TenantStats("com.suborbital.app"))
+	assert.Equal(t, TenantCacheStats{Entries: 1, Misses: 1}, cache.TenantStats("com.suborbital.other"))
+}
@@ -0,0 +1,316 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// jwksReloadInterval is how often the key set may be loaded again on demand, when a token is signed with a key that is
+// not in it.
+const jwksReloadInterval = 30 * time.Second
+
+// jwks holds the public keys of a JSON Web Key Set that is loaded from a file or a URL, and refreshed in the
+// background. Keys that cannot be used to verify signatures are skipped.
+type jwks struct {
+	source string
+	client *http.Client
+	log    zerolog.Logger
+
+	keys map[string]crypto.PublicKey
+	lock sync.RWMutex
+
+	// reloadLock guards lastReload, which limits how often tokens with unknown key IDs can make the set load again.
+	reloadLock     sync.Mutex
+	lastReload     time.Time
+	reloadInterval time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// jsonWebKey holds the members of a JWK (RFC 7517) for the RSA, EC and OKP key types.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// newJWKS loads the key set from source, and then reloads it every refresh interval until stopped. A reload that
+// fails keeps the keys that were loaded last.
+func newJWKS(source string, refresh time.Duration, log zerolog.Logger) (*jwks, error) {
+	j := &jwks{
+		source: source,
+		client: &http.Client{Timeout: 10 * time.Second},
+		log:    log.With().Str("module", "jwks").Str("source", source).Logger(),
+		stop:   make(chan struct{}),
+
+		reloadInterval: jwksReloadInterval,
+	}
+
+	if err := j.load(); err != nil {
+		return nil, errors.Wrap(err, "j.load")
+	}
+
+	j.lastReload = time.Now()
+
+	if refresh > 0 {
+		go j.refresh(refresh)
+	}
+
+	return j, nil
+}
+
+// key returns the key with the given ID. Tokens without an ID can only be verified if the set has a single key. An ID
+// that is not in the set makes it load again, since the key may have been rotated in since the last refresh, but not
+// more often than the reload interval.
+func (j *jwks) key(kid string) (crypto.PublicKey, error) {
+	if key, exists := j.lookup(kid); exists {
+		return key, nil
+	}
+
+	j.reload()
+
+	if key, exists := j.lookup(kid); exists {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("no key with id %q", kid)
+}
+
+func (j *jwks) lookup(kid string) (crypto.PublicKey, bool) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+
+	key, exists := j.keys[kid]
+
+	return key, exists
+}
+
+// reload loads the key set again unless it was last reloaded within the reload interval.
+func (j *jwks) reload() {
+	j.reloadLock.Lock()
+	defer j.reloadLock.Unlock()
+
+	if time.Since(j.lastReload) < j.reloadInterval {
+		return
+	}
+
+	j.lastReload = time.Now()
+
+	if err := j.load(); err != nil {
+		j.log.Err(err).Msg("failed to reload key set for an unknown key, keeping the current keys")
+	}
+}
+
+func (j *jwks) shutdown() {
+	j.stopOnce.Do(func() { close(j.stop) })
+}
+
+func (j *jwks) refresh(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			if err := j.load(); err != nil {
+				j.log.Err(err).Msg("failed to refresh key set, keeping the current keys")
+			}
+		}
+	}
+}
+
+func (j *jwks) load() error {
+	data, err := j.read()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data, j.log)
+	if err != nil {
+		return errors.Wrap(err, "parseJWKS")
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.keys = keys
+
+	return nil
+}
+
+func (j *jwks) read() ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		data, err := os.ReadFile(j.source)
+		if err != nil {
+			return nil, errors.Wrap(err, "os.ReadFile")
+		}
+
+		return data, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequestWithContext")
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Do")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 response %d for key set", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "io.ReadAll")
+	}
+
+	return data, nil
+}
+
+// parseJWKS returns the signature verification keys of a key set by their IDs. Keys that cannot be parsed are logged
+// and left out, so that one bad key does not take down the rest of the set.
+func parseJWKS(data []byte, log zerolog.Logger) (map[string]crypto.PublicKey, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	keys := map[string]crypto.PublicKey{}
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Err(err).Str("kid", jwk.Kid).Msg("skipping invalid key")
+			continue
+		}
+
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("key set has no signature verification keys")
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the key, or nil if it is of a type or curve that is not supported.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "n")
+		}
+
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "e")
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent is too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+		if curve == nil {
+			return nil, nil
+		}
+
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "x")
+		}
+
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "y")
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "x")
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("key has the wrong size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, nil
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "base64.RawURLEncoding.DecodeString")
+	}
+
+	if len(data) == 0 {
+		return nil, errors.New("value is empty")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
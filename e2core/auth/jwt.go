@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/system"
+)
+
+// jwtMethods are the signing algorithms that tokens are accepted with.
+var jwtMethods = []string{"RS256", "ES256", "EdDSA"}
+
+// JWTAuthorizer verifies JWTs locally against a JSON Web Key Set, and maps their claims to the tenant they belong to.
+// Tokens must have an exp claim, are rejected before their nbf claim, and must be meant for the configured audience
+// and issuer when they are set. A token grants access to the tenant whose ID is in its tenant claim, limited to the
+// scopes in its scope claim if it has one.
+type JWTAuthorizer struct {
+	config options.AuthConfig
+	keys   *jwks
+	parser *jwt.Parser
+	cache  *AuthorizationCache
+}
+
+// NewJWTAuthorizer creates a JWTAuthorizer that loads its key set from the file or URL in config.JWKS.
+func NewJWTAuthorizer(config options.AuthConfig, cacheTTL time.Duration, log zerolog.Logger) (*JWTAuthorizer, error) {
+	if config.JWKS == "" {
+		return nil, common.InvalidArgument("the jwt auth mode requires a key set")
+	}
+
+	keys, err := newJWKS(config.JWKS, config.JWKSRefresh, log)
+	if err != nil {
+		return nil, errors.Wrap(err, "newJWKS")
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(config.JWTLeeway),
+	}
+
+	if config.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(config.Audience))
+	}
+
+	if config.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(config.Issuer))
+	}
+
+	return &JWTAuthorizer{
+		config: config,
+		keys:   keys,
+		parser: jwt.NewParser(parserOpts...),
+		cache:  NewAuthorizationCache(cacheTTL, config),
+	}, nil
+}
+
+// Authorize verifies the token and returns its tenant if it is identifier. Results are cached, but not for longer than
+// the token is valid for.
+func (a *JWTAuthorizer) Authorize(token system.Credential, identifier, namespace, name string) (*TenantInfo, error) {
+	if token == nil {
+		return nil, common.Error(common.ErrAccess, "no credentials provided")
+	}
+
+	key := cacheKey{identifier: identifier, namespace: namespace, name: name, token: token.Value()}
+
+	return a.cache.Get(key, func() (*TenantInfo, error) {
+		return a.verify(token.Value(), identifier)
+	})
+}
+
+// Cache returns the cache of the authorizer's decisions.
+func (a *JWTAuthorizer) Cache() *AuthorizationCache {
+	return a.cache
+}
+
+// Shutdown stops refreshing the key set.
+func (a *JWTAuthorizer) Shutdown() {
+	a.keys.shutdown()
+}
+
+func (a *JWTAuthorizer) verify(raw, identifier string) (*TenantInfo, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := a.parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.keys.key(kid)
+	})
+	if err != nil {
+		return nil, common.Error(common.ErrAccess, "invalid token: %s", err.Error())
+	}
+
+	info := &TenantInfo{
+		ID:              stringClaim(claims, a.config.TenantClaim),
+		Name:            stringClaim(claims, a.config.TenantNameClaim),
+		Environment:     stringClaim(claims, a.config.EnvironmentClaim),
+		AuthorizedParty: stringClaim(claims, "azp"),
+	}
+
+	if a.config.ScopeClaim != "" {
+		info.Scopes = scopesClaim(claims[a.config.ScopeClaim])
+	}
+
+	if info.ID == "" {
+		return nil, common.Error(common.ErrAccess, "token has no %s claim", a.config.TenantClaim)
+	}
+
+	if info.ID != identifier {
+		return nil, common.Error(common.ErrAccess, "token does not grant access to %s", identifier)
+	}
+
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		info.expires = exp.Time
+	}
+
+	return info, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	if name == "" {
+		return ""
+	}
+
+	value, _ := claims[name].(string)
+
+	return value
+}
+
+// scopesClaim reads scopes from a claim that is either a space separated string, as in RFC 8693, or an array of
+// strings.
+func scopesClaim(value any) Scopes {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		scopes := Scopes{}
+
+		for _, item := range v {
+			if scope, ok := item.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		return scopes
+	}
+
+	return nil
+}
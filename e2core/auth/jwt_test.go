@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+type testSigner struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.Signer
+}
+
+func (s testSigner) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(s.method, claims)
+	token.Header["kid"] = s.kid
+
+	signed, err := token.SignedString(s.key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func testSigners(t *testing.T) ([]testSigner, []byte) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": encode(edKey.Public().(ed25519.PublicKey))},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": encode(rsaKey.N.Bytes()), "e": "AQAB"},
+	}}
+
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	return []testSigner{
+		{kid: "rsa", method: jwt.SigningMethodRS256, key: rsaKey},
+		{kid: "ec", method: jwt.SigningMethodES256, key: ecKey},
+		{kid: "ed", method: jwt.SigningMethodEdDSA, key: edKey},
+	}, data
+}
+
+func testJWTConfig(jwks string) options.AuthConfig {
+	return options.AuthConfig{
+		Mode:             ModeJWT,
+		JWKS:             jwks,
+		Audience:         "e2core",
+		Issuer:           "https://auth.suborbital.test",
+		TenantClaim:      "tenant",
+		TenantNameClaim:  "tenant_name",
+		EnvironmentClaim: "environment",
+		ScopeClaim:       "e2core_scope",
+	}
+}
+
+func TestJWTAuthorizer(t *testing.T) {
+	signers, set := testSigners(t)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, set, 0600))
+
+	authorizer, err := NewJWTAuthorizer(testJWTConfig(path), time.Minute, zerolog.Nop())
+	require.NoError(t, err)
+
+	defer authorizer.Shutdown()
+
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":         "https://auth.suborbital.test",
+			"aud":         "e2core",
+			"exp":         time.Now().Add(time.Hour).Unix(),
+			"tenant":      "com.suborbital.app",
+			"tenant_name": "app",
+			"environment": "com.suborbital",
+			"azp":         "dashboard",
+		}
+
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+
+		return c
+	}
+
+	for _, signer := range signers {
+		t.Run(signer.kid, func(t *testing.T) {
+			info, err := authorizer.Authorize(NewAccessToken(signer.sign(t, claims(nil))), "com.suborbital.app", "default", "hello")
+			require.NoError(t, err)
+
+			assert.Equal(t, "com.suborbital.app", info.ID)
+			assert.Equal(t, "app", info.Name)
+			assert.Equal(t, "com.suborbital", info.Environment)
+			assert.Equal(t, "dashboard", info.AuthorizedParty)
+			assert.Empty(t, info.Scopes)
+		})
+	}
+
+	scoped := map[string]any{
+		"string": "execute:default/hello workflow",
+		"array":  []string{"execute:default/hello", "workflow"},
+	}
+
+	for name, scope := range scoped {
+		t.Run("scopes as "+name, func(t *testing.T) {
+			token := signers[0].sign(t, claims(jwt.MapClaims{"e2core_scope": scope}))
+
+			info, err := authorizer.Authorize(NewAccessToken(token), "com.suborbital.app", "default", "hello")
+			require.NoError(t, err)
+			assert.Equal(t, Scopes{"execute:default/hello", "workflow"}, info.Scopes)
+		})
+	}
+
+	t.Run("oidc scopes are not e2core scopes", func(t *testing.T) {
+		token := signers[0].sign(t, claims(jwt.MapClaims{"scope": "openid profile"}))
+
+		info, err := authorizer.Authorize(NewAccessToken(token), "com.suborbital.app", "default", "hello")
+		require.NoError(t, err)
+		assert.Empty(t, info.Scopes)
+	})
+
+	rejected := map[string]string{
+		"expired":        signers[0].sign(t, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no expiry":      signers[0].sign(t, claims(jwt.MapClaims{"exp": nil})),
+		"not yet valid":  signers[0].sign(t, claims(jwt.MapClaims{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"wrong audience": signers[1].sign(t, claims(jwt.MapClaims{"aud": "someone-else"})),
+		"wrong issuer":   signers[1].sign(t, claims(jwt.MapClaims{"iss": "https://evil.test"})),
+		"other tenant":   signers[2].sign(t, claims(jwt.MapClaims{"tenant": "com.suborbital.other"})),
+		"no tenant":      signers[2].sign(t, claims(jwt.MapClaims{"tenant": nil})),
+		"unknown key":    testSigner{kid: "unknown", method: signers[2].method, key: signers[2].key}.sign(t, claims(nil)),
+		"not a token":    "not-a-token",
+	}
+
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("secret"))
+	require.NoError(t, err)
+
+	rejected["symmetric"] = hs256
+
+	for name, token := range rejected {
+		t.Run(name, func(t *testing.T) {
+			_, err := authorizer.Authorize(NewAccessToken(token), "com.suborbital.app", "default", "hello")
+			assert.True(t, common.IsError(err, common.ErrAccess), err)
+		})
+	}
+
+	_, err = authorizer.Authorize(nil, "com.suborbital.app", "default", "hello")
+	assert.True(t, common.IsError(err, common.ErrAccess))
+}
+
+func TestJWTAuthorizer_URL(t *testing.T) {
+	signers, set := testSigners(t)
+
+	var requests int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/jwks.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		requests++
+		_, _ = w.Write(set)
+	}))
+	defer srv.Close()
+
+	authorizer, err := NewJWTAuthorizer(testJWTConfig(srv.URL+"/jwks.json"), time.Minute, zerolog.Nop())
+	require.NoError(t, err)
+
+	defer authorizer.Shutdown()
+
+	token := signers[0].sign(t, jwt.MapClaims{
+		"iss":    "https://auth.suborbital.test",
+		"aud":    "e2core",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"tenant": "com.suborbital.app",
+	})
+
+	_, err = authorizer.Authorize(NewAccessToken(token), "com.suborbital.app", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	_, err = NewJWTAuthorizer(testJWTConfig(srv.URL+"/missing"), time.Minute, zerolog.Nop())
+	assert.Error(t, err)
+}
+
+func TestJWKS_ReloadsForUnknownKey(t *testing.T) {
+	_, set := testSigners(t)
+
+	full := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	require.NoError(t, json.Unmarshal(set, &full))
+
+	// the set starts out with only the ed25519 key, and the rsa key is rotated in later.
+	initial, err := json.Marshal(map[string]any{"keys": full.Keys[2:3]})
+	require.NoError(t, err)
+
+	var current atomic.Value
+	current.Store(initial)
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(current.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	keys, err := newJWKS(srv.URL, 0, zerolog.Nop())
+	require.NoError(t, err)
+
+	defer keys.shutdown()
+
+	// the set was loaded moments ago, so an unknown key does not load it again.
+	_, err = keys.key("rsa")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	current.Store(set)
+	keys.lastReload = time.Now().Add(-time.Minute)
+
+	_, err = keys.key("rsa")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	// reloading for unknown keys is rate limited.
+	_, err = keys.key("missing")
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not json":        `keys`,
+		"no keys":         `{"keys": []}`,
+		"only encryption": `{"keys": [{"kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`,
+		"off the curve":   `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`,
+		"short ed25519":   `{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "AQAB"}]}`,
+	}
+
+	for name, set := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseJWKS([]byte(set), zerolog.Nop())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseJWKS_SkipsInvalidKeys(t *testing.T) {
+	_, data := testSigners(t)
+
+	set := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	require.NoError(t, json.Unmarshal(data, &set))
+
+	set.Keys = append(set.Keys, map[string]string{"kty": "EC", "kid": "off-curve", "crv": "P-256", "x": "AQAB", "y": "AQAB"})
+
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	keys, err := parseJWKS(data, zerolog.Nop())
+	require.NoError(t, err)
+
+	assert.Len(t, keys, 3)
+	assert.NotContains(t, keys, "off-curve")
+}
+
+func TestAuthorizationCache_TokenExpiry(t *testing.T) {
+	clock := common.StableTime(time.Now())
+	cache := newAuthorizationCache(clock, 10*time.Minute, options.AuthConfig{})
+
+	loads := 0
+	load := func() (*TenantInfo, error) {
+		loads++
+		return &TenantInfo{ID: "com.suborbital.app", expires: clock.In(time.Minute)}, nil
+	}
+
+	_, err := cache.Get(cacheKey{identifier: "com.suborbital.app", token: "token"}, load)
+	require.NoError(t, err)
+
+	clock.Tick(2 * time.Minute)
+
+	_, err = cache.Get(cacheKey{identifier: "com.suborbital.app", token: "token"}, load)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loads, "entries expire with the token they were loaded for")
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+const (
+	// OpExecute runs a single module.
+	OpExecute = "execute"
+	// OpWorkflow runs a workflow.
+	OpWorkflow = "workflow"
+	// OpAdmin manages a tenant: its modules, schedules and audit log.
+	OpAdmin = "admin"
+)
+
+// Scopes limit what a credential can do within its tenant. Each scope has the form operation[:namespace[/name]], where
+// operation is one of execute, workflow, admin, or * for all of them, and namespace and name are glob patterns as
+// understood by path.Match. A part that is left out matches anything, so "execute:billing" allows executing every
+// module in the billing namespace, and "execute:*/resize-*" every module whose name starts with resize- in any
+// namespace. An empty list of scopes does not limit the credential.
+type Scopes []string
+
+// ScopeSource returns scopes that apply to a tenant on top of the scopes its credentials carry, or nil if there are
+// none. It is used to limit credentials with a local policy.
+type ScopeSource func(tenant *TenantInfo) Scopes
+
+// MissingScopeError denies a request that none of a credential's scopes allow. It wraps common.ErrAccess.
+type MissingScopeError struct {
+	// Scope is the scope that would have allowed the request.
+	Scope string
+}
+
+func (e MissingScopeError) Error() string {
+	return fmt.Sprintf("missing scope %s", e.Scope)
+}
+
+func (e MissingScopeError) Unwrap() error {
+	return common.ErrAccess
+}
+
+// ValidateScope checks that a scope is well formed.
+func ValidateScope(scope string) error {
+	op, namespace, name := splitScope(scope)
+
+	switch op {
+	case OpExecute, OpWorkflow, OpAdmin, "*":
+	default:
+		return common.InvalidArgument("scope %q has unknown operation %q", scope, op)
+	}
+
+	for _, pattern := range []string{namespace, name} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return common.InvalidArgument("scope %q has a malformed pattern %q", scope, pattern)
+		}
+	}
+
+	return nil
+}
+
+// Allows returns true if the scopes are empty, or any of them allows the operation on namespace/name. Tenant-wide
+// operations pass an empty namespace and name, and are only allowed by scopes that do not name a namespace.
+func (s Scopes) Allows(operation, namespace, name string) bool {
+	if len(s) == 0 {
+		return true
+	}
+
+	for _, scope := range s {
+		op, nsPattern, namePattern := splitScope(scope)
+
+		if op != "*" && op != operation {
+			continue
+		}
+
+		if matchScope(nsPattern, namespace) && matchScope(namePattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckScopes returns a MissingScopeError unless both the tenant's scopes and the local ones allow any of the
+// operations on namespace/name. The error names the scope for the first operation.
+func CheckScopes(tenant *TenantInfo, local Scopes, operations []string, namespace, name string) error {
+	if len(operations) == 0 {
+		return nil
+	}
+
+	for _, op := range operations {
+		if tenant.Scopes.Allows(op, namespace, name) && local.Allows(op, namespace, name) {
+			return nil
+		}
+	}
+
+	return MissingScopeError{Scope: RequiredScope(operations[0], namespace, name)}
+}
+
+// RequiredScope returns the narrowest scope that allows the operation on namespace/name.
+func RequiredScope(operation, namespace, name string) string {
+	switch {
+	case namespace == "":
+		return operation
+	case name == "":
+		return operation + ":" + namespace
+	}
+
+	return operation + ":" + namespace + "/" + name
+}
+
+// splitScope returns the parts of a scope, with the parts that are left out as empty strings.
+func splitScope(scope string) (string, string, string) {
+	op, rest, _ := strings.Cut(scope, ":")
+	namespace, name, _ := strings.Cut(rest, "/")
+
+	return op, namespace, name
+}
+
+// matchScope returns true if the pattern is empty, or matches the value. An empty value, which is given for a
+// tenant-wide operation, is only matched by an empty pattern or "*".
+func matchScope(pattern, value string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+
+	if value == "" {
+		return false
+	}
+
+	matched, err := path.Match(pattern, value)
+
+	return err == nil && matched
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+func TestScopes_Allows(t *testing.T) {
+	tests := []struct {
+		name      string
+		scopes    Scopes
+		operation string
+		namespace string
+		module    string
+		want      bool
+	}{
+		{"no scopes", nil, OpAdmin, "", "", true},
+		{"exact", Scopes{"execute:default/hello"}, OpExecute, "default", "hello", true},
+		{"other module", Scopes{"execute:default/hello"}, OpExecute, "default", "bye", false},
+		{"other operation", Scopes{"execute:default/hello"}, OpWorkflow, "default", "hello", false},
+		{"namespace", Scopes{"execute:billing"}, OpExecute, "billing", "invoice", true},
+		{"other namespace", Scopes{"execute:billing"}, OpExecute, "default", "invoice", false},
+		{"glob", Scopes{"execute:*/resize-*"}, OpExecute, "images", "resize-png", true},
+		{"glob mismatch", Scopes{"execute:*/resize-*"}, OpExecute, "images", "crop", false},
+		{"any operation", Scopes{"*:default"}, OpWorkflow, "default", "signup", true},
+		{"operation only", Scopes{"workflow"}, OpWorkflow, "shop", "checkout", true},
+		{"tenant wide", Scopes{"admin"}, OpAdmin, "", "", true},
+		{"tenant wide with namespace", Scopes{"admin:default"}, OpAdmin, "", "", false},
+		{"any of several", Scopes{"admin", "execute:default/hello"}, OpExecute, "default", "hello", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.scopes.Allows(tc.operation, tc.namespace, tc.module))
+		})
+	}
+}
+
+func TestValidateScope(t *testing.T) {
+	for _, scope := range []string{"execute", "workflow:default", "admin:*/*", "*:billing/invoice-*"} {
+		assert.NoError(t, ValidateScope(scope), scope)
+	}
+
+	for _, scope := range []string{"", "run:default", "execute:[default"} {
+		assert.Error(t, ValidateScope(scope), scope)
+	}
+}
+
+func TestCheckScopes(t *testing.T) {
+	tenant := &TenantInfo{ID: "com.suborbital.app", Scopes: Scopes{"execute:default"}}
+
+	assert.NoError(t, CheckScopes(tenant, nil, nil, "other", "hello"), "no operation needs no scope")
+	assert.NoError(t, CheckScopes(tenant, nil, []string{OpExecute}, "default", "hello"))
+	assert.NoError(t, CheckScopes(tenant, nil, []string{OpWorkflow, OpExecute}, "default", "hello"))
+
+	err := CheckScopes(tenant, Scopes{"execute:*/bye"}, []string{OpExecute}, "default", "hello")
+	assert.True(t, common.IsError(err, common.ErrAccess))
+	assert.EqualError(t, err, "missing scope execute:default/hello")
+
+	err = CheckScopes(tenant, nil, []string{OpAdmin}, "", "")
+	assert.EqualError(t, err, "missing scope admin")
+}
+
+func TestAuthorizationMiddleware_Scopes(t *testing.T) {
+	keys, err := NewAPIKeys([]APIKey{
+		{Hash: HashAPIKey("partner"), Tenant: TenantInfo{ID: "com.suborbital.app", AuthorizedParty: "partner", Scopes: Scopes{"execute:default/licensed-*"}}},
+	})
+	require.NoError(t, err)
+
+	local := func(tenant *TenantInfo) Scopes {
+		return Scopes{"execute:default/licensed-a"}
+	}
+
+	serve := func(name string, operation string) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.POST("/name/:ident/:namespace/:name", func(c echo.Context) error {
+			return c.String(http.StatusOK, c.Get("ident").(string))
+		}, AuthorizationMiddleware(keys, local, operation))
+
+		req := httptest.NewRequest(http.MethodPost, "/name/com.suborbital.app/default/"+name, nil)
+		req.Header.Set("Authorization", "Bearer partner")
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	rec := serve("licensed-a", OpExecute)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "com.suborbital.app", rec.Body.String())
+
+	rec = serve("licensed-b", OpExecute)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "allowed by the key but not by the local scopes")
+	assert.Contains(t, rec.Body.String(), "missing scope execute:default/licensed-b")
+
+	rec = serve("unlicensed", OpExecute)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve("licensed-a", OpWorkflow)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "missing scope workflow:default/licensed-a")
+}
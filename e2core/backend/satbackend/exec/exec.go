@@ -6,11 +6,16 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
+// stopGracePeriod is how long a process gets to exit after being asked to stop before it is killed.
+const stopGracePeriod = 10 * time.Second
+
 type WaitFunc func() error
 
 // Run runs a command, outputting to terminal and returning the full output and/or error
@@ -31,8 +36,15 @@ func Run(cmd []string, env ...string) (string, context.CancelCauseFunc, WaitFunc
 	command.Stdout = os.Stdout
 	command.Stderr = os.Stderr
 
+	// ask the process to stop rather than killing it outright, so that it can finish what it is doing.
+	command.Cancel = func() error {
+		return command.Process.Signal(syscall.SIGTERM)
+	}
+	command.WaitDelay = stopGracePeriod
+
 	err := command.Start()
 	if err != nil {
+		cxl(err)
 		return "", nil, nil, errors.Wrap(err, "command.Start()")
 	}
 
@@ -1,8 +1,10 @@
 package satbackend
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"syscall"
@@ -12,29 +14,50 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/suborbital/e2core/e2core/backend/satbackend/exec"
+	"github.com/suborbital/e2core/e2core/mesh"
+	"github.com/suborbital/e2core/e2core/metrics"
 	"github.com/suborbital/e2core/e2core/options"
 	"github.com/suborbital/e2core/e2core/syncer"
+	"github.com/suborbital/systemspec/fqmn"
 )
 
 type Orchestrator struct {
 	syncer           *syncer.Syncer
 	logger           zerolog.Logger
 	opts             *options.Options
+	authority        *mesh.Authority
+	tokenDir         string              // holds the join tokens of the sats, if they are issued any
 	sats             map[string]*watcher // map of FQMNs to watchers
 	failedPortCounts map[string]int
 	signalChan       chan os.Signal
 	wg               sync.WaitGroup
+
+	// procs tracks running sat processes so that shutdown can wait for them to exit.
+	procs sync.WaitGroup
 }
 
-func New(logger zerolog.Logger, opts *options.Options, syncer *syncer.Syncer) (*Orchestrator, error) {
+// New creates an Orchestrator. Each sat that it launches is granted membership of the bus mesh by authority, unless it
+// is nil, and its join token is kept renewed in a file for as long as the sat runs.
+func New(logger zerolog.Logger, opts *options.Options, syncer *syncer.Syncer, authority *mesh.Authority) (*Orchestrator, error) {
 	o := &Orchestrator{
 		syncer:           syncer,
 		logger:           logger.With().Str("module", "orchestrator").Logger(),
 		opts:             opts,
+		authority:        authority,
 		sats:             map[string]*watcher{},
 		failedPortCounts: map[string]int{},
 		signalChan:       make(chan os.Signal),
 		wg:               sync.WaitGroup{},
+		procs:            sync.WaitGroup{},
+	}
+
+	if authority != nil {
+		dir, err := os.MkdirTemp("", "e2core-mesh-")
+		if err != nil {
+			return nil, errors.Wrap(err, "os.MkdirTemp")
+		}
+
+		o.tokenDir = dir
 	}
 
 	return o, nil
@@ -73,23 +96,48 @@ loop:
 		s.terminate()
 	}
 
+	if o.tokenDir != "" {
+		if err := os.RemoveAll(o.tokenDir); err != nil {
+			ll.Err(err).Msg("failed to remove the join tokens of the sats")
+		}
+	}
+
 	o.wg.Done()
 
 	return err
 }
 
-// Shutdown signals to the orchestrator that shutdown is needed
-// mostly only required for testing purposes as the OS handles it normally
-func (o *Orchestrator) Shutdown() {
+// Shutdown stops the orchestrator, asks every sat to stop, and waits for them to exit or for ctx to be done.
+func (o *Orchestrator) Shutdown(ctx context.Context) error {
 	ll := o.logger.With().Str("method", "Shutdown").Logger()
 
 	ll.Debug().Msg("sending sigterm")
-	o.signalChan <- syscall.SIGTERM
+
+	select {
+	case o.signalChan <- syscall.SIGTERM:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "orchestrator did not stop")
+	}
 
 	ll.Debug().Msg("waiting")
-	o.wg.Wait()
+
+	done := make(chan struct{})
+
+	go func() {
+		o.wg.Wait()
+		o.procs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "sats did not exit")
+	}
 
 	ll.Debug().Msg("shutdown completed")
+
+	return nil
 }
 
 func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
@@ -102,11 +150,17 @@ func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
 		ll.Error().Msg("tenants is nil")
 	}
 
+	// current tracks the modules that are part of a tenant so that sats for modules that were deleted or replaced by
+	// a new ref can be stopped. That is only safe if every tenant could be looked at.
+	current := map[string]struct{}{}
+	complete := tenants != nil
+
 	// mount each handler into the handler group.
 	for ident := range tenants {
 		tnt := syncer.TenantOverview(ident)
 		if tnt == nil {
 			ll.Error().Str("ident", ident).Msg("syncer.TenantOverview is nil")
+			complete = false
 			continue
 		}
 
@@ -120,6 +174,8 @@ func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
 
 			ll.Debug().Str("moduleFQMN", module.FQMN).Msg("reconciling")
 
+			current[module.FQMN] = struct{}{}
+
 			if _, exists := o.sats[module.FQMN]; !exists {
 				o.sats[module.FQMN] = newWatcher(module.FQMN, o.logger)
 			}
@@ -133,6 +189,10 @@ func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
 			satWatcher.deadList = make(map[string]struct{})
 			satWatcher.deadListLock.Unlock()
 
+			if o.authority != nil {
+				satWatcher.renewGrants(o.authority)
+			}
+
 			launch := func() {
 				cmd, port := modStartCommand(module)
 
@@ -143,19 +203,43 @@ func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
 					connectionsEnv = string(defaultConnectionsJSON)
 				}
 
+				env := []string{
+					"SAT_HTTP_PORT=" + port,
+					"SAT_CONTROL_PLANE=" + o.opts.ControlPlane,
+					"SAT_CONNECTIONS=" + connectionsEnv,
+				}
+
+				var grant *mesh.Grant
+
+				if o.authority != nil {
+					// sats belong to the tenant named in their module's FQMN.
+					FQMN, err := fqmn.Parse(module.FQMN)
+					if err != nil {
+						ll.Err(err).Str("moduleFQMN", module.FQMN).Msg("failed to parse FQMN of sat instance")
+						return
+					}
+
+					grant, err = o.authority.Grant(FQMN.Tenant, module.FQMN, filepath.Join(o.tokenDir, port+".jwt"))
+					if err != nil {
+						ll.Err(err).Str("moduleFQMN", module.FQMN).Msg("failed to grant mesh membership to sat instance")
+						return
+					}
+
+					env = append(env, o.authority.Env(grant)...)
+				}
+
 				// repeat forever in case the command does error out
-				processUUID, cxl, wait, err := exec.Run(
-					cmd,
-					"SAT_HTTP_PORT="+port,
-					"SAT_CONTROL_PLANE="+o.opts.ControlPlane,
-					"SAT_CONNECTIONS="+connectionsEnv,
-				)
+				processUUID, cxl, wait, err := exec.Run(cmd, env...)
 				if err != nil {
 					ll.Err(err).Str("moduleFQMN", module.FQMN).Msg("exec.Run failed for sat instance")
 					return
 				}
 
+				o.procs.Add(1)
+
 				go func() {
+					defer o.procs.Done()
+
 					err := wait()
 					if err != nil {
 						ll.Err(err).Str("moduleFQMN", module.FQMN).Str("port", port).Msg("calling waitfunc for the module failed")
@@ -169,7 +253,7 @@ func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
 					ll.Info().Str("moduleFQMN", module.FQMN).Str("port", port).Msg("added port to dead list")
 				}()
 
-				satWatcher.add(module.FQMN, port, processUUID, cxl)
+				satWatcher.add(module.FQMN, port, processUUID, cxl, grant)
 
 				ll.Debug().Str("moduleFQMN", module.FQMN).Str("port", port).Msg("successfully started sat")
 			}
@@ -182,6 +266,12 @@ func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
 
 			report := satWatcher.report()
 
+			metrics.SatInstances(module.FQMN, len(satWatcher.instances))
+
+			if report != nil && o.opts.MetricsConfig.AggregateSats {
+				metrics.SatScheduler(module.FQMN, report.totalThreads, report.totalJobs)
+			}
+
 			if report == nil || report.instCount == 0 {
 				// if no instances exist, launch one
 				ll.Debug().Str("moduleFQMN", module.FQMN).Msg("no instance exists")
@@ -234,4 +324,21 @@ func (o *Orchestrator) reconcileConstellation(syncer *syncer.Syncer) {
 			}
 		}
 	}
+
+	if !complete {
+		return
+	}
+
+	for FQMN, satWatcher := range o.sats {
+		if _, exists := current[FQMN]; exists {
+			continue
+		}
+
+		ll.Info().Str("moduleFQMN", FQMN).Msg("module is no longer part of any tenant, terminating its instances")
+
+		satWatcher.terminate()
+		delete(o.sats, FQMN)
+
+		metrics.RemoveSat(FQMN)
+	}
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/suborbital/e2core/e2core/mesh"
 	"github.com/suborbital/e2core/foundation/scheduler"
 )
 
@@ -42,11 +43,13 @@ type instance struct {
 	metrics *MetricsResponse
 	uuid    string
 	cxl     context.CancelCauseFunc
+	grant   *mesh.Grant // the instance's membership of the bus mesh, if it was granted one
 }
 
 type watcherReport struct {
 	instCount    int
 	totalThreads int
+	totalJobs    int
 	failedPorts  []string
 }
 
@@ -76,7 +79,7 @@ func (w *watcher) addToDead(port string) error {
 }
 
 // add inserts a new instance to the watched pool.
-func (w *watcher) add(fqmn, port, uuid string, cxl context.CancelCauseFunc) {
+func (w *watcher) add(fqmn, port, uuid string, cxl context.CancelCauseFunc, grant *mesh.Grant) {
 	w.log.Info().Str("port", port).Str("fqmn", fqmn).Msg("adding one to the waitgroup port")
 	w.instancesRunning.Add(1)
 
@@ -86,9 +89,23 @@ func (w *watcher) add(fqmn, port, uuid string, cxl context.CancelCauseFunc) {
 	}
 
 	w.instances[port] = &instance{
-		fqmn: fqmn,
-		uuid: uuid,
-		cxl:  cxl,
+		fqmn:  fqmn,
+		uuid:  uuid,
+		cxl:   cxl,
+		grant: grant,
+	}
+}
+
+// renewGrants renews the join tokens of the instances that are due, so that they can keep opening connections.
+func (w *watcher) renewGrants(authority *mesh.Authority) {
+	for p, inst := range w.instances {
+		if inst.grant == nil {
+			continue
+		}
+
+		if err := authority.Renew(inst.grant); err != nil {
+			w.log.Err(err).Str("port", p).Str("fqmn", inst.fqmn).Msg("failed to renew join token")
+		}
 	}
 }
 
@@ -148,6 +165,7 @@ func (w *watcher) report() *watcherReport {
 	ll := w.log.With().Str("method", "report").Logger()
 
 	totalThreads := 0
+	totalJobs := 0
 	failedPorts := make([]string, 0)
 
 	for p := range w.instances {
@@ -158,12 +176,14 @@ func (w *watcher) report() *watcherReport {
 		} else {
 			w.instances[p].metrics = metrics
 			totalThreads += metrics.Scheduler.TotalThreadCount
+			totalJobs += metrics.Scheduler.TotalJobCount
 		}
 	}
 
 	report := &watcherReport{
 		instCount:    len(w.instances) - len(failedPorts),
 		totalThreads: totalThreads,
+		totalJobs:    totalJobs,
 		failedPorts:  failedPorts,
 	}
 
@@ -4,4 +4,5 @@ const (
 	domainFlag   = "domain"
 	httpPortFlag = "http-port"
 	tlsPortFlag  = "tls-port"
+	grpcPortFlag = "grpc-port"
 )
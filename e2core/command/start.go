@@ -3,9 +3,8 @@ package command
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -14,19 +13,18 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
+	"github.com/suborbital/e2core/e2core/admin"
 	"github.com/suborbital/e2core/e2core/auth"
 	"github.com/suborbital/e2core/e2core/backend/satbackend"
+	"github.com/suborbital/e2core/e2core/mesh"
+	"github.com/suborbital/e2core/e2core/metadata"
 	"github.com/suborbital/e2core/e2core/options"
 	"github.com/suborbital/e2core/e2core/release"
 	"github.com/suborbital/e2core/e2core/server"
 	"github.com/suborbital/e2core/e2core/sourceserver"
 	"github.com/suborbital/e2core/e2core/syncer"
-	"github.com/suborbital/systemspec/system/bundle"
-	"github.com/suborbital/systemspec/system/client"
-)
-
-const (
-	shutdownWaitTime = time.Second * 3
+	"github.com/suborbital/e2core/foundation/signaler"
+	"github.com/suborbital/systemspec/system"
 )
 
 func Start() *cobra.Command {
@@ -53,74 +51,89 @@ func Start() *cobra.Command {
 				return errors.Wrap(err, "options.NewWithModifiers")
 			}
 
-			sync := setupSyncer(logger, opts)
+			store, err := setupAdminStore(logger, opts)
+			if err != nil {
+				return errors.Wrap(err, "failed to setupAdminStore")
+			}
+
+			sync := setupSyncer(logger, opts, store)
 
 			// create the three essential parts:
-			sourceSrv, err := setupSourceServer(logger, opts)
+			sourceSrv, err := setupSourceServer(logger, opts, store)
 			if err != nil {
 				return errors.Wrap(err, "failed to setupSourceServer")
 			}
 
-			backend, err := satbackend.New(logger, opts, sync)
+			// the sats that the backend launches are issued join tokens for the mesh that the server connects to them over.
+			authority, err := mesh.FromOptions(opts)
+			if err != nil {
+				return errors.Wrap(err, "mesh.FromOptions")
+			}
+
+			backend, err := satbackend.New(logger, opts, sync, authority)
 			if err != nil {
 				return errors.Wrap(err, "failed to satbackend.New")
 			}
 
-			srv, err := server.New(logger, sync, opts)
+			srv, err := server.New(logger, sync, opts, authority)
 			if err != nil {
 				return errors.Wrap(err, "server.New")
 			}
 
-			shutdown := make(chan os.Signal, 1)
-			signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+			if store != nil {
+				if err := srv.AttachAdmin(store); err != nil {
+					return errors.Wrap(err, "srv.AttachAdmin")
+				}
+			}
 
-			serverErrors := make(chan error, 1)
+			sig := signaler.Setup()
 
 			// now start all three parts:
 
-			go func() {
+			sig.Start(func(_ context.Context) error {
 				logger.Info().Msg("starting source server")
-				if err := sourceserver.Start(sourceSrv); err != nil {
-					serverErrors <- errors.Wrap(err, "sourceserver.Start")
+				if err := sourceserver.Start(sourceSrv); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					return errors.Wrap(err, "sourceserver.Start")
 				}
 
-			}()
+				return nil
+			})
 
-			go func() {
+			sig.Start(func(_ context.Context) error {
 				logger.Info().Msg("starting backend")
 				if err := backend.Start(); err != nil {
-					serverErrors <- errors.Wrap(err, "backend.Start")
+					return errors.Wrap(err, "backend.Start")
 				}
 
-			}()
+				return nil
+			})
 
-			go func() {
+			sig.Start(func(_ context.Context) error {
 				logger.Info().Msg("starting e2core server")
-				if err := srv.Start(); err != nil {
-					serverErrors <- errors.Wrap(err, "srv.Start")
+				if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					return errors.Wrap(err, "srv.Start")
 				}
-			}()
 
-			select {
-			case err := <-serverErrors:
-				return fmt.Errorf("server error: %w", err)
+				return nil
+			})
 
-			case sig := <-shutdown:
-				logger.Info().Str("signal", sig.String()).Str("status", "shutdown started").Msg("shutdown started")
-				defer logger.Info().Str("status", "shutdown complete").Msg("all done")
+			// the signaler cancels the context when a signal is received, which starts the shutdown.
+			sig.Start(func(ctx context.Context) error {
+				<-ctx.Done()
 
-				ctx, cancel := context.WithTimeout(context.Background(), shutdownWaitTime)
-				defer cancel()
+				shutdown(logger, opts.ShutdownConfig, srv, backend, sourceSrv)
 
-				if err := srv.Shutdown(ctx); err != nil {
-					return errors.Wrap(err, "srv.Shutdown")
-				}
+				return nil
+			})
 
-				if err := sourceSrv.Shutdown(ctx); err != nil {
-					return errors.Wrap(err, "sourceSrv.Shutdown")
+			if err := sig.Wait(opts.ShutdownConfig.Total()); err != nil {
+				logger.Err(err).Msg("e2core stopped unexpectedly, shutting down")
+
+				if shutdownErr := sig.ManualShutdown(opts.ShutdownConfig.Total()); shutdownErr != nil {
+					logger.Err(shutdownErr).Msg("error during shutdown")
 				}
 
-				backend.Shutdown()
+				return fmt.Errorf("server error: %w", err)
 			}
 
 			return nil
@@ -132,6 +145,7 @@ func Start() *cobra.Command {
 	cmd.Flags().String(domainFlag, "", "if passed, it'll be used as E2CORE_DOMAIN and HTTPS will be used, otherwise HTTP will be used")
 	cmd.Flags().Int(httpPortFlag, 8080, "if passed, it'll be used as E2CORE_HTTP_PORT, otherwise '8080' will be used")
 	cmd.Flags().Int(tlsPortFlag, 443, "if passed, it'll be used as E2CORE_TLS_PORT, otherwise '443' will be used")
+	cmd.Flags().Int(grpcPortFlag, 0, "if passed, it'll be used as E2CORE_GRPC_PORT and the gRPC execution service will be started")
 
 	return cmd
 }
@@ -164,22 +178,55 @@ func modsFromFlags(flags *pflag.FlagSet) ([]options.Modifier, error) {
 		return nil, errors.Wrap(err, fmt.Sprintf("get int flag '%s' value", tlsPortFlag))
 	}
 
+	grpcPort, err := flags.GetInt(grpcPortFlag)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("get int flag '%s' value", grpcPortFlag))
+	}
+
 	opts := []options.Modifier{
 		options.Domain(domain),
 		options.HTTPPort(httpPort),
 		options.TLSPort(tlsPort),
+		options.GRPCPort(grpcPort),
 	}
 
 	return opts, nil
 }
 
-func setupSyncer(logger zerolog.Logger, opts *options.Options) *syncer.Syncer {
-	systemSource := bundle.NewBundleSource(opts.BundlePath)
+// setupAdminStore creates the store that backs the admin API when the adminV1 feature is enabled, otherwise it returns
+// nil. The store takes the place of the bundle, which is only used to seed it.
+func setupAdminStore(logger zerolog.Logger, opts *options.Options) (*admin.Store, error) {
+	if !opts.FeatureEnabled(options.FeatureMultiTenant) {
+		return nil, nil
+	}
+
+	if opts.ControlPlane != "" && opts.ControlPlane != options.DefaultControlPlane {
+		return nil, errors.Errorf("the %s feature cannot be used with an external control plane", options.FeatureMultiTenant)
+	}
+
+	logger.Info().Str("path", opts.AdminStorePath).Msg("admin API enabled, using local module store")
+
+	store, err := admin.NewStore(opts.AdminStorePath, opts.BundlePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "admin.NewStore")
+	}
 
-	if opts.ControlPlane != "" {
+	if err := store.Start(); err != nil {
+		return nil, errors.Wrap(err, "store.Start")
+	}
+
+	return store, nil
+}
+
+func setupSyncer(logger zerolog.Logger, opts *options.Options, store *admin.Store) *syncer.Syncer {
+	var systemSource system.Source = metadata.NewBundleSource(opts.BundlePath)
+
+	if store != nil {
+		systemSource = store
+	} else if opts.ControlPlane != "" {
 		// the HTTP system source gets Server's data from a remote server
 		// which can essentially control Server's behaviour.
-		systemSource = client.NewHTTPSource(opts.ControlPlane, auth.NewAccessToken(opts.EnvironmentToken))
+		systemSource = metadata.NewHTTPSource(opts.ControlPlane, auth.NewAccessToken(opts.EnvironmentToken))
 	}
 
 	sync := syncer.New(opts, logger, systemSource)
@@ -187,7 +234,7 @@ func setupSyncer(logger zerolog.Logger, opts *options.Options) *syncer.Syncer {
 	return sync
 }
 
-func setupSourceServer(logger zerolog.Logger, opts *options.Options) (*echo.Echo, error) {
+func setupSourceServer(logger zerolog.Logger, opts *options.Options, store *admin.Store) (*echo.Echo, error) {
 	ll := logger.With().Str("method", "setupSourceServer").Logger()
 
 	// if an external control plane hasn't been set, act as the control plane
@@ -195,6 +242,19 @@ func setupSourceServer(logger zerolog.Logger, opts *options.Options) (*echo.Echo
 	if opts.ControlPlane == options.DefaultControlPlane || opts.ControlPlane == "" {
 		opts.ControlPlane = options.DefaultControlPlane
 
+		if store != nil {
+			ll.Debug().Msg("creating sourceserver from admin store: " + opts.AdminStorePath)
+
+			server, err := sourceserver.FromSource(store)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to sourceserver.FromSource")
+			}
+
+			server.HideBanner = true
+
+			return server, nil
+		}
+
 		ll.Debug().Msg("creating sourceserver from bundle: " + opts.BundlePath)
 
 		server, err := sourceserver.FromBundle(opts.BundlePath)
@@ -210,3 +270,49 @@ func setupSourceServer(logger zerolog.Logger, opts *options.Options) (*echo.Echo
 	// a nil server is ok if we don't need to run one
 	return nil, nil
 }
+
+// shutdown stops e2core one phase at a time, in the order that lets work in progress complete: the server stops
+// accepting requests and waits for running executions, then withdraws from the bus and stops the authorizer, then the
+// sats are stopped, and last the source server is stopped and the traces are flushed. Each phase has its own timeout,
+// and a phase that fails does not prevent the later ones from running.
+func shutdown(logger zerolog.Logger, config options.ShutdownConfig, srv *server.Server, backend *satbackend.Orchestrator, sourceSrv *echo.Echo) {
+	ll := logger.With().Str("method", "shutdown").Logger()
+
+	ll.Info().Str("status", "shutdown started").Msg("shutdown started")
+
+	phases := []struct {
+		name    string
+		timeout time.Duration
+		run     func(ctx context.Context) error
+	}{
+		{name: "http", timeout: config.HTTPTimeout, run: srv.StopAccepting},
+		{name: "drain", timeout: config.DrainTimeout, run: srv.Drain},
+		{name: "bus", timeout: config.BusTimeout, run: srv.WithdrawBus},
+		// stopping the authorizer does not block, so it shares the bus phase's timeout rather than having its own.
+		{name: "auth", timeout: config.BusTimeout, run: srv.StopAuthorizer},
+		{name: "backend", timeout: config.BackendTimeout, run: backend.Shutdown},
+		{name: "source", timeout: config.SourceTimeout, run: func(ctx context.Context) error {
+			if sourceSrv == nil {
+				return nil
+			}
+
+			return sourceSrv.Shutdown(ctx)
+		}},
+		{name: "tracer", timeout: config.TracerTimeout, run: srv.FlushTraces},
+	}
+
+	for _, phase := range phases {
+		ctx, cancel := context.WithTimeout(context.Background(), phase.timeout)
+		started := time.Now()
+
+		if err := phase.run(ctx); err != nil {
+			ll.Err(err).Str("phase", phase.name).Msg("shutdown phase failed")
+		} else {
+			ll.Info().Str("phase", phase.name).Dur("duration", time.Since(started)).Msg("shutdown phase complete")
+		}
+
+		cancel()
+	}
+
+	ll.Info().Str("status", "shutdown complete").Msg("all done")
+}
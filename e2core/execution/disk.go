@@ -0,0 +1,137 @@
+package execution
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+const recordFileExt = ".json"
+
+// DiskStore is a Store that writes each record as a JSON file into a directory.
+type DiskStore struct {
+	dir  string
+	lock sync.RWMutex
+}
+
+// NewDiskStore creates a DiskStore rooted at dir, creating the directory if needed.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if dir == "" {
+		return nil, common.InvalidArgument("disk execution store requires a directory")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "os.MkdirAll")
+	}
+
+	d := &DiskStore{
+		dir:  dir,
+		lock: sync.RWMutex{},
+	}
+
+	return d, nil
+}
+
+// Put writes the record to disk, replacing any previous version.
+func (d *DiskStore) Put(rec *Record) error {
+	path, err := d.pathFor(rec.ID)
+	if err != nil {
+		return err
+	}
+
+	recJSON, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// write to a temporary file first so that readers never see a partially written record.
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, recJSON, 0600); err != nil {
+		return errors.Wrap(err, "os.WriteFile")
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "os.Rename")
+	}
+
+	return nil
+}
+
+// Get reads the record with the given ID from disk.
+func (d *DiskStore) Get(id string) (*Record, error) {
+	path, err := d.pathFor(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	recJSON, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.DoesNotExistError("execution %s", id)
+		}
+
+		return nil, errors.Wrap(err, "os.ReadFile")
+	}
+
+	rec := &Record{}
+	if err := json.Unmarshal(recJSON, rec); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return rec, nil
+}
+
+// Prune removes every record created before the given time.
+func (d *DiskStore) Prune(before time.Time) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return errors.Wrap(err, "os.ReadDir")
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), recordFileExt) {
+			continue
+		}
+
+		path := filepath.Join(d.dir, entry.Name())
+
+		recJSON, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "os.ReadFile")
+		}
+
+		rec := &Record{}
+		if err := json.Unmarshal(recJSON, rec); err != nil || rec.CreatedAt.Before(before) {
+			if err := os.Remove(path); err != nil {
+				return errors.Wrap(err, "os.Remove")
+			}
+		}
+	}
+
+	return nil
+}
+
+// pathFor returns the file path for a record ID, refusing IDs that could escape the store's directory.
+func (d *DiskStore) pathFor(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return "", common.InvalidArgument("invalid execution id %q", id)
+	}
+
+	return filepath.Join(d.dir, id+recordFileExt), nil
+}
@@ -0,0 +1,117 @@
+package execution
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/scheduler"
+)
+
+// Status describes where an execution is in its lifecycle.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+
+	StoreTypeMemory = "memory"
+	StoreTypeDisk   = "disk"
+)
+
+// Record is the stored result of a single (usually asynchronous) execution of a module or workflow.
+type Record struct {
+	ID          string            `json:"id"`
+	Ident       string            `json:"ident"`
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Status      Status            `json:"status"`
+	Output      []byte            `json:"output,omitempty"`
+	RespHeaders map[string]string `json:"respHeaders,omitempty"`
+	RunErr      *scheduler.RunErr `json:"runErr,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	CompletedAt *time.Time        `json:"completedAt,omitempty"`
+	Callback    *Callback         `json:"callback,omitempty"`
+}
+
+// Callback records the delivery of a record to the callback URL that was given for its execution.
+type Callback struct {
+	URL       string            `json:"url"`
+	Delivered bool              `json:"delivered"`
+	Attempts  []CallbackAttempt `json:"attempts,omitempty"`
+}
+
+// CallbackAttempt is one attempt at delivering a callback. StatusCode is zero if no response was received.
+type CallbackAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Store persists execution records so that their results can be retrieved after the fact.
+type Store interface {
+	// Put inserts or replaces the record with the record's ID.
+	Put(rec *Record) error
+	// Get returns the record for the given ID, or an error wrapping common.ErrNotExists.
+	Get(id string) (*Record, error)
+	// Prune removes every record that was created before the given time.
+	Prune(before time.Time) error
+}
+
+// NewRecord creates a pending record for an execution of ident/namespace/name.
+func NewRecord(id, ident, namespace, name string) *Record {
+	return &Record{
+		ID:        id,
+		Ident:     ident,
+		Namespace: namespace,
+		Name:      name,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Complete marks the record as finished with the given output and response headers.
+func (r *Record) Complete(output []byte, respHeaders map[string]string) {
+	now := time.Now()
+
+	r.Status = StatusCompleted
+	r.Output = output
+	r.RespHeaders = respHeaders
+	r.CompletedAt = &now
+}
+
+// Fail marks the record as failed. If err is (or wraps) a RunErr returned by a module, it is stored as such.
+func (r *Record) Fail(err error) {
+	now := time.Now()
+
+	r.Status = StatusFailed
+	r.CompletedAt = &now
+
+	runErr := scheduler.RunErr{}
+	if errors.As(err, &runErr) {
+		r.RunErr = &runErr
+		return
+	}
+
+	r.Error = err.Error()
+}
+
+// StoreFromOptions creates the Store configured by E2CORE_EXECUTION_STORE.
+func StoreFromOptions(opts *options.Options) (Store, error) {
+	switch opts.ExecutionStore {
+	case StoreTypeMemory, "":
+		return NewMemoryStore(), nil
+	case StoreTypeDisk:
+		store, err := NewDiskStore(opts.ExecutionStorePath)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewDiskStore")
+		}
+
+		return store, nil
+	default:
+		return nil, errors.Errorf("unknown execution store type %q", opts.ExecutionStore)
+	}
+}
@@ -0,0 +1,62 @@
+package execution
+
+import (
+	"sync"
+	"time"
+
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+// MemoryStore is a Store that keeps records in memory; they do not survive a restart.
+type MemoryStore struct {
+	records map[string]*Record
+	lock    sync.RWMutex
+}
+
+// NewMemoryStore creates a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]*Record{},
+		lock:    sync.RWMutex{},
+	}
+}
+
+// Put stores a copy of the record.
+func (m *MemoryStore) Put(rec *Record) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stored := *rec
+	m.records[rec.ID] = &stored
+
+	return nil
+}
+
+// Get returns a copy of the record with the given ID.
+func (m *MemoryStore) Get(id string) (*Record, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	rec, exists := m.records[id]
+	if !exists {
+		return nil, common.DoesNotExistError("execution %s", id)
+	}
+
+	found := *rec
+
+	return &found, nil
+}
+
+// Prune removes every record created before the given time.
+func (m *MemoryStore) Prune(before time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for id, rec := range m.records {
+		if rec.CreatedAt.Before(before) {
+			delete(m.records, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package execution
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/e2core/foundation/scheduler"
+)
+
+func TestStores(t *testing.T) {
+	disk, err := NewDiskStore(t.TempDir())
+	require.NoError(t, err)
+
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"disk":   disk,
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			rec := NewRecord("abc-123", "com.suborbital.app", "default", "hello")
+			require.NoError(t, store.Put(rec))
+
+			found, err := store.Get("abc-123")
+			require.NoError(t, err)
+			assert.Equal(t, StatusPending, found.Status)
+
+			rec.Complete([]byte("hello world"), map[string]string{"X-Test": "yes"})
+			require.NoError(t, store.Put(rec))
+
+			found, err = store.Get("abc-123")
+			require.NoError(t, err)
+			assert.Equal(t, StatusCompleted, found.Status)
+			assert.Equal(t, []byte("hello world"), found.Output)
+			assert.Equal(t, "yes", found.RespHeaders["X-Test"])
+			assert.NotNil(t, found.CompletedAt)
+
+			failed := NewRecord("def-456", "com.suborbital.app", "default", "hello")
+			failed.Fail(scheduler.RunErr{Code: 401, Message: "don't go there"})
+			require.NoError(t, store.Put(failed))
+
+			found, err = store.Get("def-456")
+			require.NoError(t, err)
+			assert.Equal(t, StatusFailed, found.Status)
+			require.NotNil(t, found.RunErr)
+			assert.Equal(t, 401, found.RunErr.Code)
+
+			_, err = store.Get("does-not-exist")
+			assert.True(t, common.IsError(err, common.ErrNotExists))
+
+			require.NoError(t, store.Prune(time.Now().Add(time.Minute)))
+
+			_, err = store.Get("abc-123")
+			assert.True(t, common.IsError(err, common.ErrNotExists))
+		})
+	}
+}
+
+func TestDiskStore_InvalidID(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = store.Get("../../etc/passwd")
+	assert.True(t, common.IsError(err, common.ErrInvalid))
+}
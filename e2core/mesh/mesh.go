@@ -0,0 +1,366 @@
+// Package mesh authenticates the e2core and sat instances that join the bus mesh. e2core holds the key of an
+// Authority, which is generated for every run unless one is configured, and grants each sat that it launches a key
+// pair of its own along with a join token, which binds the sat's public key to the tenant that the sat belongs to.
+// Peers prove that they hold the key that their token was issued for by signing a challenge made of fresh nonces from
+// both ends of a connection, so a token that is seen by someone else cannot be replayed. Tokens expire, and are
+// renewed by the authority before they do.
+package mesh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/bus/transport/websocket"
+)
+
+const (
+	// AnyTenant is the BelongsTo of tokens that may join the mesh of every tenant, which only e2core is issued.
+	AnyTenant = "*"
+
+	// KeyEnv, PrivateKeyEnv and TokenPathEnv are the environment variables that hand a sat the authority's public key,
+	// its own private key, and the file that holds its join token.
+	KeyEnv        = "SAT_MESH_KEY"
+	PrivateKeyEnv = "SAT_MESH_PRIVATE_KEY"
+	TokenPathEnv  = "SAT_MESH_TOKEN_PATH"
+
+	// DefaultTokenTTL is how long join tokens are valid for if the config does not say.
+	DefaultTokenTTL = time.Hour
+
+	issuer   = "e2core"
+	audience = "e2core-mesh"
+)
+
+var _ websocket.Authenticator = (*Member)(nil)
+
+// claims are the claims of a join token. Subject names the instance that the token was issued to, and Key is the
+// public key that the instance signs challenges with.
+type claims struct {
+	BelongsTo string `json:"belongsTo"`
+	Key       string `json:"key"`
+	jwt.RegisteredClaims
+}
+
+// Authority issues join tokens, which are JWTs signed with its Ed25519 key that are valid for ttl.
+type Authority struct {
+	key ed25519.PrivateKey
+	ttl time.Duration
+}
+
+// NewAuthority creates an Authority with a new key, so that the tokens it issues are only valid for the current run.
+func NewAuthority(ttl time.Duration) (*Authority, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "ed25519.GenerateKey")
+	}
+
+	return newAuthority(key, ttl), nil
+}
+
+// LoadAuthority reads an Authority's key from a PEM encoded PKCS #8 Ed25519 private key file.
+func LoadAuthority(path string, ttl time.Duration) (*Authority, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "x509.ParsePKCS8PrivateKey")
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an Ed25519 private key")
+	}
+
+	return newAuthority(key, ttl), nil
+}
+
+func newAuthority(key ed25519.PrivateKey, ttl time.Duration) *Authority {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	return &Authority{key: key, ttl: ttl}
+}
+
+// FromOptions loads the Authority whose key is configured by E2CORE_MESH_KEY_PATH, or creates one for this run.
+func FromOptions(opts *options.Options) (*Authority, error) {
+	if opts.MeshConfig.KeyPath == "" {
+		return NewAuthority(opts.MeshConfig.TokenTTL)
+	}
+
+	a, err := LoadAuthority(opts.MeshConfig.KeyPath, opts.MeshConfig.TokenTTL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "LoadAuthority %s", opts.MeshConfig.KeyPath)
+	}
+
+	return a, nil
+}
+
+// Issue returns a join token for the instance named subject that holds the private half of key, which allows it to
+// join the mesh of belongsTo until the returned expiry.
+func (a *Authority) Issue(belongsTo, subject string, key ed25519.PublicKey) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(a.ttl)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims{
+		BelongsTo: belongsTo,
+		Key:       base64.StdEncoding.EncodeToString(key),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	})
+
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "token.SignedString")
+	}
+
+	return signed, expires, nil
+}
+
+// PublicKey returns the authority's public key in the form that is handed to sats.
+func (a *Authority) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(a.key.Public().(ed25519.PublicKey))
+}
+
+// due returns true once a token that expires at expires is halfway through its validity, and should be renewed.
+func (a *Authority) due(expires time.Time) bool {
+	return time.Until(expires) < a.ttl/2
+}
+
+// Member creates a key pair for the instance named subject, and returns the Member that presents the tokens issued for
+// it, which are renewed as they are needed.
+func (a *Authority) Member(belongsTo, subject string) (*Member, error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "ed25519.GenerateKey")
+	}
+
+	var lock sync.Mutex
+	var token string
+	var expires time.Time
+
+	credential := func() (string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if token == "" || a.due(expires) {
+			renewed, renewedExpires, err := a.Issue(belongsTo, subject, pub)
+			if err != nil {
+				return "", errors.Wrap(err, "a.Issue")
+			}
+
+			token, expires = renewed, renewedExpires
+		}
+
+		return token, nil
+	}
+
+	if _, err := credential(); err != nil {
+		return nil, err
+	}
+
+	return &Member{authorityKey: a.key.Public().(ed25519.PublicKey), key: key, credential: credential}, nil
+}
+
+// Grant is the membership that an authority granted a sat: its key pair, and the file that its join token is kept in.
+// The authority renews the token in the file before it expires, and the sat reads it whenever it needs it.
+type Grant struct {
+	belongsTo string
+	subject   string
+	path      string
+	key       ed25519.PrivateKey
+	expires   time.Time
+}
+
+// Grant creates a key pair for the sat named subject, and writes a join token for it to path.
+func (a *Authority) Grant(belongsTo, subject, path string) (*Grant, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "ed25519.GenerateKey")
+	}
+
+	g := &Grant{belongsTo: belongsTo, subject: subject, path: path, key: key}
+
+	if err := a.renew(g); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Renew writes a new join token for the grant once its current one is due to be renewed.
+func (a *Authority) Renew(g *Grant) error {
+	if !a.due(g.expires) {
+		return nil
+	}
+
+	return a.renew(g)
+}
+
+func (a *Authority) renew(g *Grant) error {
+	token, expires, err := a.Issue(g.belongsTo, g.subject, g.key.Public().(ed25519.PublicKey))
+	if err != nil {
+		return errors.Wrap(err, "a.Issue")
+	}
+
+	// the token is swapped in with a rename, so that the sat never reads a partially written one.
+	tmp, err := os.CreateTemp(filepath.Dir(g.path), filepath.Base(g.path)+".*")
+	if err != nil {
+		return errors.Wrap(err, "os.CreateTemp")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(token); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "tmp.WriteString")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "tmp.Close")
+	}
+
+	if err := os.Rename(tmp.Name(), g.path); err != nil {
+		return errors.Wrap(err, "os.Rename")
+	}
+
+	g.expires = expires
+
+	return nil
+}
+
+// Env returns the environment variables that hand the grant to a sat.
+func (a *Authority) Env(g *Grant) []string {
+	return []string{
+		KeyEnv + "=" + a.PublicKey(),
+		PrivateKeyEnv + "=" + base64.StdEncoding.EncodeToString(g.key),
+		TokenPathEnv + "=" + g.path,
+	}
+}
+
+// Member is a websocket.Authenticator for an instance that was issued join tokens.
+type Member struct {
+	authorityKey ed25519.PublicKey
+	key          ed25519.PrivateKey
+	credential   func() (string, error)
+}
+
+// NewMember creates a Member from the authority's public key, the instance's private key, and the file that holds its
+// join token, as they are handed to sats.
+func NewMember(publicKey, privateKey, tokenPath string) (*Member, error) {
+	authorityKey, err := decodeKey(publicKey, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "public key")
+	}
+
+	key, err := decodeKey(privateKey, ed25519.PrivateKeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "private key")
+	}
+
+	m := &Member{
+		authorityKey: authorityKey,
+		key:          key,
+		credential: func() (string, error) {
+			token, err := os.ReadFile(tokenPath)
+			if err != nil {
+				return "", errors.Wrap(err, "os.ReadFile")
+			}
+
+			return string(token), nil
+		},
+	}
+
+	token, err := m.Credential()
+	if err != nil {
+		return nil, errors.Wrap(err, "m.Credential")
+	}
+
+	// the token must have been issued by the authority for the instance's own key.
+	challenge := []byte(issuer)
+	if _, err := m.Verify(token, challenge, m.Sign(challenge)); err != nil {
+		return nil, errors.Wrap(err, "token was not issued to the instance by the authority")
+	}
+
+	return m, nil
+}
+
+// Credential returns the member's current join token.
+func (m *Member) Credential() (string, error) {
+	return m.credential()
+}
+
+// Sign signs the challenge with the member's private key.
+func (m *Member) Sign(challenge []byte) []byte {
+	return ed25519.Sign(m.key, challenge)
+}
+
+// Verify checks that the token was issued by the member's authority and has not expired, and that the signature over
+// the challenge was made with the key that the token was issued for. It returns the BelongsTo the token was issued
+// for.
+func (m *Member) Verify(token string, challenge, signature []byte) (string, error) {
+	c := &claims{}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+
+	if _, err := parser.ParseWithClaims(token, c, func(*jwt.Token) (any, error) { return m.authorityKey, nil }); err != nil {
+		return "", errors.Wrap(err, "invalid join token")
+	}
+
+	if c.BelongsTo == "" {
+		return "", errors.New("join token has no belongsTo claim")
+	}
+
+	key, err := decodeKey(c.Key, ed25519.PublicKeySize)
+	if err != nil {
+		return "", errors.Wrap(err, "join token has an invalid key claim")
+	}
+
+	if !ed25519.Verify(key, challenge, signature) {
+		return "", errors.New("challenge was not signed with the key of the join token")
+	}
+
+	return c.BelongsTo, nil
+}
+
+func decodeKey(encoded string, size int) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "base64.StdEncoding.DecodeString")
+	}
+
+	if len(key) != size {
+		return nil, errors.New("key has the wrong size")
+	}
+
+	return key, nil
+}
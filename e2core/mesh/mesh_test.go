@@ -0,0 +1,170 @@
+package mesh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFQMN = "fqmn://com.suborbital.test/default/hello@v1"
+
+// grantedMember grants a sat membership and creates its Member from the environment that the sat would be given.
+func grantedMember(t *testing.T, authority *Authority) (*Grant, *Member) {
+	grant, err := authority.Grant("com.suborbital.test", testFQMN, filepath.Join(t.TempDir(), "sat.jwt"))
+	require.NoError(t, err)
+
+	env := map[string]string{}
+	for _, kv := range authority.Env(grant) {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	member, err := NewMember(env[KeyEnv], env[PrivateKeyEnv], env[TokenPathEnv])
+	require.NoError(t, err)
+
+	return grant, member
+}
+
+func TestAuthority_Grant(t *testing.T) {
+	authority, err := NewAuthority(time.Hour)
+	require.NoError(t, err)
+
+	_, sat := grantedMember(t, authority)
+
+	e2core, err := authority.Member(AnyTenant, "e2core")
+	require.NoError(t, err)
+
+	challenge := []byte("challenge")
+
+	satToken, err := sat.Credential()
+	require.NoError(t, err)
+
+	belongsTo, err := e2core.Verify(satToken, challenge, sat.Sign(challenge))
+	require.NoError(t, err)
+	assert.Equal(t, "com.suborbital.test", belongsTo)
+
+	e2coreToken, err := e2core.Credential()
+	require.NoError(t, err)
+
+	belongsTo, err = sat.Verify(e2coreToken, challenge, e2core.Sign(challenge))
+	require.NoError(t, err)
+	assert.Equal(t, AnyTenant, belongsTo)
+}
+
+func TestMember_RejectsReplays(t *testing.T) {
+	authority, err := NewAuthority(time.Hour)
+	require.NoError(t, err)
+
+	_, sat := grantedMember(t, authority)
+
+	e2core, err := authority.Member(AnyTenant, "e2core")
+	require.NoError(t, err)
+
+	e2coreToken, err := e2core.Credential()
+	require.NoError(t, err)
+
+	// a signature over another challenge cannot be replayed.
+	_, err = sat.Verify(e2coreToken, []byte("this connection"), e2core.Sign([]byte("earlier connection")))
+	assert.Error(t, err)
+
+	// nor can a token be presented by anyone other than the holder of its key.
+	_, err = sat.Verify(e2coreToken, []byte("challenge"), sat.Sign([]byte("challenge")))
+	assert.Error(t, err)
+}
+
+func TestMember_RejectsInvalidTokens(t *testing.T) {
+	authority, err := NewAuthority(time.Hour)
+	require.NoError(t, err)
+
+	other, err := NewAuthority(time.Hour)
+	require.NoError(t, err)
+
+	_, member := grantedMember(t, authority)
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	challenge := []byte("challenge")
+	signature := ed25519.Sign(key, challenge)
+
+	foreign, _, err := other.Issue("com.suborbital.test", "intruder", pub)
+	require.NoError(t, err)
+
+	expired, _, err := (&Authority{key: authority.key, ttl: -time.Minute}).Issue("com.suborbital.test", "sat", pub)
+	require.NoError(t, err)
+
+	unexpiring, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims{
+		BelongsTo:        "com.suborbital.test",
+		Key:              base64.StdEncoding.EncodeToString(pub),
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: issuer, Audience: jwt.ClaimStrings{audience}},
+	}).SignedString(authority.key)
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"other authority": foreign,
+		"expired":         expired,
+		"no expiry":       unexpiring,
+		"empty":           "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := member.Verify(token, challenge, signature)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = NewMember(authority.PublicKey(), "not-a-key", filepath.Join(t.TempDir(), "missing.jwt"))
+	assert.Error(t, err)
+}
+
+func TestAuthority_Renew(t *testing.T) {
+	authority, err := NewAuthority(time.Hour)
+	require.NoError(t, err)
+
+	grant, member := grantedMember(t, authority)
+
+	expires := grant.expires
+	require.NoError(t, authority.Renew(grant))
+	assert.Equal(t, expires, grant.expires, "a token is not renewed before it is due")
+
+	// the token is past halfway through its validity.
+	grant.expires = time.Now().Add(10 * time.Minute)
+	require.NoError(t, authority.Renew(grant))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), grant.expires, time.Minute)
+
+	token, err := member.Credential()
+	require.NoError(t, err)
+
+	_, err = member.Verify(token, []byte("challenge"), member.Sign([]byte("challenge")))
+	assert.NoError(t, err, "the renewed token is read from the file")
+}
+
+func TestLoadAuthority(t *testing.T) {
+	authority, err := NewAuthority(time.Hour)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(authority.key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "mesh.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	loaded, err := LoadAuthority(path, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, authority.PublicKey(), loaded.PublicKey())
+
+	require.NoError(t, os.WriteFile(path, []byte("not a key"), 0600))
+
+	_, err = LoadAuthority(path, time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+// Package metadata reads the settings of modules that tenant.Module has no place for. They are kept next to each
+// module in the tenant config, under its metadata key:
+//
+//	"modules": [
+//	  {
+//	    "name": "hello",
+//	    "namespace": "default",
+//	    "metadata": {
+//	      "timeout": "30s",
+//	      "limits": {"rps": 10, "concurrency": 2},
+//	      "schema": {
+//	        "input": {"type": "object"}
+//	      }
+//	    }
+//	  }
+//	]
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/systemspec/fqmn"
+)
+
+// Module holds the metadata of a single module.
+type Module struct {
+	// Timeout is how long the module may run for. Zero means the global execution timeout.
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// Schema declares the JSON schemas of the module's input and output, if it has any.
+	Schema *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+	// Limits sets the module's quotas. Modules without any fall back to the limits from the policy file.
+	Limits *Limits `json:"limits,omitempty" yaml:"limits,omitempty"`
+}
+
+// Limits are the quotas of a module's executions. RPS is the sustained number of executions per second, allowing
+// bursts of up to Burst, and Concurrency is the maximum number of executions in flight. Zero means unlimited.
+type Limits struct {
+	RPS         float64 `json:"rps,omitempty" yaml:"rps,omitempty"`
+	Burst       int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+	Concurrency int     `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+}
+
+// Schema declares the JSON schemas of a module's input and output, which are published in the tenant's OpenAPI
+// document. Either can be left out, in which case the module is documented as taking or returning any bytes.
+type Schema struct {
+	Input  map[string]any `json:"input,omitempty" yaml:"input,omitempty"`
+	Output map[string]any `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// Tenant holds the metadata of every module of a tenant that has any, see Key.
+type Tenant map[string]Module
+
+// Source is implemented by system sources that can provide the module metadata of a tenant version along with its
+// config.
+type Source interface {
+	ModuleMetadata(ident string, version int64) (Tenant, error)
+}
+
+// Key returns the key of a module's metadata within a Tenant.
+func Key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// Module returns the metadata of a module, which is empty if it has none.
+func (t Tenant) Module(namespace, name string) Module {
+	return t[Key(namespace, name)]
+}
+
+// FromConfigJSON reads the module metadata out of a tenant config in JSON.
+func FromConfigJSON(configJSON []byte) (Tenant, error) {
+	config := struct {
+		Modules []struct {
+			Name      string  `json:"name"`
+			Namespace string  `json:"namespace"`
+			Metadata  *Module `json:"metadata"`
+		} `json:"modules"`
+	}{}
+
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	t := Tenant{}
+
+	for _, mod := range config.Modules {
+		if mod.Metadata == nil {
+			continue
+		}
+
+		if l := mod.Metadata.Limits; l != nil && (l.RPS < 0 || l.Burst < 0 || l.Concurrency < 0) {
+			return nil, fmt.Errorf("module %s: limits must not be negative", mod.Name)
+		}
+
+		// tenant.Config puts modules without a namespace into the default one, so do the same.
+		namespace := mod.Namespace
+		if namespace == "" {
+			namespace = fqmn.NamespaceDefault
+		}
+
+		t[Key(namespace, mod.Name)] = *mod.Metadata
+	}
+
+	return t, nil
+}
+
+// Duration is a time.Duration that is written as a string such as "30s".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var val string
+	if err := json.Unmarshal(data, &val); err != nil {
+		return errors.Wrap(err, "json.Unmarshal")
+	}
+
+	parsed, err := time.ParseDuration(val)
+	if err != nil {
+		return errors.Wrap(err, "time.ParseDuration")
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package metadata
+
+import (
+	"archive/zip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/systemspec/system"
+)
+
+const testConfig = `{
+	"identifier": "com.suborbital.test",
+	"tenantVersion": 1,
+	"modules": [
+		{"name": "slow", "namespace": "default", "metadata": {"timeout": "1m"}},
+		{"name": "unnamespaced", "metadata": {"timeout": "5s"}},
+		{"name": "plain", "namespace": "default"},
+		{"name": "greet", "namespace": "default", "metadata": {"schema": {"input": {"type": "object"}}}},
+		{"name": "noisy", "namespace": "default", "metadata": {"limits": {"rps": 5, "concurrency": 2}}}
+	]
+}`
+
+func TestFromConfigJSON(t *testing.T) {
+	md, err := FromConfigJSON([]byte(testConfig))
+	require.NoError(t, err)
+
+	assert.Len(t, md, 4)
+	assert.Equal(t, Duration(time.Minute), md.Module("default", "slow").Timeout)
+	assert.Equal(t, Duration(5*time.Second), md.Module("default", "unnamespaced").Timeout)
+	assert.Equal(t, Module{}, md.Module("default", "plain"))
+	assert.Equal(t, &Schema{Input: map[string]any{"type": "object"}}, md.Module("default", "greet").Schema)
+
+	assert.Equal(t, &Limits{RPS: 5, Concurrency: 2}, md.Module("default", "noisy").Limits)
+
+	var nilTenant Tenant
+	assert.Equal(t, Module{}, nilTenant.Module("default", "slow"))
+
+	_, err = FromConfigJSON([]byte(`{"modules": [{"name": "slow", "metadata": {"timeout": "soon"}}]}`))
+	assert.Error(t, err)
+
+	_, err = FromConfigJSON([]byte(`{"modules": [{"name": "noisy", "metadata": {"limits": {"rps": -1}}}]}`))
+	assert.Error(t, err)
+}
+
+func TestReadBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modules.wasm.zip")
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+
+	w := zip.NewWriter(file)
+
+	f, err := w.Create("tenant.json")
+	require.NoError(t, err)
+
+	_, err = f.Write([]byte(testConfig))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	require.NoError(t, file.Close())
+
+	md, err := NewBundleSource(path).ModuleMetadata("com.suborbital.test", 1)
+	require.NoError(t, err)
+	assert.Equal(t, Duration(time.Minute), md.Module("default", "slow").Timeout)
+
+	_, err = ReadBundle(filepath.Join(t.TempDir(), "missing.wasm.zip"))
+	assert.Error(t, err)
+}
+
+func TestHTTPSource(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/system/v1/tenant/com.suborbital.test" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"identifier": "com.suborbital.test", "version": 1, "config": ` + testConfig + `}`))
+	}))
+	defer server.Close()
+
+	source := NewHTTPSource(server.URL, auth.NewAccessToken("token"))
+
+	ovv, err := source.TenantOverview("com.suborbital.test")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), ovv.Version)
+	require.NotNil(t, ovv.Config)
+
+	md, err := source.ModuleMetadata("com.suborbital.test", ovv.Version)
+	require.NoError(t, err)
+	assert.Equal(t, Duration(time.Minute), md.Module("default", "slow").Timeout)
+	assert.Equal(t, int32(1), requests.Load(), "the metadata is read from the overview's response")
+
+	_, err = source.ModuleMetadata("com.suborbital.test", 2)
+	assert.Error(t, err, "the control plane does not serve version 2")
+
+	md, err = NewHTTPSource(server.URL, auth.NewAccessToken("token")).ModuleMetadata("com.suborbital.test", 1)
+	require.NoError(t, err)
+	assert.Equal(t, Duration(time.Minute), md.Module("default", "slow").Timeout)
+
+	_, err = NewHTTPSource(server.URL, auth.NewAccessToken("token")).ModuleMetadata("com.suborbital.other", 1)
+	assert.Error(t, err)
+
+	_, err = NewHTTPSource(server.URL, nil).TenantOverview("com.suborbital.test")
+	assert.ErrorIs(t, err, system.ErrAuthenticationFailed)
+}
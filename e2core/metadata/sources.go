@@ -0,0 +1,210 @@
+package metadata
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/systemspec/system"
+	"github.com/suborbital/systemspec/system/bundle"
+	"github.com/suborbital/systemspec/system/client"
+)
+
+// requestTimeout is how long fetching the metadata of a tenant from the control plane may take.
+const requestTimeout = 10 * time.Second
+
+// BundleSource is the bundle system source, which also reads the module metadata from the bundle's tenant config.
+type BundleSource struct {
+	system.Source
+
+	path string
+}
+
+// NewBundleSource creates a BundleSource for the bundle at path.
+func NewBundleSource(path string) *BundleSource {
+	return &BundleSource{
+		Source: bundle.NewBundleSource(path),
+		path:   path,
+	}
+}
+
+// ModuleMetadata reads the module metadata from the bundle, which holds a single version of a single tenant.
+func (b *BundleSource) ModuleMetadata(_ string, _ int64) (Tenant, error) {
+	return ReadBundle(b.path)
+}
+
+// ReadBundle reads the module metadata from the tenant config of the bundle at path.
+func ReadBundle(path string) (Tenant, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "zip.OpenReader")
+	}
+
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.Name != "tenant.json" {
+			continue
+		}
+
+		file, err := f.Open()
+		if err != nil {
+			return nil, errors.Wrap(err, "f.Open")
+		}
+
+		configJSON, err := io.ReadAll(file)
+		_ = file.Close()
+
+		if err != nil {
+			return nil, errors.Wrap(err, "io.ReadAll")
+		}
+
+		return FromConfigJSON(configJSON)
+	}
+
+	return nil, errors.New("bundle is missing tenant.json")
+}
+
+// HTTPSource is the control plane system source, which also reads the module metadata from the tenant configs that
+// the control plane serves. The metadata is parsed from the same response as the tenant's overview, so that each sync
+// fetches a tenant once.
+type HTTPSource struct {
+	system.Source
+
+	host       string
+	authHeader string
+	client     *http.Client
+
+	lock     sync.RWMutex
+	metadata map[string]versioned
+}
+
+// versioned is the module metadata of a version of a tenant.
+type versioned struct {
+	version  int64
+	metadata Tenant
+}
+
+// NewHTTPSource creates an HTTPSource for the control plane at host.
+func NewHTTPSource(host string, creds system.Credential) *HTTPSource {
+	h := &HTTPSource{
+		Source:   client.NewHTTPSource(host, creds),
+		host:     host,
+		client:   &http.Client{Timeout: requestTimeout},
+		metadata: map[string]versioned{},
+	}
+
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		h.host = fmt.Sprintf("http://%s", host)
+	}
+
+	if creds != nil {
+		h.authHeader = fmt.Sprintf("%s %s", creds.Scheme(), creds.Value())
+	}
+
+	return h
+}
+
+// TenantOverview fetches the tenant's overview, and keeps the module metadata from its config for ModuleMetadata.
+func (h *HTTPSource) TenantOverview(ident string) (*system.TenantOverview, error) {
+	ovv, _, err := h.fetch(ident)
+	if err != nil {
+		return nil, err
+	}
+
+	return ovv, nil
+}
+
+// ModuleMetadata returns the module metadata of the version of the tenant whose overview was last fetched, or fetches
+// it. The control plane only serves the latest version of a tenant, so asking for any other version is an error.
+func (h *HTTPSource) ModuleMetadata(ident string, version int64) (Tenant, error) {
+	h.lock.RLock()
+	md, exists := h.metadata[ident]
+	h.lock.RUnlock()
+
+	if !exists || md.version != version {
+		ovv, metadata, err := h.fetch(ident)
+		if err != nil {
+			return nil, err
+		}
+
+		if ovv.Version != version {
+			return nil, fmt.Errorf("control plane serves version %d of tenant %s, not %d", ovv.Version, ident, version)
+		}
+
+		md = versioned{version: ovv.Version, metadata: metadata}
+	}
+
+	return md.metadata, nil
+}
+
+// fetch gets the tenant's overview from the control plane and parses the module metadata from its config.
+func (h *HTTPSource) fetch(ident string) (*system.TenantOverview, Tenant, error) {
+	ctx, cxl := context.WithTimeout(context.Background(), requestTimeout)
+	defer cxl()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/system/v1/tenant/%s", h.host, ident), nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "http.NewRequestWithContext")
+	}
+
+	if h.authHeader != "" {
+		req.Header.Set("Authorization", h.authHeader)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "h.client.Do")
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "io.ReadAll")
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, nil, errors.WithMessage(system.ErrAuthenticationFailed, fmt.Sprintf("response body: %s", string(body)))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("non-200 response %d for tenant overview", resp.StatusCode)
+	}
+
+	ovv := &system.TenantOverview{}
+	if err := json.Unmarshal(body, ovv); err != nil {
+		return nil, nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	raw := struct {
+		Config json.RawMessage `json:"config"`
+	}{}
+
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	md := Tenant{}
+
+	if len(raw.Config) > 0 && string(raw.Config) != "null" {
+		md, err = FromConfigJSON(raw.Config)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "FromConfigJSON")
+		}
+	}
+
+	h.lock.Lock()
+	h.metadata[ident] = versioned{version: ovv.Version, metadata: md}
+	h.lock.Unlock()
+
+	return ovv, md, nil
+}
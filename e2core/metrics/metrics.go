@@ -0,0 +1,182 @@
+// Package metrics collects the e2core server's and orchestrator's metrics and serves them in the Prometheus text
+// format.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/suborbital/systemspec/fqmn"
+)
+
+const metricsNamespace = "e2core"
+
+const (
+	TransportHTTP   = "http"
+	TransportGRPC   = "grpc"
+	TransportBridge = "bridge"
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Execution requests handled, by tenant, namespace, module or workflow name, transport and response code.",
+	}, []string{"ident", "namespace", "name", "transport", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_duration_seconds",
+		Help:      "How long execution requests took, by tenant, namespace, module or workflow name and transport.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"ident", "namespace", "name", "transport"})
+
+	dispatchTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dispatch_timeouts_total",
+		Help:      "Dispatched executions that did not complete before their timeout, by module.",
+	}, []string{"ident", "namespace", "module"})
+
+	tunnelFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tunnel_failures_total",
+		Help:      "Executions that could not be tunneled to a sat, by module.",
+	}, []string{"ident", "namespace", "module"})
+
+	authCache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_cache_requests_total",
+		Help:      "Authorization cache lookups, by result (hit or miss).",
+	}, []string{"result"})
+
+	authCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_cache_evictions_total",
+		Help:      "Authorization decisions evicted from the cache to stay within its size.",
+	})
+
+	syncVersion = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "syncer_system_version",
+		Help:      "The system version that the syncer last synced.",
+	})
+
+	lastSync = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "syncer_last_sync_timestamp_seconds",
+		Help:      "Unix time of the syncer's last successful sync.",
+	})
+
+	satInstances = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "orchestrator_instances",
+		Help:      "Sat instances running, by FQMN.",
+	}, []string{"fqmn"})
+
+	satThreads = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sat_scheduler_threads",
+		Help:      "Threads of the schedulers of all sat instances, by FQMN.",
+	}, []string{"fqmn"})
+
+	satJobs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sat_scheduler_jobs",
+		Help:      "Jobs run by the schedulers of all sat instances, by FQMN.",
+	}, []string{"fqmn"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests,
+		requestDuration,
+		dispatchTimeouts,
+		tunnelFailures,
+		authCache,
+		authCacheEvictions,
+		syncVersion,
+		lastSync,
+		satInstances,
+		satThreads,
+		satJobs,
+	)
+}
+
+// Handler returns an http.Handler that serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records an execution request and how long it took since start.
+func ObserveRequest(ident, namespace, name, transport, code string, start time.Time) {
+	requests.WithLabelValues(ident, namespace, name, transport, code).Inc()
+	requestDuration.WithLabelValues(ident, namespace, name, transport).Observe(time.Since(start).Seconds())
+}
+
+// DispatchTimeout records that the execution of the module with the given FQMN timed out.
+func DispatchTimeout(FQMN string) {
+	dispatchTimeouts.WithLabelValues(moduleLabels(FQMN)...).Inc()
+}
+
+// TunnelFailure records that an execution of the module with the given FQMN could not be tunneled to a sat.
+func TunnelFailure(FQMN string) {
+	tunnelFailures.WithLabelValues(moduleLabels(FQMN)...).Inc()
+}
+
+// AuthCacheHit records an authorization that was answered from the cache.
+func AuthCacheHit() {
+	authCache.WithLabelValues("hit").Inc()
+}
+
+// AuthCacheMiss records an authorization that had to be loaded.
+func AuthCacheMiss() {
+	authCache.WithLabelValues("miss").Inc()
+}
+
+// AuthCacheEviction records an authorization that was evicted from the cache to make room for another.
+func AuthCacheEviction() {
+	authCacheEvictions.Inc()
+}
+
+// Synced records a successful sync of the given system version.
+func Synced(version int64) {
+	syncVersion.Set(float64(version))
+	lastSync.SetToCurrentTime()
+}
+
+// SatInstances records how many sat instances are running for the FQMN.
+func SatInstances(FQMN string, count int) {
+	satInstances.WithLabelValues(FQMN).Set(float64(count))
+}
+
+// SatScheduler records the scheduler metrics reported by the sat instances of the FQMN, summed across instances.
+func SatScheduler(FQMN string, threads, jobs int) {
+	satThreads.WithLabelValues(FQMN).Set(float64(threads))
+	satJobs.WithLabelValues(FQMN).Set(float64(jobs))
+}
+
+// RemoveSat removes the orchestrator metrics of an FQMN that is no longer running.
+func RemoveSat(FQMN string) {
+	satInstances.DeleteLabelValues(FQMN)
+	satThreads.DeleteLabelValues(FQMN)
+	satJobs.DeleteLabelValues(FQMN)
+}
+
+// moduleLabels returns the ident, namespace and name labels for an FQMN. Refs are left out to keep the number of
+// series from growing every time a module is updated.
+func moduleLabels(FQMN string) []string {
+	parsed, err := fqmn.Parse(FQMN)
+	if err != nil {
+		return []string{"", "", FQMN}
+	}
+
+	return []string{parsed.Tenant, parsed.Namespace, parsed.Name}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	ObserveRequest("com.suborbital.test", "default", "hello", TransportHTTP, "200", time.Now())
+	DispatchTimeout("fqmn://com.suborbital.test/default/hello@abc")
+	AuthCacheHit()
+	AuthCacheEviction()
+	Synced(3)
+	SatInstances("fqmn://com.suborbital.test/default/hello@abc", 2)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		`e2core_requests_total{code="200",ident="com.suborbital.test",name="hello",namespace="default",transport="http"} 1`,
+		`e2core_dispatch_timeouts_total{ident="com.suborbital.test",module="hello",namespace="default"} 1`,
+		`e2core_auth_cache_requests_total{result="hit"} 1`,
+		`e2core_auth_cache_evictions_total 1`,
+		`e2core_syncer_system_version 3`,
+		`e2core_orchestrator_instances{fqmn="fqmn://com.suborbital.test/default/hello@abc"} 2`,
+	} {
+		assert.Contains(t, string(body), line)
+	}
+}
+
+func TestRemoveSat(t *testing.T) {
+	SatInstances("fqmn://com.suborbital.test/default/goodbye@abc", 1)
+	SatScheduler("fqmn://com.suborbital.test/default/goodbye@abc", 4, 10)
+
+	assert.Equal(t, float64(4), testutil.ToFloat64(satThreads.WithLabelValues("fqmn://com.suborbital.test/default/goodbye@abc")))
+
+	RemoveSat("fqmn://com.suborbital.test/default/goodbye@abc")
+
+	assert.Zero(t, testutil.CollectAndCount(satJobs))
+}
@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+// Version is the version of the OpenAPI specification that generated documents follow.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document. Only the parts that e2core generates are modelled.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components *Components           `json:"components,omitempty"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// The parts of a Document, named as in the specification.
+type (
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	}
+
+	PathItem struct {
+		Post *Operation `json:"post,omitempty"`
+	}
+
+	Operation struct {
+		OperationID string              `json:"operationId"`
+		Summary     string              `json:"summary,omitempty"`
+		Tags        []string            `json:"tags,omitempty"`
+		Parameters  []Parameter         `json:"parameters,omitempty"`
+		RequestBody *RequestBody        `json:"requestBody,omitempty"`
+		Responses   map[string]Response `json:"responses"`
+	}
+
+	Parameter struct {
+		Name        string         `json:"name"`
+		In          string         `json:"in"`
+		Description string         `json:"description,omitempty"`
+		Schema      map[string]any `json:"schema"`
+	}
+
+	RequestBody struct {
+		Content map[string]MediaType `json:"content"`
+	}
+
+	Response struct {
+		Description string               `json:"description"`
+		Content     map[string]MediaType `json:"content,omitempty"`
+	}
+
+	MediaType struct {
+		Schema map[string]any `json:"schema"`
+	}
+
+	Components struct {
+		SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+	}
+
+	SecurityScheme struct {
+		Type   string `json:"type"`
+		Scheme string `json:"scheme"`
+	}
+)
+
+// SchemaFunc returns the schemas declared for a module, or nil if there are none.
+type SchemaFunc func(namespace, module string) *metadata.Schema
+
+// Options changes what is generated. PathIdent is the ident used in the paths of operations, which is the one that
+// clients call e2core with. Authenticated adds a bearer token requirement to every operation.
+type Options struct {
+	PathIdent     string
+	Authenticated bool
+}
+
+const bearerScheme = "bearerAuth"
+
+// Generate creates a document with an operation for every module and workflow in the tenant config. schemas may be
+// nil.
+func Generate(cfg *tenant.Config, schemas SchemaFunc, opts Options) *Document {
+	if schemas == nil {
+		schemas = func(string, string) *metadata.Schema { return nil }
+	}
+
+	ident := opts.PathIdent
+	if ident == "" {
+		ident = cfg.Identifier
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:   cfg.Identifier,
+			Version: strconv.FormatInt(cfg.TenantVersion, 10),
+		},
+		Paths: map[string]*PathItem{},
+	}
+
+	if opts.Authenticated {
+		doc.Components = &Components{SecuritySchemes: map[string]SecurityScheme{bearerScheme: {Type: "http", Scheme: "bearer"}}}
+		doc.Security = []map[string][]string{{bearerScheme: {}}}
+	}
+
+	modules := make([]tenant.Module, len(cfg.Modules))
+	copy(modules, cfg.Modules)
+
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Namespace != modules[j].Namespace {
+			return modules[i].Namespace < modules[j].Namespace
+		}
+
+		return modules[i].Name < modules[j].Name
+	})
+
+	for _, mod := range modules {
+		path := fmt.Sprintf("/name/%s/%s/%s", ident, mod.Namespace, mod.Name)
+
+		doc.Paths[path] = &PathItem{Post: operation(
+			fmt.Sprintf("module.%s.%s", mod.Namespace, mod.Name),
+			fmt.Sprintf("Execute the %s module", mod.Name),
+			mod.Namespace,
+			schemas(mod.Namespace, mod.Name),
+			schemas(mod.Namespace, mod.Name),
+		)}
+	}
+
+	for _, ns := range append([]tenant.NamespaceConfig{cfg.DefaultNamespace}, cfg.Namespaces...) {
+		for _, wfl := range ns.Workflows {
+			path := fmt.Sprintf("/workflow/%s/%s/%s", ident, ns.Name, wfl.Name)
+
+			input, output := workflowSchemas(cfg, ns.Name, wfl, schemas)
+
+			doc.Paths[path] = &PathItem{Post: operation(
+				fmt.Sprintf("workflow.%s.%s", ns.Name, wfl.Name),
+				fmt.Sprintf("Execute the %s workflow", wfl.Name),
+				ns.Name,
+				input,
+				output,
+			)}
+		}
+	}
+
+	return doc
+}
+
+// workflowSchemas returns the schemas of the module that receives a workflow's input and of the one whose output is
+// the workflow's response.
+func workflowSchemas(cfg *tenant.Config, namespace string, wfl tenant.Workflow, schemas SchemaFunc) (*metadata.Schema, *metadata.Schema) {
+	find := func(refs ...string) *metadata.Schema {
+		for _, ref := range refs {
+			if mod, err := cfg.FindModule(ref); err == nil && mod != nil {
+				return schemas(mod.Namespace, mod.Name)
+			}
+		}
+
+		return nil
+	}
+
+	var input, output *metadata.Schema
+
+	if len(wfl.Steps) > 0 && wfl.Steps[0].IsSingle() {
+		input = find(wfl.Steps[0].FQMN)
+	}
+
+	if wfl.Response != "" {
+		output = find(wfl.Response, fmt.Sprintf("/name/%s/%s", namespace, wfl.Response))
+	} else if len(wfl.Steps) > 0 && wfl.Steps[len(wfl.Steps)-1].IsSingle() {
+		output = find(wfl.Steps[len(wfl.Steps)-1].FQMN)
+	}
+
+	return input, output
+}
+
+// operation describes the execution of a module or a workflow, whose input and output are those declared by the
+// given schemas, if any.
+func operation(id, summary, namespace string, input, output *metadata.Schema) *Operation {
+	return &Operation{
+		OperationID: id,
+		Summary:     summary,
+		Tags:        []string{namespace},
+		Parameters: []Parameter{
+			{Name: "X-E2Core-Timeout", In: "header", Description: "how long the execution may take, such as 5s", Schema: map[string]any{"type": "string"}},
+			{Name: "Prefer", In: "header", Description: "respond-async to execute in the background", Schema: map[string]any{"type": "string"}},
+		},
+		RequestBody: &RequestBody{Content: content(input, func(r *metadata.Schema) map[string]any { return r.Input })},
+		Responses: map[string]Response{
+			"200": {Description: "the execution's output", Content: content(output, func(r *metadata.Schema) map[string]any { return r.Output })},
+			"202": {Description: "the execution was started in the background"},
+			"default": {
+				Description: "the execution failed",
+				Content:     map[string]MediaType{"application/json": {Schema: errorSchema}},
+			},
+		},
+	}
+}
+
+// content is the JSON schema picked from the rule, or any bytes if there is none.
+func content(rule *metadata.Schema, pick func(*metadata.Schema) map[string]any) map[string]MediaType {
+	if rule != nil {
+		if schema := pick(rule); schema != nil {
+			return map[string]MediaType{"application/json": {Schema: schema}}
+		}
+	}
+
+	return map[string]MediaType{"application/octet-stream": {Schema: map[string]any{"type": "string", "format": "binary"}}}
+}
+
+// errorSchema matches the errors that e2core responds with.
+var errorSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"status":  map[string]any{"type": "integer"},
+		"message": map[string]any{"type": "string"},
+	},
+}
@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func testConfig() *tenant.Config {
+	return &tenant.Config{
+		Identifier:    "com.suborbital.app",
+		TenantVersion: 3,
+		DefaultNamespace: tenant.NamespaceConfig{
+			Name: "default",
+			Workflows: []tenant.Workflow{
+				{Name: "welcome", Steps: []tenant.WorkflowStep{
+					{FQMN: "fqmn://com.suborbital.app/default/greet@v1"},
+					{FQMN: "fqmn://com.suborbital.app/default/wave@v1"},
+				}},
+			},
+		},
+		Modules: []tenant.Module{
+			{Name: "wave", Namespace: "default", Ref: "v1", FQMN: "fqmn://com.suborbital.app/default/wave@v1"},
+			{Name: "greet", Namespace: "default", Ref: "v1", FQMN: "fqmn://com.suborbital.app/default/greet@v1"},
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	greetInput := map[string]any{"type": "object"}
+	waveOutput := map[string]any{"type": "string"}
+
+	schemas := func(namespace, module string) *metadata.Schema {
+		switch module {
+		case "greet":
+			return &metadata.Schema{Input: greetInput}
+		case "wave":
+			return &metadata.Schema{Output: waveOutput}
+		}
+
+		return nil
+	}
+
+	doc := Generate(testConfig(), schemas, Options{PathIdent: "app", Authenticated: true})
+
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Equal(t, Info{Title: "com.suborbital.app", Version: "3"}, doc.Info)
+	require.Len(t, doc.Paths, 3)
+
+	greet := doc.Paths["/name/app/default/greet"]
+	require.NotNil(t, greet)
+	assert.Equal(t, "module.default.greet", greet.Post.OperationID)
+	assert.Equal(t, greetInput, greet.Post.RequestBody.Content["application/json"].Schema)
+	assert.Contains(t, greet.Post.Responses["200"].Content, "application/octet-stream")
+
+	// a workflow takes the input of its first step and returns the output of its last.
+	welcome := doc.Paths["/workflow/app/default/welcome"]
+	require.NotNil(t, welcome)
+	assert.Equal(t, greetInput, welcome.Post.RequestBody.Content["application/json"].Schema)
+	assert.Equal(t, waveOutput, welcome.Post.Responses["200"].Content["application/json"].Schema)
+
+	require.NotNil(t, doc.Components)
+	assert.Contains(t, doc.Components.SecuritySchemes, bearerScheme)
+
+	_, err := json.Marshal(doc)
+	assert.NoError(t, err)
+}
+
+func TestGenerate_NoSchemas(t *testing.T) {
+	doc := Generate(testConfig(), nil, Options{})
+
+	require.Contains(t, doc.Paths, "/name/com.suborbital.app/default/wave")
+	assert.Nil(t, doc.Components)
+	assert.Nil(t, doc.Security)
+}
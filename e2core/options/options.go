@@ -17,19 +17,44 @@ const (
 
 // Options defines options for E2Core.
 type Options struct {
-	Features         []string      `env:"E2CORE_API_FEATURES"`
-	BundlePath       string        `env:"E2CORE_BUNDLE_PATH"`
-	RunSchedules     *bool         `env:"E2CORE_RUN_SCHEDULES,default=true"`
-	ControlPlane     string        `env:"E2CORE_CONTROL_PLANE"`
-	AuthCacheTTL     time.Duration `env:"E2CORE_AUTH_CACHE_TTL,default=10m"`
-	UpstreamAddress  string        `env:"E2CORE_UPSTREAM_ADDRESS"`
-	EnvironmentToken string        `env:"E2CORE_ENV_TOKEN"`
-	StaticPeers      string        `env:"E2CORE_PEERS"`
-	AppName          string        `env:"E2CORE_APP_NAME,default=E2Core"`
-	Domain           string        `env:"E2CORE_DOMAIN"`
-	HTTPPort         int           `env:"E2CORE_HTTP_PORT,default=8080"`
-	TLSPort          int           `env:"E2CORE_TLS_PORT,default=443"`
-	TracerConfig     TracerConfig  `env:",prefix=E2CORE_TRACER_"`
+	Features         []string       `env:"E2CORE_API_FEATURES"`
+	BundlePath       string         `env:"E2CORE_BUNDLE_PATH"`
+	RunSchedules     *bool          `env:"E2CORE_RUN_SCHEDULES,default=true"`
+	ControlPlane     string         `env:"E2CORE_CONTROL_PLANE"`
+	AuthCacheTTL     time.Duration  `env:"E2CORE_AUTH_CACHE_TTL,default=10m"`
+	UpstreamAddress  string         `env:"E2CORE_UPSTREAM_ADDRESS"`
+	EnvironmentToken string         `env:"E2CORE_ENV_TOKEN"`
+	StaticPeers      string         `env:"E2CORE_PEERS"`
+	AppName          string         `env:"E2CORE_APP_NAME,default=E2Core"`
+	Domain           string         `env:"E2CORE_DOMAIN"`
+	HTTPPort         int            `env:"E2CORE_HTTP_PORT,default=8080"`
+	TLSPort          int            `env:"E2CORE_TLS_PORT,default=443"`
+	GRPCPort         int            `env:"E2CORE_GRPC_PORT"`
+	TLSConfig        TLSConfig      `env:",prefix=E2CORE_TLS_"`
+	TracerConfig     TracerConfig   `env:",prefix=E2CORE_TRACER_"`
+	ShutdownConfig   ShutdownConfig `env:",prefix=E2CORE_SHUTDOWN_"`
+	MetricsConfig    MetricsConfig  `env:",prefix=E2CORE_METRICS_"`
+	BridgeConfig     BridgeConfig   `env:",prefix=E2CORE_BRIDGE_"`
+	AuditConfig      AuditConfig    `env:",prefix=E2CORE_AUDIT_"`
+	CallbackConfig   CallbackConfig `env:",prefix=E2CORE_CALLBACK_"`
+	AuthConfig       AuthConfig     `env:",prefix=E2CORE_AUTH_"`
+	MeshConfig       MeshConfig     `env:",prefix=E2CORE_MESH_"`
+
+	ExecutionStore     string        `env:"E2CORE_EXECUTION_STORE,default=memory"`
+	ExecutionStorePath string        `env:"E2CORE_EXECUTION_STORE_PATH"`
+	ExecutionRetention time.Duration `env:"E2CORE_EXECUTION_RETENTION,default=1h"`
+	ExecutionTimeout   time.Duration `env:"E2CORE_EXECUTION_TIMEOUT,default=10s"`
+	// ExecutionMaxPending is how many asynchronous executions may be running at once, further ones are refused.
+	ExecutionMaxPending int `env:"E2CORE_EXECUTION_MAX_PENDING,default=1000"`
+
+	BatchParallelism int `env:"E2CORE_BATCH_PARALLELISM,default=16"`
+	BatchMaxItems    int `env:"E2CORE_BATCH_MAX_ITEMS,default=10000"`
+
+	PolicyPath    string `env:"E2CORE_POLICY_PATH"`
+	SchedulesPath string `env:"E2CORE_SCHEDULES_PATH"`
+	TriggersPath  string `env:"E2CORE_TRIGGERS_PATH"`
+
+	AdminStorePath string `env:"E2CORE_ADMIN_STORE_PATH,default=.e2core/admin"`
 }
 
 // TracerConfig holds values specific to setting up the tracer. It's only used in proxy mode. All configuration options
@@ -42,6 +67,145 @@ type TracerConfig struct {
 	HoneycombConfig *HoneycombConfig `env:",prefix=HONEYCOMB_,noinit"`
 }
 
+// TLSConfig holds values for serving HTTPS on the TLS port. Setting CertFile and KeyFile, SelfSigned, or the Domain
+// option (which obtains a certificate using ACME) enables it. All configuration options have a prefix of E2CORE_TLS_
+// specified in the parent Options struct.
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM files that are loaded again when they change.
+	CertFile string `env:"CERT_FILE"`
+	KeyFile  string `env:"KEY_FILE"`
+	// SelfSigned serves a generated certificate, which is only useful for testing.
+	SelfSigned bool `env:"SELF_SIGNED"`
+	// ACMECacheDir is where certificates obtained using ACME are stored.
+	ACMECacheDir string `env:"ACME_CACHE_DIR,default=.e2core/autocert"`
+	// ACMEEmail is the contact address given to the ACME CA.
+	ACMEEmail string `env:"ACME_EMAIL"`
+	// Redirect makes the HTTP port redirect to HTTPS instead of serving requests while TLS is enabled.
+	Redirect bool `env:"REDIRECT,default=true"`
+}
+
+// ShutdownConfig holds how long each phase of a graceful shutdown may take before the next one is started anyway. All
+// configuration options have a prefix of E2CORE_SHUTDOWN_ specified in the parent Options struct.
+type ShutdownConfig struct {
+	// HTTPTimeout is how long in-flight HTTP and gRPC requests get to complete once no new ones are accepted.
+	HTTPTimeout time.Duration `env:"HTTP_TIMEOUT,default=10s"`
+	// DrainTimeout is how long executions that are not tied to a request (asynchronous ones, for example) get to
+	// complete.
+	DrainTimeout time.Duration `env:"DRAIN_TIMEOUT,default=30s"`
+	// BusTimeout is how long withdrawing from the bus mesh may take.
+	BusTimeout time.Duration `env:"BUS_TIMEOUT,default=5s"`
+	// BackendTimeout is how long sats get to exit.
+	BackendTimeout time.Duration `env:"BACKEND_TIMEOUT,default=15s"`
+	// SourceTimeout is how long the sourceserver gets to stop.
+	SourceTimeout time.Duration `env:"SOURCE_TIMEOUT,default=3s"`
+	// TracerTimeout is how long flushing buffered traces may take.
+	TracerTimeout time.Duration `env:"TRACER_TIMEOUT,default=5s"`
+}
+
+// Total returns the longest that a shutdown can take.
+func (c ShutdownConfig) Total() time.Duration {
+	return c.HTTPTimeout + c.DrainTimeout + c.BusTimeout + c.BackendTimeout + c.SourceTimeout + c.TracerTimeout
+}
+
+// MetricsConfig holds values for the Prometheus metrics endpoint. All configuration options have a prefix of
+// E2CORE_METRICS_ specified in the parent Options struct.
+type MetricsConfig struct {
+	// Enabled serves the metrics at /metrics on the HTTP port.
+	Enabled bool `env:"ENABLED,default=true"`
+	// AggregateSats adds the scheduler metrics that the orchestrator collects from sats to the metrics.
+	AggregateSats bool `env:"AGGREGATE_SATS,default=false"`
+}
+
+// BridgeConfig holds values for connecting the bus to a message broker, which topic triggers are run from. All
+// configuration options have a prefix of E2CORE_BRIDGE_ specified in the parent Options struct.
+type BridgeConfig struct {
+	// Type is the kind of broker, either nats or kafka. Leaving it empty disables the bridge and topic triggers.
+	Type string `env:"TYPE"`
+	// Address is the broker's address, such as nats://localhost:4222 or localhost:9092.
+	Address string `env:"ADDRESS"`
+}
+
+// AuditConfig holds values for recording every execution so that it can be looked up afterwards. All configuration
+// options have a prefix of E2CORE_AUDIT_ specified in the parent Options struct.
+type AuditConfig struct {
+	// Store is where executions are recorded: memory (a ring buffer of Capacity entries), disk (files under Path), or
+	// none.
+	Store    string `env:"STORE,default=memory"`
+	Path     string `env:"PATH,default=.e2core/audit"`
+	Capacity int    `env:"CAPACITY,default=10000"`
+	// Retention is how long executions are kept for. Zero keeps them until the memory store reaches its capacity, and
+	// for good in the disk store.
+	Retention time.Duration `env:"RETENTION,default=24h"`
+	// PayloadBytes is how much of each execution's input and output is recorded. Zero records only their sizes.
+	PayloadBytes int `env:"PAYLOAD_BYTES,default=0"`
+}
+
+// AuthConfig holds values for authorizing requests. All configuration options have a prefix of E2CORE_AUTH_ specified
+// in the parent Options struct.
+type AuthConfig struct {
+	// Mode is how tokens are checked: remote (by the control plane), apikey (against the keys in KeysPath), jwt
+	// (verified against JWKS), or disabled, which lets every request through and is only meant for local development.
+	Mode string `env:"MODE,default=remote"`
+	// KeysPath is a YAML or JSON file of API keys, used by the apikey mode.
+	KeysPath string `env:"KEYS_PATH"`
+
+	// JWKS is the file or URL of the JSON Web Key Set that the jwt mode verifies tokens with. It is loaded again every
+	// JWKSRefresh.
+	JWKS        string        `env:"JWKS"`
+	JWKSRefresh time.Duration `env:"JWKS_REFRESH,default=5m"`
+	// Audience and Issuer must match the aud and iss claims of tokens when they are set.
+	Audience string `env:"AUDIENCE"`
+	Issuer   string `env:"ISSUER"`
+	// JWTLeeway allows for clock skew when checking the exp and nbf claims.
+	JWTLeeway time.Duration `env:"JWT_LEEWAY,default=30s"`
+	// TenantClaim, TenantNameClaim and EnvironmentClaim name the claims that hold the tenant's ID and name, and the
+	// environment it belongs to.
+	TenantClaim      string `env:"TENANT_CLAIM,default=tenant"`
+	TenantNameClaim  string `env:"TENANT_NAME_CLAIM,default=tenant_name"`
+	EnvironmentClaim string `env:"ENVIRONMENT_CLAIM,default=environment"`
+	// ScopeClaim names the claim that limits a token to scopes, either as a space separated string or an array. It is
+	// not the standard scope claim, since identity providers fill that with OAuth scopes such as openid, which would
+	// limit a token to nothing.
+	ScopeClaim string `env:"SCOPE_CLAIM,default=e2core_scope"`
+
+	// CacheSize is the most authorization decisions that are cached, the least recently used being evicted first.
+	CacheSize int `env:"CACHE_SIZE,default=10000"`
+	// CacheDeniedTTL is how long denied credentials are remembered, so that they are not checked again on every
+	// request. Zero turns it off.
+	CacheDeniedTTL time.Duration `env:"CACHE_DENIED_TTL,default=30s"`
+	// CacheRefreshAhead is how long before a cached decision expires that it is checked again in the background, while
+	// the cached one keeps being used. Zero turns it off.
+	CacheRefreshAhead time.Duration `env:"CACHE_REFRESH_AHEAD,default=1m"`
+}
+
+// MeshConfig holds values for authenticating the sats that join the bus mesh. KeyPath is a PEM encoded PKCS #8 Ed25519
+// private key that sats' join tokens are signed with; if it is not set, a key is generated for every run. Join tokens
+// are valid for TokenTTL, and are renewed halfway through. All configuration options have a prefix of E2CORE_MESH_
+// specified in the parent Options struct.
+type MeshConfig struct {
+	KeyPath  string        `env:"KEY_PATH"`
+	TokenTTL time.Duration `env:"TOKEN_TTL,default=1h"`
+}
+
+// CallbackConfig holds values for POSTing the results of asynchronous executions to the callback URL that was given for
+// them. Callbacks are signed with a secret derived from Secret for each tenant, and are only sent if it is set. Attempts
+// that fail are retried up to Attempts times in total, waiting Backoff before the first retry and twice as long before
+// each one after it, up to MaxBackoff.
+// The remaining fields restrict where callbacks can be sent, the same way as the rules of the HTTP capability. All
+// configuration options have a prefix of E2CORE_CALLBACK_ specified in the parent Options struct.
+type CallbackConfig struct {
+	Secret     string        `env:"SECRET"`
+	Attempts   int           `env:"ATTEMPTS,default=5"`
+	Backoff    time.Duration `env:"BACKOFF,default=1s"`
+	MaxBackoff time.Duration `env:"MAX_BACKOFF,default=1m"`
+
+	AllowedDomains []string `env:"ALLOWED_DOMAINS"`
+	BlockedDomains []string `env:"BLOCKED_DOMAINS"`
+	AllowIPs       bool     `env:"ALLOW_IPS,default=false"`
+	AllowPrivate   bool     `env:"ALLOW_PRIVATE,default=false"`
+	AllowHTTP      bool     `env:"ALLOW_HTTP,default=false"`
+}
+
 // CollectorConfig holds config values specific to the collector tracer exporter running locally / within your cluster.
 // All the configuration values here have a prefix of E2CORE_TRACER_COLLECTOR_, specified in the top level Options struct,
 // and the parent TracerConfig struct.
@@ -110,6 +274,25 @@ func TLSPort(port int) Modifier {
 	}
 }
 
+// GRPCPort sets the port that the gRPC execution service listens on, 0 disables it. It serves TLS whenever the HTTP
+// server does.
+func GRPCPort(port int) Modifier {
+	return func(opts *Options) {
+		opts.GRPCPort = port
+	}
+}
+
+// FeatureEnabled returns true if the named feature was enabled with E2CORE_API_FEATURES.
+func (o *Options) FeatureEnabled(name string) bool {
+	for _, f := range o.Features {
+		if strings.TrimSpace(f) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 // finalize "locks in" the options by overriding any existing options with the version from the environment, and setting the default logger if needed.
 func (o *Options) finalize() error {
 	envOpts := Options{}
@@ -147,6 +330,11 @@ func (o *Options) finalize() error {
 		o.TLSPort = envOpts.TLSPort
 	}
 
+	// set GRPCPort if it was not passed as a flag.
+	if o.GRPCPort == 0 {
+		o.GRPCPort = envOpts.GRPCPort
+	}
+
 	o.Features = envOpts.Features
 	o.EnvironmentToken = ""
 	o.TracerConfig = TracerConfig{}
@@ -154,6 +342,29 @@ func (o *Options) finalize() error {
 
 	o.EnvironmentToken = envOpts.EnvironmentToken
 	o.TracerConfig = envOpts.TracerConfig
+	o.TLSConfig = envOpts.TLSConfig
+	o.ShutdownConfig = envOpts.ShutdownConfig
+	o.MetricsConfig = envOpts.MetricsConfig
+	o.BridgeConfig = envOpts.BridgeConfig
+	o.AuditConfig = envOpts.AuditConfig
+	o.CallbackConfig = envOpts.CallbackConfig
+	o.AuthConfig = envOpts.AuthConfig
+	o.MeshConfig = envOpts.MeshConfig
+
+	o.ExecutionStore = envOpts.ExecutionStore
+	o.ExecutionStorePath = envOpts.ExecutionStorePath
+	o.ExecutionRetention = envOpts.ExecutionRetention
+	o.ExecutionTimeout = envOpts.ExecutionTimeout
+	o.ExecutionMaxPending = envOpts.ExecutionMaxPending
+
+	o.BatchParallelism = envOpts.BatchParallelism
+	o.BatchMaxItems = envOpts.BatchMaxItems
+
+	o.PolicyPath = envOpts.PolicyPath
+	o.SchedulesPath = envOpts.SchedulesPath
+	o.TriggersPath = envOpts.TriggersPath
+
+	o.AdminStorePath = envOpts.AdminStorePath
 
 	return nil
 }
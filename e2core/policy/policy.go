@@ -0,0 +1,238 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/e2core/e2core/options"
+)
+
+const (
+	PerTenant    = "tenant"
+	PerNamespace = "namespace"
+	PerModule    = "module"
+)
+
+// Policy holds limits for modules that are configured locally rather than through the tenant config, which has no
+// place for them.
+type Policy struct {
+	Modules []ModuleRule `yaml:"modules" json:"modules"`
+	Limits  []LimitRule  `yaml:"limits" json:"limits"`
+	Access  []AccessRule `yaml:"access" json:"access"`
+}
+
+// ModuleRule applies limits to the modules it matches. Ident, Namespace, and Module each match either exactly, or any
+// value when empty or "*". Rules are evaluated in order and the first match wins.
+type ModuleRule struct {
+	Ident     string     `yaml:"ident" json:"ident"`
+	Namespace string     `yaml:"namespace" json:"namespace"`
+	Module    string     `yaml:"module" json:"module"`
+	Cache     *CacheRule `yaml:"cache,omitempty" json:"cache,omitempty"`
+	// CallbackURL receives the results of asynchronous executions that were not given a callback URL of their own.
+	// Module matches the name of a workflow as well as of a module.
+	CallbackURL string `yaml:"callbackURL,omitempty" json:"callbackURL,omitempty"`
+}
+
+// CacheRule turns on response caching for modules whose output depends only on their input. Responses are keyed on
+// the request's method, body, and the listed Headers, and are kept for TTL. At most MaxEntries responses are kept for
+// each module, the oldest being evicted first; zero means the default of 1000.
+type CacheRule struct {
+	TTL        time.Duration `yaml:"ttl" json:"ttl"`
+	MaxEntries int           `yaml:"maxEntries" json:"maxEntries"`
+	Headers    []string      `yaml:"headers" json:"headers"`
+}
+
+// LimitRule sets quotas for the executions of the modules it matches, which are matched the same way as for
+// ModuleRule. Unlike ModuleRules, every matching LimitRule applies. Per sets whether every tenant, namespace, or module
+// matched by the rule gets its own quota, and defaults to module. RPS is the sustained number of executions per second,
+// allowing bursts of up to Burst, and Concurrency is the maximum number of executions in flight. Zero means unlimited.
+// LimitRules are a fallback for modules whose metadata in the tenant config sets no limits of their own.
+type LimitRule struct {
+	Ident       string  `yaml:"ident" json:"ident"`
+	Namespace   string  `yaml:"namespace" json:"namespace"`
+	Module      string  `yaml:"module" json:"module"`
+	Per         string  `yaml:"per" json:"per"`
+	RPS         float64 `yaml:"rps" json:"rps"`
+	Burst       int     `yaml:"burst" json:"burst"`
+	Concurrency int     `yaml:"concurrency" json:"concurrency"`
+}
+
+// AccessRule limits the credentials of the tenants it matches to Scopes, in the form described by auth.Scopes, on top
+// of any scopes that the credentials carry themselves. Ident matches the tenant, and AuthorizedParty the party that the
+// credentials were issued to, each either exactly or any value when empty or "*". Rules are evaluated in order and
+// the first match wins.
+type AccessRule struct {
+	Ident           string   `yaml:"ident" json:"ident"`
+	AuthorizedParty string   `yaml:"authorizedParty" json:"authorizedParty"`
+	Scopes          []string `yaml:"scopes" json:"scopes"`
+}
+
+// Limit is a quota that applies to an execution. Executions with the same Key share the quota.
+type Limit struct {
+	Key         string
+	RPS         float64
+	Burst       int
+	Concurrency int
+}
+
+// NewLimit creates the Limit with the given key and quotas. A Burst of zero allows bursts as big as one second's
+// worth of RPS.
+func NewLimit(key string, rps float64, burst, concurrency int) Limit {
+	if burst == 0 && rps > 0 {
+		burst = int(math.Max(1, math.Ceil(rps)))
+	}
+
+	return Limit{
+		Key:         key,
+		RPS:         rps,
+		Burst:       burst,
+		Concurrency: concurrency,
+	}
+}
+
+// Load reads a YAML (or JSON) policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile")
+	}
+
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, errors.Wrap(err, "yaml.Unmarshal")
+	}
+
+	for i, rule := range p.Modules {
+		if rule.Cache != nil && (rule.Cache.TTL <= 0 || rule.Cache.MaxEntries < 0) {
+			return nil, fmt.Errorf("module %d: cache ttl must be positive and maxEntries must not be negative", i)
+		}
+	}
+
+	for i, rule := range p.Limits {
+		switch rule.Per {
+		case PerTenant, PerNamespace, PerModule, "":
+		default:
+			return nil, fmt.Errorf("limit %d: per must be one of %s, %s, or %s", i, PerTenant, PerNamespace, PerModule)
+		}
+
+		if rule.RPS < 0 || rule.Burst < 0 || rule.Concurrency < 0 {
+			return nil, fmt.Errorf("limit %d: limits must not be negative", i)
+		}
+	}
+
+	for i, rule := range p.Access {
+		if len(rule.Scopes) == 0 {
+			return nil, fmt.Errorf("access %d: scopes must be set", i)
+		}
+
+		for _, scope := range rule.Scopes {
+			if err := auth.ValidateScope(scope); err != nil {
+				return nil, errors.Wrapf(err, "access %d", i)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// FromOptions loads the policy file configured in opts, returning an empty policy if there is none.
+func FromOptions(opts *options.Options) (*Policy, error) {
+	if opts.PolicyPath == "" {
+		return &Policy{}, nil
+	}
+
+	p, err := Load(opts.PolicyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Load %s", opts.PolicyPath)
+	}
+
+	return p, nil
+}
+
+// ModuleCache returns the cache rule for a module, or nil if its responses are not cached.
+func (p *Policy) ModuleCache(ident, namespace, module string) *CacheRule {
+	if rule := p.match(ident, namespace, module, func(r ModuleRule) bool { return r.Cache != nil }); rule != nil {
+		return rule.Cache
+	}
+
+	return nil
+}
+
+// ModuleCallback returns the callback URL configured for a module or workflow, or an empty string if there is none.
+func (p *Policy) ModuleCallback(ident, namespace, name string) string {
+	if rule := p.match(ident, namespace, name, func(r ModuleRule) bool { return r.CallbackURL != "" }); rule != nil {
+		return rule.CallbackURL
+	}
+
+	return ""
+}
+
+// TenantScopes returns the scopes of the first access rule that matches the tenant, or nil if none does. It is used as
+// an auth.ScopeSource.
+func (p *Policy) TenantScopes(tenant *auth.TenantInfo) auth.Scopes {
+	if p == nil {
+		return nil
+	}
+
+	for _, rule := range p.Access {
+		if matches(rule.Ident, tenant.ID) && matches(rule.AuthorizedParty, tenant.AuthorizedParty) {
+			return rule.Scopes
+		}
+	}
+
+	return nil
+}
+
+// ModuleLimits returns the quotas of every rule that matches the module.
+func (p *Policy) ModuleLimits(ident, namespace, module string) []Limit {
+	if p == nil {
+		return nil
+	}
+
+	var limits []Limit
+
+	for i, rule := range p.Limits {
+		if !matches(rule.Ident, ident) || !matches(rule.Namespace, namespace) || !matches(rule.Module, module) {
+			continue
+		}
+
+		var scope string
+		switch rule.Per {
+		case PerTenant:
+			scope = ident
+		case PerNamespace:
+			scope = ident + "/" + namespace
+		default:
+			scope = ident + "/" + namespace + "/" + module
+		}
+
+		limits = append(limits, NewLimit(fmt.Sprintf("%d:%s", i, scope), rule.RPS, rule.Burst, rule.Concurrency))
+	}
+
+	return limits
+}
+
+// match returns the first rule matching the module that also satisfies applies.
+func (p *Policy) match(ident, namespace, module string, applies func(ModuleRule) bool) *ModuleRule {
+	if p == nil {
+		return nil
+	}
+
+	for i, rule := range p.Modules {
+		if matches(rule.Ident, ident) && matches(rule.Namespace, namespace) && matches(rule.Module, module) && applies(rule) {
+			return &p.Modules[i]
+		}
+	}
+
+	return nil
+}
+
+func matches(pattern, value string) bool {
+	return pattern == "" || pattern == "*" || pattern == value
+}
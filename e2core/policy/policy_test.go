@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/auth"
+)
+
+const testLimitsPolicy = `
+limits:
+  - ident: "*"
+    per: tenant
+    rps: 100
+  - ident: com.suborbital.app
+    module: noisy
+    concurrency: 2
+    rps: 0.5
+    burst: 3
+`
+
+func TestModuleLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testLimitsPolicy), 0600))
+
+	p, err := Load(path)
+	require.NoError(t, err)
+
+	limits := p.ModuleLimits("com.suborbital.app", "default", "noisy")
+	assert.Equal(t, []Limit{
+		{Key: "0:com.suborbital.app", RPS: 100, Burst: 100},
+		{Key: "1:com.suborbital.app/default/noisy", RPS: 0.5, Burst: 3, Concurrency: 2},
+	}, limits)
+
+	limits = p.ModuleLimits("com.suborbital.other", "default", "noisy")
+	assert.Equal(t, []Limit{{Key: "0:com.suborbital.other", RPS: 100, Burst: 100}}, limits)
+
+	var nilPolicy *Policy
+	assert.Empty(t, nilPolicy.ModuleLimits("com.suborbital.app", "default", "noisy"))
+}
+
+func TestLoad_InvalidLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("limits:\n  - per: everyone\n"), 0600))
+
+	_, err := Load(path)
+	assert.Error(t, err)
+}
+
+const testCachePolicy = `
+modules:
+  - ident: com.suborbital.app
+    module: slow
+    callbackURL: https://example.com/callback
+  - ident: com.suborbital.app
+    module: "*"
+    cache:
+      ttl: 5m
+      maxEntries: 100
+      headers: [Accept]
+`
+
+func TestModuleCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testCachePolicy), 0600))
+
+	p, err := Load(path)
+	require.NoError(t, err)
+
+	want := &CacheRule{TTL: 5 * time.Minute, MaxEntries: 100, Headers: []string{"Accept"}}
+
+	// rules without a cache are skipped, so the first rule setting one applies.
+	assert.Equal(t, want, p.ModuleCache("com.suborbital.app", "default", "slow"))
+	assert.Equal(t, want, p.ModuleCache("com.suborbital.app", "default", "hash"))
+	assert.Nil(t, p.ModuleCache("com.suborbital.other", "default", "hash"))
+
+	require.NoError(t, os.WriteFile(path, []byte("modules:\n  - cache:\n      maxEntries: 10\n"), 0600))
+
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestTenantScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+access:
+  - ident: com.suborbital.app
+    authorizedParty: partner
+    scopes: ["execute:default/licensed-*"]
+  - ident: com.suborbital.app
+    scopes: ["*"]
+`), 0600))
+
+	p, err := Load(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, auth.Scopes{"execute:default/licensed-*"}, p.TenantScopes(&auth.TenantInfo{ID: "com.suborbital.app", AuthorizedParty: "partner"}))
+	assert.Equal(t, auth.Scopes{"*"}, p.TenantScopes(&auth.TenantInfo{ID: "com.suborbital.app", AuthorizedParty: "dashboard"}))
+	assert.Nil(t, p.TenantScopes(&auth.TenantInfo{ID: "com.suborbital.other"}))
+
+	var nilPolicy *Policy
+	assert.Nil(t, nilPolicy.TenantScopes(&auth.TenantInfo{ID: "com.suborbital.app"}))
+}
+
+func TestLoad_InvalidAccess(t *testing.T) {
+	for name, policy := range map[string]string{
+		"no scopes":     "access:\n  - ident: com.suborbital.app\n",
+		"unknown scope": "access:\n  - scopes: [\"deploy\"]\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(policy), 0600))
+
+			_, err := Load(path)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v23.4.0
+// source: e2core/rpc/e2core.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Execution_Execute_FullMethodName         = "/e2core.rpc.v1.Execution/Execute"
+	Execution_ExecuteWorkflow_FullMethodName = "/e2core.rpc.v1.Execution/ExecuteWorkflow"
+	Execution_ExecuteStream_FullMethodName   = "/e2core.rpc.v1.Execution/ExecuteStream"
+)
+
+// ExecutionClient is the client API for Execution service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ExecutionClient interface {
+	// Execute runs a single module.
+	Execute(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecuteResponse, error)
+	// ExecuteWorkflow runs a workflow from the tenant's configuration.
+	ExecuteWorkflow(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecuteResponse, error)
+	// ExecuteStream runs a module for every request sent on the stream. Responses carry the ID of the request they
+	// belong to and may arrive in a different order than the requests were sent. Failed executions are reported in the
+	// response's error rather than ending the stream.
+	ExecuteStream(ctx context.Context, opts ...grpc.CallOption) (Execution_ExecuteStreamClient, error)
+}
+
+type executionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExecutionClient(cc grpc.ClientConnInterface) ExecutionClient {
+	return &executionClient{cc}
+}
+
+func (c *executionClient) Execute(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecuteResponse, error) {
+	out := new(ExecuteResponse)
+	err := c.cc.Invoke(ctx, Execution_Execute_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executionClient) ExecuteWorkflow(ctx context.Context, in *ExecuteRequest, opts ...grpc.CallOption) (*ExecuteResponse, error) {
+	out := new(ExecuteResponse)
+	err := c.cc.Invoke(ctx, Execution_ExecuteWorkflow_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *executionClient) ExecuteStream(ctx context.Context, opts ...grpc.CallOption) (Execution_ExecuteStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Execution_ServiceDesc.Streams[0], Execution_ExecuteStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &executionExecuteStreamClient{stream}
+	return x, nil
+}
+
+type Execution_ExecuteStreamClient interface {
+	Send(*ExecuteRequest) error
+	Recv() (*ExecuteResponse, error)
+	grpc.ClientStream
+}
+
+type executionExecuteStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *executionExecuteStreamClient) Send(m *ExecuteRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *executionExecuteStreamClient) Recv() (*ExecuteResponse, error) {
+	m := new(ExecuteResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ExecutionServer is the server API for Execution service.
+// All implementations must embed UnimplementedExecutionServer
+// for forward compatibility
+type ExecutionServer interface {
+	// Execute runs a single module.
+	Execute(context.Context, *ExecuteRequest) (*ExecuteResponse, error)
+	// ExecuteWorkflow runs a workflow from the tenant's configuration.
+	ExecuteWorkflow(context.Context, *ExecuteRequest) (*ExecuteResponse, error)
+	// ExecuteStream runs a module for every request sent on the stream. Responses carry the ID of the request they
+	// belong to and may arrive in a different order than the requests were sent. Failed executions are reported in the
+	// response's error rather than ending the stream.
+	ExecuteStream(Execution_ExecuteStreamServer) error
+	mustEmbedUnimplementedExecutionServer()
+}
+
+// UnimplementedExecutionServer must be embedded to have forward compatible implementations.
+type UnimplementedExecutionServer struct {
+}
+
+func (UnimplementedExecutionServer) Execute(context.Context, *ExecuteRequest) (*ExecuteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Execute not implemented")
+}
+func (UnimplementedExecutionServer) ExecuteWorkflow(context.Context, *ExecuteRequest) (*ExecuteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecuteWorkflow not implemented")
+}
+func (UnimplementedExecutionServer) ExecuteStream(Execution_ExecuteStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExecuteStream not implemented")
+}
+func (UnimplementedExecutionServer) mustEmbedUnimplementedExecutionServer() {}
+
+// UnsafeExecutionServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ExecutionServer will
+// result in compilation errors.
+type UnsafeExecutionServer interface {
+	mustEmbedUnimplementedExecutionServer()
+}
+
+func RegisterExecutionServer(s grpc.ServiceRegistrar, srv ExecutionServer) {
+	s.RegisterService(&Execution_ServiceDesc, srv)
+}
+
+func _Execution_Execute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutionServer).Execute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Execution_Execute_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutionServer).Execute(ctx, req.(*ExecuteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Execution_ExecuteWorkflow_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExecutionServer).ExecuteWorkflow(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Execution_ExecuteWorkflow_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExecutionServer).ExecuteWorkflow(ctx, req.(*ExecuteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Execution_ExecuteStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ExecutionServer).ExecuteStream(&executionExecuteStreamServer{stream})
+}
+
+type Execution_ExecuteStreamServer interface {
+	Send(*ExecuteResponse) error
+	Recv() (*ExecuteRequest, error)
+	grpc.ServerStream
+}
+
+type executionExecuteStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *executionExecuteStreamServer) Send(m *ExecuteResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *executionExecuteStreamServer) Recv() (*ExecuteRequest, error) {
+	m := new(ExecuteRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Execution_ServiceDesc is the grpc.ServiceDesc for Execution service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Execution_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "e2core.rpc.v1.Execution",
+	HandlerType: (*ExecutionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Execute",
+			Handler:    _Execution_Execute_Handler,
+		},
+		{
+			MethodName: "ExecuteWorkflow",
+			Handler:    _Execution_ExecuteWorkflow_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExecuteStream",
+			Handler:       _Execution_ExecuteStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "e2core/rpc/e2core.proto",
+}
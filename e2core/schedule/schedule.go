@@ -0,0 +1,247 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/fqmn"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const (
+	SourceTenant = "tenant"
+	SourceFile   = "file"
+)
+
+// File is the local schedules file, which holds schedules in addition to the ones in tenant config.
+type File struct {
+	Schedules []Definition `yaml:"schedules" json:"schedules"`
+}
+
+// Definition describes when to execute a module or a workflow. Exactly one of Module and Workflow, and exactly one of
+// Every, After, and Cron (a standard five field cron expression) must be set. Every schedules run once when they are
+// registered, and then at every interval. Body is used as the body of every execution, and State as its initial
+// state.
+type Definition struct {
+	Name      string            `yaml:"name" json:"name"`
+	Ident     string            `yaml:"ident" json:"ident"`
+	Namespace string            `yaml:"namespace" json:"namespace"`
+	Module    string            `yaml:"module,omitempty" json:"module,omitempty"`
+	Workflow  string            `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+	Every     time.Duration     `yaml:"every,omitempty" json:"every,omitempty"`
+	After     time.Duration     `yaml:"after,omitempty" json:"after,omitempty"`
+	Cron      string            `yaml:"cron,omitempty" json:"cron,omitempty"`
+	Body      string            `yaml:"body,omitempty" json:"body,omitempty"`
+	State     map[string]string `yaml:"state,omitempty" json:"state,omitempty"`
+
+	// Steps replaces the steps of the workflow, if set. Only tenant config can set it.
+	Steps []tenant.WorkflowStep `yaml:"-" json:"-"`
+}
+
+// Load reads a YAML (or JSON) schedules file.
+func Load(path string) ([]Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile")
+	}
+
+	f := &File{}
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, errors.Wrap(err, "yaml.Unmarshal")
+	}
+
+	names := map[string]struct{}{}
+
+	for i := range f.Schedules {
+		def := &f.Schedules[i]
+
+		if def.Namespace == "" {
+			def.Namespace = fqmn.NamespaceDefault
+		}
+
+		if err := def.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "schedule %d", i)
+		}
+
+		key := def.Ident + "/" + def.Name
+		if _, exists := names[key]; exists {
+			return nil, fmt.Errorf("schedule %d: %s is defined more than once for %s", i, def.Name, def.Ident)
+		}
+
+		names[key] = struct{}{}
+	}
+
+	return f.Schedules, nil
+}
+
+// FromOptions loads the schedules file configured in opts, returning no schedules if there is none.
+func FromOptions(opts *options.Options) ([]Definition, error) {
+	if opts.SchedulesPath == "" {
+		return nil, nil
+	}
+
+	defs, err := Load(opts.SchedulesPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Load %s", opts.SchedulesPath)
+	}
+
+	return defs, nil
+}
+
+// FromTenant returns the schedules of the workflows in a tenant's config. They are named after their workflow.
+func FromTenant(ident string, config *tenant.Config) []Definition {
+	if config == nil {
+		return nil
+	}
+
+	var defs []Definition
+
+	namespaces := append([]tenant.NamespaceConfig{config.DefaultNamespace}, config.Namespaces...)
+
+	for _, ns := range namespaces {
+		for _, wfl := range ns.Workflows {
+			if wfl.Schedule == nil || wfl.Schedule.NumberOfSeconds() <= 0 {
+				continue
+			}
+
+			defs = append(defs, Definition{
+				Name:      wfl.Name,
+				Ident:     ident,
+				Namespace: ns.Name,
+				Workflow:  wfl.Name,
+				Every:     time.Duration(wfl.Schedule.NumberOfSeconds()) * time.Second,
+				State:     wfl.Schedule.State,
+				Steps:     wfl.Schedule.Steps,
+			})
+		}
+	}
+
+	return defs
+}
+
+// Validate checks that the definition says what to execute and when.
+func (d Definition) Validate() error {
+	if d.Name == "" || d.Ident == "" {
+		return errors.New("name and ident must be set")
+	}
+
+	if (d.Module == "") == (d.Workflow == "") {
+		return errors.New("exactly one of module and workflow must be set")
+	}
+
+	set := 0
+	for _, isSet := range []bool{d.Every != 0, d.After != 0, d.Cron != ""} {
+		if isSet {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return errors.New("exactly one of every, after, and cron must be set")
+	}
+
+	if d.Every < 0 || d.After < 0 {
+		return errors.New("every and after must not be negative")
+	}
+
+	if d.Cron != "" {
+		if _, err := cron.ParseStandard(d.Cron); err != nil {
+			return errors.Wrap(err, "cron.ParseStandard")
+		}
+	}
+
+	return nil
+}
+
+// Schedule returns a scheduler.Schedule that produces the jobs returned by jobFunc at the times the definition asks
+// for.
+func (d Definition) Schedule(jobFunc func() scheduler.Job) (scheduler.Schedule, error) {
+	switch {
+	case d.Cron != "":
+		spec, err := cron.ParseStandard(d.Cron)
+		if err != nil {
+			return nil, errors.Wrap(err, "cron.ParseStandard")
+		}
+
+		return &cronSchedule{spec: spec, next: spec.Next(time.Now()), jobFunc: jobFunc}, nil
+	case d.After > 0:
+		return scheduler.After(seconds(d.After), jobFunc), nil
+	case d.Every > 0:
+		return scheduler.Every(seconds(d.Every), jobFunc), nil
+	}
+
+	return nil, errors.New("definition has no every, after, or cron")
+}
+
+// Next returns when the schedule will run next, given when it was registered and when it last ran (if it has), or nil
+// if it will not run again.
+func (d Definition) Next(registered time.Time, lastRun *time.Time, now time.Time) *time.Time {
+	var next time.Time
+
+	switch {
+	case d.Cron != "":
+		spec, err := cron.ParseStandard(d.Cron)
+		if err != nil {
+			return nil
+		}
+
+		next = spec.Next(now)
+	case d.After > 0:
+		if lastRun != nil {
+			return nil
+		}
+
+		next = registered.Add(time.Duration(seconds(d.After)) * time.Second)
+	case d.Every > 0:
+		if lastRun == nil {
+			next = registered
+		} else {
+			next = lastRun.Add(time.Duration(seconds(d.Every)) * time.Second)
+		}
+	default:
+		return nil
+	}
+
+	return &next
+}
+
+// seconds rounds d up to whole seconds, which is the resolution of scheduler schedules.
+func seconds(d time.Duration) int {
+	s := int((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		return 1
+	}
+
+	return s
+}
+
+// cronSchedule produces a job whenever a cron expression's next time has passed.
+type cronSchedule struct {
+	spec    cron.Schedule
+	next    time.Time
+	jobFunc func() scheduler.Job
+}
+
+func (c *cronSchedule) Check() *scheduler.Job {
+	now := time.Now()
+	if now.Before(c.next) {
+		return nil
+	}
+
+	c.next = c.spec.Next(now)
+
+	job := c.jobFunc()
+
+	return &job
+}
+
+func (c *cronSchedule) Done() bool {
+	return false
+}
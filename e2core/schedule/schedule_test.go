@@ -0,0 +1,112 @@
+package schedule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+schedules:
+  - name: cleanup
+    ident: com.suborbital.test
+    module: cleanup
+    every: 1h
+  - name: report
+    ident: com.suborbital.test
+    namespace: reports
+    workflow: daily
+    cron: "0 3 * * *"
+    body: '{"format":"pdf"}'
+`), 0600))
+
+	defs, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, defs, 2)
+
+	assert.Equal(t, "default", defs[0].Namespace)
+	assert.Equal(t, time.Hour, defs[0].Every)
+	assert.Equal(t, "0 3 * * *", defs[1].Cron)
+	assert.Equal(t, `{"format":"pdf"}`, defs[1].Body)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		def  Definition
+	}{
+		{name: "no name", def: Definition{Ident: "a", Module: "m", Every: time.Second}},
+		{name: "module and workflow", def: Definition{Name: "n", Ident: "a", Module: "m", Workflow: "w", Every: time.Second}},
+		{name: "nothing to execute", def: Definition{Name: "n", Ident: "a", Every: time.Second}},
+		{name: "no timing", def: Definition{Name: "n", Ident: "a", Module: "m"}},
+		{name: "two timings", def: Definition{Name: "n", Ident: "a", Module: "m", Every: time.Second, Cron: "* * * * *"}},
+		{name: "invalid cron", def: Definition{Name: "n", Ident: "a", Module: "m", Cron: "every day"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.def.Validate())
+		})
+	}
+}
+
+func TestFromTenant(t *testing.T) {
+	config := &tenant.Config{
+		DefaultNamespace: tenant.NamespaceConfig{
+			Name: "default",
+			Workflows: []tenant.Workflow{
+				{Name: "unscheduled"},
+				{Name: "cleanup", Schedule: &tenant.Schedule{
+					Every: tenant.ScheduleEvery{Minutes: 5},
+					State: map[string]string{"mode": "full"},
+				}},
+			},
+		},
+		Namespaces: []tenant.NamespaceConfig{
+			{Name: "reports", Workflows: []tenant.Workflow{
+				{Name: "daily", Schedule: &tenant.Schedule{Every: tenant.ScheduleEvery{Days: 1}}},
+			}},
+		},
+	}
+
+	defs := FromTenant("com.suborbital.test", config)
+	require.Len(t, defs, 2)
+
+	assert.Equal(t, Definition{
+		Name:      "cleanup",
+		Ident:     "com.suborbital.test",
+		Namespace: "default",
+		Workflow:  "cleanup",
+		Every:     5 * time.Minute,
+		State:     map[string]string{"mode": "full"},
+	}, defs[0])
+
+	assert.Equal(t, "reports", defs[1].Namespace)
+	assert.Equal(t, 24*time.Hour, defs[1].Every)
+}
+
+func TestNext(t *testing.T) {
+	registered := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	lastRun := registered.Add(time.Minute)
+	now := lastRun.Add(time.Second)
+
+	every := Definition{Every: 10 * time.Minute}
+	assert.Equal(t, registered, *every.Next(registered, nil, now))
+	assert.Equal(t, lastRun.Add(10*time.Minute), *every.Next(registered, &lastRun, now))
+
+	after := Definition{After: 30 * time.Second}
+	assert.Equal(t, registered.Add(30*time.Second), *after.Next(registered, nil, now))
+	assert.Nil(t, after.Next(registered, &lastRun, now))
+
+	cron := Definition{Cron: "0 3 * * *"}
+	assert.Equal(t, time.Date(2023, 8, 2, 3, 0, 0, 0, time.UTC), *cron.Next(registered, &lastRun, now))
+}
@@ -0,0 +1,61 @@
+package sequence
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// StatusHeader is a reserved response header that a module sets (directly or with the resp_set_status host
+	// function) to choose the HTTP status code of the response. It is not passed on as a header of HTTP responses.
+	StatusHeader = "X-Suborbital-Status"
+
+	// DefaultContentType is used for responses whose modules did not set a Content-Type.
+	DefaultContentType = "application/octet-stream"
+)
+
+// ResponseMeta is what the modules of a sequence asked for their response to look like, beyond its body.
+type ResponseMeta struct {
+	Status      int
+	ContentType string
+	Headers     map[string]string
+}
+
+// NewResponseMeta splits the response headers set by modules into the status code, the content type, and the
+// remaining headers. Header names are matched case-insensitively, and the status defaults to 200 and the content type
+// to application/octet-stream if the modules did not set a valid one.
+func NewResponseMeta(respHeaders map[string]string) ResponseMeta {
+	meta := ResponseMeta{
+		Status:      http.StatusOK,
+		ContentType: DefaultContentType,
+		Headers:     make(map[string]string, len(respHeaders)),
+	}
+
+	for key, val := range respHeaders {
+		switch {
+		case strings.EqualFold(key, StatusHeader):
+			if status, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && ValidStatus(status) {
+				meta.Status = status
+			}
+		case strings.EqualFold(key, "Content-Type"):
+			if val != "" {
+				meta.ContentType = val
+			}
+		default:
+			meta.Headers[key] = val
+		}
+	}
+
+	return meta
+}
+
+// HasBody returns false if the status does not permit a response body.
+func (m ResponseMeta) HasBody() bool {
+	return m.Status != http.StatusNoContent && m.Status != http.StatusNotModified
+}
+
+// ValidStatus returns true if status can be used as the final status code of an HTTP response.
+func ValidStatus(status int) bool {
+	return status >= 200 && status <= 599
+}
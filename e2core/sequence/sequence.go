@@ -3,6 +3,7 @@ package sequence
 import (
 	"encoding/json"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -23,6 +24,9 @@ type Sequence struct {
 type Step struct {
 	tenant.WorkflowStep `json:"inline"`
 	Completed           bool `json:"completed"`
+
+	// Timeout is how long the step's module (or each module of a group) may run for, zero if it was never set.
+	Timeout time.Duration `json:"timeout,omitempty"`
 }
 
 type ExecResult struct {
@@ -118,6 +122,39 @@ func (seq *Sequence) HandleStepResults(results []ExecResult) error {
 	return nil
 }
 
+// SetTimeouts sets the timeout of each step to the one returned for its module. A group step gets the longest timeout
+// of its members.
+func (seq *Sequence) SetTimeouts(timeout func(FQMN string) time.Duration) error {
+	seq.lock.Lock()
+	defer seq.lock.Unlock()
+
+	for i := range seq.steps {
+		step := &seq.steps[i]
+
+		if step.IsSingle() {
+			step.Timeout = timeout(step.FQMN)
+			continue
+		}
+
+		step.Timeout = 0
+
+		for _, FQMN := range step.Group {
+			if t := timeout(FQMN); t > step.Timeout {
+				step.Timeout = t
+			}
+		}
+	}
+
+	stepsJSON, err := json.Marshal(seq.steps)
+	if err != nil {
+		return errors.Wrap(err, "failed to Marshal steps")
+	}
+
+	seq.req.SequenceJSON = stepsJSON
+
+	return nil
+}
+
 // StepsJSON returns the JSON of the steps it is working on.
 func (seq *Sequence) StepsJSON() ([]byte, error) {
 	return json.Marshal(seq.steps)
@@ -127,7 +164,7 @@ func createUncompletedSteps(execs []tenant.WorkflowStep) []Step {
 	steps := make([]Step, len(execs))
 
 	for i := range execs {
-		steps[i] = Step{execs[i], false}
+		steps[i] = Step{WorkflowStep: execs[i]}
 	}
 
 	return steps
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/execution"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const (
+	preferHeader            = "Prefer"
+	preferenceAppliedHeader = "Preference-Applied"
+	preferRespondAsync      = "respond-async"
+
+	// pruneInterval is the minimum time between two prunes of the execution store.
+	pruneInterval = time.Minute
+)
+
+// AsyncResponse is sent back to clients that requested asynchronous execution.
+type AsyncResponse struct {
+	ID     string           `json:"id"`
+	Status execution.Status `json:"status"`
+}
+
+// preferAsync returns true if the request carries a `Prefer: respond-async` header (RFC 7240).
+func preferAsync(header http.Header) bool {
+	for _, value := range header.Values(preferHeader) {
+		for _, pref := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), preferRespondAsync) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// respondAsync records a pending execution, starts executing the steps in the background, and responds with 202 and
+// the location that the result can be retrieved from. release is called once the execution has finished. Executions
+// are refused with 429 while ExecutionMaxPending of them are running.
+func (s *Server) respondAsync(c echo.Context, req *request.CoordinatedRequest, steps []tenant.WorkflowStep, responseKey string, release func()) error {
+	select {
+	case s.pending <- struct{}{}:
+	default:
+		release()
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many pending executions")
+	}
+
+	done := func() {
+		<-s.pending
+		release()
+	}
+
+	// the ID of the execution, which is also the ID that its request is dispatched with, is never taken from the
+	// client, so that it cannot be chosen to collide with another execution.
+	req.ID = uuid.New().String()
+
+	// the path ident is stored (rather than the tenant ID set by the authorization middleware) so that
+	// retrieving the result can be authorized with the same credentials that started the execution.
+	rec := execution.NewRecord(req.ID, c.Param("ident"), ReadParam(c, "namespace"), ReadParam(c, "name"))
+
+	callback, err := s.callbackURL(c, ReadParam(c, "ident"), rec.Namespace, rec.Name)
+	if err != nil {
+		done()
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid callback URL").SetInternal(err)
+	}
+
+	if callback != "" {
+		rec.Callback = &execution.Callback{URL: callback}
+	}
+
+	if err := s.executions.Put(rec); err != nil {
+		done()
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
+	}
+
+	// the record belongs to the execution once it starts, so the response is taken from it beforehand.
+	resp := AsyncResponse{ID: rec.ID, Status: rec.Status}
+
+	// counted as in flight from here, since the execution may not have started by the time the server shuts down.
+	if !s.inFlight.add() {
+		done()
+		return executionHTTPError(ErrDraining)
+	}
+
+	// the tenant ID (rather than the path ident) picks the secret that the callback is signed with.
+	tenantID := ReadParam(c, "ident")
+
+	go func() {
+		defer s.inFlight.done()
+		defer done()
+
+		s.executeAsync(rec, tenantID, req, steps, responseKey)
+	}()
+
+	c.Response().Header().Set(echo.HeaderLocation, "/executions/"+resp.ID)
+	c.Response().Header().Set(preferenceAppliedHeader, preferRespondAsync)
+
+	return c.JSON(http.StatusAccepted, resp)
+}
+
+// executeAsync runs the steps and stores the outcome in the execution record, then sends the record to its callback URL
+// if it has one, signed with the secret of the tenant.
+func (s *Server) executeAsync(rec *execution.Record, tenantID string, req *request.CoordinatedRequest, steps []tenant.WorkflowStep, responseKey string) {
+	ll := s.logger.With().Str("method", "executeAsync").Str("executionID", rec.ID).Logger()
+
+	seq, err := s.executeCounted(req, steps)
+	if err != nil {
+		ll.Err(err).Msg("asynchronous execution failed")
+		rec.Fail(err)
+	} else {
+		rec.Complete(seq.Request().State[responseKey], req.RespHeaders)
+	}
+
+	if err := s.executions.Put(rec); err != nil {
+		ll.Err(err).Msg("failed to store execution record")
+	}
+
+	// delivery is retried for a while, so it does not hold up the execution's place in the limiter. Shutdown waits for
+	// it separately.
+	if rec.Callback != nil {
+		s.callbacks.start(rec, tenantID)
+	}
+
+	s.pruneExecutions()
+}
+
+// pruneExecutions drops records older than the configured retention, at most once per pruneInterval.
+func (s *Server) pruneExecutions() {
+	now := time.Now()
+
+	last := s.lastPrune.Load()
+	if now.Sub(time.Unix(0, last)) < pruneInterval || !s.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	if err := s.executions.Prune(now.Add(-s.options.ExecutionRetention)); err != nil {
+		s.logger.Err(err).Str("method", "pruneExecutions").Msg("failed to prune execution store")
+	}
+}
+
+// loadExecutionParams looks up the requested execution and exposes the ident, namespace and name it was started with
+// as path params, so that the authorization middleware can authorize access to its result. The execution is looked up
+// before the request is authorized, so authorization failures are reported as the execution not being found, and do
+// not tell whether it exists.
+func (s *Server) loadExecutionParams() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			rec, err := s.executions.Get(c.Param("id"))
+			if err != nil {
+				if common.IsError(err, common.ErrNotExists) || common.IsError(err, common.ErrInvalid) {
+					return echo.NewHTTPError(http.StatusNotFound, "execution not found").SetInternal(err)
+				}
+
+				return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
+			}
+
+			c.SetParamNames("id", "ident", "namespace", "name")
+			c.SetParamValues(rec.ID, rec.Ident, rec.Namespace, rec.Name)
+			c.Set("execution", rec)
+
+			err = next(c)
+
+			httpErr := &echo.HTTPError{}
+			if errors.As(err, &httpErr) && (httpErr.Code == http.StatusUnauthorized || httpErr.Code == http.StatusForbidden) {
+				// the error handler responds with an internal HTTPError in place of the outer one.
+				return echo.NewHTTPError(http.StatusNotFound, "execution not found").SetInternal(httpErr.Internal)
+			}
+
+			return err
+		}
+	}
+}
+
+// getExecutionHandler returns the current state of an execution.
+func (s *Server) getExecutionHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rec, ok := c.Get("execution").(*execution.Record)
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "execution not found")
+		}
+
+		return c.JSON(http.StatusOK, rec)
+	}
+}
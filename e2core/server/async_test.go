@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/e2core/e2core/execution"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/system"
+)
+
+// testAuthorizer lets the token "valid" access the test tenant, and nothing else.
+type testAuthorizer struct{}
+
+func (testAuthorizer) Authorize(token system.Credential, identifier, _, _ string) (*auth.TenantInfo, error) {
+	if token == nil || token.Value() != "valid" || identifier != testIdent {
+		return nil, common.Error(common.ErrAccess, "access denied")
+	}
+
+	return &auth.TenantInfo{ID: testIdent}, nil
+}
+
+func newAsyncTestServer(t *testing.T, sats *fakeSats) *Server {
+	s := newTestServer(t, sats)
+	s.authorizer = testAuthorizer{}
+	s.server.GET("/executions/:id", s.getExecutionHandler(), s.loadExecutionParams(), s.authorize(auth.OpExecute, auth.OpWorkflow))
+
+	return s
+}
+
+func startAsync(t *testing.T, s *Server, requestID string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+
+	req := httptest.NewRequest(http.MethodPost, "/name/"+testIdent+"/default/a", strings.NewReader("input"))
+	req.Header.Set(preferHeader, preferRespondAsync)
+	req.Header.Set(echo.HeaderXRequestID, requestID)
+
+	s.server.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestRespondAsync(t *testing.T) {
+	s := newAsyncTestServer(t, newFakeSats())
+
+	rec := startAsync(t, s, "chosen-by-client")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	resp := AsyncResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	assert.NotEqual(t, "chosen-by-client", resp.ID, "the execution ID must not be taken from the client")
+	assert.Equal(t, "/executions/"+resp.ID, rec.Header().Get("Location"))
+
+	// a second execution with the same request ID does not replace the first.
+	other := AsyncResponse{}
+	require.NoError(t, json.Unmarshal(startAsync(t, s, "chosen-by-client").Body.Bytes(), &other))
+	assert.NotEqual(t, resp.ID, other.ID)
+
+	require.Eventually(t, func() bool {
+		stored, err := s.executions.Get(resp.ID)
+		return err == nil && stored.Status == execution.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	get := httptest.NewRecorder()
+	getReq := httptest.NewRequest(http.MethodGet, "/executions/"+resp.ID, nil)
+	getReq.Header.Set("Authorization", "Bearer valid")
+
+	s.server.ServeHTTP(get, getReq)
+
+	assert.Equal(t, http.StatusOK, get.Code)
+	assert.Contains(t, get.Body.String(), resp.ID)
+}
+
+func TestGetExecution_DoesNotRevealExistence(t *testing.T) {
+	s := newAsyncTestServer(t, newFakeSats())
+
+	resp := AsyncResponse{}
+	require.NoError(t, json.Unmarshal(startAsync(t, s, "request").Body.Bytes(), &resp))
+
+	get := func(id, token string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/executions/"+id, nil)
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		s.server.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, get("does-not-exist", ""))
+	assert.Equal(t, http.StatusNotFound, get("does-not-exist", "valid"))
+	assert.Equal(t, http.StatusNotFound, get(resp.ID, ""))
+	assert.Equal(t, http.StatusNotFound, get(resp.ID, "invalid"))
+}
+
+func TestRespondAsync_LimitsPending(t *testing.T) {
+	s := newAsyncTestServer(t, newFakeSats())
+	s.pending = make(chan struct{}, 1)
+
+	// take the only slot, as a running execution would.
+	s.pending <- struct{}{}
+
+	assert.Equal(t, http.StatusTooManyRequests, startAsync(t, s, "request").Code)
+
+	<-s.pending
+
+	assert.Equal(t, http.StatusAccepted, startAsync(t, s, "request").Code)
+}
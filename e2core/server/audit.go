@@ -0,0 +1,152 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/audit"
+	"github.com/suborbital/e2core/e2core/sequence"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/fqmn"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+// recordExecution adds an entry for an execution of the steps to the audit log, if there is one. seq is nil if the
+// execution failed.
+func (s *Server) recordExecution(req *request.CoordinatedRequest, steps []tenant.WorkflowStep, input []byte, started time.Time, seq *sequence.Sequence, err error) {
+	if s.audit == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		RequestID:  req.ID,
+		Method:     req.Method,
+		URL:        req.URL,
+		StartedAt:  started,
+		DurationMS: time.Since(started).Milliseconds(),
+		InputSize:  len(input),
+	}
+
+	for _, step := range steps {
+		if step.IsGroup() {
+			entry.Steps = append(entry.Steps, step.Group...)
+		} else {
+			entry.Steps = append(entry.Steps, step.FQMN)
+		}
+	}
+
+	if len(entry.Steps) > 0 {
+		if parsed, err := fqmn.Parse(entry.Steps[0]); err == nil {
+			entry.Ident = parsed.Tenant
+			entry.Namespace = parsed.Namespace
+		}
+	}
+
+	// a single module is recorded by its FQMN rather than as a one step workflow.
+	if len(steps) == 1 && steps[0].IsSingle() {
+		entry.FQMN = steps[0].FQMN
+		entry.Steps = nil
+	}
+
+	var output []byte
+
+	if err != nil {
+		entry.Status = executionHTTPError(err).Code
+
+		runErr := scheduler.RunErr{}
+		if errors.As(err, &runErr) {
+			entry.RunErr = &runErr
+		} else {
+			entry.ExecErr = err.Error()
+		}
+	} else {
+		entry.Status = sequence.NewResponseMeta(req.RespHeaders).Status
+
+		if last := steps[len(steps)-1]; last.IsSingle() {
+			output = seq.Request().State[last.FQMN]
+		}
+	}
+
+	entry.OutputSize = len(output)
+
+	if max := s.options.AuditConfig.PayloadBytes; max > 0 {
+		entry.Input = audit.Truncate(input, max)
+		entry.Output = audit.Truncate(output, max)
+	}
+
+	if err := s.audit.Add(entry); err != nil {
+		s.logger.Err(err).Str("method", "recordExecution").Str("requestID", req.ID).Msg("failed to add audit entry")
+	}
+
+	s.pruneAudit()
+}
+
+// pruneAudit drops audit entries older than the configured retention, at most once per pruneInterval. Without a
+// retention nothing is dropped.
+func (s *Server) pruneAudit() {
+	if s.options.AuditConfig.Retention <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	last := s.lastAuditPrune.Load()
+	if now.Sub(time.Unix(0, last)) < pruneInterval || !s.lastAuditPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	if err := s.audit.Prune(now.Add(-s.options.AuditConfig.Retention)); err != nil {
+		s.logger.Err(err).Str("method", "pruneAudit").Msg("failed to prune audit log")
+	}
+}
+
+// auditHandler returns the recorded executions of a tenant, newest first. They can be narrowed down with the fqmn,
+// status (a status code or a class such as 5xx), since (an RFC 3339 time) and limit query params.
+func (s *Server) auditHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.audit == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "execution auditing is disabled")
+		}
+
+		q := audit.Query{
+			Ident:  ReadParam(c, "ident"),
+			FQMN:   c.QueryParam("fqmn"),
+			Status: c.QueryParam("status"),
+		}
+
+		if limit := c.QueryParam("limit"); limit != "" {
+			l, err := strconv.Atoi(limit)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "limit must be a number").SetInternal(err)
+			}
+
+			q.Limit = l
+		}
+
+		if since := c.QueryParam("since"); since != "" {
+			t, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "since must be an RFC 3339 time").SetInternal(err)
+			}
+
+			q.Since = t
+		}
+
+		entries, err := s.audit.Query(q)
+		if err != nil {
+			if common.IsError(err, common.ErrInvalid) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to query executions").SetInternal(err)
+		}
+
+		return c.JSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/audit"
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func TestRecordExecution(t *testing.T) {
+	s := &Server{
+		audit:          audit.NewRingLog(10),
+		lastAuditPrune: &atomic.Int64{},
+		options:        &options.Options{AuditConfig: options.AuditConfig{PayloadBytes: 4, Retention: time.Hour}},
+		logger:         zerolog.Nop(),
+	}
+
+	req := &request.CoordinatedRequest{ID: "abc-123", Method: http.MethodPost, URL: "/workflow/com.suborbital.app/default/greet"}
+	steps := []tenant.WorkflowStep{
+		{FQMN: "fqmn://com.suborbital.app/default/hello@v1"},
+		{Group: []string{"fqmn://com.suborbital.app/default/bye@v1", "fqmn://com.suborbital.app/default/wave@v1"}},
+	}
+
+	err := errors.Wrap(scheduler.RunErr{Code: http.StatusConflict, Message: "already exists"}, "dispatcher.Execute")
+	s.recordExecution(req, steps, []byte("hello world"), time.Now(), nil, err)
+
+	found, err := s.audit.Query(audit.Query{Ident: "com.suborbital.app"})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	entry := found[0]
+	assert.Equal(t, "abc-123", entry.RequestID)
+	assert.Equal(t, "default", entry.Namespace)
+	assert.Empty(t, entry.FQMN)
+	assert.Len(t, entry.Steps, 3)
+	assert.Equal(t, http.StatusConflict, entry.Status)
+	require.NotNil(t, entry.RunErr)
+	assert.Equal(t, "already exists", entry.RunErr.Message)
+	assert.Equal(t, 11, entry.InputSize)
+	assert.Equal(t, "hell", string(entry.Input))
+}
+
+func TestRecordExecution_NoRetention(t *testing.T) {
+	s := &Server{
+		audit:          audit.NewRingLog(10),
+		lastAuditPrune: &atomic.Int64{},
+		options:        &options.Options{AuditConfig: options.AuditConfig{Retention: 0}},
+		logger:         zerolog.Nop(),
+	}
+
+	req := &request.CoordinatedRequest{ID: "abc-123", Method: http.MethodPost, URL: "/name/com.suborbital.app/default/hello"}
+	steps := []tenant.WorkflowStep{{FQMN: "fqmn://com.suborbital.app/default/hello@v1"}}
+
+	s.recordExecution(req, steps, []byte("hello"), time.Now().Add(-time.Minute), nil, scheduler.RunErr{Code: http.StatusInternalServerError, Message: "failed"})
+
+	found, err := s.audit.Query(audit.Query{Ident: "com.suborbital.app"})
+	require.NoError(t, err)
+	assert.Len(t, found, 1, "entries are kept until the log is full")
+}
+
+func TestAuditHandler(t *testing.T) {
+	s := &Server{audit: audit.NewRingLog(10)}
+
+	require.NoError(t, s.audit.Add(audit.Entry{RequestID: "abc-123", Ident: "com.suborbital.app", Status: 500, StartedAt: time.Now()}))
+	require.NoError(t, s.audit.Add(audit.Entry{RequestID: "def-456", Ident: "com.suborbital.app", Status: 200, StartedAt: time.Now()}))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{"all", "ident=com.suborbital.app", http.StatusOK, []string{"def-456", "abc-123"}},
+		{"status class", "ident=com.suborbital.app&status=5xx", http.StatusOK, []string{"abc-123"}},
+		{"other tenant", "ident=com.suborbital.other", http.StatusOK, []string{}},
+		{"no ident", "status=5xx", http.StatusBadRequest, nil},
+		{"invalid status", "ident=com.suborbital.app&status=teapot", http.StatusBadRequest, nil},
+		{"invalid since", "ident=com.suborbital.app&since=yesterday", http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/admin/executions", s.auditHandler(), identQueryParam())
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/executions?"+tc.query, nil))
+
+			require.Equal(t, tc.wantStatus, rec.Code)
+
+			if tc.wantIDs == nil {
+				return
+			}
+
+			var entries []audit.Entry
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+
+			ids := []string{}
+			for _, entry := range entries {
+				ids = append(ids, entry.RequestID)
+			}
+
+			assert.Equal(t, tc.wantIDs, ids)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/suborbital/e2core/e2core/auth"
+)
+
+// purgeAuthCacheRequest names the token whose cached decisions are purged. Leaving it out purges those of the whole
+// tenant.
+type purgeAuthCacheRequest struct {
+	Token string `json:"token"`
+}
+
+type purgeAuthCacheResponse struct {
+	Purged int `json:"purged"`
+}
+
+// authCache returns the cache of the authorizer's decisions, or nil if it does not cache them.
+func (s *Server) authCache() *auth.AuthorizationCache {
+	if authorizer, ok := s.authorizer.(auth.CachingAuthorizer); ok {
+		return authorizer.Cache()
+	}
+
+	return nil
+}
+
+// authCacheHandler returns the statistics of the decisions of the tenant given by the ident query param. Those of the
+// whole cache are not reported, since they would reveal the activity of other tenants.
+func (s *Server) authCacheHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cache := s.authCache()
+		if cache == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "authorization decisions are not cached")
+		}
+
+		return c.JSON(http.StatusOK, cache.TenantStats(c.Param("ident")))
+	}
+}
+
+// purgeAuthCacheHandler removes the cached authorization decisions of the tenant given by the ident query param, or
+// only those of the token in the request body, so that a revoked token stops working right away. Decisions are cached
+// by the ident that was requested, which is not always the ID of the tenant it resolves to, so the ident is read from
+// the path param rather than with ReadParam.
+func (s *Server) purgeAuthCacheHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cache := s.authCache()
+		if cache == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "authorization decisions are not cached")
+		}
+
+		req := purgeAuthCacheRequest{}
+		if c.Request().ContentLength != 0 {
+			if err := c.Bind(&req); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "request body must be a JSON object").SetInternal(err)
+			}
+		}
+
+		ident := c.Param("ident")
+		purged := cache.Purge(ident, req.Token)
+
+		s.logger.Info().Str("ident", ident).Bool("token", req.Token != "").Int("purged", purged).Msg("purged authorization cache")
+
+		return c.JSON(http.StatusOK, purgeAuthCacheResponse{Purged: purged})
+	}
+}
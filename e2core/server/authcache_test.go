@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/e2core/e2core/options"
+)
+
+func TestPurgeAuthCacheHandler(t *testing.T) {
+	var checks atomic.Int32
+
+	controlPlane := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks.Add(1)
+		_ = json.NewEncoder(w).Encode(auth.TenantInfo{ID: "com.suborbital.app"})
+	}))
+	defer controlPlane.Close()
+
+	authorizer := auth.NewApiAuthClient(&options.Options{ControlPlane: controlPlane.URL, AuthCacheTTL: time.Minute})
+	s := &Server{authorizer: authorizer, logger: zerolog.Nop()}
+
+	for _, token := range []string{"a", "b", "a"} {
+		_, err := authorizer.Authorize(auth.NewAccessToken(token), "com.suborbital.app", "default", "hello")
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, int32(2), checks.Load())
+
+	e := echo.New()
+	e.GET("/admin/auth/cache", s.authCacheHandler(), identQueryParam())
+	e.POST("/admin/auth/cache/purge", s.purgeAuthCacheHandler(), identQueryParam())
+
+	purge := func(ident, body string) purgeAuthCacheResponse {
+		req := httptest.NewRequest(http.MethodPost, "/admin/auth/cache/purge?ident="+ident, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := purgeAuthCacheResponse{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+		return resp
+	}
+
+	assert.Equal(t, 1, purge("com.suborbital.app", `{"token": "a"}`).Purged)
+	assert.Equal(t, 0, purge("com.suborbital.other", "").Purged)
+
+	_, err := authorizer.Authorize(auth.NewAccessToken("a"), "com.suborbital.app", "default", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), checks.Load(), "a purged token is checked again")
+
+	stats := func(ident string) auth.TenantCacheStats {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/auth/cache?ident="+ident, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		resp := auth.TenantCacheStats{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+		return resp
+	}
+
+	assert.Equal(t, auth.TenantCacheStats{Entries: 2, Hits: 1, Misses: 3}, stats("com.suborbital.app"))
+	assert.Equal(t, auth.TenantCacheStats{}, stats("com.suborbital.other"), "other tenants do not see the app's activity")
+
+	assert.Equal(t, 2, purge("com.suborbital.app", "").Purged)
+	assert.Equal(t, auth.TenantCacheStats{}, stats("com.suborbital.app"))
+
+	s.authorizer = auth.DisabledAuthorizer{}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/auth/cache?ident=com.suborbital.app", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestPurgeAuthCacheHandler_TenantIDDiffersFromIdent(t *testing.T) {
+	controlPlane := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(auth.TenantInfo{ID: "tenant-123"})
+	}))
+	defer controlPlane.Close()
+
+	authorizer := auth.NewApiAuthClient(&options.Options{ControlPlane: controlPlane.URL, AuthCacheTTL: time.Minute})
+	s := &Server{authorizer: authorizer, logger: zerolog.Nop()}
+
+	_, err := authorizer.Authorize(auth.NewAccessToken("a"), "com.suborbital.app", "default", "hello")
+	require.NoError(t, err)
+
+	// the authorization middleware replaces the ident with the ID of the tenant that it resolved to.
+	resolved := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("ident", "tenant-123")
+			return next(c)
+		}
+	}
+
+	e := echo.New()
+	e.POST("/admin/auth/cache/purge", s.purgeAuthCacheHandler(), identQueryParam(), resolved)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/auth/cache/purge?ident=com.suborbital.app", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	resp := purgeAuthCacheResponse{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Purged)
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/request"
+)
+
+const (
+	// MIMEApplicationNDJSON is the content type of batch responses.
+	MIMEApplicationNDJSON = "application/x-ndjson"
+
+	// defaultBatchParallelism is used if the batch parallelism option is not set.
+	defaultBatchParallelism = 16
+)
+
+// ErrBatchTooLarge is returned when a batch has more items than the configured maximum.
+var ErrBatchTooLarge = errors.New("batch has too many items")
+
+// BatchResponse is written back for every item of a batch, in the order of the items. Index is the position of the
+// item in the batch.
+type BatchResponse struct {
+	Index int `json:"index"`
+	StreamResponse
+}
+
+// batchHandler runs a module once for every item of the request body, which is either a JSON array or newline
+// delimited JSON. Each item is used as the body of its own invocation in its JSON form. Up to the configured number of
+// items (which the parallelism query param can lower) are executed at the same time, and their responses are
+// streamed back as NDJSON in the same order as the items. An item that fails does not fail the rest of the batch.
+func (s *Server) batchHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ident := ReadParam(c, "ident")
+		namespace := ReadParam(c, "namespace")
+		name := ReadParam(c, "name")
+
+		ll := s.logger.With().
+			Str("ident", ident).
+			Str("namespace", namespace).
+			Str("fn", name).
+			Str("method", "batchHandler").
+			Logger()
+
+		if mod := s.syncer.GetModuleByName(ident, namespace, name); mod == nil {
+			ll.Error().Msg("syncer did not find module by these details")
+			return echo.NewHTTPError(http.StatusNotFound, "module not found").SetInternal(fmt.Errorf("no module with %s/%s/%s", ident, namespace, name))
+		}
+
+		parallelism, err := s.batchParallelism(c.QueryParam("parallelism"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+		}
+
+		// the whole body is read before anything is written back, since HTTP/1.x does not allow reading the request
+		// once the response has started.
+		template, err := request.FromEchoContext(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
+		}
+
+		items, err := parseBatch(template.Body, s.options.BatchMaxItems)
+		if err != nil {
+			if errors.Is(err, ErrBatchTooLarge) {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error()).SetInternal(err)
+			}
+
+			return echo.NewHTTPError(http.StatusBadRequest, "request body is not a JSON array or NDJSON").SetInternal(err)
+		}
+
+		ll.Info().Int("items", len(items)).Int("parallelism", parallelism).Msg("starting batch")
+
+		// each item's response channel is queued in order, and the queue only has room for as many items as may
+		// execute at the same time, so it limits the parallelism as well as keeping the order.
+		queue := make(chan chan BatchResponse, parallelism-1)
+
+		// items are no longer dispatched once the client has gone away.
+		ctx := c.Request().Context()
+
+		go func() {
+			defer close(queue)
+
+			for i := range items {
+				// checked first as well, since select picks at random when the queue also has room.
+				if ctx.Err() != nil {
+					ll.Warn().Int("dispatched", i).Msg("client disconnected, stopping batch")
+					return
+				}
+
+				result := make(chan BatchResponse, 1)
+
+				select {
+				case queue <- result:
+				case <-ctx.Done():
+					ll.Warn().Int("dispatched", i).Msg("client disconnected, stopping batch")
+					return
+				}
+
+				go func(index int) {
+					resp := s.executeInvocation(ident, namespace, name, template, uuid.New().String(), items[index])
+					result <- BatchResponse{Index: index, StreamResponse: resp}
+				}(i)
+			}
+		}()
+
+		c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+		c.Response().WriteHeader(http.StatusOK)
+
+		enc := json.NewEncoder(c.Response())
+		disconnected := false
+
+		for result := range queue {
+			resp := <-result
+
+			// keep receiving after the client has gone away so that every item's goroutine can finish.
+			if disconnected {
+				continue
+			}
+
+			if err := enc.Encode(resp); err != nil {
+				ll.Err(err).Int("index", resp.Index).Msg("failed to write batch response, client disconnected")
+				disconnected = true
+
+				continue
+			}
+
+			c.Response().Flush()
+		}
+
+		ll.Info().Int("items", len(items)).Msg("finished batch")
+
+		return nil
+	}
+}
+
+// batchParallelism returns how many items of a batch may execute at the same time: the configured parallelism,
+// lowered to the requested one if it is smaller.
+func (s *Server) batchParallelism(requested string) (int, error) {
+	parallelism := s.options.BatchParallelism
+	if parallelism <= 0 {
+		parallelism = defaultBatchParallelism
+	}
+
+	if requested == "" {
+		return parallelism, nil
+	}
+
+	n, err := strconv.Atoi(requested)
+	if err != nil || n <= 0 {
+		return 0, common.InvalidArgument("parallelism must be a positive integer, got %q", requested)
+	}
+
+	if n < parallelism {
+		return n, nil
+	}
+
+	return parallelism, nil
+}
+
+// parseBatch splits a JSON array or a stream of JSON values (such as NDJSON) into its items. It returns an error
+// wrapping ErrBatchTooLarge if there are more than maxItems, unless maxItems is zero.
+func parseBatch(body []byte, maxItems int) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(body)
+
+	var items []json.RawMessage
+
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, errors.Wrap(err, "json.Unmarshal")
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+
+		for {
+			item := json.RawMessage{}
+			if err := dec.Decode(&item); err != nil {
+				if err == io.EOF {
+					break
+				}
+
+				return nil, errors.Wrapf(err, "dec.Decode item %d", len(items))
+			}
+
+			items = append(items, item)
+
+			if maxItems > 0 && len(items) > maxItems {
+				break
+			}
+		}
+	}
+
+	if maxItems > 0 && len(items) > maxItems {
+		return nil, errors.Wrapf(ErrBatchTooLarge, "more than %d items", maxItems)
+	}
+
+	result := make([][]byte, len(items))
+	for i := range items {
+		result[i] = items[i]
+	}
+
+	return result, nil
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/foundation/scheduler"
+)
+
+func TestParseBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "JSON array", body: ` [{"a":1}, "two", 3] `, want: []string{`{"a":1}`, `"two"`, `3`}},
+		{name: "NDJSON", body: "{\"a\":1}\n{\"a\":2}\n\n{\"a\":3}\n", want: []string{`{"a":1}`, `{"a":2}`, `{"a":3}`}},
+		{name: "empty", body: "", want: []string{}},
+		{name: "invalid NDJSON", body: "{\"a\":1}\n{\"a\":", wantErr: true},
+		{name: "invalid array", body: `[{"a":1},`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := parseBatch([]byte(tt.body), 10)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			got := make([]string, len(items))
+			for i := range items {
+				got[i] = string(items[i])
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("too many items", func(t *testing.T) {
+		_, err := parseBatch([]byte("1\n2\n3\n"), 2)
+		assert.ErrorIs(t, err, ErrBatchTooLarge)
+
+		_, err = parseBatch([]byte("[1,2,3]"), 2)
+		assert.ErrorIs(t, err, ErrBatchTooLarge)
+	})
+}
+
+func TestBatchParallelism(t *testing.T) {
+	s := &Server{options: &options.Options{BatchParallelism: 8}}
+
+	parallelism, err := s.batchParallelism("")
+	require.NoError(t, err)
+	assert.Equal(t, 8, parallelism)
+
+	parallelism, err = s.batchParallelism("2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, parallelism)
+
+	parallelism, err = s.batchParallelism("100")
+	require.NoError(t, err)
+	assert.Equal(t, 8, parallelism)
+
+	_, err = s.batchParallelism("0")
+	assert.Error(t, err)
+}
+
+func postBatch(ctx context.Context, s *Server, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/batch/"+testIdent+"/default/a?parallelism=2", strings.NewReader(body)).WithContext(ctx)
+
+	s.server.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func readBatch(t *testing.T, rec *httptest.ResponseRecorder) []BatchResponse {
+	responses := []BatchResponse{}
+
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		resp := BatchResponse{}
+		require.NoError(t, dec.Decode(&resp))
+
+		responses = append(responses, resp)
+	}
+
+	return responses
+}
+
+func TestBatchHandler(t *testing.T) {
+	sats := newFakeSats()
+	sats.echo = true
+	sats.bodyFailures = map[string]scheduler.RunErr{"3": {Code: http.StatusUnprocessableEntity, Message: "three is not allowed"}}
+
+	s := newTestServer(t, sats)
+	s.server.POST("/batch/:ident/:namespace/:name", s.batchHandler())
+
+	rec := postBatch(context.Background(), s, "[0, 1, 2, 3, 4, 5, 6, 7]")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, MIMEApplicationNDJSON, rec.Header().Get(echo.HeaderContentType))
+
+	responses := readBatch(t, rec)
+	require.Len(t, responses, 8)
+
+	// the responses are in the order of the items, and a failed item does not fail the rest.
+	for i, resp := range responses {
+		assert.Equal(t, i, resp.Index)
+
+		if i == 3 {
+			assert.Equal(t, http.StatusUnprocessableEntity, resp.Status)
+			assert.Equal(t, "three is not allowed", resp.Error)
+
+			continue
+		}
+
+		assert.Equal(t, http.StatusOK, resp.Status)
+		assert.Equal(t, strconv.Itoa(i), string(resp.Output))
+	}
+}
+
+func TestBatchHandler_StopsWhenClientDisconnects(t *testing.T) {
+	sats := newFakeSats()
+	sats.hold = make(chan struct{})
+
+	s := newTestServer(t, sats)
+	s.server.POST("/batch/:ident/:namespace/:name", s.batchHandler())
+
+	ctx, cxl := context.WithCancel(context.Background())
+	defer cxl()
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- postBatch(ctx, s, "[0, 1, 2, 3, 4, 5, 6, 7]")
+	}()
+
+	// as many items as the parallelism allows are running when the client goes away.
+	require.Eventually(t, func() bool { return sats.held.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	cxl()
+	close(sats.hold)
+
+	rec := <-done
+
+	assert.Len(t, readBatch(t, rec), 2)
+	assert.Equal(t, int32(2), sats.held.Load())
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/policy"
+	"github.com/suborbital/e2core/e2core/sequence"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const (
+	// CacheHeader tells clients whether a response came from the response cache.
+	CacheHeader = "X-E2Core-Cache"
+	CacheHit    = "hit"
+	CacheMiss   = "miss"
+
+	// defaultCacheEntries is how many responses are kept for a module if its cache rule does not say.
+	defaultCacheEntries = 1000
+)
+
+// cachedResponse is a module's response as it is written back to clients.
+type cachedResponse struct {
+	output      []byte
+	respHeaders map[string]string
+}
+
+// responseCache holds the cached responses of the modules that the policy turns caching on for. Each module has its
+// own cache, which is dropped when the syncer sees a new ref for the module.
+type responseCache struct {
+	policy *policy.Policy
+	clock  common.Clock
+
+	modules map[string]*moduleCache
+	lock    sync.Mutex
+}
+
+// moduleCache holds the responses of one version of a module. Entries are loaded through a LoadingCache so that
+// identical requests that arrive while a response is being loaded wait for it rather than executing again. entries
+// tracks the state of each key that the LoadingCache cannot tell: whether it has loaded, when it expires, and whether
+// it must be loaded again because it failed; order holds the keys from oldest to newest.
+type moduleCache struct {
+	FQMN  string
+	rule  policy.CacheRule
+	clock common.Clock
+	cache *common.LoadingCache[*cachedResponse]
+
+	entries map[string]*cacheEntry
+	order   []string
+	lock    sync.Mutex
+}
+
+type cacheEntry struct {
+	loaded  bool
+	stale   bool
+	expires time.Time
+}
+
+func newResponseCache(p *policy.Policy, clock common.Clock) *responseCache {
+	return &responseCache{
+		policy:  p,
+		clock:   clock,
+		modules: map[string]*moduleCache{},
+	}
+}
+
+// rule returns the cache rule for the module, or nil if its responses are not cached.
+func (rc *responseCache) rule(ident string, mod *tenant.Module) *policy.CacheRule {
+	return rc.policy.ModuleCache(ident, mod.Namespace, mod.Name)
+}
+
+// module returns the cache for the module's current version, replacing the cache of any other version.
+func (rc *responseCache) module(ident string, mod *tenant.Module, rule *policy.CacheRule) *moduleCache {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	name := moduleCacheName(ident, mod.Namespace, mod.Name)
+
+	mc, exists := rc.modules[name]
+	if !exists || mc.FQMN != mod.FQMN {
+		mc = &moduleCache{
+			FQMN:    mod.FQMN,
+			rule:    *rule,
+			clock:   rc.clock,
+			cache:   common.NewLoadingCache[*cachedResponse](common.NewMapStore[*cachedResponse]()),
+			entries: map[string]*cacheEntry{},
+		}
+
+		rc.modules[name] = mc
+	}
+
+	return mc
+}
+
+// invalidate drops every cached response of the module. It is used as a syncer.ModuleListener.
+func (rc *responseCache) invalidate(ident string, mod tenant.Module) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	delete(rc.modules, moduleCacheName(ident, mod.Namespace, mod.Name))
+}
+
+// get returns the response cached for key, calling load to get it if there is none or it has expired. The returned
+// bool is true if the response came from the cache, including when the request waited for an identical one. Failed
+// loads and responses with a 5xx status are not kept.
+func (mc *moduleCache) get(key string, load func() (*cachedResponse, error)) (*cachedResponse, bool, error) {
+	// executed is only set by the loader of the request that installed it, and the LoadingCache's lock orders the
+	// write before Get returns.
+	executed := false
+
+	loader := func() (*cachedResponse, error) {
+		executed = true
+
+		return load()
+	}
+
+	mc.lock.Lock()
+
+	entry, exists := mc.entries[key]
+
+	switch {
+	case !exists:
+		mc.evict()
+
+		mc.cache.Replace(key, loader)
+		mc.entries[key] = &cacheEntry{}
+		mc.order = append(mc.order, key)
+	case entry.loaded && (entry.stale || !mc.clock.Now().Before(entry.expires)):
+		mc.cache.Replace(key, loader)
+		*entry = cacheEntry{}
+	}
+
+	mc.lock.Unlock()
+
+	value := mc.cache.Get(key)
+
+	// the entry was evicted between being found and being read.
+	if errors.Is(value.Error, common.ErrNotExists) && !executed {
+		resp, err := load()
+		return resp, false, err
+	}
+
+	if executed {
+		mc.lock.Lock()
+
+		if entry, exists := mc.entries[key]; exists {
+			entry.loaded = true
+			entry.stale = value.Error != nil || sequence.NewResponseMeta(value.Value.respHeaders).Status >= http.StatusInternalServerError
+			entry.expires = mc.clock.In(mc.rule.TTL)
+		}
+
+		mc.lock.Unlock()
+	}
+
+	if value.Error != nil {
+		return nil, false, value.Error
+	}
+
+	return value.Value, !executed, nil
+}
+
+// evict makes room for a new entry by dropping the oldest entries that have loaded. Entries that are still loading
+// are kept, since requests are waiting for them. The lock must be held.
+func (mc *moduleCache) evict() {
+	max := mc.rule.MaxEntries
+	if max <= 0 {
+		max = defaultCacheEntries
+	}
+
+	for i := 0; i < len(mc.order) && len(mc.entries) >= max; {
+		key := mc.order[i]
+
+		if !mc.entries[key].loaded {
+			i++
+			continue
+		}
+
+		mc.cache.Drop(key)
+		delete(mc.entries, key)
+		mc.order = append(mc.order[:i], mc.order[i+1:]...)
+	}
+}
+
+// respondCached responds with the module's cached response for the request, executing the module if there is none.
+// It sets CacheHeader to tell the client which happened.
+func (s *Server) respondCached(c echo.Context, req *request.CoordinatedRequest, ident string, mod *tenant.Module, rule *policy.CacheRule) error {
+	if _, err := requestedTimeout(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a positive duration", TimeoutHeader)).SetInternal(err)
+	}
+
+	steps := []tenant.WorkflowStep{{FQMN: mod.FQMN}}
+	key := cacheKey(mod.FQMN, c.Request(), req.Body, rule.Headers)
+
+	resp, hit, err := s.cache.module(ident, mod, rule).get(key, func() (*cachedResponse, error) {
+		release, err := s.limits.acquire(steps)
+		if err != nil {
+			return nil, err
+		}
+
+		defer release()
+
+		seq, err := s.executeSteps(req, steps)
+		if err != nil {
+			return nil, err
+		}
+
+		return &cachedResponse{output: seq.Request().State[mod.FQMN], respHeaders: req.RespHeaders}, nil
+	})
+
+	if err != nil {
+		if after, ok := retryAfter(err); ok {
+			c.Response().Header().Set(RetryAfterHeader, after)
+		}
+
+		return executionHTTPError(err)
+	}
+
+	if hit {
+		c.Response().Header().Set(CacheHeader, CacheHit)
+	} else {
+		c.Response().Header().Set(CacheHeader, CacheMiss)
+	}
+
+	return writeResponse(c, resp.output, resp.respHeaders)
+}
+
+// cacheKey identifies a request to a module by the module's FQMN (which includes its ref) and a hash of the method,
+// the body, and the values of the given headers.
+func cacheKey(FQMN string, r *http.Request, body []byte, headers []string) string {
+	h := sha256.New()
+
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+
+	for _, name := range headers {
+		h.Write([]byte(http.CanonicalHeaderKey(name)))
+		h.Write([]byte{0})
+
+		for _, value := range r.Header.Values(name) {
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+	}
+
+	h.Write(body)
+
+	return FQMN + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+func moduleCacheName(ident, namespace, name string) string {
+	return ident + "/" + namespace + "/" + name
+}
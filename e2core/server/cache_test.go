@@ -0,0 +1,175 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/policy"
+	"github.com/suborbital/e2core/e2core/sequence"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func testModuleCache(clock common.Clock, rule policy.CacheRule) (*responseCache, *moduleCache) {
+	p := &policy.Policy{Modules: []policy.ModuleRule{{Cache: &rule}}}
+	rc := newResponseCache(p, clock)
+
+	mod := &tenant.Module{Name: "hash", Namespace: "default", FQMN: "fqmn://com.suborbital.test/default/hash@v1"}
+
+	return rc, rc.module("com.suborbital.test", mod, rc.rule("com.suborbital.test", mod))
+}
+
+func TestModuleCache_Coalesces(t *testing.T) {
+	_, mc := testModuleCache(common.SystemTime(), policy.CacheRule{TTL: time.Minute})
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+
+	load := func() (*cachedResponse, error) {
+		loads.Add(1)
+		<-release
+
+		return &cachedResponse{output: []byte("done")}, nil
+	}
+
+	var wg sync.WaitGroup
+	var misses atomic.Int32
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			resp, hit, err := mc.get("key", load)
+			assert.NoError(t, err)
+			assert.Equal(t, "done", string(resp.output))
+
+			if !hit {
+				misses.Add(1)
+			}
+		}()
+	}
+
+	// give every request the chance to find the pending entry.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), loads.Load())
+	assert.Equal(t, int32(1), misses.Load())
+}
+
+func TestModuleCache_Expires(t *testing.T) {
+	clock := common.StableTime(time.Now())
+	_, mc := testModuleCache(clock, policy.CacheRule{TTL: time.Minute})
+
+	loads := 0
+	load := func() (*cachedResponse, error) {
+		loads++
+		return &cachedResponse{}, nil
+	}
+
+	_, hit, err := mc.get("key", load)
+	require.NoError(t, err)
+	assert.False(t, hit)
+
+	clock.Tick(30 * time.Second)
+
+	_, hit, err = mc.get("key", load)
+	require.NoError(t, err)
+	assert.True(t, hit)
+
+	clock.Tick(time.Minute)
+
+	_, hit, err = mc.get("key", load)
+	require.NoError(t, err)
+	assert.False(t, hit)
+	assert.Equal(t, 2, loads)
+}
+
+func TestModuleCache_DoesNotKeepFailures(t *testing.T) {
+	_, mc := testModuleCache(common.SystemTime(), policy.CacheRule{TTL: time.Minute})
+
+	_, _, err := mc.get("error", func() (*cachedResponse, error) { return nil, errors.New("module failed") })
+	assert.Error(t, err)
+
+	_, hit, err := mc.get("error", func() (*cachedResponse, error) { return &cachedResponse{}, nil })
+	require.NoError(t, err)
+	assert.False(t, hit)
+
+	serverError := &cachedResponse{respHeaders: map[string]string{sequence.StatusHeader: "503"}}
+
+	_, _, err = mc.get("5xx", func() (*cachedResponse, error) { return serverError, nil })
+	require.NoError(t, err)
+
+	_, hit, err = mc.get("5xx", func() (*cachedResponse, error) { return serverError, nil })
+	require.NoError(t, err)
+	assert.False(t, hit)
+}
+
+func TestModuleCache_Evicts(t *testing.T) {
+	_, mc := testModuleCache(common.SystemTime(), policy.CacheRule{TTL: time.Minute, MaxEntries: 2})
+
+	load := func() (*cachedResponse, error) { return &cachedResponse{}, nil }
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, _, err := mc.get(key, load)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"b", "c"}, mc.order)
+
+	_, hit, err := mc.get("a", load)
+	require.NoError(t, err)
+	assert.False(t, hit)
+}
+
+func TestResponseCache_Invalidate(t *testing.T) {
+	rc, mc := testModuleCache(common.SystemTime(), policy.CacheRule{TTL: time.Minute})
+
+	_, _, err := mc.get("key", func() (*cachedResponse, error) { return &cachedResponse{}, nil })
+	require.NoError(t, err)
+
+	mod := &tenant.Module{Name: "hash", Namespace: "default", FQMN: mc.FQMN}
+	rule := rc.rule("com.suborbital.test", mod)
+
+	assert.Same(t, mc, rc.module("com.suborbital.test", mod, rule))
+
+	rc.invalidate("com.suborbital.test", *mod)
+	assert.NotSame(t, mc, rc.module("com.suborbital.test", mod, rule))
+
+	// a new ref gets a cache of its own even before the syncer reports it.
+	current := rc.module("com.suborbital.test", mod, rule)
+	updated := &tenant.Module{Name: "hash", Namespace: "default", FQMN: "fqmn://com.suborbital.test/default/hash@v2"}
+	assert.NotSame(t, current, rc.module("com.suborbital.test", updated, rule))
+}
+
+func TestCacheKey(t *testing.T) {
+	request := func(method, accept string) *http.Request {
+		r := httptest.NewRequest(method, "/name/com.suborbital.test/default/hash", nil)
+		r.Header.Set("Accept", accept)
+		r.Header.Set("X-Request-Id", method+accept)
+
+		return r
+	}
+
+	FQMN := "fqmn://com.suborbital.test/default/hash@v1"
+	headers := []string{"accept"}
+	key := cacheKey(FQMN, request(http.MethodPost, "text/plain"), []byte("body"), headers)
+
+	assert.True(t, strings.HasPrefix(key, FQMN+":"))
+	assert.Equal(t, key, cacheKey(FQMN, request(http.MethodPost, "text/plain"), []byte("body"), headers), "unselected headers are ignored")
+	assert.NotEqual(t, key, cacheKey(FQMN, request(http.MethodPost, "application/json"), []byte("body"), headers))
+	assert.NotEqual(t, key, cacheKey(FQMN, request(http.MethodPut, "text/plain"), []byte("body"), headers))
+	assert.NotEqual(t, key, cacheKey(FQMN, request(http.MethodPost, "text/plain"), []byte("other"), headers))
+}
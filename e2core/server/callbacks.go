@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/suborbital/e2core/e2core/execution"
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/systemspec/capabilities"
+)
+
+const (
+	// CallbackURLHeader asks for the result of an asynchronous execution to be POSTed to the given URL.
+	CallbackURLHeader = "X-E2Core-Callback-URL"
+	// CallbackSignatureHeader carries the signature of a callback, made by CallbackSignature.
+	CallbackSignatureHeader = "X-E2Core-Signature"
+	// CallbackTimestampHeader carries the Unix time at which a callback was signed.
+	CallbackTimestampHeader = "X-E2Core-Timestamp"
+
+	signaturePrefix = "sha256="
+)
+
+// callbacks delivers the records of finished executions to their callback URLs, retrying failed deliveries with an
+// exponential backoff and storing every attempt in the record. Each callback is signed with the secret of the tenant
+// that the execution belongs to.
+type callbacks struct {
+	config options.CallbackConfig
+	client capabilities.HTTPCapability
+	auth   capabilities.AuthCapability
+	store  execution.Store
+	sleep  func(time.Duration)
+	log    zerolog.Logger
+
+	// inFlight tracks deliveries so that shutdown can wait for them, and stop ends their retries.
+	inFlight sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCallbacks(config options.CallbackConfig, store execution.Store, log zerolog.Logger) *callbacks {
+	rules := capabilities.HTTPRules{
+		AllowedDomains: config.AllowedDomains,
+		BlockedDomains: config.BlockedDomains,
+		AllowIPs:       config.AllowIPs,
+		AllowPrivate:   config.AllowPrivate,
+		AllowHTTP:      config.AllowHTTP,
+	}
+
+	cb := &callbacks{
+		config: config,
+		client: capabilities.DefaultHTTPClient(capabilities.HTTPConfig{Enabled: true, Rules: rules}),
+		auth:   capabilities.DefaultAuthProvider(capabilities.AuthConfig{}),
+		store:  store,
+		log:    log.With().Str("module", "callbacks").Logger(),
+		stop:   make(chan struct{}),
+	}
+
+	cb.sleep = cb.pause
+
+	return cb
+}
+
+// callbackURL returns the URL that the result of an asynchronous execution of ident/namespace/name should be sent to:
+// the one in the request's CallbackURLHeader, or the one configured in the policy file. It is empty if there is none.
+func (s *Server) callbackURL(c echo.Context, ident, namespace, name string) (string, error) {
+	callback := c.Request().Header.Get(CallbackURLHeader)
+	if callback == "" {
+		callback = s.policy.ModuleCallback(ident, namespace, name)
+	}
+
+	if callback == "" {
+		return "", nil
+	}
+
+	if s.callbacks.config.Secret == "" {
+		return "", errors.New("callbacks are not enabled")
+	}
+
+	parsed, err := url.Parse(callback)
+	if err != nil {
+		return "", errors.Wrap(err, "url.Parse")
+	}
+
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("callback URL %q must be an absolute http or https URL", callback)
+	}
+
+	return callback, nil
+}
+
+// start delivers the record of an execution of the tenant in the background.
+func (cb *callbacks) start(rec *execution.Record, ident string) {
+	cb.inFlight.Add(1)
+
+	go func() {
+		defer cb.inFlight.Done()
+
+		cb.deliver(rec, ident)
+	}()
+}
+
+// drain stops deliveries from being retried, and waits for the attempts that are being made to complete.
+func (cb *callbacks) drain(ctx context.Context) error {
+	cb.stopOnce.Do(func() { close(cb.stop) })
+
+	drained := make(chan struct{})
+
+	go func() {
+		cb.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "callback deliveries did not complete")
+	}
+
+	return nil
+}
+
+// pause waits before retrying a delivery, unless the deliveries are being drained.
+func (cb *callbacks) pause(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-cb.stop:
+	}
+}
+
+// deliver POSTs the record of an execution of the tenant to its callback URL until a 2xx response is received, the
+// attempts run out, the URL is found to be disallowed, or the deliveries are drained.
+func (cb *callbacks) deliver(rec *execution.Record, ident string) {
+	ll := cb.log.With().Str("executionID", rec.ID).Str("url", rec.Callback.URL).Logger()
+
+	secret := TenantCallbackSecret(cb.config.Secret, ident)
+
+	payload := *rec
+	payload.Callback = nil
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		ll.Err(err).Msg("failed to marshal callback payload")
+		return
+	}
+
+	attempts := cb.config.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	backoff := cb.config.Backoff
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		status, err := cb.post(rec.Callback.URL, secret, body)
+
+		result := execution.CallbackAttempt{At: time.Now(), StatusCode: status}
+		if err != nil {
+			result.Error = err.Error()
+		}
+
+		// the stored record keeps a copy of the callback, so it is replaced rather than appended to.
+		delivered := err == nil
+		made := append(append([]execution.CallbackAttempt{}, rec.Callback.Attempts...), result)
+
+		rec.Callback = &execution.Callback{URL: rec.Callback.URL, Delivered: delivered, Attempts: made}
+
+		if err := cb.store.Put(rec); err != nil {
+			ll.Err(err).Msg("failed to store callback attempt")
+		}
+
+		if delivered {
+			ll.Debug().Int("attempt", attempt).Msg("delivered callback")
+			return
+		}
+
+		if disallowed(err) {
+			ll.Warn().Err(err).Msg("callback URL is disallowed")
+			return
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		cb.sleep(backoff)
+
+		select {
+		case <-cb.stop:
+			ll.Warn().Int("attempts", attempt).Msg("shutting down, giving up on callback")
+			return
+		default:
+		}
+
+		backoff *= 2
+		if cb.config.MaxBackoff > 0 && backoff > cb.config.MaxBackoff {
+			backoff = cb.config.MaxBackoff
+		}
+	}
+
+	ll.Warn().Int("attempts", len(rec.Callback.Attempts)).Msg("failed to deliver callback")
+}
+
+// post sends one callback signed with secret and returns the response's status code. Any status other than 2xx is an
+// error.
+func (cb *callbacks) post(callback, secret string, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	headers := http.Header{}
+	headers.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	headers.Set(CallbackTimestampHeader, timestamp)
+	headers.Set(CallbackSignatureHeader, CallbackSignature([]byte(secret), timestamp, body))
+
+	resp, err := cb.client.Do(cb.auth, http.MethodPost, callback, body, headers)
+	if err != nil {
+		return 0, errors.Wrap(err, "client.Do")
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback responded with %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// CallbackSignature signs a callback's timestamp and body with the secret, for the CallbackSignatureHeader. Receivers
+// verify a callback by computing the signature of the CallbackTimestampHeader and the body they received and comparing
+// it with the header.
+func CallbackSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TenantCallbackSecret derives the secret that the callbacks of a tenant are signed with from the configured secret,
+// so that the receivers of one tenant cannot forge the callbacks of another. Tenant admins can retrieve it from
+// /admin/callbacks/secret.
+func TenantCallbackSecret(secret, ident string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ident))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// callbackSecretHandler responds with the secret that the callbacks of the tenant are signed with.
+func (s *Server) callbackSecretHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.callbacks.config.Secret == "" {
+			return echo.NewHTTPError(http.StatusNotFound, "callbacks are not enabled")
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{"secret": TenantCallbackSecret(s.callbacks.config.Secret, ReadParam(c, "ident"))})
+	}
+}
+
+// disallowed returns true if the error is caused by the callback rules, in which case retrying is pointless.
+func disallowed(err error) bool {
+	for _, ruleErr := range []error{
+		capabilities.ErrHttpDisallowed,
+		capabilities.ErrIPsDisallowed,
+		capabilities.ErrPrivateDisallowed,
+		capabilities.ErrDomainDisallowed,
+		capabilities.ErrPortDisallowed,
+	} {
+		if errors.Is(err, ruleErr) {
+			return true
+		}
+	}
+
+	return false
+}
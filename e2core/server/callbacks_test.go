@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/execution"
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/policy"
+)
+
+func testCallbacks(config options.CallbackConfig) (*callbacks, *[]time.Duration) {
+	cb := newCallbacks(config, execution.NewMemoryStore(), zerolog.Nop())
+
+	slept := &[]time.Duration{}
+	cb.sleep = func(d time.Duration) { *slept = append(*slept, d) }
+
+	return cb, slept
+}
+
+func TestCallbacks_Deliver(t *testing.T) {
+	var calls atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		timestamp := r.Header.Get(CallbackTimestampHeader)
+		secret := TenantCallbackSecret("shh", "com.suborbital.app")
+		assert.Equal(t, CallbackSignature([]byte(secret), timestamp, body), r.Header.Get(CallbackSignatureHeader))
+
+		rec := execution.Record{}
+		require.NoError(t, json.Unmarshal(body, &rec))
+		assert.Equal(t, "abc-123", rec.ID)
+		assert.Equal(t, "hello world", string(rec.Output))
+		assert.Nil(t, rec.Callback)
+
+		// fail twice before accepting the callback.
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	cb, slept := testCallbacks(options.CallbackConfig{
+		Secret:       "shh",
+		Attempts:     5,
+		Backoff:      time.Second,
+		MaxBackoff:   time.Minute,
+		AllowIPs:     true,
+		AllowPrivate: true,
+		AllowHTTP:    true,
+	})
+
+	rec := execution.NewRecord("abc-123", "com.suborbital.app", "default", "hello")
+	rec.Complete([]byte("hello world"), nil)
+	rec.Callback = &execution.Callback{URL: receiver.URL}
+
+	cb.deliver(rec, "com.suborbital.app")
+
+	stored, err := cb.store.Get("abc-123")
+	require.NoError(t, err)
+	require.NotNil(t, stored.Callback)
+	assert.True(t, stored.Callback.Delivered)
+	require.Len(t, stored.Callback.Attempts, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, stored.Callback.Attempts[0].StatusCode)
+	assert.Equal(t, http.StatusNoContent, stored.Callback.Attempts[2].StatusCode)
+
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *slept)
+}
+
+func TestCallbacks_GivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	cb, slept := testCallbacks(options.CallbackConfig{
+		Secret:       "shh",
+		Attempts:     4,
+		Backoff:      time.Second,
+		MaxBackoff:   3 * time.Second,
+		AllowIPs:     true,
+		AllowPrivate: true,
+		AllowHTTP:    true,
+	})
+
+	rec := execution.NewRecord("abc-123", "com.suborbital.app", "default", "hello")
+	rec.Callback = &execution.Callback{URL: receiver.URL}
+
+	cb.deliver(rec, "com.suborbital.app")
+
+	assert.False(t, rec.Callback.Delivered)
+	assert.Len(t, rec.Callback.Attempts, 4)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}, *slept)
+}
+
+func TestCallbacks_Disallowed(t *testing.T) {
+	var calls atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+
+	// the defaults only allow HTTPS, so the receiver is never called and the delivery is not retried.
+	cb, slept := testCallbacks(options.CallbackConfig{Secret: "shh", Attempts: 5, Backoff: time.Second})
+
+	rec := execution.NewRecord("abc-123", "com.suborbital.app", "default", "hello")
+	rec.Callback = &execution.Callback{URL: receiver.URL}
+
+	cb.deliver(rec, "com.suborbital.app")
+
+	assert.Zero(t, calls.Load())
+	assert.Empty(t, *slept)
+	require.Len(t, rec.Callback.Attempts, 1)
+	assert.NotEmpty(t, rec.Callback.Attempts[0].Error)
+}
+
+func TestCallbacks_Drain(t *testing.T) {
+	var calls atomic.Int32
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	// the backoff would keep the delivery going for hours if draining did not cut it short.
+	cb := newCallbacks(options.CallbackConfig{
+		Secret:       "shh",
+		Attempts:     5,
+		Backoff:      time.Hour,
+		MaxBackoff:   time.Hour,
+		AllowIPs:     true,
+		AllowPrivate: true,
+		AllowHTTP:    true,
+	}, execution.NewMemoryStore(), zerolog.Nop())
+
+	rec := execution.NewRecord("abc-123", "com.suborbital.app", "default", "hello")
+	rec.Callback = &execution.Callback{URL: receiver.URL}
+
+	cb.start(rec, "com.suborbital.app")
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cxl := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cxl()
+
+	require.NoError(t, cb.drain(ctx))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestTenantCallbackSecret(t *testing.T) {
+	secret := TenantCallbackSecret("shh", "com.suborbital.app")
+
+	assert.Equal(t, secret, TenantCallbackSecret("shh", "com.suborbital.app"))
+	assert.NotEqual(t, secret, TenantCallbackSecret("shh", "com.suborbital.other"))
+	assert.NotEqual(t, secret, TenantCallbackSecret("other", "com.suborbital.app"))
+	assert.NotContains(t, secret, "shh")
+}
+
+func TestRespond_CallbackRequiresAsync(t *testing.T) {
+	sats := newFakeSats()
+	s := newTestServer(t, sats)
+
+	req := httptest.NewRequest(http.MethodPost, "/name/"+testIdent+"/default/a", strings.NewReader("input"))
+	req.Header.Set(CallbackURLHeader, "https://example.com/done")
+
+	rec := httptest.NewRecorder()
+	s.server.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, sats.executed)
+}
+
+func TestCallbackURL(t *testing.T) {
+	p := &policy.Policy{Modules: []policy.ModuleRule{{Ident: "com.suborbital.app", CallbackURL: "https://example.com/done"}}}
+
+	tests := []struct {
+		name    string
+		secret  string
+		ident   string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "header", secret: "shh", ident: "com.suborbital.app", header: "https://example.com/mine", want: "https://example.com/mine"},
+		{name: "policy", secret: "shh", ident: "com.suborbital.app", want: "https://example.com/done"},
+		{name: "none", secret: "shh", ident: "com.suborbital.other"},
+		{name: "relative", secret: "shh", ident: "com.suborbital.other", header: "/done", wantErr: true},
+		{name: "not http", secret: "shh", ident: "com.suborbital.other", header: "ftp://example.com", wantErr: true},
+		{name: "no secret", ident: "com.suborbital.app", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{policy: p, callbacks: &callbacks{config: options.CallbackConfig{Secret: tc.secret}}}
+
+			req := httptest.NewRequest(http.MethodPost, "/name/"+tc.ident+"/default/hello", nil)
+			if tc.header != "" {
+				req.Header.Set(CallbackURLHeader, tc.header)
+			}
+
+			callback, err := s.callbackURL(echo.New().NewContext(req, httptest.NewRecorder()), tc.ident, "default", "hello")
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, callback)
+		})
+	}
+}
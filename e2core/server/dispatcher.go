@@ -9,37 +9,53 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/suborbital/e2core/e2core/metrics"
 	"github.com/suborbital/e2core/e2core/sequence"
 	"github.com/suborbital/e2core/foundation/bus/bus"
 )
 
 const (
 	MsgTypeSuborbitalResult = "suborbital.result"
+
+	// MsgTypeSuborbitalCancel is sent to sats when an execution has timed out. Its parent ID is the ID of the request
+	// and its data is the FQMN of the module that should stop working on it.
+	MsgTypeSuborbitalCancel = "suborbital.cancel"
+
+	// defaultDispatchTimeout is used for steps whose timeout was never set.
+	defaultDispatchTimeout = time.Second * 10
 )
 
 var (
 	ErrDesiredStateNotGenerated = errors.New("desired state was not generated")
 	ErrDispatchTimeout          = errors.New("dispatched execution did not complete before the timeout")
 	ErrCannotHandle             = errors.New("cannot handle job")
+	ErrDuplicateGroupMember     = errors.New("group step contains the same module more than once")
 )
 
 type callback func(*sequence.ExecResult)
 
+// dispatchPod is the part of a *bus.Pod that the dispatcher uses to reach sats.
+type dispatchPod interface {
+	Send(msg bus.Message) *bus.MsgReceipt
+	Tunnel(capability string, msg bus.Message) error
+	OnType(msgType string, onFunc bus.MsgFunc)
+}
+
 // dispatcher is responsible for "resolving" a sequence by sending messages to sats and collecting the results
 type dispatcher struct {
 	log       zerolog.Logger
-	pod       *bus.Pod
+	pod       dispatchPod
 	callbacks map[string]callback
 	lock      *sync.RWMutex
 }
 
 type sequenceDispatcher struct {
 	seq *sequence.Sequence
-	pod *bus.Pod
+	pod dispatchPod
 	log zerolog.Logger
 }
 
-func newDispatcher(l zerolog.Logger, pod *bus.Pod) *dispatcher {
+func newDispatcher(l zerolog.Logger, pod dispatchPod) *dispatcher {
 	ll := l.With().Str("module", "dispatcher").Logger()
 	d := &dispatcher{
 		log:       ll,
@@ -62,37 +78,55 @@ func (d *dispatcher) Execute(seq *sequence.Sequence) error {
 		log: d.log,
 	}
 
+	// done is closed once Execute returns so that late results (i.e. those that arrive after a timeout)
+	// do not block the bus while waiting for a reader that is never coming.
+	done := make(chan struct{})
+	defer close(done)
+
 	resultChan := make(chan *sequence.ExecResult)
 	cb := func(result *sequence.ExecResult) {
-		resultChan <- result
+		select {
+		case resultChan <- result:
+		case <-done:
+		}
 	}
 
 	d.addCallback(seq.ParentID(), cb)
 	defer d.removeCallback(seq.ParentID())
 
-	firstStep := seq.NextStep()
-	if firstStep == nil {
+	if seq.NextStep() == nil {
 		return errors.New("sequence contains no steps")
 	}
 
-	if err := s.dispatchSingle(firstStep, resultChan); err != nil {
-		return errors.Wrap(err, "failed to dispatchSingle")
-	}
+	// sats chain consecutive single steps themselves, so we only need to dispatch a single step if it is the first
+	// step in the sequence or if it follows a group (which are always coordinated from here), otherwise we need only
+	// await its response.
+	shouldDispatch := true
 
 	for {
-		// if there is only one step in the sequence, this loop will not run
-		// but if additional steps exist, we need only await their responses
-		// as the sats will handle dispatching each subsequence step themselves
-
 		step := seq.NextStep()
 		if step == nil {
 			break
-		} else if step.IsSingle() {
-			if err := s.awaitResult(resultChan); err != nil {
+		}
+
+		if step.IsSingle() {
+			if shouldDispatch {
+				if err := s.dispatchSingle(step, resultChan); err != nil {
+					return errors.Wrap(err, "failed to dispatchSingle")
+				}
+			} else if err := s.awaitResult(step, resultChan); err != nil {
 				return errors.Wrap(err, "failed to awaitResult")
 			}
+
+			shouldDispatch = false
 		} else if step.IsGroup() {
-			return errors.Wrap(ErrCannotHandle, "dispatching group steps not yet supported")
+			if err := s.dispatchGroup(step, resultChan); err != nil {
+				return errors.Wrap(err, "failed to dispatchGroup")
+			}
+
+			shouldDispatch = true
+		} else {
+			return errors.Wrap(ErrCannotHandle, "step is neither single nor group")
 		}
 	}
 
@@ -101,26 +135,109 @@ func (d *dispatcher) Execute(seq *sequence.Sequence) error {
 
 // dispatchSingle executes a single plugin from a sequence step
 func (s *sequenceDispatcher) dispatchSingle(step *sequence.Step, resultChan chan *sequence.ExecResult) error {
+	if err := s.tunnel(step.FQMN); err != nil {
+		return errors.Wrap(err, "failed to tunnel")
+	}
+
+	return s.awaitResult(step, resultChan)
+}
+
+// dispatchGroup executes every plugin in a group step at the same time, waits for all of them to complete, and
+// then hands all the results to the sequence in one go so that their outputs are merged into the request state.
+// Results and outputs are told apart by FQMN, so a group cannot contain the same module twice.
+func (s *sequenceDispatcher) dispatchGroup(step *sequence.Step, resultChan chan *sequence.ExecResult) error {
+	pending := make(map[string]struct{}, len(step.Group))
+	for _, FQMN := range step.Group {
+		if _, exists := pending[FQMN]; exists {
+			return errors.Wrap(ErrDuplicateGroupMember, FQMN)
+		}
+
+		pending[FQMN] = struct{}{}
+	}
+
+	for _, FQMN := range step.Group {
+		if err := s.tunnel(FQMN); err != nil {
+			return errors.Wrapf(err, "failed to tunnel group member %s", FQMN)
+		}
+	}
+
+	results := make([]sequence.ExecResult, 0, len(step.Group))
+	timeout := time.After(stepTimeout(step))
+
+	for len(pending) > 0 {
+		select {
+		case result := <-resultChan:
+			if _, isPending := pending[result.FQMN]; !isPending {
+				s.log.Warn().Str("parentID", s.seq.ParentID()).Str("fqmn", result.FQMN).Msg("received result for a module that is not part of the current group, discarding")
+				continue
+			}
+
+			if result.Response == nil {
+				return fmt.Errorf("recieved nil response for %s", result.FQMN)
+			}
+
+			delete(pending, result.FQMN)
+			results = append(results, *result)
+		case <-timeout:
+			for FQMN := range pending {
+				metrics.DispatchTimeout(FQMN)
+				s.cancel(FQMN)
+			}
+
+			return ErrDispatchTimeout
+		}
+	}
+
+	if err := s.seq.HandleStepResults(results); err != nil {
+		return errors.Wrap(err, "failed to HandleStepResults")
+	}
+
+	return nil
+}
+
+// tunnel sends the sequence's request to a peer that has advertised the given FQMN.
+func (s *sequenceDispatcher) tunnel(FQMN string) error {
+	// the sat receiving the request works out which step it is executing from the sequence, so it needs to reflect
+	// the steps that have been completed so far. The request's SequenceJSON is otherwise left as it was when the
+	// sequence was created, and a single step dispatched after a group would be taken for the group's first member.
+	stepsJSON, err := s.seq.StepsJSON()
+	if err != nil {
+		return errors.Wrap(err, "failed to StepsJSON")
+	}
+
+	s.seq.Request().SequenceJSON = stepsJSON
+
 	data, err := s.seq.Request().ToJSON()
 	if err != nil {
 		return errors.Wrap(err, "failed to req.toJSON")
 	}
 
-	msg := bus.NewMsgWithParentID(step.FQMN, s.seq.ParentID(), data)
+	msg := bus.NewMsgWithParentID(FQMN, s.seq.ParentID(), data)
 
-	// find an appropriate peer and tunnel the first excution to them
-	if err := s.pod.Tunnel(step.FQMN, msg); err != nil {
+	// find an appropriate peer and tunnel the excution to them
+	if err := s.pod.Tunnel(FQMN, msg); err != nil {
+		metrics.TunnelFailure(FQMN)
 		return errors.Wrap(err, "failed to Tunnel")
 	}
 
 	s.log.Debug().Str("parentID", s.seq.ParentID()).
+		Str("fqmn", FQMN).
 		Str("msgUUID", msg.UUID()).
 		Msg("dispatched execution for parent to peer with message")
 
-	return s.awaitResult(resultChan)
+	return nil
 }
 
-func (s *sequenceDispatcher) awaitResult(resultChan chan *sequence.ExecResult) error {
+// cancel tells the sats to stop working on the sequence's request for the given module, if they still are.
+func (s *sequenceDispatcher) cancel(FQMN string) {
+	msg := bus.NewMsgWithParentID(MsgTypeSuborbitalCancel, s.seq.ParentID(), []byte(FQMN))
+
+	s.pod.Send(msg)
+
+	s.log.Debug().Str("parentID", s.seq.ParentID()).Str("fqmn", FQMN).Msg("execution timed out, sent cancellation")
+}
+
+func (s *sequenceDispatcher) awaitResult(step *sequence.Step, resultChan chan *sequence.ExecResult) error {
 	select {
 	case result := <-resultChan:
 		if result.Response == nil {
@@ -130,13 +247,24 @@ func (s *sequenceDispatcher) awaitResult(resultChan chan *sequence.ExecResult) e
 		if err := s.seq.HandleStepResults([]sequence.ExecResult{*result}); err != nil {
 			return errors.Wrap(err, "failed to HandleStepResults")
 		}
-	case <-time.After(time.Second * 10):
+	case <-time.After(stepTimeout(step)):
+		metrics.DispatchTimeout(step.FQMN)
+		s.cancel(step.FQMN)
 		return ErrDispatchTimeout
 	}
 
 	return nil
 }
 
+// stepTimeout returns how long to wait for the step to complete.
+func stepTimeout(step *sequence.Step) time.Duration {
+	if step.Timeout > 0 {
+		return step.Timeout
+	}
+
+	return defaultDispatchTimeout
+}
+
 // onMsgHandler is called when a new message is received from the pod
 func (d *dispatcher) onMsgHandler() bus.MsgFunc {
 	return func(msg bus.Message) error {
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/sequence"
+	"github.com/suborbital/e2core/foundation/bus/bus"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+// fakeSats stands in for the bus and the sats behind it. Every module that is tunneled to runs the way a sat would:
+// it reports its result to the dispatcher and, unless it is a group member, chains the next single step itself. Each
+// module outputs its own FQMN, or fails with the RunErr in failures.
+type fakeSats struct {
+	failures map[string]scheduler.RunErr
+	// bodyFailures fails the modules that run with one of its keys as the request body.
+	bodyFailures map[string]scheduler.RunErr
+	// echo makes every module respond with its request body rather than its FQMN.
+	echo bool
+	// hold, if set, keeps every module running until it is closed.
+	hold chan struct{}
+	// held counts the modules that have been kept running by hold.
+	held atomic.Int32
+
+	lock     sync.Mutex
+	handlers map[string]bus.MsgFunc
+	// executed holds the step that each module found itself at when it ran, in order.
+	executed []executedStep
+}
+
+type executedStep struct {
+	FQMN string
+	step sequence.Step
+}
+
+func newFakeSats() *fakeSats {
+	return &fakeSats{
+		failures: map[string]scheduler.RunErr{},
+		handlers: map[string]bus.MsgFunc{},
+	}
+}
+
+func (f *fakeSats) Send(msg bus.Message) *bus.MsgReceipt {
+	f.lock.Lock()
+	handler := f.handlers[msg.Type()]
+	f.lock.Unlock()
+
+	if handler != nil {
+		_ = handler(msg)
+	}
+
+	return &bus.MsgReceipt{UUID: msg.UUID()}
+}
+
+func (f *fakeSats) Tunnel(capability string, msg bus.Message) error {
+	go f.run(capability, msg)
+
+	return nil
+}
+
+func (f *fakeSats) OnType(msgType string, onFunc bus.MsgFunc) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.handlers[msgType] = onFunc
+}
+
+func (f *fakeSats) run(FQMN string, msg bus.Message) {
+	req, err := request.FromJSON(msg.Data())
+	if err != nil {
+		panic(err)
+	}
+
+	seq, err := sequence.FromJSON(req.SequenceJSON, req)
+	if err != nil {
+		panic(err)
+	}
+
+	step := seq.NextStep()
+
+	if f.hold != nil {
+		f.held.Add(1)
+		<-f.hold
+	}
+
+	f.lock.Lock()
+	f.executed = append(f.executed, executedStep{FQMN: FQMN, step: *step})
+	f.lock.Unlock()
+
+	output := []byte(FQMN)
+	if f.echo {
+		output = req.Body
+	}
+
+	result := &sequence.ExecResult{FQMN: FQMN, Response: &request.CoordinatedResponse{Output: output}}
+	if runErr, fails := f.failures[FQMN]; fails {
+		result.RunErr = runErr
+	} else if runErr, fails := f.bodyFailures[string(req.Body)]; fails {
+		result.RunErr = runErr
+	}
+
+	resultJSON, _ := json.Marshal(result)
+	f.Send(bus.NewMsgWithParentID(MsgTypeSuborbitalResult, req.ID, resultJSON))
+
+	if step.IsGroup() || seq.HandleStepResults([]sequence.ExecResult{*result}) != nil {
+		return
+	}
+
+	next := seq.NextStep()
+	if next == nil || next.IsGroup() {
+		return
+	}
+
+	req.SequenceJSON, _ = seq.StepsJSON()
+	reqJSON, _ := req.ToJSON()
+
+	_ = f.Tunnel(next.FQMN, bus.NewMsgWithParentID(next.FQMN, req.ID, reqJSON))
+}
+
+func testSequence(t *testing.T, steps []tenant.WorkflowStep) *sequence.Sequence {
+	req := &request.CoordinatedRequest{
+		Method:      http.MethodPost,
+		URL:         "/workflow/com.suborbital.test/default/test",
+		ID:          "request-id",
+		State:       map[string][]byte{},
+		RespHeaders: map[string]string{},
+	}
+
+	seq, err := sequence.New(steps, req)
+	require.NoError(t, err)
+
+	require.NoError(t, seq.SetTimeouts(func(string) time.Duration { return time.Second }))
+
+	return seq
+}
+
+func TestDispatcher_GroupThenSingles(t *testing.T) {
+	sats := newFakeSats()
+	d := newDispatcher(zerolog.Nop(), sats)
+
+	seq := testSequence(t, []tenant.WorkflowStep{
+		{Group: []string{"a", "b"}},
+		{FQMN: "c"},
+		{FQMN: "d"},
+	})
+
+	require.NoError(t, d.Execute(seq))
+
+	state := seq.Request().State
+	for _, FQMN := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, FQMN, string(state[FQMN]))
+	}
+
+	require.Len(t, sats.executed, 4)
+
+	// the step after the group must not be mistaken for a member of the group it follows, and is chained by its sat.
+	assert.Equal(t, "c", sats.executed[2].FQMN)
+	assert.Equal(t, "c", sats.executed[2].step.FQMN)
+	assert.Equal(t, "d", sats.executed[3].FQMN)
+	assert.Equal(t, "d", sats.executed[3].step.FQMN)
+}
+
+func TestDispatcher_SinglesAroundGroup(t *testing.T) {
+	sats := newFakeSats()
+	d := newDispatcher(zerolog.Nop(), sats)
+
+	seq := testSequence(t, []tenant.WorkflowStep{
+		{FQMN: "a"},
+		{Group: []string{"b", "c"}},
+		{FQMN: "d"},
+	})
+
+	require.NoError(t, d.Execute(seq))
+
+	for _, FQMN := range []string{"a", "b", "c", "d"} {
+		assert.Equal(t, FQMN, string(seq.Request().State[FQMN]))
+	}
+}
+
+func TestDispatcher_DuplicateGroupMembers(t *testing.T) {
+	sats := newFakeSats()
+	d := newDispatcher(zerolog.Nop(), sats)
+
+	seq := testSequence(t, []tenant.WorkflowStep{{Group: []string{"a", "b", "a"}}})
+
+	err := d.Execute(seq)
+	assert.ErrorIs(t, err, ErrDuplicateGroupMember)
+	assert.Empty(t, sats.executed, "no member of the group may run")
+}
+
+func TestDispatcher_GroupMemberFails(t *testing.T) {
+	sats := newFakeSats()
+	sats.failures["b"] = scheduler.RunErr{Code: http.StatusConflict, Message: "b failed"}
+
+	d := newDispatcher(zerolog.Nop(), sats)
+
+	seq := testSequence(t, []tenant.WorkflowStep{
+		{Group: []string{"a", "b"}},
+		{FQMN: "c"},
+	})
+
+	err := d.Execute(seq)
+
+	runErr := scheduler.RunErr{}
+	require.ErrorAs(t, err, &runErr)
+	assert.Equal(t, http.StatusConflict, runErr.Code)
+	assert.Nil(t, seq.Request().State["c"])
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDraining is returned for executions that are refused because the server is shutting down.
+var ErrDraining = errors.New("server is shutting down")
+
+// drainGroup counts the executions in flight so that shutdown can wait for them to complete. Unlike a bare
+// sync.WaitGroup, it refuses to count new executions once draining has started, so that none can be added while the
+// wait is underway.
+type drainGroup struct {
+	lock     sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// add counts a new execution, returning false once draining has started. done must be called when the execution
+// completes.
+func (d *drainGroup) add() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.draining {
+		return false
+	}
+
+	d.wg.Add(1)
+
+	return true
+}
+
+func (d *drainGroup) done() {
+	d.wg.Done()
+}
+
+// drain refuses new executions and waits for the counted ones to complete, or for ctx to be done.
+func (d *drainGroup) drain(ctx context.Context) error {
+	d.lock.Lock()
+	d.draining = true
+	d.lock.Unlock()
+
+	drained := make(chan struct{})
+
+	go func() {
+		d.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "executions did not complete")
+	}
+
+	return nil
+}
+
+// streamSessions holds the open stream sessions so that they can be closed on shutdown, since the HTTP server does not
+// close connections that have been upgraded to websockets.
+type streamSessions struct {
+	lock     sync.Mutex
+	closed   bool
+	sessions map[*streamSession]struct{}
+}
+
+// add holds on to a session until remove is called, returning false if the sessions have been closed.
+func (ss *streamSessions) add(session *streamSession) bool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.closed {
+		return false
+	}
+
+	if ss.sessions == nil {
+		ss.sessions = map[*streamSession]struct{}{}
+	}
+
+	ss.sessions[session] = struct{}{}
+
+	return true
+}
+
+func (ss *streamSessions) remove(session *streamSession) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	delete(ss.sessions, session)
+}
+
+// close shuts every session down, which ends it once its in-flight invocations have responded. Sessions that are added
+// later are refused.
+func (ss *streamSessions) close() {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	ss.closed = true
+
+	for session := range ss.sessions {
+		session.shutdown()
+	}
+}
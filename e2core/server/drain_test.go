@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainGroup(t *testing.T) {
+	d := &drainGroup{}
+
+	require.True(t, d.add())
+
+	ctx, cxl := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cxl()
+
+	// the counted execution has not completed.
+	assert.Error(t, d.drain(ctx))
+
+	// once draining has started, nothing more is counted.
+	assert.False(t, d.add())
+
+	d.done()
+
+	assert.NoError(t, d.drain(context.Background()))
+}
@@ -3,8 +3,10 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
 
 	"github.com/suborbital/e2core/e2core/sequence"
 	"github.com/suborbital/systemspec/request"
@@ -49,42 +51,337 @@ func (s *Server) executePluginByNameHandler() echo.HandlerFunc {
 			Str("fqmn", mod.FQMN).
 			Msg("found module with fqmn")
 
+		if rule := s.cache.rule(ident, mod); rule != nil && !preferAsync(c.Request().Header) {
+			return s.respondCached(c, req, ident, mod, rule)
+		}
+
 		steps := []tenant.WorkflowStep{{FQMN: mod.FQMN}}
 
-		// a sequence executes the handler's steps and manages its state.
-		seq, err := sequence.New(steps, req)
+		return s.respond(c, req, steps, mod.FQMN)
+	}
+}
+
+func (s *Server) executeWorkflowByNameHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ident := ReadParam(c, "ident")
+		namespace := ReadParam(c, "namespace")
+		name := ReadParam(c, "name")
+
+		ll := s.logger.With().
+			Str("ident", ident).
+			Str("namespace", namespace).
+			Str("workflow", name).
+			Logger()
+
+		wfl := s.syncer.GetWorkflowByName(ident, namespace, name)
+		if wfl == nil {
+			ll.Error().Msg("syncer did not find workflow by these details")
+			return echo.NewHTTPError(http.StatusNotFound, "workflow not found").SetInternal(fmt.Errorf("no workflow with %s/%s/%s", ident, namespace, name))
+		}
+
+		steps, err := s.resolveWorkflowSteps(ident, wfl.Steps)
+		if err != nil {
+			ll.Err(err).Msg("resolveWorkflowSteps")
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
+		}
+
+		responseKey, err := s.workflowResponseKey(ident, namespace, wfl.Response, steps)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
+		}
+
+		req, err := request.FromEchoContext(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
+		}
+
+		err = req.UseSuborbitalHeaders(c)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
 		}
 
-		if err := s.dispatcher.Execute(seq); err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "failed to execute plugin").SetInternal(err)
+		ll.Info().Int("steps", len(steps)).Msg("found workflow")
+
+		return s.respond(c, req, steps, responseKey)
+	}
+}
+
+// respond executes the steps and sends back the state found at responseKey, or if the client asked for asynchronous
+// execution, starts the execution in the background and sends back where its result can be retrieved from.
+func (s *Server) respond(c echo.Context, req *request.CoordinatedRequest, steps []tenant.WorkflowStep, responseKey string) error {
+	if _, err := requestedTimeout(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a positive duration", TimeoutHeader)).SetInternal(err)
+	}
+
+	async := preferAsync(c.Request().Header)
+
+	// the result of a synchronous execution is in the response, so it would never be sent to the callback URL.
+	if !async && c.Request().Header.Get(CallbackURLHeader) != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s requires %s: %s", CallbackURLHeader, preferHeader, preferRespondAsync))
+	}
+
+	release, err := s.limits.acquire(steps)
+	if err != nil {
+		if after, ok := retryAfter(err); ok {
+			c.Response().Header().Set(RetryAfterHeader, after)
+		}
+
+		return executionHTTPError(err)
+	}
+
+	if async {
+		return s.respondAsync(c, req, steps, responseKey, release)
+	}
+
+	defer release()
+
+	seq, err := s.executeSteps(req, steps)
+	if err != nil {
+		return executionHTTPError(err)
+	}
+
+	s.logger.Info().Str("requestID", req.ID).Str("response", responseKey).Msg("finished execution, sending back data")
+
+	return writeResponse(c, seq.Request().State[responseKey], req.RespHeaders)
+}
+
+// writeResponse sends the output back with the status code, content type, and headers that the modules set.
+func writeResponse(c echo.Context, output []byte, respHeaders map[string]string) error {
+	meta := sequence.NewResponseMeta(respHeaders)
+
+	setRespHeaders(c, meta.Headers)
+
+	if !meta.HasBody() {
+		return c.NoContent(meta.Status)
+	}
+
+	return c.Blob(meta.Status, meta.ContentType, output)
+}
+
+// executeSteps runs the given steps through the dispatcher and returns the sequence holding the final state, unless the
+// server is draining. Every execution is recorded in the audit log.
+func (s *Server) executeSteps(req *request.CoordinatedRequest, steps []tenant.WorkflowStep) (*sequence.Sequence, error) {
+	if !s.inFlight.add() {
+		return nil, ErrDraining
+	}
+
+	defer s.inFlight.done()
+
+	return s.executeCounted(req, steps)
+}
+
+// executeCounted is executeSteps for callers that have already counted the execution as in flight.
+func (s *Server) executeCounted(req *request.CoordinatedRequest, steps []tenant.WorkflowStep) (*sequence.Sequence, error) {
+	// the body is kept aside since modules can replace the request's state as they run.
+	input := req.Body
+	started := time.Now()
+
+	seq, err := s.runSteps(req, steps)
+
+	s.recordExecution(req, steps, input, started, seq, err)
+
+	return seq, err
+}
+
+func (s *Server) runSteps(req *request.CoordinatedRequest, steps []tenant.WorkflowStep) (*sequence.Sequence, error) {
+	// a sequence executes the handler's steps and manages its state.
+	seq, err := sequence.New(steps, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "sequence.New")
+	}
+
+	requested, err := requestedTimeout(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "requestedTimeout")
+	}
+
+	err = seq.SetTimeouts(func(FQMN string) time.Duration {
+		return s.moduleTimeout(FQMN, requested)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "seq.SetTimeouts")
+	}
+
+	if err := s.dispatcher.Execute(seq); err != nil {
+		return nil, errors.Wrap(err, "dispatcher.Execute")
+	}
+
+	return seq, nil
+}
+
+// setRespHeaders handles any response headers that were set by the Runnables.
+func setRespHeaders(c echo.Context, respHeaders map[string]string) {
+	for head, val := range respHeaders {
+		// need to directly assign because .Add and .Set will filter out non-standard
+		// header names, which ours are.
+		if c.Response().Header()[head] == nil {
+			c.Response().Header()[head] = make([]string, 0)
+		}
+
+		c.Response().Header()[head] = append(c.Response().Header()[head], val)
+	}
+}
+
+// resolveWorkflowSteps returns a copy of steps where every module reference (which in tenant config can be any of the
+// forms fqmn.Parse accepts) is replaced by the fully qualified FQMN of the module that the sats advertise.
+func (s *Server) resolveWorkflowSteps(ident string, steps []tenant.WorkflowStep) ([]tenant.WorkflowStep, error) {
+	tnt := s.syncer.TenantOverview(ident)
+	if tnt == nil || tnt.Config == nil {
+		return nil, fmt.Errorf("tenant %s not found", ident)
+	}
+
+	resolve := func(ref string) (string, error) {
+		mod, err := tnt.Config.FindModule(ref)
+		if err != nil {
+			return "", errors.Wrapf(err, "FindModule %s", ref)
+		}
+
+		if mod == nil {
+			return "", fmt.Errorf("workflow step references unknown module %s", ref)
 		}
 
-		// handle any response headers that were set by the Runnables.
-		if req.RespHeaders != nil {
-			for head, val := range req.RespHeaders {
-				// need to directly assign because .Add and .Set will filter out non-standard
-				// header names, which ours are.
-				if c.Response().Header()[head] == nil {
-					c.Response().Header()[head] = make([]string, 0)
+		return mod.FQMN, nil
+	}
+
+	resolved := make([]tenant.WorkflowStep, len(steps))
+
+	for i, step := range steps {
+		if step.IsSingle() {
+			FQMN, err := resolve(step.FQMN)
+			if err != nil {
+				return nil, err
+			}
+
+			resolved[i] = tenant.WorkflowStep{FQMN: FQMN}
+		} else if step.IsGroup() {
+			group := make([]string, len(step.Group))
+
+			for j, ref := range step.Group {
+				FQMN, err := resolve(ref)
+				if err != nil {
+					return nil, err
 				}
 
-				c.Response().Header()[head] = append(c.Response().Header()[head], val)
+				group[j] = FQMN
+			}
+
+			resolved[i] = tenant.WorkflowStep{Group: group}
+		} else {
+			return nil, fmt.Errorf("workflow step at position %d is neither a single step nor a group", i)
+		}
+	}
+
+	return resolved, nil
+}
+
+// workflowResponseKey determines which state key holds a workflow's response. If the workflow declares a response, it
+// is resolved to a module FQMN where possible, otherwise the output of the last (single) step is used.
+func (s *Server) workflowResponseKey(ident, namespace, response string, steps []tenant.WorkflowStep) (string, error) {
+	if response != "" {
+		tnt := s.syncer.TenantOverview(ident)
+		if tnt != nil && tnt.Config != nil {
+			for _, ref := range []string{response, fmt.Sprintf("/name/%s/%s", namespace, response)} {
+				if mod, err := tnt.Config.FindModule(ref); err == nil && mod != nil {
+					return mod.FQMN, nil
+				}
 			}
 		}
 
-		responseData := seq.Request().State[mod.FQMN]
+		return response, nil
+	}
+
+	if len(steps) == 0 {
+		return "", errors.New("workflow contains no steps")
+	}
+
+	last := steps[len(steps)-1]
+	if !last.IsSingle() {
+		return "", errors.New("workflow ends with a group step but does not declare a response")
+	}
+
+	return last.FQMN, nil
+}
+
+// resolveTarget finds the steps to execute for a module or a workflow (exactly one of which is named) that is not
+// invoked through its route, such as by a schedule or a trigger, and the state key holding the response. If override
+// is set, it replaces the workflow's steps.
+func (s *Server) resolveTarget(ident, namespace, module, workflow string, override []tenant.WorkflowStep) ([]tenant.WorkflowStep, string, error) {
+	if module != "" {
+		mod := s.syncer.GetModuleByName(ident, namespace, module)
+		if mod == nil {
+			return nil, "", fmt.Errorf("no module with %s/%s/%s", ident, namespace, module)
+		}
+
+		return []tenant.WorkflowStep{{FQMN: mod.FQMN}}, mod.FQMN, nil
+	}
+
+	wfl := s.syncer.GetWorkflowByName(ident, namespace, workflow)
+	if wfl == nil {
+		return nil, "", fmt.Errorf("no workflow with %s/%s/%s", ident, namespace, workflow)
+	}
+
+	steps := wfl.Steps
+	if len(override) > 0 {
+		steps = override
+	}
+
+	resolved, err := s.resolveWorkflowSteps(ident, steps)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "resolveWorkflowSteps")
+	}
+
+	responseKey, err := s.workflowResponseKey(ident, namespace, wfl.Response, resolved)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "workflowResponseKey")
+	}
+
+	return resolved, responseKey, nil
+}
+
+// executeTarget runs resolved steps for an execution that did not come in through a route, and returns the state at
+// responseKey along with the status code set by the modules. If the execution fails, it returns the error (and its
+// status code) that a route would have responded with. The caller must have counted the execution as in flight.
+func (s *Server) executeTarget(req *request.CoordinatedRequest, steps []tenant.WorkflowStep, responseKey string) ([]byte, int, *echo.HTTPError) {
+	release, err := s.limits.acquire(steps)
+	if err != nil {
+		httpErr := executionHTTPError(err)
+		return nil, httpErr.Code, httpErr
+	}
 
-		ll.Info().Str("fqmn", mod.FQMN).Msg("finished execution of the module, sending back data")
+	defer release()
 
-		return c.Blob(http.StatusOK, "application/octet-stream", responseData)
+	seq, err := s.executeCounted(req, steps)
+	if err != nil {
+		httpErr := executionHTTPError(err)
+		return nil, httpErr.Code, httpErr
 	}
+
+	return seq.Request().State[responseKey], sequence.NewResponseMeta(req.RespHeaders).Status, nil
 }
 
+// healthHandler reports that the server is alive. With the verbose query param, it adds the outcome of the readiness
+// checks, which do not affect the response's status.
 func (s *Server) healthHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]bool{"healthy": true})
+		if _, verbose := c.QueryParams()["verbose"]; !verbose {
+			return c.JSON(http.StatusOK, map[string]bool{"healthy": true})
+		}
+
+		readiness := s.readiness(c.Request().Context())
+
+		return c.JSON(http.StatusOK, map[string]any{"healthy": true, "ready": readiness.Ready, "checks": readiness.Checks})
+	}
+}
+
+// readyHandler responds with 200 once the server can serve executions, and 503 until then.
+func (s *Server) readyHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		readiness := s.readiness(c.Request().Context())
+		if !readiness.Ready {
+			return c.JSON(http.StatusServiceUnavailable, readiness)
+		}
+
+		return c.JSON(http.StatusOK, readiness)
 	}
 }
 
@@ -98,3 +395,21 @@ func ReadParam(ctx echo.Context, name string) string {
 
 	return ctx.Param(name)
 }
+
+// identQueryParam exposes the ident query param as a path param for routes that are not scoped to a tenant by their
+// path, so that the authorization middleware can authorize access to the tenant.
+func identQueryParam() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ident := c.QueryParam("ident")
+			if ident == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "ident query param is required")
+			}
+
+			c.SetParamNames("ident")
+			c.SetParamValues(ident)
+
+			return next(c)
+		}
+	}
+}
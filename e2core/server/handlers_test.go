@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/execution"
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/policy"
+	"github.com/suborbital/e2core/e2core/syncer"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	kitError "github.com/suborbital/go-kit/web/error"
+	"github.com/suborbital/go-kit/web/mid"
+	"github.com/suborbital/systemspec/capabilities"
+	"github.com/suborbital/systemspec/system"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func TestWriteResponse(t *testing.T) {
+	tests := []struct {
+		name            string
+		respHeaders     map[string]string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{"defaults", map[string]string{}, http.StatusOK, "application/octet-stream", "output"},
+		{"status and content type", map[string]string{"X-Suborbital-Status": "201", "content-type": "application/json"}, http.StatusCreated, "application/json", "output"},
+		{"no content", map[string]string{"x-suborbital-status": "204"}, http.StatusNoContent, "", ""},
+		{"invalid status", map[string]string{"X-Suborbital-Status": "teapot"}, http.StatusOK, "application/octet-stream", "output"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+
+			require.NoError(t, writeResponse(c, []byte("output"), tc.respHeaders))
+
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			assert.Equal(t, tc.wantContentType, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, tc.wantBody, rec.Body.String())
+			assert.Empty(t, rec.Header().Get("X-Suborbital-Status"))
+		})
+	}
+}
+
+func TestExecutionHTTPError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantMsg    string
+	}{
+		{"run error", errors.Wrap(scheduler.RunErr{Code: http.StatusConflict, Message: "already exists"}, "dispatcher.Execute"), http.StatusConflict, "already exists"},
+		{"run error without an error status", scheduler.RunErr{Code: 1, Message: "oops"}, http.StatusInternalServerError, "failed to execute plugin"},
+		{"quota", &limitError{err: common.TooManyRequests("more than 1 concurrent executions")}, http.StatusTooManyRequests, "too many requests"},
+		{"timeout", errors.Wrap(ErrDispatchTimeout, "dispatcher.Execute"), http.StatusGatewayTimeout, "execution timed out"},
+		{"draining", ErrDraining, http.StatusServiceUnavailable, "server is shutting down"},
+		{"other", errors.New("boom"), http.StatusInternalServerError, "failed to execute plugin"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			httpErr := executionHTTPError(tc.err)
+
+			assert.Equal(t, tc.wantStatus, httpErr.Code)
+			assert.Equal(t, tc.wantMsg, httpErr.Message)
+		})
+	}
+}
+
+const testIdent = "com.suborbital.test"
+
+// testSource is a system.Source serving a single tenant's config and module metadata.
+type testSource struct {
+	config   *tenant.Config
+	metadata metadata.Tenant
+}
+
+func (s *testSource) ModuleMetadata(string, int64) (metadata.Tenant, error) {
+	return s.metadata, nil
+}
+
+func (s *testSource) Start() error { return nil }
+
+func (s *testSource) State() (*system.State, error) {
+	return &system.State{SystemVersion: s.config.TenantVersion}, nil
+}
+
+func (s *testSource) Overview() (*system.Overview, error) {
+	return &system.Overview{
+		State:      system.State{SystemVersion: s.config.TenantVersion},
+		TenantRefs: system.References{Identifiers: map[string]int64{s.config.Identifier: s.config.TenantVersion}},
+	}, nil
+}
+
+func (s *testSource) TenantOverview(ident string) (*system.TenantOverview, error) {
+	if ident != s.config.Identifier {
+		return nil, system.ErrTenantNotFound
+	}
+
+	return &system.TenantOverview{Identifier: ident, Version: s.config.TenantVersion, Config: s.config}, nil
+}
+
+func (s *testSource) GetModule(string) (*tenant.Module, error) {
+	return nil, system.ErrModuleNotFound
+}
+
+func (s *testSource) Workflows(string, string, int64) ([]tenant.Workflow, error) {
+	return s.config.DefaultNamespace.Workflows, nil
+}
+
+func (s *testSource) Connections(string, string, int64) ([]tenant.Connection, error) {
+	return nil, nil
+}
+
+func (s *testSource) Authentication(string, string, int64) (*tenant.Authentication, error) {
+	return nil, system.ErrTenantNotFound
+}
+
+func (s *testSource) Capabilities(string, string, int64) (*capabilities.CapabilityConfig, error) {
+	config := capabilities.DefaultCapabilityConfig()
+	return &config, nil
+}
+
+// testFQMN returns the FQMN of the test tenant's module with the given name.
+func testFQMN(name string) string {
+	return fmt.Sprintf("fqmn://%s/default/%s@v1", testIdent, name)
+}
+
+// newTestServer creates a Server for the test tenant, whose modules a, b, c and d run on sats, and which has the
+// workflows:
+//
+//	chain:   a -> b -> c
+//	fanout:  a -> [b, c] -> d
+func newTestServer(t *testing.T, sats *fakeSats) *Server {
+	config := &tenant.Config{
+		Identifier:    testIdent,
+		TenantVersion: 1,
+		DefaultNamespace: tenant.NamespaceConfig{
+			Name: "default",
+			Workflows: []tenant.Workflow{
+				{Name: "chain", Steps: []tenant.WorkflowStep{{FQMN: testFQMN("a")}, {FQMN: testFQMN("b")}, {FQMN: testFQMN("c")}}},
+				{Name: "fanout", Steps: []tenant.WorkflowStep{{FQMN: testFQMN("a")}, {Group: []string{testFQMN("b"), testFQMN("c")}}, {FQMN: testFQMN("d")}}},
+			},
+		},
+	}
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		config.Modules = append(config.Modules, tenant.Module{Name: name, Namespace: "default", Ref: "v1", FQMN: testFQMN(name)})
+	}
+
+	opts := &options.Options{ExecutionRetention: time.Hour}
+	s := syncer.New(opts, zerolog.Nop(), &testSource{config: config})
+	require.NoError(t, s.Start())
+
+	p := &policy.Policy{}
+	executions := execution.NewMemoryStore()
+
+	server := &Server{
+		server:     echo.New(),
+		syncer:     s,
+		dispatcher: newDispatcher(zerolog.Nop(), sats),
+		executions: executions,
+		lastPrune:  &atomic.Int64{},
+		callbacks:  newCallbacks(opts.CallbackConfig, executions, zerolog.Nop()),
+		pending:    make(chan struct{}, 10),
+		policy:     p,
+		limits:     newLimiter(p, s.ModuleMetadata),
+		cache:      newResponseCache(p, common.SystemTime()),
+		inFlight:   &drainGroup{},
+		streams:    &streamSessions{},
+		options:    opts,
+		logger:     zerolog.Nop(),
+	}
+
+	server.server.HTTPErrorHandler = kitError.Handler(zerolog.Nop())
+	server.server.Use(mid.UUIDRequestID())
+	server.server.POST("/name/:ident/:namespace/:name", server.executePluginByNameHandler())
+	server.server.POST("/workflow/:ident/:namespace/:name", server.executeWorkflowByNameHandler())
+
+	return server
+}
+
+func TestExecuteWorkflowByNameHandler(t *testing.T) {
+	post := func(s *Server, workflow string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/workflow/"+testIdent+"/default/"+workflow, strings.NewReader("input"))
+
+		s.server.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("runs every step and responds with the last", func(t *testing.T) {
+		sats := newFakeSats()
+
+		rec := post(newTestServer(t, sats), "chain")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, testFQMN("c"), rec.Body.String())
+
+		require.Len(t, sats.executed, 3)
+
+		for i, name := range []string{"a", "b", "c"} {
+			assert.Equal(t, testFQMN(name), sats.executed[i].FQMN)
+		}
+	})
+
+	t.Run("runs a group between single steps", func(t *testing.T) {
+		sats := newFakeSats()
+
+		rec := post(newTestServer(t, sats), "fanout")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, testFQMN("d"), rec.Body.String())
+		assert.Len(t, sats.executed, 4)
+	})
+
+	t.Run("refused while draining", func(t *testing.T) {
+		sats := newFakeSats()
+		s := newTestServer(t, sats)
+
+		require.NoError(t, s.Drain(context.Background()))
+
+		rec := post(s, "chain")
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Empty(t, sats.executed)
+	})
+
+	t.Run("unknown workflow", func(t *testing.T) {
+		sats := newFakeSats()
+
+		rec := post(newTestServer(t, sats), "missing")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Empty(t, sats.executed)
+	})
+
+	t.Run("a step fails", func(t *testing.T) {
+		sats := newFakeSats()
+		sats.failures[testFQMN("b")] = scheduler.RunErr{Code: http.StatusUnprocessableEntity, Message: "b cannot handle the input"}
+
+		rec := post(newTestServer(t, sats), "chain")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "b cannot handle the input")
+
+		// the workflow stops at the failed step.
+		require.Len(t, sats.executed, 2)
+		assert.Equal(t, testFQMN("b"), sats.executed[1].FQMN)
+	})
+}
@@ -45,6 +45,9 @@ func setupTracing(config options.TracerConfig, logger zerolog.Logger) (func(ctx
 			Probability: config.Probability,
 			ServiceName: config.ServiceName,
 		})
+		if err != nil {
+			return emptyShutdown, errors.Wrap(err, "observability.OtelTracer")
+		}
 
 		return tp.Shutdown, nil
 	default:
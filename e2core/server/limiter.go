@@ -0,0 +1,196 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/e2core/policy"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/fqmn"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const (
+	RetryAfterHeader = "Retry-After"
+
+	// concurrencyRetryAfter is suggested to clients rejected because of a concurrency quota, since there is no way to
+	// know when an execution will finish.
+	concurrencyRetryAfter = time.Second
+)
+
+// limitError is returned when an execution is rejected by a quota. It wraps common.ErrLimit.
+type limitError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *limitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *limitError) Unwrap() error {
+	return e.err
+}
+
+// limiter enforces rate and concurrency quotas on executions. A module's quotas come from its metadata in the tenant
+// config, or from the policy if its metadata sets none.
+type limiter struct {
+	policy   *policy.Policy
+	metadata func(ident, namespace, name string) metadata.Module
+	quotas   map[string]*quota
+	lock     sync.Mutex
+}
+
+type quota struct {
+	rate     *rate.Limiter
+	inFlight int
+}
+
+func newLimiter(p *policy.Policy, md func(ident, namespace, name string) metadata.Module) *limiter {
+	return &limiter{
+		policy:   p,
+		metadata: md,
+		quotas:   map[string]*quota{},
+		lock:     sync.Mutex{},
+	}
+}
+
+// acquire reserves an execution of the steps in every quota that applies to their modules, each quota being counted
+// once even if several modules share it. The returned func releases the reservation and must be called when the
+// execution has finished. If any quota is exhausted nothing is reserved, and the error wraps common.ErrLimit.
+func (l *limiter) acquire(steps []tenant.WorkflowStep) (func(), error) {
+	limits := map[string]policy.Limit{}
+
+	for _, step := range steps {
+		FQMNs := step.Group
+		if step.IsSingle() {
+			FQMNs = []string{step.FQMN}
+		}
+
+		for _, FQMN := range FQMNs {
+			parsed, err := fqmn.Parse(FQMN)
+			if err != nil {
+				continue
+			}
+
+			for _, limit := range l.moduleLimits(parsed.Tenant, parsed.Namespace, parsed.Name) {
+				limits[limit.Key] = limit
+			}
+		}
+	}
+
+	if len(limits) == 0 {
+		return func() {}, nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// check concurrency first so that a rejected execution does not use up any rate quota.
+	for key, limit := range limits {
+		if q := l.quota(key, limit); limit.Concurrency > 0 && q.inFlight >= limit.Concurrency {
+			return nil, &limitError{
+				err:        common.TooManyRequests("more than %d concurrent executions", limit.Concurrency),
+				retryAfter: concurrencyRetryAfter,
+			}
+		}
+	}
+
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, len(limits))
+
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+
+	for key, limit := range limits {
+		q := l.quota(key, limit)
+		if q.rate == nil {
+			continue
+		}
+
+		r := q.rate.ReserveN(now, 1)
+		if delay := r.DelayFrom(now); !r.OK() || delay > 0 {
+			r.CancelAt(now)
+			cancel()
+
+			return nil, &limitError{
+				err:        common.TooManyRequests("more than %g executions per second", limit.RPS),
+				retryAfter: delay,
+			}
+		}
+
+		reservations = append(reservations, r)
+	}
+
+	for key := range limits {
+		l.quotas[key].inFlight++
+	}
+
+	once := sync.Once{}
+
+	release := func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+
+			for key := range limits {
+				l.quotas[key].inFlight--
+			}
+		})
+	}
+
+	return release, nil
+}
+
+// moduleLimits returns the quotas that apply to a module. The limits from the module's metadata are keyed on their
+// values as well, so that a tenant version that changes them starts with fresh quotas.
+func (l *limiter) moduleLimits(ident, namespace, name string) []policy.Limit {
+	if md := l.metadata(ident, namespace, name).Limits; md != nil {
+		key := fmt.Sprintf("metadata:%s/%s/%s:%g/%d/%d", ident, namespace, name, md.RPS, md.Burst, md.Concurrency)
+
+		return []policy.Limit{policy.NewLimit(key, md.RPS, md.Burst, md.Concurrency)}
+	}
+
+	return l.policy.ModuleLimits(ident, namespace, name)
+}
+
+// quota returns the quota for the key, creating it if needed. The lock must be held.
+func (l *limiter) quota(key string, limit policy.Limit) *quota {
+	q, exists := l.quotas[key]
+	if !exists {
+		q = &quota{}
+
+		if limit.RPS > 0 {
+			q.rate = rate.NewLimiter(rate.Limit(limit.RPS), limit.Burst)
+		}
+
+		l.quotas[key] = q
+	}
+
+	return q
+}
+
+// retryAfter returns the value for the Retry-After header if err was caused by a quota.
+func retryAfter(err error) (string, bool) {
+	limitErr := &limitError{}
+	if !errors.As(err, &limitErr) {
+		return "", false
+	}
+
+	seconds := math.Ceil(limitErr.retryAfter.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return strconv.Itoa(int(seconds)), true
+}
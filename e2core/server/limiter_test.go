@@ -0,0 +1,115 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/e2core/policy"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func noMetadata(string, string, string) metadata.Module {
+	return metadata.Module{}
+}
+
+func TestLimiterConcurrency(t *testing.T) {
+	l := newLimiter(&policy.Policy{
+		Limits: []policy.LimitRule{
+			{Ident: "com.suborbital.app", Module: "noisy", Concurrency: 1},
+		},
+	}, noMetadata)
+
+	noisy := []tenant.WorkflowStep{{FQMN: "fqmn://com.suborbital.app/default/noisy@v1.0.0"}}
+	quiet := []tenant.WorkflowStep{{FQMN: "fqmn://com.suborbital.app/default/quiet@v1.0.0"}}
+
+	release, err := l.acquire(noisy)
+	require.NoError(t, err)
+
+	_, err = l.acquire(noisy)
+	assert.True(t, common.IsError(err, common.ErrLimit))
+
+	after, ok := retryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, "1", after)
+
+	releaseQuiet, err := l.acquire(quiet)
+	require.NoError(t, err, "other modules are not affected")
+	releaseQuiet()
+
+	release()
+	release() // releasing twice must not free up an extra slot
+
+	release, err = l.acquire(noisy)
+	require.NoError(t, err)
+
+	_, err = l.acquire(noisy)
+	assert.True(t, common.IsError(err, common.ErrLimit))
+
+	release()
+}
+
+func TestLimiterRate(t *testing.T) {
+	l := newLimiter(&policy.Policy{
+		Limits: []policy.LimitRule{
+			{Per: policy.PerTenant, RPS: 0.1, Burst: 2},
+		},
+	}, noMetadata)
+
+	group := []tenant.WorkflowStep{{Group: []string{
+		"fqmn://com.suborbital.app/default/one@v1.0.0",
+		"fqmn://com.suborbital.app/default/two@v1.0.0",
+	}}}
+
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(group)
+		require.NoError(t, err, "a tenant wide quota is counted once per execution")
+		release()
+	}
+
+	_, err := l.acquire(group)
+	assert.True(t, common.IsError(err, common.ErrLimit))
+
+	after, ok := retryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, "10", after)
+
+	release, err := l.acquire([]tenant.WorkflowStep{{FQMN: "fqmn://com.suborbital.other/default/one@v1.0.0"}})
+	require.NoError(t, err, "other tenants have their own quota")
+	release()
+}
+
+func TestLimiterMetadata(t *testing.T) {
+	md := metadata.Tenant{metadata.Key("default", "noisy"): {Limits: &metadata.Limits{Concurrency: 2}}}
+
+	l := newLimiter(&policy.Policy{
+		Limits: []policy.LimitRule{
+			{Ident: "com.suborbital.app", Concurrency: 1},
+		},
+	}, func(_, namespace, name string) metadata.Module {
+		return md.Module(namespace, name)
+	})
+
+	noisy := []tenant.WorkflowStep{{FQMN: "fqmn://com.suborbital.app/default/noisy@v1.0.0"}}
+	quiet := []tenant.WorkflowStep{{FQMN: "fqmn://com.suborbital.app/default/quiet@v1.0.0"}}
+
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(noisy)
+		require.NoError(t, err, "the limits from the metadata replace the policy's")
+		defer release()
+	}
+
+	_, err := l.acquire(noisy)
+	assert.True(t, common.IsError(err, common.ErrLimit))
+
+	release, err := l.acquire(quiet)
+	require.NoError(t, err)
+
+	_, err = l.acquire(quiet)
+	assert.True(t, common.IsError(err, common.ErrLimit), "modules without limits in their metadata fall back to the policy")
+
+	release()
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/suborbital/e2core/e2core/metrics"
+	"github.com/suborbital/e2core/e2core/rpc"
+)
+
+// observeRequests records the count and latency of execution requests. It goes after the authorization middleware so
+// that requests for tenants that do not exist do not create series.
+func (s *Server) observeRequests() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			metrics.ObserveRequest(
+				ReadParam(c, "ident"),
+				ReadParam(c, "namespace"),
+				ReadParam(c, "name"),
+				metrics.TransportHTTP,
+				strconv.Itoa(responseCode(c, err)),
+				start,
+			)
+
+			return err
+		}
+	}
+}
+
+// responseCode returns the status code that the response will be sent with, which is not written yet if the handler
+// returned an error.
+func responseCode(c echo.Context, err error) int {
+	if err == nil {
+		return c.Response().Status
+	}
+
+	httpErr := &echo.HTTPError{}
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+
+	return http.StatusInternalServerError
+}
+
+// observeRPC is the gRPC counterpart of observeRequests. Calls that failed authorization are not recorded.
+func observeRPC(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	in, ok := req.(*rpc.ExecuteRequest)
+	if code := status.Code(err); ok && code != codes.Unauthenticated {
+		metrics.ObserveRequest(in.Ident, in.Namespace, in.Name, metrics.TransportGRPC, code.String(), start)
+	}
+
+	return resp, err
+}
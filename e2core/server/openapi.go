@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/e2core/openapi"
+)
+
+// openapiDocs holds the OpenAPI documents generated for the system version that the syncer last saw. They are all
+// dropped once the version changes, since any tenant may have changed with it.
+type openapiDocs struct {
+	version int64
+	docs    map[string][]byte
+	lock    sync.Mutex
+}
+
+func newOpenapiDocs() *openapiDocs {
+	return &openapiDocs{docs: map[string][]byte{}}
+}
+
+// get returns the document stored under key for the system version, calling generate to create it if there is none.
+func (o *openapiDocs) get(version int64, key string, generate func() (*openapi.Document, error)) ([]byte, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if version != o.version {
+		o.version = version
+		o.docs = map[string][]byte{}
+	}
+
+	if doc, exists := o.docs[key]; exists {
+		return doc, nil
+	}
+
+	doc, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+
+	o.docs[key] = data
+
+	return data, nil
+}
+
+// openapiHandler returns an OpenAPI document describing the modules and workflows of the tenant given by the ident
+// query param.
+func (s *Server) openapiHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// the document's paths use the ident that the client called with, while the tenant is looked up by the ID that
+		// the authorization middleware found for it.
+		ident := ReadParam(c, "ident")
+		pathIdent := c.Param("ident")
+
+		version := s.syncer.State().SystemVersion
+
+		doc, err := s.openapi.get(version, ident+"/"+pathIdent, func() (*openapi.Document, error) {
+			ovv := s.syncer.TenantOverview(ident)
+			if ovv == nil || ovv.Config == nil {
+				return nil, echo.NewHTTPError(http.StatusNotFound, "tenant not found").SetInternal(fmt.Errorf("no tenant %s", ident))
+			}
+
+			schemas := func(namespace, module string) *metadata.Schema {
+				return s.syncer.ModuleMetadata(ident, namespace, module).Schema
+			}
+
+			return openapi.Generate(ovv.Config, schemas, openapi.Options{PathIdent: pathIdent, Authenticated: s.options.AuthConfig.Mode != auth.ModeDisabled}), nil
+		})
+
+		if err != nil {
+			httpErr := &echo.HTTPError{}
+			if errors.As(err, &httpErr) {
+				return httpErr
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to generate document").SetInternal(err)
+		}
+
+		return c.JSONBlob(http.StatusOK, doc)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/e2core/openapi"
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/syncer"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func TestOpenapiDocs(t *testing.T) {
+	docs := newOpenapiDocs()
+
+	generated := 0
+	generate := func() (*openapi.Document, error) {
+		generated++
+		return &openapi.Document{OpenAPI: openapi.Version}, nil
+	}
+
+	first, err := docs.get(1, "com.suborbital.app", generate)
+	require.NoError(t, err)
+
+	_, err = docs.get(1, "com.suborbital.app", generate)
+	require.NoError(t, err)
+	assert.Equal(t, 1, generated)
+
+	// a new system version regenerates every document.
+	second, err := docs.get(2, "com.suborbital.app", generate)
+	require.NoError(t, err)
+	assert.Equal(t, 2, generated)
+	assert.JSONEq(t, string(first), string(second))
+}
+
+func TestOpenapiHandler_SchemasFromMetadata(t *testing.T) {
+	config := &tenant.Config{
+		Identifier:       testIdent,
+		TenantVersion:    1,
+		DefaultNamespace: tenant.NamespaceConfig{Name: "default"},
+		Modules:          []tenant.Module{{Name: "greet", Namespace: "default", Ref: "v1", FQMN: testFQMN("greet")}},
+	}
+
+	input := map[string]any{"type": "object"}
+
+	source := &testSource{
+		config:   config,
+		metadata: metadata.Tenant{metadata.Key("default", "greet"): {Schema: &metadata.Schema{Input: input}}},
+	}
+
+	opts := &options.Options{}
+
+	sync := syncer.New(opts, zerolog.Nop(), source)
+	require.NoError(t, sync.Start())
+
+	s := &Server{server: echo.New(), options: opts, syncer: sync, openapi: newOpenapiDocs(), logger: zerolog.Nop()}
+	s.server.GET("/openapi.json", s.openapiHandler(), identQueryParam())
+
+	rec := httptest.NewRecorder()
+	s.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json?ident="+testIdent, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	doc := openapi.Document{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+
+	greet := doc.Paths["/name/"+testIdent+"/default/greet"]
+	require.NotNil(t, greet)
+	assert.Equal(t, input, greet.Post.RequestBody.Content["application/json"].Schema)
+}
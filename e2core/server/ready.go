@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	E2CoreReadyURI = "/ready"
+
+	CheckSyncer  = "syncer"
+	CheckModules = "modules"
+	CheckSource  = "source"
+
+	// sourceCheckTimeout is how long the system source gets to respond to a readiness check.
+	sourceCheckTimeout = 2 * time.Second
+)
+
+// Readiness reports whether the server can serve executions, and the outcome of each check that decides it.
+type Readiness struct {
+	Ready  bool    `json:"ready"`
+	Checks []Check `json:"checks"`
+}
+
+// Check is the outcome of one readiness check.
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// readiness runs every readiness check: the syncer must have completed a sync and its last sync must have succeeded,
+// every module must be served by at least one sat on the mesh, and the system source that the sats load modules from
+// must respond.
+func (s *Server) readiness(ctx context.Context) Readiness {
+	checks := []Check{s.checkSyncer(), s.checkModules(), s.checkSource(ctx)}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+
+	return Readiness{Ready: ready, Checks: checks}
+}
+
+func (s *Server) checkSyncer() Check {
+	status := s.syncer.Status()
+
+	switch {
+	case !status.Synced && status.Error != "":
+		return Check{Name: CheckSyncer, Message: "initial sync failed: " + status.Error}
+	case !status.Synced:
+		return Check{Name: CheckSyncer, Message: "initial sync has not completed"}
+	case status.Error != "":
+		return Check{Name: CheckSyncer, Message: "last sync failed: " + status.Error}
+	}
+
+	return Check{Name: CheckSyncer, OK: true, Message: fmt.Sprintf("synced at %s", status.LastSync.Format(time.RFC3339))}
+}
+
+// checkModules fails if a module has no sat advertising its FQMN, since executing it would fail until one joins. The
+// probes are not authenticated, so only the number of missing modules is reported, not which tenants they belong to.
+func (s *Server) checkModules() Check {
+	missing, total := 0, 0
+
+	for ident := range s.syncer.ListTenants() {
+		ovv := s.syncer.TenantOverview(ident)
+		if ovv == nil || ovv.Config == nil {
+			continue
+		}
+
+		for _, mod := range ovv.Config.Modules {
+			total++
+
+			if !s.bus.HasCapability(mod.FQMN) {
+				missing++
+			}
+		}
+	}
+
+	if missing > 0 {
+		return Check{Name: CheckModules, Message: fmt.Sprintf("%d of %d modules have no sat", missing, total)}
+	}
+
+	return Check{Name: CheckModules, OK: true, Message: fmt.Sprintf("%d modules served", total)}
+}
+
+func (s *Server) checkSource(ctx context.Context) Check {
+	if err := pingSource(ctx, s.options.ControlPlane); err != nil {
+		return Check{Name: CheckSource, Message: err.Error()}
+	}
+
+	return Check{Name: CheckSource, OK: true}
+}
+
+// pingSource returns an error if the system source at host does not respond. Any response other than a server error
+// counts, since an external control plane may require credentials that e2core does not hold.
+func pingSource(ctx context.Context, host string) error {
+	if host == "" {
+		return errors.New("no system source is configured")
+	}
+
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sourceCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/system/v1/state", nil)
+	if err != nil {
+		return errors.Wrap(err, "http.NewRequestWithContext")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "system source is unreachable")
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("system source responded with %d", resp.StatusCode)
+	}
+
+	return nil
+}
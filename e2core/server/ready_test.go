@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/syncer"
+	"github.com/suborbital/e2core/foundation/bus/bus"
+	"github.com/suborbital/systemspec/system"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func TestPingSource(t *testing.T) {
+	status := http.StatusOK
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/system/v1/state", r.URL.Path)
+		w.WriteHeader(status)
+	}))
+
+	assert.NoError(t, pingSource(context.Background(), source.URL))
+
+	// an external control plane may refuse e2core's credentials, but it is reachable.
+	status = http.StatusUnauthorized
+	assert.NoError(t, pingSource(context.Background(), source.URL))
+
+	status = http.StatusBadGateway
+	assert.Error(t, pingSource(context.Background(), source.URL))
+
+	source.Close()
+	assert.Error(t, pingSource(context.Background(), source.URL))
+
+	assert.Error(t, pingSource(context.Background(), ""))
+}
+
+// flakySource is a testSource whose state can be made to fail.
+type flakySource struct {
+	*testSource
+	failing atomic.Bool
+}
+
+func (s *flakySource) State() (*system.State, error) {
+	if s.failing.Load() {
+		return nil, errors.New("source is down")
+	}
+
+	return s.testSource.State()
+}
+
+func TestCheckSyncer(t *testing.T) {
+	config := &tenant.Config{Identifier: testIdent, TenantVersion: 1, DefaultNamespace: tenant.NamespaceConfig{Name: "default"}}
+	source := &flakySource{testSource: &testSource{config: config}}
+
+	s := &Server{syncer: syncer.New(&options.Options{}, zerolog.Nop(), source)}
+
+	check := s.checkSyncer()
+	assert.False(t, check.OK)
+	assert.Equal(t, "initial sync has not completed", check.Message)
+
+	source.failing.Store(true)
+	require.Error(t, s.syncer.Start())
+
+	check = s.checkSyncer()
+	assert.False(t, check.OK)
+	assert.Contains(t, check.Message, "initial sync failed")
+
+	source.failing.Store(false)
+
+	s.syncer = syncer.New(&options.Options{}, zerolog.Nop(), source)
+	require.NoError(t, s.syncer.Start())
+
+	check = s.checkSyncer()
+	assert.True(t, check.OK)
+	assert.Contains(t, check.Message, "synced at")
+
+	// the syncer keeps syncing in the background, and a failure after the first sync makes the server unready.
+	source.failing.Store(true)
+
+	require.Eventually(t, func() bool {
+		check = s.checkSyncer()
+		return !check.OK
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Contains(t, check.Message, "last sync failed")
+}
+
+func TestCheckModules(t *testing.T) {
+	s := newTestServer(t, newFakeSats())
+	s.bus = bus.New(bus.UseLogger(zerolog.Nop()))
+
+	// no sat has joined the mesh, so none of the test tenant's modules are served.
+	check := s.checkModules()
+	assert.False(t, check.OK)
+	assert.Equal(t, CheckModules, check.Name)
+	assert.Equal(t, "4 of 4 modules have no sat", check.Message, "the probes do not name the modules of any tenant")
+
+	empty := &tenant.Config{Identifier: testIdent, TenantVersion: 1, DefaultNamespace: tenant.NamespaceConfig{Name: "default"}}
+
+	s.syncer = syncer.New(&options.Options{}, zerolog.Nop(), &testSource{config: empty})
+	require.NoError(t, s.syncer.Start())
+
+	check = s.checkModules()
+	assert.True(t, check.OK)
+	assert.Equal(t, "0 modules served", check.Message)
+}
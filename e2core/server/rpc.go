@@ -0,0 +1,455 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/e2core/e2core/rpc"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+// RunErrCodeTrailer is the trailer key that carries the code of a RunErr returned by a module to gRPC callers.
+const RunErrCodeTrailer = "e2core-run-err-code"
+
+// rpcServer implements the gRPC Execution service using the same module lookup, authorization, and dispatcher as the
+// HTTP handlers.
+type rpcServer struct {
+	rpc.UnimplementedExecutionServer
+
+	server     *Server
+	authorizer auth.Authorizer
+}
+
+// newRPCServer creates the gRPC server. It serves TLS with the same certificates as the HTTP server if TLS is enabled,
+// so setupTLS must have been called first.
+func newRPCServer(s *Server) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(observeRPC, recoverUnaryRPC(s.logger)),
+		grpc.ChainStreamInterceptor(recoverStreamRPC(s.logger)),
+	}
+
+	if s.tlsEnabled() {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.server.TLSServer.TLSConfig)))
+	}
+
+	g := grpc.NewServer(opts...)
+
+	rpc.RegisterExecutionServer(g, &rpcServer{
+		server:     s,
+		authorizer: s.authorizer,
+	})
+
+	return g
+}
+
+// Execute runs a single module.
+func (r *rpcServer) Execute(ctx context.Context, in *rpc.ExecuteRequest) (*rpc.ExecuteResponse, error) {
+	resp, err := r.executeModule(ctx, in)
+	if err != nil {
+		r.setRunErrTrailer(ctx, err)
+		r.setRetryAfterHeader(ctx, err)
+		return nil, rpcStatus(err).Err()
+	}
+
+	return resp, nil
+}
+
+// ExecuteWorkflow runs a workflow from the tenant's configuration.
+func (r *rpcServer) ExecuteWorkflow(ctx context.Context, in *rpc.ExecuteRequest) (*rpc.ExecuteResponse, error) {
+	ident, err := r.authorize(ctx, in, auth.OpWorkflow)
+	if err != nil {
+		return nil, rpcStatus(err).Err()
+	}
+
+	ll := r.server.logger.With().
+		Str("ident", ident).
+		Str("namespace", in.Namespace).
+		Str("workflow", in.Name).
+		Str("method", "rpc.ExecuteWorkflow").
+		Logger()
+
+	wfl := r.server.syncer.GetWorkflowByName(ident, in.Namespace, in.Name)
+	if wfl == nil {
+		ll.Error().Msg("syncer did not find workflow by these details")
+		return nil, status.Error(codes.NotFound, "workflow not found")
+	}
+
+	steps, err := r.server.resolveWorkflowSteps(ident, wfl.Steps)
+	if err != nil {
+		ll.Err(err).Msg("resolveWorkflowSteps")
+		return nil, status.Error(codes.Internal, "failed to handle request")
+	}
+
+	responseKey, err := r.server.workflowResponseKey(ident, in.Namespace, wfl.Response, steps)
+	if err != nil {
+		ll.Err(err).Msg("workflowResponseKey")
+		return nil, status.Error(codes.Internal, "failed to handle request")
+	}
+
+	req := rpcRequest(in, "workflow", ident)
+	useDeadline(ctx, req)
+
+	ll.Info().Int("steps", len(steps)).Msg("found workflow")
+
+	resp, err := r.execute(in.Id, req, steps, responseKey)
+	if err != nil {
+		ll.Err(err).Str("requestID", req.ID).Msg("workflow execution failed")
+
+		r.setRunErrTrailer(ctx, err)
+		r.setRetryAfterHeader(ctx, err)
+		return nil, rpcStatus(err).Err()
+	}
+
+	return resp, nil
+}
+
+// ExecuteStream runs a module for every request received on the stream. Requests are executed concurrently and a
+// failed execution is reported in its response rather than ending the stream.
+func (r *rpcServer) ExecuteStream(stream rpc.Execution_ExecuteStreamServer) error {
+	inFlight := make(chan struct{}, streamConcurrency)
+	wg := sync.WaitGroup{}
+	sendLock := sync.Mutex{}
+
+	defer wg.Wait()
+
+	for {
+		in, err := stream.Recv()
+		if err != nil {
+			// io.EOF means the client has finished sending, anything else means the stream is gone. Either way the
+			// in-flight executions are awaited before returning.
+			return nil
+		}
+
+		if in.Id == "" {
+			in.Id = uuid.New().String()
+		}
+
+		inFlight <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-inFlight
+				wg.Done()
+			}()
+
+			var resp *rpc.ExecuteResponse
+
+			// the interceptors cannot recover from a panic in this goroutine, so it does so itself.
+			err := func() (err error) {
+				defer recoverRPC(r.server.logger, "ExecuteStream", &err)
+
+				resp, err = r.executeModule(stream.Context(), in)
+				return err
+			}()
+			if err != nil {
+				resp = &rpc.ExecuteResponse{Id: in.Id, Error: rpcError(err)}
+			}
+
+			// grpc streams do not support concurrent calls to Send.
+			sendLock.Lock()
+			defer sendLock.Unlock()
+
+			if err := stream.Send(resp); err != nil {
+				r.server.logger.Err(err).Str("id", in.Id).Msg("failed to send stream response")
+			}
+		}()
+	}
+}
+
+// executeModule authorizes the request, finds the module that it names, and runs it.
+func (r *rpcServer) executeModule(ctx context.Context, in *rpc.ExecuteRequest) (*rpc.ExecuteResponse, error) {
+	ident, err := r.authorize(ctx, in, auth.OpExecute)
+	if err != nil {
+		return nil, err
+	}
+
+	ll := r.server.logger.With().
+		Str("ident", ident).
+		Str("namespace", in.Namespace).
+		Str("fn", in.Name).
+		Str("method", "rpc.executeModule").
+		Logger()
+
+	mod := r.server.syncer.GetModuleByName(ident, in.Namespace, in.Name)
+	if mod == nil {
+		ll.Error().Msg("syncer did not find module by these details")
+		return nil, status.Error(codes.NotFound, "module not found")
+	}
+
+	req := rpcRequest(in, "name", ident)
+	useDeadline(ctx, req)
+
+	resp, err := r.execute(in.Id, req, []tenant.WorkflowStep{{FQMN: mod.FQMN}}, mod.FQMN)
+	if err != nil {
+		ll.Err(err).Str("fqmn", mod.FQMN).Str("requestID", req.ID).Msg("module execution failed")
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// execute runs the steps and builds the response from the state found at responseKey. The response carries id, the
+// ID that the caller gave the request, rather than the ID of the request that was sent to the sats.
+func (r *rpcServer) execute(id string, req *request.CoordinatedRequest, steps []tenant.WorkflowStep, responseKey string) (*rpc.ExecuteResponse, error) {
+	release, err := r.server.limits.acquire(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	seq, err := r.server.executeSteps(req, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.ExecuteResponse{
+		Id:          id,
+		Output:      seq.Request().State[responseKey],
+		RespHeaders: req.RespHeaders,
+	}, nil
+}
+
+// authorize checks the credentials in the call's metadata and their scopes for the operation the same way the HTTP
+// authorization middleware does, and returns the tenant's ident.
+func (r *rpcServer) authorize(ctx context.Context, in *rpc.ExecuteRequest, operation string) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	token := auth.ExtractAccessToken(http.Header{"Authorization": md.Get("authorization")})
+
+	tntInfo, err := r.authorizer.Authorize(token, in.Ident, in.Namespace, in.Name)
+	if err != nil {
+		r.server.logger.Debug().Err(err).Str("ident", in.Ident).Msg("rpc authorization failed")
+		return "", status.Error(codes.Unauthenticated, "unauthorized")
+	}
+
+	if err := auth.CheckScopes(tntInfo, r.server.policy.TenantScopes(tntInfo), []string{operation}, in.Namespace, in.Name); err != nil {
+		return "", status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	return tntInfo.ID, nil
+}
+
+// setRunErrTrailer passes along the code of a RunErr returned by a module, since it does not survive the translation
+// into a gRPC status code.
+func (r *rpcServer) setRunErrTrailer(ctx context.Context, err error) {
+	runErr := scheduler.RunErr{}
+	if !errors.As(err, &runErr) {
+		return
+	}
+
+	if err := grpc.SetTrailer(ctx, metadata.Pairs(RunErrCodeTrailer, strconv.Itoa(runErr.Code))); err != nil {
+		r.server.logger.Err(err).Msg("failed to set run error trailer")
+	}
+}
+
+// setRetryAfterHeader tells the caller when to retry a call that was rejected by a quota, the same way the
+// Retry-After header does for HTTP.
+func (r *rpcServer) setRetryAfterHeader(ctx context.Context, err error) {
+	after, ok := retryAfter(err)
+	if !ok {
+		return
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(RetryAfterHeader), after)); err != nil {
+		r.server.logger.Err(err).Msg("failed to set retry after header")
+	}
+}
+
+// rpcRequest creates a CoordinatedRequest from an rpc request, made to look like the equivalent HTTP request so that
+// modules behave the same regardless of how they were invoked. The request always gets an ID of its own, as the one
+// chosen by the caller is neither unique nor safe to route messages on the bus by.
+func rpcRequest(in *rpc.ExecuteRequest, route, ident string) *request.CoordinatedRequest {
+	headers := map[string]string{}
+	for k, v := range in.Headers {
+		// lowercase the key the same way request.FromEchoContext does.
+		headers[strings.ToLower(k)] = v
+	}
+
+	params := map[string]string{
+		"ident":     ident,
+		"namespace": in.Namespace,
+		"name":      in.Name,
+	}
+
+	for k, v := range in.Params {
+		params[k] = v
+	}
+
+	state := map[string][]byte{}
+	for k, v := range in.State {
+		state[k] = v
+	}
+
+	body := in.Body
+	if body == nil {
+		body = []byte{}
+	}
+
+	return &request.CoordinatedRequest{
+		Method:      http.MethodPost,
+		URL:         fmt.Sprintf("/%s/%s/%s/%s", route, in.Ident, in.Namespace, in.Name),
+		ID:          uuid.New().String(),
+		Body:        body,
+		Headers:     headers,
+		RespHeaders: map[string]string{},
+		Params:      params,
+		State:       state,
+	}
+}
+
+// recoverUnaryRPC turns a panic while handling a call into an Internal error, the same way the Recover middleware
+// does for HTTP.
+func recoverUnaryRPC(logger zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer recoverRPC(logger, info.FullMethod, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+// recoverStreamRPC is recoverUnaryRPC for streams.
+func recoverStreamRPC(logger zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverRPC(logger, info.FullMethod, &err)
+
+		return handler(srv, ss)
+	}
+}
+
+// recoverRPC must be deferred. It recovers from a panic, logs it and replaces err with an Internal error.
+func recoverRPC(logger zerolog.Logger, method string, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	logger.Error().Str("method", method).Str("stack", string(debug.Stack())).Msgf("recovered from panic: %v", p)
+
+	*err = status.Error(codes.Internal, "failed to handle request")
+}
+
+// rpcStatus converts an error from authorization, lookup, or execution into a gRPC status.
+func rpcStatus(err error) *status.Status {
+	if s, ok := status.FromError(err); ok {
+		return s
+	}
+
+	runErr := scheduler.RunErr{}
+	if errors.As(err, &runErr) {
+		return status.New(runErrCode(runErr.Code), runErr.Message)
+	}
+
+	if common.IsError(err, common.ErrInvalid) {
+		return status.New(codes.InvalidArgument, fmt.Sprintf("%s must be a positive duration", TimeoutHeader))
+	}
+
+	if common.IsError(err, common.ErrLimit) {
+		return status.New(codes.ResourceExhausted, "too many requests")
+	}
+
+	if errors.Is(err, ErrDispatchTimeout) {
+		return status.New(codes.DeadlineExceeded, "execution timed out")
+	}
+
+	if errors.Is(err, ErrDraining) {
+		return status.New(codes.Unavailable, ErrDraining.Error())
+	}
+
+	return status.New(codes.Internal, "failed to execute plugin")
+}
+
+// rpcError converts an error into the form used to report failures on ExecuteStream responses.
+func rpcError(err error) *rpc.Error {
+	s := rpcStatus(err)
+
+	rpcErr := &rpc.Error{
+		Code:    uint32(s.Code()),
+		Message: s.Message(),
+	}
+
+	runErr := scheduler.RunErr{}
+	if errors.As(err, &runErr) {
+		rpcErr.RunErrorCode = int32(runErr.Code)
+	}
+
+	return rpcErr
+}
+
+// runErrCode maps the code of a RunErr, which modules conventionally set to an HTTP status, to a gRPC code.
+func runErrCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	return codes.Unknown
+}
+
+// startRPC serves the gRPC Execution service until it is stopped, over TLS if it is enabled.
+func (s *Server) startRPC() error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.options.GRPCPort))
+	if err != nil {
+		return errors.Wrap(err, "net.Listen")
+	}
+
+	if err := s.rpc.Serve(lis); err != nil {
+		return errors.Wrap(err, "grpc.Server.Serve")
+	}
+
+	return nil
+}
+
+// shutdownRPC waits for in-flight calls to complete, forcibly closing them if ctx is done first.
+func (s *Server) shutdownRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+
+	go func() {
+		s.rpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.rpc.Stop()
+	}
+}
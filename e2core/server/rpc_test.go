@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/suborbital/e2core/e2core/rpc"
+	"github.com/suborbital/e2core/foundation/scheduler"
+)
+
+func TestRPCStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantMessage string
+		wantRunErr  int32
+	}{
+		{
+			name:        "status errors are passed through",
+			err:         status.Error(codes.NotFound, "module not found"),
+			wantCode:    codes.NotFound,
+			wantMessage: "module not found",
+		},
+		{
+			name:        "run errors with an HTTP status are mapped",
+			err:         errors.Wrap(scheduler.RunErr{Code: http.StatusBadRequest, Message: "bad input"}, "dispatcher.Execute"),
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "bad input",
+			wantRunErr:  http.StatusBadRequest,
+		},
+		{
+			name:        "run errors with other codes are unknown",
+			err:         scheduler.RunErr{Code: 1, Message: "failed"},
+			wantCode:    codes.Unknown,
+			wantMessage: "failed",
+			wantRunErr:  1,
+		},
+		{
+			name:        "dispatch timeouts exceed the deadline",
+			err:         errors.Wrap(ErrDispatchTimeout, "failed to dispatchSingle"),
+			wantCode:    codes.DeadlineExceeded,
+			wantMessage: "execution timed out",
+		},
+		{
+			name:        "other errors are internal",
+			err:         errors.New("sequence contains no steps"),
+			wantCode:    codes.Internal,
+			wantMessage: "failed to execute plugin",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := rpcStatus(tc.err)
+			assert.Equal(t, tc.wantCode, s.Code())
+			assert.Equal(t, tc.wantMessage, s.Message())
+
+			rpcErr := rpcError(tc.err)
+			assert.Equal(t, uint32(tc.wantCode), rpcErr.Code)
+			assert.Equal(t, tc.wantRunErr, rpcErr.RunErrorCode)
+		})
+	}
+}
+
+func TestRPCRequest(t *testing.T) {
+	in := &rpc.ExecuteRequest{
+		Id:        "client-id",
+		Ident:     "com.suborbital.app",
+		Namespace: "default",
+		Name:      "helloworld-rs",
+		Body:      []byte("world"),
+		Headers:   map[string]string{"Content-Type": "text/plain"},
+		Params:    map[string]string{"extra": "param"},
+		State:     map[string][]byte{"key": []byte("value")},
+	}
+
+	req := rpcRequest(in, "name", "tenant-uuid")
+
+	assert.NotEmpty(t, req.ID)
+	assert.NotEqual(t, in.Id, req.ID, "the caller must not choose the ID of the request on the bus")
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "/name/com.suborbital.app/default/helloworld-rs", req.URL)
+	assert.Equal(t, []byte("world"), req.Body)
+	assert.Equal(t, map[string]string{"content-type": "text/plain"}, req.Headers)
+	assert.Equal(t, "tenant-uuid", req.Params["ident"])
+	assert.Equal(t, "param", req.Params["extra"])
+	assert.Equal(t, []byte("value"), req.State["key"])
+	assert.NotNil(t, req.RespHeaders)
+}
+
+func TestRPCServer_Execute(t *testing.T) {
+	s := newTestServer(t, newFakeSats())
+	s.authorizer = testAuthorizer{}
+
+	r := &rpcServer{server: s, authorizer: s.authorizer}
+
+	in := &rpc.ExecuteRequest{Id: "client-id", Ident: testIdent, Namespace: "default", Name: "a"}
+
+	t.Run("echoes the caller's ID", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer valid"))
+
+		resp, err := r.Execute(ctx, in)
+		require.NoError(t, err)
+
+		assert.Equal(t, "client-id", resp.Id)
+		assert.Equal(t, testFQMN("a"), string(resp.Output))
+	})
+
+	t.Run("credentials without a scheme", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "valid"))
+
+		_, err := r.Execute(ctx, in)
+		assert.NoError(t, err)
+
+		ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "forged"))
+
+		_, err = r.Execute(ctx, in)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+func TestRPCServer_TLS(t *testing.T) {
+	s := newTestServer(t, newFakeSats())
+	s.authorizer = testAuthorizer{}
+
+	cert, err := selfSignedCertificate("localhost")
+	require.NoError(t, err)
+
+	s.server.TLSServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*cert}, MinVersion: tls.VersionTLS12}
+
+	g := newRPCServer(s)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() { _ = g.Serve(lis) }()
+	defer g.Stop()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: tls.VersionTLS12})))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer valid")
+
+	resp, err := rpc.NewExecutionClient(conn).Execute(ctx, &rpc.ExecuteRequest{Ident: testIdent, Namespace: "default", Name: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, testFQMN("a"), string(resp.Output))
+
+	plain, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer plain.Close()
+
+	_, err = rpc.NewExecutionClient(plain).Execute(ctx, &rpc.ExecuteRequest{Ident: testIdent, Namespace: "default", Name: "a"})
+	assert.Equal(t, codes.Unavailable, status.Code(err), "plaintext calls are refused")
+}
+
+func TestRecoverRPC(t *testing.T) {
+	unary := recoverUnaryRPC(zerolog.Nop())
+
+	_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test"}, func(context.Context, interface{}) (interface{}, error) {
+		panic("unary")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	stream := recoverStreamRPC(zerolog.Nop())
+
+	err = stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/test"}, func(interface{}, grpc.ServerStream) error {
+		panic("stream")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/suborbital/e2core/e2core/schedule"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/request"
+)
+
+const (
+	scheduleJobType = "e2core.schedule"
+
+	// scheduleReconcileInterval is how often the schedules are compared to the tenant config.
+	scheduleReconcileInterval = time.Second
+
+	// maxScheduleOutput is how much of the output of a schedule's last run is kept.
+	maxScheduleOutput = 64 << 10
+)
+
+// ScheduleStatus describes a registered schedule and how its last run went.
+type ScheduleStatus struct {
+	Source string `json:"source"`
+	schedule.Definition
+	Registered time.Time       `json:"registered"`
+	LastRun    *time.Time      `json:"lastRun,omitempty"`
+	NextRun    *time.Time      `json:"nextRun,omitempty"`
+	LastResult *ScheduleResult `json:"lastResult,omitempty"`
+}
+
+// ScheduleResult is the outcome of a scheduled execution. Output is cut short if it is longer than 64KiB.
+type ScheduleResult struct {
+	RequestID  string `json:"requestId"`
+	Status     int    `json:"status"`
+	Output     []byte `json:"output,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// schedules keeps the scheduler's schedules in line with the tenant config and the schedules file, and executes them.
+type schedules struct {
+	server *Server
+	sched  *scheduler.Scheduler
+	file   []schedule.Definition
+	log    zerolog.Logger
+
+	active   map[string]*activeSchedule
+	lock     sync.RWMutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// activeSchedule is a schedule that has been handed to the scheduler. Once cancelled, it produces no more jobs and is
+// dropped by the scheduler.
+type activeSchedule struct {
+	source     string
+	def        schedule.Definition
+	registered time.Time
+	cancelled  atomic.Bool
+	running    atomic.Bool
+
+	lastRun    *time.Time
+	lastResult *ScheduleResult
+	lock       sync.RWMutex
+}
+
+func newSchedules(s *Server, file []schedule.Definition) *schedules {
+	ss := &schedules{
+		server: s,
+		sched:  scheduler.NewWithLogger(s.logger),
+		file:   file,
+		log:    s.logger.With().Str("module", "schedules").Logger(),
+		active: map[string]*activeSchedule{},
+		stop:   make(chan struct{}),
+	}
+
+	ss.sched.Register(scheduleJobType, ss, scheduler.Autoscale(0))
+
+	return ss
+}
+
+// start reconciles the schedules until stopped.
+func (ss *schedules) start() {
+	go func() {
+		ticker := time.NewTicker(scheduleReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			ss.reconcile()
+
+			select {
+			case <-ss.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// shutdown cancels every schedule so that no more executions are started.
+func (ss *schedules) shutdown() {
+	ss.stopOnce.Do(func() {
+		close(ss.stop)
+
+		ss.lock.Lock()
+		defer ss.lock.Unlock()
+
+		for key, a := range ss.active {
+			a.cancelled.Store(true)
+			delete(ss.active, key)
+		}
+	})
+}
+
+// reconcile registers new and changed schedules, and cancels the ones that no longer exist. Schedules that did not
+// change are left alone so that their timing is not reset.
+func (ss *schedules) reconcile() {
+	desired := map[string]*activeSchedule{}
+
+	for _, def := range ss.file {
+		desired[scheduleKey(schedule.SourceFile, def)] = &activeSchedule{source: schedule.SourceFile, def: def}
+	}
+
+	for ident := range ss.server.syncer.ListTenants() {
+		tnt := ss.server.syncer.TenantOverview(ident)
+		if tnt == nil {
+			continue
+		}
+
+		for _, def := range schedule.FromTenant(ident, tnt.Config) {
+			desired[scheduleKey(schedule.SourceTenant, def)] = &activeSchedule{source: schedule.SourceTenant, def: def}
+		}
+	}
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	select {
+	case <-ss.stop:
+		return
+	default:
+	}
+
+	for key, a := range ss.active {
+		if d, exists := desired[key]; exists && reflect.DeepEqual(d.def, a.def) {
+			continue
+		}
+
+		ss.log.Info().Str("schedule", key).Msg("cancelling schedule")
+
+		a.cancelled.Store(true)
+		delete(ss.active, key)
+	}
+
+	for key, d := range desired {
+		if _, exists := ss.active[key]; exists {
+			continue
+		}
+
+		if err := ss.register(d); err != nil {
+			ss.log.Err(err).Str("schedule", key).Msg("failed to register schedule")
+			continue
+		}
+
+		ss.log.Info().Str("schedule", key).Msg("registered schedule")
+
+		ss.active[key] = d
+	}
+}
+
+// register hands a schedule to the scheduler. The lock must be held.
+func (ss *schedules) register(a *activeSchedule) error {
+	sched, err := a.def.Schedule(func() scheduler.Job {
+		return scheduler.NewJob(scheduleJobType, a)
+	})
+	if err != nil {
+		return errors.Wrap(err, "def.Schedule")
+	}
+
+	a.registered = time.Now()
+
+	ss.sched.Schedule(&cancellableSchedule{Schedule: sched, active: a})
+
+	return nil
+}
+
+// Run executes a schedule, unless the previous execution of the same schedule is still running.
+func (ss *schedules) Run(job scheduler.Job, _ *scheduler.Ctx) (interface{}, error) {
+	a, ok := job.Data().(*activeSchedule)
+	if !ok || a.cancelled.Load() {
+		return nil, nil
+	}
+
+	ll := ss.log.With().
+		Str("ident", a.def.Ident).
+		Str("namespace", a.def.Namespace).
+		Str("schedule", a.def.Name).
+		Logger()
+
+	if !a.running.CompareAndSwap(false, true) {
+		ll.Warn().Msg("previous run is still in progress, skipping")
+		return nil, nil
+	}
+
+	defer a.running.Store(false)
+
+	started := time.Now()
+	result := ss.execute(a.def)
+	result.DurationMS = time.Since(started).Milliseconds()
+
+	a.lock.Lock()
+	a.lastRun = &started
+	a.lastResult = result
+	a.lock.Unlock()
+
+	if result.Error != "" {
+		ll.Error().Int("status", result.Status).Str("error", result.Error).Msg("scheduled execution failed")
+	} else {
+		ll.Info().Str("requestID", result.RequestID).Msg("scheduled execution completed")
+	}
+
+	return nil, nil
+}
+
+func (ss *schedules) OnChange(_ scheduler.ChangeEvent) error { return nil }
+
+// execute runs the schedule's module or workflow once.
+func (ss *schedules) execute(def schedule.Definition) *ScheduleResult {
+	s := ss.server
+
+	result := &ScheduleResult{RequestID: uuid.New().String()}
+
+	if !s.inFlight.add() {
+		result.Status = http.StatusServiceUnavailable
+		result.Error = ErrDraining.Error()
+
+		return result
+	}
+
+	defer s.inFlight.done()
+
+	steps, responseKey, err := s.resolveTarget(def.Ident, def.Namespace, def.Module, def.Workflow, def.Steps)
+	if err != nil {
+		result.Status = http.StatusNotFound
+		result.Error = err.Error()
+
+		return result
+	}
+
+	state := make(map[string][]byte, len(def.State))
+	for k, v := range def.State {
+		state[k] = []byte(v)
+	}
+
+	req := &request.CoordinatedRequest{
+		Method:      http.MethodPost,
+		URL:         fmt.Sprintf("/schedules/%s/%s", def.Ident, def.Name),
+		ID:          result.RequestID,
+		Body:        []byte(def.Body),
+		Headers:     map[string]string{},
+		RespHeaders: map[string]string{},
+		Params:      map[string]string{},
+		State:       state,
+	}
+
+	output, status, httpErr := s.executeTarget(req, steps, responseKey)
+	result.Status = status
+
+	if httpErr != nil {
+		result.Error = fmt.Sprint(httpErr.Message)
+
+		return result
+	}
+
+	result.Output = output
+
+	if len(result.Output) > maxScheduleOutput {
+		result.Output = result.Output[:maxScheduleOutput]
+	}
+
+	return result
+}
+
+// statuses returns the status of every schedule of the tenant, ordered by namespace and name.
+func (ss *schedules) statuses(ident string) []ScheduleStatus {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	now := time.Now()
+	list := make([]ScheduleStatus, 0)
+
+	for _, a := range ss.active {
+		if a.def.Ident != ident {
+			continue
+		}
+
+		a.lock.RLock()
+		list = append(list, ScheduleStatus{
+			Source:     a.source,
+			Definition: a.def,
+			Registered: a.registered,
+			LastRun:    a.lastRun,
+			NextRun:    a.def.Next(a.registered, a.lastRun, now),
+			LastResult: a.lastResult,
+		})
+		a.lock.RUnlock()
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+
+		return list[i].Name < list[j].Name
+	})
+
+	return list
+}
+
+// schedulesHandler lists a tenant's schedules along with when they last and will next run.
+func (s *Server) schedulesHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.schedules == nil {
+			return c.JSON(http.StatusOK, []ScheduleStatus{})
+		}
+
+		return c.JSON(http.StatusOK, s.schedules.statuses(ReadParam(c, "ident")))
+	}
+}
+
+func scheduleKey(source string, def schedule.Definition) string {
+	return fmt.Sprintf("%s:%s/%s/%s", source, def.Ident, def.Namespace, def.Name)
+}
+
+// cancellableSchedule stops producing jobs once its schedule has been cancelled, which also makes the scheduler drop
+// it.
+type cancellableSchedule struct {
+	scheduler.Schedule
+	active *activeSchedule
+}
+
+func (c *cancellableSchedule) Check() *scheduler.Job {
+	if c.active.cancelled.Load() {
+		return nil
+	}
+
+	return c.Schedule.Check()
+}
+
+func (c *cancellableSchedule) Done() bool {
+	return c.active.cancelled.Load() || c.Schedule.Done()
+}
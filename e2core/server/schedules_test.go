@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/schedule"
+	"github.com/suborbital/e2core/foundation/scheduler"
+)
+
+// newTestSchedules creates the schedules of a test server from the definitions of a schedules file. The definitions run
+// after an hour, so that the scheduler does not run them during the test.
+func newTestSchedules(t *testing.T, s *Server, names ...string) *schedules {
+	var defs []schedule.Definition
+	for _, name := range names {
+		defs = append(defs, schedule.Definition{Name: name, Ident: testIdent, Namespace: "default", Module: "a", After: time.Hour})
+	}
+
+	ss := newSchedules(s, defs)
+	t.Cleanup(ss.shutdown)
+
+	return ss
+}
+
+func activeSchedules(ss *schedules) map[string]*activeSchedule {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	active := make(map[string]*activeSchedule, len(ss.active))
+	for key, a := range ss.active {
+		active[key] = a
+	}
+
+	return active
+}
+
+func TestSchedules_Reconcile(t *testing.T) {
+	ss := newTestSchedules(t, newTestServer(t, newFakeSats()), "first", "second")
+
+	ss.reconcile()
+
+	before := activeSchedules(ss)
+	require.Len(t, before, 2)
+
+	first := before[scheduleKey(schedule.SourceFile, ss.file[0])]
+	require.NotNil(t, first)
+
+	t.Run("unchanged schedules keep their timing", func(t *testing.T) {
+		registered := first.registered
+
+		ss.reconcile()
+
+		after := activeSchedules(ss)
+		assert.Same(t, first, after[scheduleKey(schedule.SourceFile, ss.file[0])])
+		assert.Equal(t, registered, first.registered)
+		assert.False(t, first.cancelled.Load())
+	})
+
+	t.Run("changed schedules are replaced", func(t *testing.T) {
+		ss.file[0].After = 2 * time.Hour
+
+		ss.reconcile()
+
+		replaced := activeSchedules(ss)[scheduleKey(schedule.SourceFile, ss.file[0])]
+		require.NotNil(t, replaced)
+		assert.NotSame(t, first, replaced)
+		assert.Equal(t, 2*time.Hour, replaced.def.After)
+		assert.True(t, first.cancelled.Load())
+	})
+
+	t.Run("removed schedules are cancelled", func(t *testing.T) {
+		second := activeSchedules(ss)[scheduleKey(schedule.SourceFile, ss.file[1])]
+		require.NotNil(t, second)
+
+		ss.file = ss.file[:1]
+
+		ss.reconcile()
+
+		assert.Len(t, activeSchedules(ss), 1)
+		assert.True(t, second.cancelled.Load())
+	})
+}
+
+// everyCheck is a schedule that produces a job on every check.
+type everyCheck struct{}
+
+func (everyCheck) Check() *scheduler.Job {
+	job := scheduler.NewJob(scheduleJobType, nil)
+	return &job
+}
+
+func (everyCheck) Done() bool {
+	return false
+}
+
+func TestCancellableSchedule(t *testing.T) {
+	a := &activeSchedule{}
+	c := &cancellableSchedule{Schedule: everyCheck{}, active: a}
+
+	assert.NotNil(t, c.Check())
+	assert.False(t, c.Done())
+
+	a.cancelled.Store(true)
+
+	assert.Nil(t, c.Check(), "cancelled schedules produce no more jobs")
+	assert.True(t, c.Done(), "cancelled schedules are dropped by the scheduler")
+}
+
+func TestSchedules_Run(t *testing.T) {
+	t.Run("skips a run while the previous one is in progress", func(t *testing.T) {
+		sats := newFakeSats()
+		sats.hold = make(chan struct{})
+
+		ss := newTestSchedules(t, newTestServer(t, sats), "held")
+		a := &activeSchedule{def: ss.file[0]}
+
+		done := make(chan struct{})
+
+		go func() {
+			_, _ = ss.Run(scheduler.NewJob(scheduleJobType, a), nil)
+			close(done)
+		}()
+
+		require.Eventually(t, func() bool { return sats.held.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		_, err := ss.Run(scheduler.NewJob(scheduleJobType, a), nil)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), sats.held.Load(), "the second run did not execute the module")
+
+		close(sats.hold)
+		<-done
+
+		a.lock.RLock()
+		defer a.lock.RUnlock()
+
+		require.NotNil(t, a.lastResult)
+		assert.Equal(t, http.StatusOK, a.lastResult.Status)
+	})
+
+	t.Run("cancelled schedules do not run", func(t *testing.T) {
+		sats := newFakeSats()
+
+		ss := newTestSchedules(t, newTestServer(t, sats), "cancelled")
+		a := &activeSchedule{def: ss.file[0]}
+		a.cancelled.Store(true)
+
+		_, err := ss.Run(scheduler.NewJob(scheduleJobType, a), nil)
+		require.NoError(t, err)
+		assert.Nil(t, a.lastRun)
+	})
+
+	t.Run("runs are refused while draining", func(t *testing.T) {
+		sats := newFakeSats()
+		s := newTestServer(t, sats)
+
+		ss := newTestSchedules(t, s, "draining")
+		a := &activeSchedule{def: ss.file[0]}
+
+		require.NoError(t, s.inFlight.drain(context.Background()))
+
+		_, err := ss.Run(scheduler.NewJob(scheduleJobType, a), nil)
+		require.NoError(t, err)
+
+		require.NotNil(t, a.lastResult)
+		assert.Equal(t, http.StatusServiceUnavailable, a.lastResult.Status)
+		assert.Equal(t, ErrDraining.Error(), a.lastResult.Error)
+
+		sats.lock.Lock()
+		defer sats.lock.Unlock()
+
+		assert.Empty(t, sats.executed)
+	})
+}
+
+func TestSchedulesHandler(t *testing.T) {
+	s := newTestServer(t, newFakeSats())
+	s.server.GET("/schedules/:ident", s.schedulesHandler())
+
+	list := func(ident string) []ScheduleStatus {
+		rec := httptest.NewRecorder()
+		s.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/schedules/"+ident, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var statuses []ScheduleStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+
+		return statuses
+	}
+
+	assert.Empty(t, list(testIdent), "schedules are not enabled")
+
+	s.schedules = newTestSchedules(t, s, "second", "first")
+	s.schedules.reconcile()
+
+	statuses := list(testIdent)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "first", statuses[0].Name, "schedules are ordered by name")
+	assert.Equal(t, schedule.SourceFile, statuses[0].Source)
+
+	require.NotNil(t, statuses[0].NextRun)
+	assert.WithinDuration(t, statuses[0].Registered.Add(time.Hour), *statuses[0].NextRun, time.Second)
+	assert.Nil(t, statuses[0].LastRun)
+	assert.Nil(t, statuses[0].LastResult)
+
+	a := activeSchedules(s.schedules)[scheduleKey(schedule.SourceFile, s.schedules.file[1])]
+	require.NotNil(t, a)
+
+	_, err := s.schedules.Run(scheduler.NewJob(scheduleJobType, a), nil)
+	require.NoError(t, err)
+
+	statuses = list(testIdent)
+	require.NotNil(t, statuses[0].LastRun)
+	assert.Nil(t, statuses[0].NextRun, "after schedules only run once")
+
+	require.NotNil(t, statuses[0].LastResult)
+	assert.Equal(t, http.StatusOK, statuses[0].LastResult.Status)
+	assert.Equal(t, testFQMN("a"), string(statuses[0].LastResult.Output))
+	assert.NotEmpty(t, statuses[0].LastResult.RequestID)
+
+	assert.Empty(t, list("com.suborbital.other"), "other tenants' schedules are not listed")
+}
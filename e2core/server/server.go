@@ -3,19 +3,31 @@ package server
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync/atomic"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"google.golang.org/grpc"
 
+	"github.com/suborbital/e2core/e2core/admin"
+	"github.com/suborbital/e2core/e2core/audit"
 	"github.com/suborbital/e2core/e2core/auth"
+	"github.com/suborbital/e2core/e2core/execution"
+	"github.com/suborbital/e2core/e2core/mesh"
+	"github.com/suborbital/e2core/e2core/metrics"
 	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/policy"
+	"github.com/suborbital/e2core/e2core/schedule"
 	"github.com/suborbital/e2core/e2core/syncer"
+	"github.com/suborbital/e2core/e2core/trigger"
 	"github.com/suborbital/e2core/foundation/bus/bus"
 	"github.com/suborbital/e2core/foundation/bus/discovery/local"
 	"github.com/suborbital/e2core/foundation/bus/transport/websocket"
+	"github.com/suborbital/e2core/foundation/common"
 	kitError "github.com/suborbital/go-kit/web/error"
 	"github.com/suborbital/go-kit/web/mid"
 )
@@ -25,31 +37,81 @@ const E2CoreHealthURI = "/health"
 // Server is a E2Core server.
 type Server struct {
 	server *echo.Echo
+	rpc    *grpc.Server
 	syncer *syncer.Syncer
 
+	// redirect serves the HTTP port while TLS is enabled.
+	redirect *http.Server
+
+	// schedules is nil unless schedules are enabled, and triggers is nil unless a bridge is configured.
+	schedules *schedules
+	triggers  *triggers
+
 	bus        *bus.Bus
 	dispatcher *dispatcher
 
+	executions execution.Store
+	lastPrune  *atomic.Int64
+	callbacks  *callbacks
+	// pending holds a slot for every asynchronous execution that is running.
+	pending chan struct{}
+
+	// audit is nil if executions are not recorded.
+	audit          audit.Log
+	lastAuditPrune *atomic.Int64
+
+	policy *policy.Policy
+	limits *limiter
+	cache  *responseCache
+
+	openapi *openapiDocs
+
+	// inFlight tracks executions so that shutdown can wait for them to complete.
+	inFlight       *drainGroup
+	streams        *streamSessions
+	shutdownTracer func(context.Context) error
+
+	authorizer auth.Authorizer
+
 	options *options.Options
 	logger  zerolog.Logger
 }
 
-// New creates a new Server instance.
-func New(l zerolog.Logger, sync *syncer.Syncer, opts *options.Options) (*Server, error) {
+// New creates a new Server instance. The server joins the bus mesh as a member of authority, and only connects to peers
+// that prove their membership, unless authority is nil.
+func New(l zerolog.Logger, s *syncer.Syncer, opts *options.Options, authority *mesh.Authority) (*Server, error) {
 	ll := l.With().Str("module", "server").Logger()
 
-	// @todo https://github.com/suborbital/e2core/issues/144, the first return value is a function that would close the
-	// tracer in case of a shutdown. Usually that is put in a defer statement. Server doesn't have a graceful shutdown.
-	_, err := setupTracing(opts.TracerConfig, ll)
+	shutdownTracer, err := setupTracing(opts.TracerConfig, ll)
 	if err != nil {
 		return nil, errors.Wrapf(err, "setupTracing(%s, %s, %f)", "e2core", "reporter_uri", 0.04)
 	}
 
+	var transportOpts []websocket.Option
+
+	if authority != nil {
+		member, err := authority.Member(mesh.AnyTenant, "e2core")
+		if err != nil {
+			return nil, errors.Wrap(err, "authority.Member")
+		}
+
+		transportOpts = append(transportOpts, websocket.UseAuthenticator(member))
+	}
+
 	busOpts := []bus.OptionsModifier{
-		bus.UseMeshTransport(websocket.New()),
+		bus.UseMeshTransport(websocket.New(transportOpts...)),
 		bus.UseDiscovery(local.New()),
 	}
 
+	bridge, err := newBridge(opts.BridgeConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "newBridge")
+	}
+
+	if bridge != nil {
+		busOpts = append(busOpts, bus.UseBridgeTransport(bridge))
+	}
+
 	b := bus.New(busOpts...)
 
 	e := echo.New()
@@ -64,31 +126,155 @@ func New(l zerolog.Logger, sync *syncer.Syncer, opts *options.Options) (*Server,
 
 	d := newDispatcher(ll, b.Connect())
 
+	executions, err := execution.StoreFromOptions(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "execution.StoreFromOptions")
+	}
+
+	auditLog, err := audit.FromOptions(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "audit.FromOptions")
+	}
+
+	pol, err := policy.FromOptions(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "policy.FromOptions")
+	}
+
 	server := &Server{
-		server:     e,
-		syncer:     sync,
-		options:    opts,
-		bus:        b,
-		dispatcher: d,
-		logger:     ll,
+		server:         e,
+		syncer:         s,
+		options:        opts,
+		bus:            b,
+		dispatcher:     d,
+		executions:     executions,
+		lastPrune:      &atomic.Int64{},
+		pending:        make(chan struct{}, opts.ExecutionMaxPending),
+		callbacks:      newCallbacks(opts.CallbackConfig, executions, ll),
+		audit:          auditLog,
+		lastAuditPrune: &atomic.Int64{},
+		policy:         pol,
+		limits:         newLimiter(pol, s.ModuleMetadata),
+		cache:          newResponseCache(pol, common.SystemTime()),
+		openapi:        newOpenapiDocs(),
+		inFlight:       &drainGroup{},
+		streams:        &streamSessions{},
+		shutdownTracer: shutdownTracer,
+		logger:         ll,
 	}
 
-	e.POST("/name/:ident/:namespace/:name", server.executePluginByNameHandler(), auth.AuthorizationMiddleware(opts))
+	s.OnModuleChange(server.cache.invalidate)
 
-	e.GET("/health", server.healthHandler())
+	authorizer, err := auth.FromOptions(opts, ll)
+	if err != nil {
+		return nil, errors.Wrap(err, "auth.FromOptions")
+	}
+
+	server.authorizer = authorizer
+
+	e.POST("/name/:ident/:namespace/:name", server.executePluginByNameHandler(), server.authorize(auth.OpExecute), server.observeRequests())
+	e.POST("/workflow/:ident/:namespace/:name", server.executeWorkflowByNameHandler(), server.authorize(auth.OpWorkflow), server.observeRequests())
+	e.POST("/batch/:ident/:namespace/:name", server.batchHandler(), server.authorize(auth.OpExecute), server.observeRequests())
+	e.GET("/stream/:ident/:namespace/:name", server.streamHandler(), server.authorize(auth.OpExecute))
+	// the record does not say whether a module or a workflow was executed, so either scope can read it.
+	e.GET("/executions/:id", server.getExecutionHandler(), server.loadExecutionParams(), server.authorize(auth.OpExecute, auth.OpWorkflow))
+
+	e.GET("/schedules/:ident", server.schedulesHandler(), server.authorize(auth.OpAdmin))
+	e.GET("/admin/executions", server.auditHandler(), identQueryParam(), server.authorize(auth.OpAdmin))
+	e.GET("/admin/auth/cache", server.authCacheHandler(), identQueryParam(), server.authorize(auth.OpAdmin))
+	e.POST("/admin/auth/cache/purge", server.purgeAuthCacheHandler(), identQueryParam(), server.authorize(auth.OpAdmin))
+	e.GET("/admin/callbacks/secret", server.callbackSecretHandler(), identQueryParam(), server.authorize(auth.OpAdmin))
+	e.GET("/openapi.json", server.openapiHandler(), identQueryParam(), server.authorize())
+
+	e.GET(E2CoreHealthURI, server.healthHandler())
+	e.GET(E2CoreReadyURI, server.readyHandler())
+
+	if opts.MetricsConfig.Enabled {
+		e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	}
+
+	if opts.RunSchedules == nil || *opts.RunSchedules {
+		defs, err := schedule.FromOptions(opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "schedule.FromOptions")
+		}
+
+		server.schedules = newSchedules(server, defs)
+	}
+
+	if bridge != nil {
+		defs, err := trigger.FromOptions(opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "trigger.FromOptions")
+		}
+
+		server.triggers = newTriggers(server, opts.BridgeConfig.Type, defs)
+	}
+
+	if err := server.setupTLS(); err != nil {
+		return nil, errors.Wrap(err, "server.setupTLS")
+	}
+
+	if opts.GRPCPort != 0 {
+		server.rpc = newRPCServer(server)
+	}
 
 	return server, nil
 }
 
-// Start starts the Server.
+// Start starts the Server, and the TLS and gRPC servers, the schedules, and the triggers if they are configured. It
+// returns when any of the servers stops.
 func (s *Server) Start() error {
-	if err := s.server.Start(fmt.Sprintf(":%d", s.Options().HTTPPort)); err != nil {
-		return errors.Wrap(err, "failed to server.Start")
+	serverErrors := make(chan error, 3)
+
+	if s.schedules != nil {
+		s.schedules.start()
+	}
+
+	if s.triggers != nil {
+		s.triggers.start()
+	}
+
+	if s.rpc != nil {
+		go func() {
+			serverErrors <- errors.Wrap(s.startRPC(), "failed to startRPC")
+		}()
+	}
+
+	if s.tlsEnabled() {
+		go func() {
+			serverErrors <- errors.Wrap(s.server.StartServer(s.server.TLSServer), "failed to server.StartServer")
+		}()
+	}
+
+	go func() {
+		if s.redirect != nil {
+			serverErrors <- errors.Wrap(s.redirect.ListenAndServe(), "failed to redirect.ListenAndServe")
+			return
+		}
+
+		serverErrors <- errors.Wrap(s.server.Start(fmt.Sprintf(":%d", s.Options().HTTPPort)), "failed to server.Start")
+	}()
+
+	return <-serverErrors
+}
+
+// AttachAdmin mounts the admin API for the store under /admin/v1, behind the same authorization as the execution
+// endpoints, requiring the admin scope. It is only used when the adminV1 feature is enabled.
+func (s *Server) AttachAdmin(store *admin.Store) error {
+	if err := admin.NewRouter(s.logger, store).Attach("/admin/v1", s.server, s.authorize(auth.OpAdmin)); err != nil {
+		return errors.Wrap(err, "admin.Router.Attach")
 	}
 
 	return nil
 }
 
+// authorize returns the middleware that authorizes requests for one of the operations, with the scopes of the
+// request's credentials and those of the policy's access rules. Without operations, any valid credentials are enough.
+func (s *Server) authorize(operations ...string) echo.MiddlewareFunc {
+	return auth.AuthorizationMiddleware(s.authorizer, s.policy.TenantScopes, operations...)
+}
+
 // Options returns the options that the server was configured with
 func (s *Server) Options() options.Options {
 	return *s.options
@@ -99,8 +285,55 @@ func (s *Server) Syncer() *syncer.Syncer {
 	return s.syncer
 }
 
-// Shutdown shuts down the server
+// Shutdown shuts down the server, running every phase of the shutdown with the same context. The start command runs
+// the phases individually instead, each with its own timeout.
 func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.StopAccepting(ctx); err != nil {
+		return errors.Wrap(err, "s.StopAccepting")
+	}
+
+	if err := s.Drain(ctx); err != nil {
+		return errors.Wrap(err, "s.Drain")
+	}
+
+	if err := s.WithdrawBus(ctx); err != nil {
+		return errors.Wrap(err, "s.WithdrawBus")
+	}
+
+	if err := s.StopAuthorizer(ctx); err != nil {
+		return errors.Wrap(err, "s.StopAuthorizer")
+	}
+
+	if err := s.FlushTraces(ctx); err != nil {
+		return errors.Wrap(err, "s.FlushTraces")
+	}
+
+	return nil
+}
+
+// StopAccepting stops the schedules and triggers, closes the stream sessions, and stops the HTTP and gRPC servers from
+// accepting requests, waiting for the in-flight ones to complete.
+func (s *Server) StopAccepting(ctx context.Context) error {
+	if s.schedules != nil {
+		s.schedules.shutdown()
+	}
+
+	if s.triggers != nil {
+		s.triggers.shutdown()
+	}
+
+	if s.rpc != nil {
+		s.shutdownRPC(ctx)
+	}
+
+	s.streams.close()
+
+	if s.redirect != nil {
+		if err := s.redirect.Shutdown(ctx); err != nil {
+			return errors.Wrap(err, "redirect.Shutdown")
+		}
+	}
+
 	if err := s.server.Shutdown(ctx); err != nil {
 		return errors.Wrap(err, "http.Server.StopCtx")
 	}
@@ -108,6 +341,69 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// Drain waits for executions that are still running, such as asynchronous ones, to complete, along with the callback
+// deliveries that are being attempted, and then closes the audit log so that their entries are written out. Executions
+// that would start once draining has begun are refused with ErrDraining.
+func (s *Server) Drain(ctx context.Context) error {
+	drainErr := s.inFlight.drain(ctx)
+
+	if err := s.callbacks.drain(ctx); err != nil && drainErr == nil {
+		drainErr = err
+	}
+
+	// closed even if executions are still running, since the entries that have been added would otherwise be lost.
+	var closeErr error
+	if s.audit != nil {
+		closeErr = s.audit.Close()
+	}
+
+	if drainErr != nil {
+		return drainErr
+	}
+
+	return errors.Wrap(closeErr, "audit.Close")
+}
+
+// WithdrawBus withdraws from the bus mesh so that sats stop sending messages, and then stops the bus.
+func (s *Server) WithdrawBus(ctx context.Context) error {
+	stopped := make(chan error, 1)
+
+	go func() {
+		if err := s.bus.Withdraw(); err != nil {
+			stopped <- errors.Wrap(err, "bus.Withdraw")
+			return
+		}
+
+		stopped <- errors.Wrap(s.bus.Stop(), "bus.Stop")
+	}()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "bus did not stop")
+	}
+}
+
+// StopAuthorizer stops authorizers that refresh their keys in the background from doing so. It is run once the
+// requests have been drained, since they may still need the keys.
+func (s *Server) StopAuthorizer(_ context.Context) error {
+	if authorizer, ok := s.authorizer.(interface{ Shutdown() }); ok {
+		authorizer.Shutdown()
+	}
+
+	return nil
+}
+
+// FlushTraces sends any buffered spans to the tracing backend and stops the tracer.
+func (s *Server) FlushTraces(ctx context.Context) error {
+	if err := s.shutdownTracer(ctx); err != nil {
+		return errors.Wrap(err, "shutdownTracer")
+	}
+
+	return nil
+}
+
 func (s *Server) testServer() *echo.Echo {
 	return s.server
 }
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -18,6 +19,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/suborbital/e2core/e2core/backend/satbackend"
+	"github.com/suborbital/e2core/e2core/mesh"
 	"github.com/suborbital/e2core/e2core/options"
 	"github.com/suborbital/e2core/e2core/syncer"
 	"github.com/suborbital/systemspec/system/bundle"
@@ -68,7 +70,11 @@ func (s *serverTestSuite) TearDownSuite() {
 
 	if s.o != nil {
 		s.T().Log("starting shutdown of orchestrator")
-		s.o.Shutdown()
+		ctx, cxl := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := s.o.Shutdown(ctx); err != nil {
+			s.T().Logf("orchestrator shutdown: %s", err)
+		}
+		cxl()
 		s.T().Log("shutdown completed of orchestrator")
 
 		s.o = nil
@@ -159,14 +165,17 @@ func (s *serverTestSuite) serverForBundle(filepath string) error {
 
 	syncR := syncer.New(opts, logger, source)
 
-	server, err := New(logger, syncR, opts)
+	authority, err := mesh.NewAuthority(mesh.DefaultTokenTTL)
+	s.Require().NoError(err, "mesh.NewAuthority")
+
+	server, err := New(logger, syncR, opts, authority)
 	if err != nil {
 		return errors.Wrap(err, "failed to New")
 	}
 
 	testServer := server.testServer()
 
-	orchestrator, err := satbackend.New(logger, opts, syncR)
+	orchestrator, err := satbackend.New(logger, opts, syncR, authority)
 	if err != nil {
 		return errors.Wrap(err, "failed to orchestrator.New")
 	}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/e2core/sequence"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const (
+	// streamConcurrency is the maximum number of frames from a single session being executed at the same time. Frames
+	// that arrive while as many are executing are refused with 429 rather than waited on, so that the session keeps
+	// reading control frames.
+	streamConcurrency = 16
+
+	// streamMaxFrameSize is the largest frame that a client may send, the session is closed if it sends a larger one.
+	streamMaxFrameSize = 4 << 20
+
+	streamWriteWait  = 10 * time.Second
+	streamPongWait   = 60 * time.Second
+	streamPingPeriod = (streamPongWait * 9) / 10
+)
+
+var streamUpgrader = websocket.Upgrader{}
+
+// StreamRequest is an inbound frame on a stream session. Frames that are not a valid StreamRequest are used as the
+// body of the invocation in their entirety and are assigned a generated ID.
+type StreamRequest struct {
+	ID   string `json:"id"`
+	Body []byte `json:"body"`
+}
+
+// StreamResponse is written back for every inbound frame, carrying the ID of the frame that it is a response to.
+// Responses may arrive in a different order than their requests.
+type StreamResponse struct {
+	ID          string            `json:"id"`
+	Status      int               `json:"status"`
+	Output      []byte            `json:"output,omitempty"`
+	RespHeaders map[string]string `json:"respHeaders,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// streamSession is a single authorized websocket connection executing one module.
+type streamSession struct {
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+	// closing is set by shutdown, after which the session ends once its in-flight invocations have responded.
+	closing atomic.Bool
+}
+
+func (s *Server) streamHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ident := ReadParam(c, "ident")
+		namespace := ReadParam(c, "namespace")
+		name := ReadParam(c, "name")
+
+		ll := s.logger.With().
+			Str("ident", ident).
+			Str("namespace", namespace).
+			Str("fn", name).
+			Str("method", "streamHandler").
+			Logger()
+
+		if mod := s.syncer.GetModuleByName(ident, namespace, name); mod == nil {
+			ll.Error().Msg("syncer did not find module by these details")
+			return echo.NewHTTPError(http.StatusNotFound, "module not found").SetInternal(fmt.Errorf("no module with %s/%s/%s", ident, namespace, name))
+		}
+
+		// the upgrade request is used as the template for every invocation on this session.
+		template, err := request.FromEchoContext(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "failed to handle request").SetInternal(err)
+		}
+
+		conn, err := streamUpgrader.Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			// the upgrader has already responded to the client.
+			ll.Err(err).Msg("could not upgrade connection to websocket")
+			return nil
+		}
+
+		session := &streamSession{conn: conn}
+		defer conn.Close()
+
+		if !s.streams.add(session) {
+			session.closeGoingAway()
+			return nil
+		}
+
+		defer s.streams.remove(session)
+
+		ll.Debug().Msg("stream session started")
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go session.keepAlive(stop)
+
+		conn.SetReadLimit(streamMaxFrameSize)
+
+		_ = conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		})
+
+		inFlight := make(chan struct{}, streamConcurrency)
+		wg := sync.WaitGroup{}
+
+		for {
+			_, frame, err := conn.ReadMessage()
+			if err != nil {
+				if !session.closing.Load() && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					ll.Err(err).Msg("stream session ended unexpectedly")
+				}
+
+				break
+			}
+
+			in := parseStreamFrame(frame)
+
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				resp := StreamResponse{ID: in.ID, Status: http.StatusTooManyRequests, Error: "too many invocations in flight"}
+
+				if err := session.write(resp); err != nil {
+					ll.Err(err).Str("frameID", resp.ID).Msg("failed to write stream response")
+				}
+
+				continue
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer func() {
+					<-inFlight
+					wg.Done()
+				}()
+
+				resp := s.executeInvocation(ident, namespace, name, template, in.ID, in.Body)
+
+				if err := session.write(resp); err != nil {
+					ll.Err(err).Str("frameID", resp.ID).Msg("failed to write stream response")
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if session.closing.Load() {
+			session.closeGoingAway()
+		}
+
+		ll.Debug().Msg("stream session ended")
+
+		return nil
+	}
+}
+
+// parseStreamFrame reads an inbound frame, using the whole frame as the body if it is not a StreamRequest.
+func parseStreamFrame(frame []byte) StreamRequest {
+	in := StreamRequest{}
+	if err := json.Unmarshal(frame, &in); err != nil || in.Body == nil {
+		in = StreamRequest{Body: frame}
+	}
+
+	if in.ID == "" {
+		in.ID = uuid.New().String()
+	}
+
+	return in
+}
+
+// executeInvocation runs the module once with body as the input, taking everything else about the request from
+// template, and builds the response for the invocation with the given ID. Failures are reported in the response rather
+// than returned, since they only concern this one invocation of the stream or batch it is part of.
+func (s *Server) executeInvocation(ident, namespace, name string, template *request.CoordinatedRequest, id string, body []byte) StreamResponse {
+	resp := StreamResponse{ID: id}
+
+	mod := s.syncer.GetModuleByName(ident, namespace, name)
+	if mod == nil {
+		resp.Status = http.StatusNotFound
+		resp.Error = "module not found"
+
+		return resp
+	}
+
+	req := &request.CoordinatedRequest{
+		Method:      template.Method,
+		URL:         template.URL,
+		ID:          uuid.New().String(),
+		Body:        body,
+		Headers:     template.Headers,
+		RespHeaders: map[string]string{},
+		Params:      template.Params,
+		State:       map[string][]byte{},
+	}
+
+	steps := []tenant.WorkflowStep{{FQMN: mod.FQMN}}
+
+	release, err := s.limits.acquire(steps)
+	if err != nil {
+		resp.Status = http.StatusTooManyRequests
+		resp.Error = "too many requests"
+
+		if after, ok := retryAfter(err); ok {
+			resp.RespHeaders = map[string]string{RetryAfterHeader: after}
+		}
+
+		return resp
+	}
+
+	defer release()
+
+	seq, err := s.executeSteps(req, steps)
+	if err != nil {
+		s.logger.Err(err).Str("fqmn", mod.FQMN).Str("invocationID", id).Msg("invocation failed")
+
+		httpErr := executionHTTPError(err)
+		resp.Status = httpErr.Code
+		resp.Error = fmt.Sprint(httpErr.Message)
+
+		return resp
+	}
+
+	meta := sequence.NewResponseMeta(req.RespHeaders)
+
+	resp.Status = meta.Status
+	resp.Output = seq.Request().State[mod.FQMN]
+	resp.RespHeaders = meta.Headers
+
+	if meta.ContentType != sequence.DefaultContentType {
+		resp.RespHeaders[echo.HeaderContentType] = meta.ContentType
+	}
+
+	return resp
+}
+
+// write sends a response frame; gorilla/websocket connections support only one concurrent writer.
+func (ss *streamSession) write(resp StreamResponse) error {
+	respJSON, err := json.Marshal(resp)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	ss.writeLock.Lock()
+	defer ss.writeLock.Unlock()
+
+	_ = ss.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+
+	return ss.conn.WriteMessage(websocket.TextMessage, respJSON)
+}
+
+// shutdown stops the session from reading further frames. Its in-flight invocations still respond before the client is
+// told that the server is going away.
+func (ss *streamSession) shutdown() {
+	ss.closing.Store(true)
+
+	_ = ss.conn.SetReadDeadline(time.Now())
+}
+
+// closeGoingAway tells the client that the server is shutting down.
+func (ss *streamSession) closeGoingAway() {
+	ss.writeLock.Lock()
+	defer ss.writeLock.Unlock()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, ErrDraining.Error())
+	_ = ss.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(streamWriteWait))
+}
+
+// keepAlive pings the client until stop is closed so that dead connections are noticed by the read deadline.
+func (ss *streamSession) keepAlive(stop chan struct{}) {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ss.writeLock.Lock()
+			err := ss.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait))
+			ss.writeLock.Unlock()
+
+			if err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dialStream starts a stream session for module a of the test tenant.
+func dialStream(t *testing.T, sats *fakeSats) *websocket.Conn {
+	_, conn := startStream(t, sats)
+
+	return conn
+}
+
+func startStream(t *testing.T, sats *fakeSats) (*Server, *websocket.Conn) {
+	s := newTestServer(t, sats)
+	s.server.GET("/stream/:ident/:namespace/:name", s.streamHandler())
+
+	ts := httptest.NewServer(s.server)
+	t.Cleanup(ts.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/stream/"+testIdent+"/default/a", nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() })
+
+	return s, conn
+}
+
+func readStreamResponse(t *testing.T, conn *websocket.Conn) StreamResponse {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	_, frame, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	resp := StreamResponse{}
+	require.NoError(t, json.Unmarshal(frame, &resp))
+
+	return resp
+}
+
+func TestStream(t *testing.T) {
+	conn := dialStream(t, newFakeSats())
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{ID: "first", Body: []byte("input")}))
+
+	resp := readStreamResponse(t, conn)
+	assert.Equal(t, "first", resp.ID)
+	assert.Equal(t, http.StatusOK, resp.Status)
+	assert.Equal(t, testFQMN("a"), string(resp.Output))
+
+	// frames that are not a StreamRequest are the body of an invocation with a generated ID.
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("raw input")))
+
+	resp = readStreamResponse(t, conn)
+	assert.NotEmpty(t, resp.ID)
+	assert.Equal(t, http.StatusOK, resp.Status)
+}
+
+func TestStream_RefusesWhenSaturated(t *testing.T) {
+	sats := newFakeSats()
+	sats.hold = make(chan struct{})
+
+	conn := dialStream(t, sats)
+
+	// the held invocations must complete before the session can end.
+	t.Cleanup(func() { close(sats.hold) })
+
+	for i := 0; i < streamConcurrency; i++ {
+		require.NoError(t, conn.WriteJSON(StreamRequest{ID: "held", Body: []byte("input")}))
+	}
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{ID: "refused", Body: []byte("input")}))
+
+	resp := readStreamResponse(t, conn)
+	assert.Equal(t, "refused", resp.ID)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Status)
+
+	// control frames are still handled while the session is saturated.
+	pong := make(chan struct{}, 1)
+	conn.SetPongHandler(func(string) error {
+		pong <- struct{}{}
+		return nil
+	})
+
+	require.NoError(t, conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)))
+
+	// the pong handler runs while reading, which times out since no responses are sent.
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, _ = conn.ReadMessage()
+
+	select {
+	case <-pong:
+	default:
+		t.Fatal("the server did not answer the ping")
+	}
+}
+
+func TestStream_ReadLimit(t *testing.T) {
+	conn := dialStream(t, newFakeSats())
+
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, make([]byte, streamMaxFrameSize+1)))
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), "expected the session to be closed, got %v", err)
+}
+
+func TestStream_ClosedOnShutdown(t *testing.T) {
+	sats := newFakeSats()
+	sats.hold = make(chan struct{})
+
+	s, conn := startStream(t, sats)
+
+	require.NoError(t, conn.WriteJSON(StreamRequest{ID: "held", Body: []byte("input")}))
+
+	// wait for the invocation to reach the module before shutting the session down.
+	require.Eventually(t, func() bool { return sats.held.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	s.streams.close()
+	close(sats.hold)
+
+	// the in-flight invocation still responds before the session is closed.
+	resp := readStreamResponse(t, conn)
+	assert.Equal(t, "held", resp.ID)
+	assert.Equal(t, http.StatusOK, resp.Status)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "expected the session to be closed, got %v", err)
+}
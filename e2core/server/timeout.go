@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/fqmn"
+	"github.com/suborbital/systemspec/request"
+)
+
+// TimeoutHeader lets a caller shorten how long a request's modules may run for, as a duration such as "2s" or
+// "500ms". It cannot extend the timeout past the limit of the module being executed.
+const TimeoutHeader = "X-E2Core-Timeout"
+
+// requestedTimeout returns the timeout asked for by the request's TimeoutHeader, or zero if there is none.
+func requestedTimeout(req *request.CoordinatedRequest) (time.Duration, error) {
+	// CoordinatedRequest headers are lowercased.
+	val, exists := req.Headers[strings.ToLower(TimeoutHeader)]
+	if !exists || val == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(val)
+	if err != nil || timeout <= 0 {
+		return 0, common.InvalidArgument("%s must be a positive duration, got %q", TimeoutHeader, val)
+	}
+
+	return timeout, nil
+}
+
+// moduleTimeout returns how long the module may run for: the timeout from the module's metadata in the tenant config,
+// or the global execution timeout if there is none, lowered to the requested timeout if one was given.
+func (s *Server) moduleTimeout(FQMN string, requested time.Duration) time.Duration {
+	limit := s.options.ExecutionTimeout
+	if limit <= 0 {
+		limit = defaultDispatchTimeout
+	}
+
+	if parsed, err := fqmn.Parse(FQMN); err == nil {
+		if t := time.Duration(s.syncer.ModuleMetadata(parsed.Tenant, parsed.Namespace, parsed.Name).Timeout); t > 0 {
+			limit = t
+		}
+	}
+
+	if requested > 0 && requested < limit {
+		return requested
+	}
+
+	return limit
+}
+
+// useDeadline carries the deadline of a gRPC call over into the request's TimeoutHeader, unless the caller set the
+// header explicitly.
+func useDeadline(ctx context.Context, req *request.CoordinatedRequest) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+
+	key := strings.ToLower(TimeoutHeader)
+	if _, exists := req.Headers[key]; exists {
+		return
+	}
+
+	if remaining := time.Until(deadline); remaining > 0 {
+		req.Headers[key] = remaining.String()
+	}
+}
+
+// executionHTTPError converts an error from executeSteps into the HTTP error to respond with. A RunErr returned by a
+// module is passed on with its code as the status, as long as that is an error status.
+func executionHTTPError(err error) *echo.HTTPError {
+	runErr := scheduler.RunErr{}
+
+	switch {
+	case errors.As(err, &runErr) && runErr.Code >= http.StatusBadRequest && runErr.Code <= 599:
+		return echo.NewHTTPError(runErr.Code, runErr.Message).SetInternal(err)
+	case common.IsError(err, common.ErrInvalid):
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request").SetInternal(err)
+	case common.IsError(err, common.ErrLimit):
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests").SetInternal(err)
+	case errors.Is(err, ErrDispatchTimeout):
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "execution timed out").SetInternal(err)
+	case errors.Is(err, ErrDraining):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, ErrDraining.Error()).SetInternal(err)
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError, "failed to execute plugin").SetInternal(err)
+}
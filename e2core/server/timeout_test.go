@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/syncer"
+	"github.com/suborbital/e2core/foundation/common"
+	"github.com/suborbital/systemspec/request"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func TestRequestedTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"no header", "", 0, false},
+		{"duration", "1500ms", 1500 * time.Millisecond, false},
+		{"not a duration", "soon", 0, true},
+		{"negative", "-1s", 0, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &request.CoordinatedRequest{Headers: map[string]string{}}
+			if tc.value != "" {
+				req.Headers["x-e2core-timeout"] = tc.value
+			}
+
+			got, err := requestedTimeout(req)
+			if tc.wantErr {
+				assert.True(t, common.IsError(err, common.ErrInvalid))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestModuleTimeout(t *testing.T) {
+	config := &tenant.Config{
+		Identifier:       "com.suborbital.app",
+		TenantVersion:    1,
+		DefaultNamespace: tenant.NamespaceConfig{Name: "default"},
+	}
+
+	source := &testSource{
+		config:   config,
+		metadata: metadata.Tenant{metadata.Key("default", "slow"): {Timeout: metadata.Duration(time.Minute)}},
+	}
+
+	opts := &options.Options{ExecutionTimeout: 10 * time.Second}
+
+	sync := syncer.New(opts, zerolog.Nop(), source)
+	require.NoError(t, sync.Start())
+
+	s := &Server{options: opts, syncer: sync}
+
+	slow := "fqmn://com.suborbital.app/default/slow@v1.0.0"
+	fast := "fqmn://com.suborbital.app/default/fast@v1.0.0"
+
+	assert.Equal(t, time.Minute, s.moduleTimeout(slow, 0))
+	assert.Equal(t, 10*time.Second, s.moduleTimeout(fast, 0))
+	assert.Equal(t, 2*time.Second, s.moduleTimeout(fast, 2*time.Second), "requests may lower the timeout")
+	assert.Equal(t, 10*time.Second, s.moduleTimeout(fast, time.Hour), "requests may not raise the timeout past the module limit")
+	assert.Equal(t, 30*time.Second, s.moduleTimeout(slow, 30*time.Second))
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certCheckInterval is how often the certificate files are checked for changes.
+const certCheckInterval = 10 * time.Second
+
+// setupTLS configures the TLS server if TLS is enabled, which it is if certificate files are configured, a
+// self-signed certificate was asked for, or a domain is set (in which case the certificate is obtained using ACME).
+// While TLS is enabled the HTTP port redirects to HTTPS, unless the redirect was turned off. The health and readiness
+// probes are still answered on the HTTP port, since probes often cannot follow a redirect to a certificate they trust.
+func (s *Server) setupTLS() error {
+	opts := s.options.TLSConfig
+
+	ll := s.logger.With().Str("method", "setupTLS").Logger()
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	var redirect http.Handler = redirectHandler(s.options.TLSPort, s.server)
+
+	switch {
+	case opts.CertFile != "" || opts.KeyFile != "":
+		reloader, err := newCertReloader(opts.CertFile, opts.KeyFile, s.logger)
+		if err != nil {
+			return errors.Wrap(err, "newCertReloader")
+		}
+
+		ll.Info().Str("cert", opts.CertFile).Msg("serving TLS with certificate files")
+
+		tlsConfig.GetCertificate = reloader.GetCertificate
+	case opts.SelfSigned:
+		cert, err := selfSignedCertificate(s.options.Domain)
+		if err != nil {
+			return errors.Wrap(err, "selfSignedCertificate")
+		}
+
+		ll.Warn().Msg("serving TLS with a self-signed certificate")
+
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	case s.options.Domain != "":
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.options.Domain),
+			Cache:      autocert.DirCache(opts.ACMECacheDir),
+			Email:      opts.ACMEEmail,
+		}
+
+		ll.Info().Str("domain", s.options.Domain).Msg("serving TLS with a certificate obtained using ACME")
+
+		tlsConfig.GetCertificate = manager.GetCertificate
+		tlsConfig.NextProtos = []string{acme.ALPNProto}
+
+		// HTTP-01 challenges are answered on the HTTP port.
+		redirect = manager.HTTPHandler(redirect)
+	default:
+		return nil
+	}
+
+	if !s.server.DisableHTTP2 {
+		tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2")
+	}
+
+	s.server.TLSServer.Addr = fmt.Sprintf(":%d", s.options.TLSPort)
+	s.server.TLSServer.TLSConfig = tlsConfig
+
+	if opts.Redirect {
+		s.redirect = &http.Server{
+			Addr:              fmt.Sprintf(":%d", s.options.HTTPPort),
+			Handler:           redirect,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+
+	return nil
+}
+
+// tlsEnabled returns true if setupTLS configured the TLS server.
+func (s *Server) tlsEnabled() bool {
+	return s.server.TLSServer.TLSConfig != nil
+}
+
+// redirectHandler permanently redirects every request to the same URL with the https scheme and the TLS port, except
+// for the health and readiness probes, which are passed to probes.
+func redirectHandler(tlsPort int, probes http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == E2CoreHealthURI || r.URL.Path == E2CoreReadyURI {
+			probes.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if tlsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(tlsPort))
+		}
+
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+		}
+
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+}
+
+// certReloader serves a certificate from a pair of files, and loads them again when they change so that renewed
+// certificates are picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	log      zerolog.Logger
+
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+	lock    sync.Mutex
+}
+
+func newCertReloader(certFile, keyFile string, log zerolog.Logger) (*certReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a certificate file and a key file must be set")
+	}
+
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		log:      log.With().Str("module", "certReloader").Logger(),
+	}
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, errors.Wrap(err, "r.latestModTime")
+	}
+
+	if err := r.load(modTime); err != nil {
+		return nil, errors.Wrap(err, "r.load")
+	}
+
+	return r, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate. If the files changed but can no longer be loaded, the previous
+// certificate keeps being served.
+func (r *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if time.Since(r.checked) < certCheckInterval {
+		return r.cert, nil
+	}
+
+	r.checked = time.Now()
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		r.log.Err(err).Msg("failed to check certificate files, serving the loaded certificate")
+		return r.cert, nil
+	}
+
+	if modTime.Equal(r.modTime) {
+		return r.cert, nil
+	}
+
+	if err := r.load(modTime); err != nil {
+		r.log.Err(err).Msg("failed to reload certificate, serving the previous one")
+		return r.cert, nil
+	}
+
+	r.log.Info().Str("cert", r.certFile).Msg("reloaded certificate")
+
+	return r.cert, nil
+}
+
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "tls.LoadX509KeyPair")
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+
+	return nil
+}
+
+// latestModTime returns the time that either of the files was last modified.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "os.Stat")
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// selfSignedCertificate generates a certificate for the domain, or for localhost if there is none. It is meant for
+// testing, since clients will not trust it.
+func selfSignedCertificate(domain string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "ecdsa.GenerateKey")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "rand.Int")
+	}
+
+	if domain == "" {
+		domain = "localhost"
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"E2Core"}, CommonName: domain},
+		DNSNames:     []string{domain},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "x509.CreateCertificate")
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	probes := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		tlsPort int
+		url     string
+		want    string
+	}{
+		{name: "default port", tlsPort: 443, url: "http://example.com:8080/name/a/b/c?x=1", want: "https://example.com/name/a/b/c?x=1"},
+		{name: "custom port", tlsPort: 8443, url: "http://example.com/metrics", want: "https://example.com:8443/metrics"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			redirectHandler(tt.tlsPort, probes).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.url, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+			assert.Equal(t, tt.want, rec.Header().Get("Location"))
+		})
+	}
+
+	for _, path := range []string{E2CoreHealthURI, E2CoreReadyURI} {
+		t.Run("probe "+path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			redirectHandler(443, probes).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com"+path, nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Empty(t, rec.Header().Get("Location"))
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	writeCertificate(t, certFile, keyFile, "first.example.com")
+
+	r, err := newCertReloader(certFile, keyFile, zerolog.Nop())
+	require.NoError(t, err)
+
+	assert.Equal(t, "first.example.com", servedName(t, r))
+
+	writeCertificate(t, certFile, keyFile, "second.example.com")
+	require.NoError(t, os.Chtimes(certFile, time.Now(), time.Now().Add(time.Minute)))
+
+	// the files are not checked again until certCheckInterval has passed.
+	assert.Equal(t, "first.example.com", servedName(t, r))
+
+	r.checked = time.Time{}
+	assert.Equal(t, "second.example.com", servedName(t, r))
+
+	t.Run("a broken file keeps the previous certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0600))
+		require.NoError(t, os.Chtimes(certFile, time.Now(), time.Now().Add(2*time.Minute)))
+
+		r.checked = time.Time{}
+		assert.Equal(t, "second.example.com", servedName(t, r))
+	})
+
+	t.Run("missing files are rejected", func(t *testing.T) {
+		_, err := newCertReloader(filepath.Join(dir, "missing.pem"), keyFile, zerolog.Nop())
+		assert.Error(t, err)
+	})
+}
+
+func writeCertificate(t *testing.T, certFile, keyFile, domain string) {
+	t.Helper()
+
+	cert, err := selfSignedCertificate(domain)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func servedName(t *testing.T, r *certReloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+
+	return parsed.Subject.CommonName
+}
@@ -0,0 +1,425 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/suborbital/e2core/e2core/metrics"
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/trigger"
+	"github.com/suborbital/e2core/foundation/bus/bus"
+	"github.com/suborbital/e2core/foundation/bus/transport/kafka"
+	"github.com/suborbital/e2core/foundation/bus/transport/nats"
+	"github.com/suborbital/systemspec/request"
+)
+
+const (
+	BridgeNATS  = "nats"
+	BridgeKafka = "kafka"
+
+	// triggerReconcileInterval is how often the triggers are compared to the tenant config.
+	triggerReconcileInterval = time.Second
+
+	// triggerConcurrency is how many executions each trigger may run at the same time. Messages that arrive while a
+	// trigger is saturated wait for one of its executions to complete.
+	triggerConcurrency = 16
+
+	// triggerMaxRetries is how many times an execution that was rejected with 429 is tried again before the trigger
+	// gives up and publishes the error.
+	triggerMaxRetries = 5
+
+	// triggerRetryDelay is how long to wait before trying a rejected execution again, unless the rejection says.
+	triggerRetryDelay = time.Second
+)
+
+// TriggerError is published to a trigger's error topic when an execution that the trigger started fails.
+type TriggerError struct {
+	Trigger   string `json:"trigger"`
+	Ident     string `json:"ident"`
+	Namespace string `json:"namespace"`
+	Topic     string `json:"topic"`
+	MessageID string `json:"messageId"`
+	RequestID string `json:"requestId"`
+	Status    int    `json:"status"`
+	Error     string `json:"error"`
+}
+
+// newBridge creates the bridge transport that the config asks for, or returns nil if there is none.
+func newBridge(config options.BridgeConfig) (bus.BridgeTransport, error) {
+	switch config.Type {
+	case "":
+		return nil, nil
+	case BridgeNATS:
+		t, err := nats.New(config.Address)
+		if err != nil {
+			return nil, errors.Wrap(err, "nats.New")
+		}
+
+		return t, nil
+	case BridgeKafka:
+		t, err := kafka.New(config.Address)
+		if err != nil {
+			return nil, errors.Wrap(err, "kafka.New")
+		}
+
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("unknown bridge type %q, must be %s or %s", config.Type, BridgeNATS, BridgeKafka)
+}
+
+// triggers keeps the bus connected to the topics of the tenant config's and the triggers file's triggers, and runs
+// the triggers for every message on those topics. Topics stay connected once they have been, since the bus cannot
+// disconnect them; messages on topics that no longer have triggers are ignored.
+type triggers struct {
+	server *Server
+	bus    *bus.Bus
+	bridge string
+	file   []trigger.Definition
+	log    zerolog.Logger
+
+	// execute runs a trigger's module or workflow with a message's data as the body.
+	execute func(def trigger.Definition, id string, body []byte) ([]byte, int, *echo.HTTPError)
+
+	concurrency int
+	retries     int
+
+	// active holds the triggers by topic, and slots the semaphore of each active trigger by triggerKey.
+	active map[string][]trigger.Definition
+	slots  map[string]chan struct{}
+	// bridged holds the topics that the bus is connected to, and pods the ones that are listened to.
+	bridged map[string]struct{}
+	pods    map[string]*bus.Pod
+
+	lock     sync.RWMutex
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newTriggers(s *Server, bridge string, file []trigger.Definition) *triggers {
+	t := &triggers{
+		server:      s,
+		bus:         s.bus,
+		bridge:      bridge,
+		file:        file,
+		log:         s.logger.With().Str("module", "triggers").Logger(),
+		concurrency: triggerConcurrency,
+		retries:     triggerMaxRetries,
+		active:      map[string][]trigger.Definition{},
+		slots:       map[string]chan struct{}{},
+		bridged:     map[string]struct{}{},
+		pods:        map[string]*bus.Pod{},
+		stop:        make(chan struct{}),
+	}
+
+	t.execute = t.executeTrigger
+
+	return t
+}
+
+// start reconciles the triggers until stopped.
+func (t *triggers) start() {
+	go func() {
+		ticker := time.NewTicker(triggerReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			t.reconcile(t.desired())
+
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// shutdown stops listening to the topics so that no more executions are started.
+func (t *triggers) shutdown() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		for topic, pod := range t.pods {
+			pod.Disconnect()
+			delete(t.pods, topic)
+		}
+
+		t.active = map[string][]trigger.Definition{}
+		t.slots = map[string]chan struct{}{}
+	})
+}
+
+// desired returns the triggers of the triggers file and of every tenant that run on the configured bridge.
+func (t *triggers) desired() []trigger.Definition {
+	var defs []trigger.Definition
+
+	defs = append(defs, t.file...)
+
+	for ident := range t.server.syncer.ListTenants() {
+		tnt := t.server.syncer.TenantOverview(ident)
+		if tnt == nil {
+			continue
+		}
+
+		defs = append(defs, trigger.FromTenant(ident, tnt.Config)...)
+	}
+
+	return defs
+}
+
+// reconcile connects the bus to the topics that the triggers use, and replaces the active triggers with defs. A
+// trigger whose topics could not be connected is left out, and tried again the next time.
+func (t *triggers) reconcile(defs []trigger.Definition) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	select {
+	case <-t.stop:
+		return
+	default:
+	}
+
+	active := map[string][]trigger.Definition{}
+	slots := map[string]chan struct{}{}
+
+	for _, def := range defs {
+		if !def.UsesBridge(t.bridge) {
+			continue
+		}
+
+		if err := t.connect(def); err != nil {
+			t.log.Err(err).Str("trigger", triggerKey(def)).Msg("failed to connect trigger")
+			continue
+		}
+
+		active[def.Topic] = append(active[def.Topic], def)
+
+		// a trigger keeps its semaphore while it stays active, since its executions may still be running.
+		key := triggerKey(def)
+
+		slots[key] = t.slots[key]
+		if slots[key] == nil {
+			slots[key] = make(chan struct{}, t.concurrency)
+		}
+	}
+
+	for _, key := range changedTriggers(active, t.active) {
+		t.log.Info().Str("trigger", key).Msg("registered trigger")
+	}
+
+	for _, key := range changedTriggers(t.active, active) {
+		t.log.Info().Str("trigger", key).Msg("removed trigger")
+	}
+
+	t.active = active
+	t.slots = slots
+}
+
+// connect connects the bus to the trigger's topics and listens to its topic. The lock must be held.
+func (t *triggers) connect(def trigger.Definition) error {
+	for _, topic := range []string{def.Topic, def.ReplyTopic, def.ErrorTopic} {
+		if _, exists := t.bridged[topic]; exists || topic == "" {
+			continue
+		}
+
+		if err := t.bus.ConnectBridgeTopic(topic); err != nil {
+			return errors.Wrapf(err, "bus.ConnectBridgeTopic %s", topic)
+		}
+
+		t.bridged[topic] = struct{}{}
+	}
+
+	if _, exists := t.pods[def.Topic]; !exists {
+		pod := t.bus.Connect()
+		pod.OnType(def.Topic, t.onMessage(pod, def.Topic))
+
+		t.pods[def.Topic] = pod
+	}
+
+	return nil
+}
+
+// onMessage starts every trigger of the topic for each message. Executions run in the background so that a slow module
+// does not hold up the other triggers, but a trigger that is running as many executions as it may holds up the
+// message until one of them completes.
+func (t *triggers) onMessage(pod *bus.Pod, topic string) bus.MsgFunc {
+	return func(msg bus.Message) error {
+		t.lock.RLock()
+		defs := t.active[topic]
+		slots := make([]chan struct{}, len(defs))
+
+		for i := range defs {
+			slots[i] = t.slots[triggerKey(defs[i])]
+		}
+		t.lock.RUnlock()
+
+		for i, def := range defs {
+			select {
+			case slots[i] <- struct{}{}:
+			case <-t.stop:
+				return nil
+			}
+
+			if !t.server.inFlight.add() {
+				<-slots[i]
+
+				t.log.Warn().Str("topic", topic).Str("messageID", msg.UUID()).Msg("server is shutting down, dropping triggered executions")
+
+				return nil
+			}
+
+			go func(def trigger.Definition, slot chan struct{}) {
+				defer func() { <-slot }()
+				defer t.server.inFlight.done()
+
+				t.run(pod, def, msg)
+			}(def, slots[i])
+		}
+
+		return nil
+	}
+}
+
+// run executes a trigger for a message, and publishes the output to the reply topic or the error to the error topic.
+// An execution that is rejected with 429 is tried again after a delay, up to the retry limit.
+func (t *triggers) run(pod *bus.Pod, def trigger.Definition, msg bus.Message) {
+	ll := t.log.With().
+		Str("ident", def.Ident).
+		Str("namespace", def.Namespace).
+		Str("trigger", def.Name).
+		Str("messageID", msg.UUID()).
+		Logger()
+
+	started := time.Now()
+	requestID := uuid.New().String()
+
+	output, status, httpErr := t.execute(def, requestID, msg.Data())
+
+retry:
+	for attempt := 1; status == http.StatusTooManyRequests && attempt <= t.retries; attempt++ {
+		delay := triggerRetryAfter(httpErr)
+
+		ll.Warn().Int("attempt", attempt).Dur("delay", delay).Msg("triggered execution was rejected, trying again")
+
+		select {
+		case <-time.After(delay):
+		case <-t.stop:
+			// the server is shutting down, so the rejection is published as it is.
+			break retry
+		}
+
+		output, status, httpErr = t.execute(def, requestID, msg.Data())
+	}
+
+	name := def.Module
+	if name == "" {
+		name = def.Workflow
+	}
+
+	metrics.ObserveRequest(def.Ident, def.Namespace, name, metrics.TransportBridge, strconv.Itoa(status), started)
+
+	if httpErr != nil {
+		ll.Error().Int("status", status).Str("error", fmt.Sprint(httpErr.Message)).Msg("triggered execution failed")
+
+		data, err := json.Marshal(TriggerError{
+			Trigger:   def.Name,
+			Ident:     def.Ident,
+			Namespace: def.Namespace,
+			Topic:     def.Topic,
+			MessageID: msg.UUID(),
+			RequestID: requestID,
+			Status:    status,
+			Error:     fmt.Sprint(httpErr.Message),
+		})
+		if err != nil {
+			ll.Err(err).Msg("json.Marshal TriggerError")
+			return
+		}
+
+		pod.ReplyTo(msg, bus.NewMsg(def.ErrorTopic, data))
+
+		return
+	}
+
+	ll.Debug().Str("requestID", requestID).Msg("triggered execution completed")
+
+	if def.ReplyTopic != "" {
+		pod.ReplyTo(msg, bus.NewMsg(def.ReplyTopic, output))
+	}
+}
+
+// executeTrigger runs the trigger's module or workflow once.
+func (t *triggers) executeTrigger(def trigger.Definition, id string, body []byte) ([]byte, int, *echo.HTTPError) {
+	s := t.server
+
+	steps, responseKey, err := s.resolveTarget(def.Ident, def.Namespace, def.Module, def.Workflow, nil)
+	if err != nil {
+		return nil, http.StatusNotFound, echo.NewHTTPError(http.StatusNotFound, err.Error()).SetInternal(err)
+	}
+
+	req := &request.CoordinatedRequest{
+		Method:      http.MethodPost,
+		URL:         fmt.Sprintf("/triggers/%s/%s", def.Ident, def.Name),
+		ID:          id,
+		Body:        body,
+		Headers:     map[string]string{},
+		RespHeaders: map[string]string{},
+		Params:      map[string]string{},
+		State:       map[string][]byte{},
+	}
+
+	return s.executeTarget(req, steps, responseKey)
+}
+
+// triggerRetryAfter returns how long to wait before trying an execution that was rejected with httpErr again.
+func triggerRetryAfter(httpErr *echo.HTTPError) time.Duration {
+	limitErr := &limitError{}
+	if httpErr != nil && errors.As(httpErr.Internal, &limitErr) && limitErr.retryAfter > 0 {
+		return limitErr.retryAfter
+	}
+
+	return triggerRetryDelay
+}
+
+func triggerKey(def trigger.Definition) string {
+	return fmt.Sprintf("%s/%s/%s", def.Ident, def.Namespace, def.Name)
+}
+
+// changedTriggers returns the keys of the triggers in a that are not in b, sorted.
+func changedTriggers(a, b map[string][]trigger.Definition) []string {
+	existing := map[string]struct{}{}
+
+	for _, defs := range b {
+		for _, def := range defs {
+			existing[triggerKey(def)] = struct{}{}
+		}
+	}
+
+	var keys []string
+
+	for _, defs := range a {
+		for _, def := range defs {
+			if _, exists := existing[triggerKey(def)]; !exists {
+				keys = append(keys, triggerKey(def))
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/e2core/e2core/trigger"
+	"github.com/suborbital/e2core/foundation/bus/bus"
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+func TestTriggersNATS(t *testing.T) {
+	ns := natsserver.RunRandClientPortServer()
+	defer ns.Shutdown()
+
+	bridge, err := newBridge(options.BridgeConfig{Type: BridgeNATS, Address: ns.ClientURL()})
+	require.NoError(t, err)
+
+	s := &Server{
+		bus:      bus.New(bus.UseLogger(zerolog.Nop()), bus.UseBridgeTransport(bridge)),
+		inFlight: &drainGroup{},
+		logger:   zerolog.Nop(),
+	}
+
+	tr := newTriggers(s, BridgeNATS, nil)
+	defer tr.shutdown()
+
+	tr.execute = func(def trigger.Definition, id string, body []byte) ([]byte, int, *echo.HTTPError) {
+		if string(body) == "fail" {
+			return nil, http.StatusInternalServerError, echo.NewHTTPError(http.StatusInternalServerError, "module failed")
+		}
+
+		return bytes.ToUpper(body), http.StatusOK, nil
+	}
+
+	tr.reconcile([]trigger.Definition{
+		{Name: "shout", Ident: "com.suborbital.test", Namespace: "default", Module: "shout", Topic: "words", ReplyTopic: "words.shouted", ErrorTopic: "words.errors"},
+		{Name: "elsewhere", Ident: "com.suborbital.test", Namespace: "default", Module: "shout", Bridge: "kafka", Topic: "ignored"},
+	})
+
+	require.Len(t, tr.active, 1)
+
+	nc, err := natsgo.Connect(ns.ClientURL())
+	require.NoError(t, err)
+
+	defer nc.Close()
+
+	replies := make(chan *natsgo.Msg, 16)
+	_, err = nc.ChanSubscribe("words.shouted", replies)
+	require.NoError(t, err)
+
+	failures := make(chan *natsgo.Msg, 16)
+	_, err = nc.ChanSubscribe("words.errors", failures)
+	require.NoError(t, err)
+
+	require.NoError(t, nc.Flush())
+
+	// the bus connects to the topics in the background, so keep publishing until it is listening.
+	receive := func(data string, from chan *natsgo.Msg) *natsgo.Msg {
+		var msg *natsgo.Msg
+
+		require.Eventually(t, func() bool {
+			require.NoError(t, nc.Publish("words", []byte(data)))
+
+			select {
+			case msg = <-from:
+				return true
+			case <-time.After(100 * time.Millisecond):
+				return false
+			}
+		}, 5*time.Second, 10*time.Millisecond)
+
+		return msg
+	}
+
+	reply := receive("hello", replies)
+	assert.Equal(t, "HELLO", string(reply.Data))
+
+	failure := receive("fail", failures)
+
+	triggerErr := TriggerError{}
+	require.NoError(t, json.Unmarshal(failure.Data, &triggerErr))
+
+	assert.Equal(t, "shout", triggerErr.Trigger)
+	assert.Equal(t, "words", triggerErr.Topic)
+	assert.Equal(t, http.StatusInternalServerError, triggerErr.Status)
+	assert.Equal(t, "module failed", triggerErr.Error)
+}
+
+func TestTriggersKafka(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(1, "words", "words.shouted", "words.errors"))
+	require.NoError(t, err)
+
+	defer cluster.Close()
+
+	bridge, err := newBridge(options.BridgeConfig{Type: BridgeKafka, Address: cluster.ListenAddrs()[0]})
+	require.NoError(t, err)
+
+	s := &Server{
+		bus:      bus.New(bus.UseLogger(zerolog.Nop()), bus.UseBridgeTransport(bridge)),
+		inFlight: &drainGroup{},
+		logger:   zerolog.Nop(),
+	}
+
+	tr := newTriggers(s, BridgeKafka, nil)
+	defer tr.shutdown()
+
+	tr.execute = func(def trigger.Definition, id string, body []byte) ([]byte, int, *echo.HTTPError) {
+		if string(body) == "fail" {
+			return nil, http.StatusInternalServerError, echo.NewHTTPError(http.StatusInternalServerError, "module failed")
+		}
+
+		return bytes.ToUpper(body), http.StatusOK, nil
+	}
+
+	tr.reconcile([]trigger.Definition{
+		{Name: "shout", Ident: "com.suborbital.test", Namespace: "default", Module: "shout", Topic: "words", ReplyTopic: "words.shouted", ErrorTopic: "words.errors"},
+		{Name: "elsewhere", Ident: "com.suborbital.test", Namespace: "default", Module: "shout", Bridge: BridgeNATS, Topic: "ignored"},
+	})
+
+	require.Len(t, tr.active, 1)
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics("words.shouted", "words.errors"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+
+	defer client.Close()
+
+	// the bus connects to the topics in the background, so keep producing until it is listening.
+	receive := func(data, from string) *kgo.Record {
+		var record *kgo.Record
+
+		require.Eventually(t, func() bool {
+			require.NoError(t, client.ProduceSync(context.Background(), &kgo.Record{Topic: "words", Value: []byte(data)}).FirstErr())
+
+			ctx, cxl := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cxl()
+
+			client.PollFetches(ctx).EachRecord(func(r *kgo.Record) {
+				if r.Topic == from && record == nil {
+					record = r
+				}
+			})
+
+			return record != nil
+		}, 10*time.Second, 10*time.Millisecond)
+
+		return record
+	}
+
+	reply := receive("hello", "words.shouted")
+	assert.Equal(t, "HELLO", string(reply.Value))
+
+	failure := receive("fail", "words.errors")
+
+	triggerErr := TriggerError{}
+	require.NoError(t, json.Unmarshal(failure.Value, &triggerErr))
+
+	assert.Equal(t, "shout", triggerErr.Trigger)
+	assert.Equal(t, "words", triggerErr.Topic)
+	assert.Equal(t, http.StatusInternalServerError, triggerErr.Status)
+	assert.Equal(t, "module failed", triggerErr.Error)
+}
+
+func TestNewBridge(t *testing.T) {
+	bridge, err := newBridge(options.BridgeConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, bridge)
+
+	_, err = newBridge(options.BridgeConfig{Type: "carrier-pigeon"})
+	assert.Error(t, err)
+}
+
+// newLocalTriggers creates triggers on a bus without a bridge, with def active on its topic. Messages are delivered
+// by calling the returned onMessage directly.
+func newLocalTriggers(t *testing.T, def trigger.Definition) (*triggers, bus.MsgFunc) {
+	s := &Server{
+		bus:      bus.New(bus.UseLogger(zerolog.Nop())),
+		inFlight: &drainGroup{},
+		logger:   zerolog.Nop(),
+	}
+
+	tr := newTriggers(s, BridgeNATS, nil)
+	t.Cleanup(tr.shutdown)
+
+	tr.concurrency = 2
+	tr.active[def.Topic] = []trigger.Definition{def}
+	tr.slots[triggerKey(def)] = make(chan struct{}, tr.concurrency)
+
+	pod := s.bus.Connect()
+	t.Cleanup(pod.Disconnect)
+
+	return tr, tr.onMessage(pod, def.Topic)
+}
+
+func TestTriggers_Concurrency(t *testing.T) {
+	def := trigger.Definition{Name: "slow", Ident: "com.suborbital.test", Namespace: "default", Module: "slow", Topic: "jobs", ErrorTopic: "jobs.errors"}
+
+	tr, onMessage := newLocalTriggers(t, def)
+
+	running := atomic.Int32{}
+	release := make(chan struct{})
+
+	tr.execute = func(trigger.Definition, string, []byte) ([]byte, int, *echo.HTTPError) {
+		running.Add(1)
+		<-release
+
+		return nil, http.StatusOK, nil
+	}
+
+	delivered := make(chan struct{}, 3)
+
+	for i := 0; i < 3; i++ {
+		go func() {
+			_ = onMessage(bus.NewMsg(def.Topic, []byte("job")))
+			delivered <- struct{}{}
+		}()
+	}
+
+	// the third message waits until one of the first two executions completes.
+	require.Eventually(t, func() bool { return len(delivered) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), running.Load())
+
+	release <- struct{}{}
+
+	require.Eventually(t, func() bool { return len(delivered) == 3 }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return running.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	close(release)
+}
+
+func TestTriggers_RetriesRejected(t *testing.T) {
+	def := trigger.Definition{Name: "busy", Ident: "com.suborbital.test", Namespace: "default", Module: "busy", Topic: "jobs", ErrorTopic: "jobs.errors"}
+
+	rejection := echo.NewHTTPError(http.StatusTooManyRequests, "too many requests").
+		SetInternal(&limitError{err: common.TooManyRequests("rate exceeded"), retryAfter: 10 * time.Millisecond})
+
+	t.Run("succeeds once accepted", func(t *testing.T) {
+		tr, onMessage := newLocalTriggers(t, def)
+
+		attempts := atomic.Int32{}
+		done := make(chan struct{})
+
+		tr.execute = func(trigger.Definition, string, []byte) ([]byte, int, *echo.HTTPError) {
+			if attempts.Add(1) < 3 {
+				return nil, http.StatusTooManyRequests, rejection
+			}
+
+			close(done)
+
+			return nil, http.StatusOK, nil
+		}
+
+		require.NoError(t, onMessage(bus.NewMsg(def.Topic, []byte("job"))))
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the execution was not tried again")
+		}
+
+		assert.Equal(t, int32(3), attempts.Load())
+	})
+
+	t.Run("gives up after the retry limit", func(t *testing.T) {
+		tr, onMessage := newLocalTriggers(t, def)
+		tr.retries = 2
+
+		failures := make(chan bus.Message, 1)
+
+		errPod := tr.bus.Connect()
+		defer errPod.Disconnect()
+
+		errPod.OnType(def.ErrorTopic, func(msg bus.Message) error {
+			failures <- msg
+			return nil
+		})
+
+		attempts := atomic.Int32{}
+
+		tr.execute = func(trigger.Definition, string, []byte) ([]byte, int, *echo.HTTPError) {
+			attempts.Add(1)
+
+			return nil, http.StatusTooManyRequests, rejection
+		}
+
+		require.NoError(t, onMessage(bus.NewMsg(def.Topic, []byte("job"))))
+
+		select {
+		case msg := <-failures:
+			triggerErr := TriggerError{}
+			require.NoError(t, json.Unmarshal(msg.Data(), &triggerErr))
+
+			assert.Equal(t, http.StatusTooManyRequests, triggerErr.Status)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the rejection was not published")
+		}
+
+		assert.Equal(t, int32(3), attempts.Load())
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/suborbital/go-kit/web/mid"
+	"github.com/suborbital/systemspec/system"
 	"github.com/suborbital/systemspec/system/bundle"
 )
 
@@ -20,6 +21,11 @@ func FromBundle(bundlePath string) (*echo.Echo, error) {
 		return nil, errors.Wrap(err, "failed to Start bundle source")
 	}
 
+	return FromSource(bs)
+}
+
+// FromSource creates a sourceserver that serves an already started system source.
+func FromSource(source system.Source) (*echo.Echo, error) {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	l := zerolog.New(os.Stderr).With().
 		Timestamp().
@@ -34,7 +40,7 @@ func FromBundle(bundlePath string) (*echo.Echo, error) {
 		middleware.Recover(),
 	)
 
-	rt := NewRouter(l, bs)
+	rt := NewRouter(l, source)
 
 	if err := rt.Attach("/system/v1", e); err != nil {
 		return nil, errors.Wrap(err, "es.Attach with /system/v1 prefix")
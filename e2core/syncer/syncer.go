@@ -2,12 +2,16 @@ package syncer
 
 import (
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/suborbital/e2core/e2core/metadata"
+	"github.com/suborbital/e2core/e2core/metrics"
 	"github.com/suborbital/e2core/e2core/options"
 	"github.com/suborbital/e2core/foundation/scheduler"
+	"github.com/suborbital/systemspec/fqmn"
 	"github.com/suborbital/systemspec/system"
 	"github.com/suborbital/systemspec/tenant"
 )
@@ -27,12 +31,27 @@ type syncJob struct {
 	state        *system.State
 	tenantIdents map[string]int64
 	overviews    map[string]*system.TenantOverview
+	metadata     map[string]metadata.Tenant
 	modules      map[string]tenant.Module
+	listeners    []ModuleListener
+	status       Status
 
 	log  zerolog.Logger
 	lock *sync.RWMutex
 }
 
+// Status describes how syncing with the system source has gone. Synced is true once a sync has completed, and Error
+// holds the error of the last attempt, if it failed.
+type Status struct {
+	Synced      bool      `json:"synced"`
+	LastSync    time.Time `json:"lastSync"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// ModuleListener is called with a module that the syncer has seen a new ref for.
+type ModuleListener func(ident string, mod tenant.Module)
+
 // New creates a syncer with the given SystemSource
 func New(opts *options.Options, logger zerolog.Logger, source system.Source) *Syncer {
 	s := &Syncer{
@@ -45,6 +64,7 @@ func New(opts *options.Options, logger zerolog.Logger, source system.Source) *Sy
 		state:        &system.State{},
 		tenantIdents: make(map[string]int64),
 		overviews:    make(map[string]*system.TenantOverview),
+		metadata:     make(map[string]metadata.Tenant),
 		modules:      make(map[string]tenant.Module),
 		log:          logger.With().Str("module", "syncJob").Logger(),
 		lock:         &sync.RWMutex{},
@@ -73,18 +93,46 @@ func (s *Syncer) Start() error {
 
 // Run runs a sync job
 func (s *syncJob) Run(_ scheduler.Job, _ *scheduler.Ctx) (interface{}, error) {
+	attempted := time.Now()
+	err := s.sync()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.status.LastAttempt = attempted
+	s.status.Error = ""
+
+	if err != nil {
+		s.status.Error = err.Error()
+		return nil, err
+	}
+
+	s.status.Synced = true
+	s.status.LastSync = attempted
+
+	return nil, nil
+}
+
+// sync brings the local state up to date with the system source if its version has changed.
+func (s *syncJob) sync() error {
 	state, err := s.systemSource.State()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to systemSource.State")
+		return errors.Wrap(err, "failed to systemSource.State")
 	}
 
 	ll := s.log.With().Str("method", "Run").Logger()
 
 	if state.SystemVersion == s.state.SystemVersion {
 		ll.Debug().Int64("s.state.SystemVersion", s.state.SystemVersion).Msg("versions match, skipping sync")
-		return nil, nil
+		metrics.Synced(state.SystemVersion)
+		return nil
 	}
 
+	var changed []changedModule
+
+	// listeners are notified once the lock has been released, so that they can use the syncer.
+	defer func() { s.notify(changed) }()
+
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
@@ -94,7 +142,7 @@ func (s *syncJob) Run(_ scheduler.Job, _ *scheduler.Ctx) (interface{}, error) {
 			Int64("s.state.SystemVersion", s.state.SystemVersion).
 			Int64("state.SystemVersion", state.SystemVersion).
 			Msg("skipping sync as local state systemversion is lower than s.state.SystemVersion")
-		return nil, nil
+		return nil
 	}
 
 	ll.Debug().
@@ -104,7 +152,7 @@ func (s *syncJob) Run(_ scheduler.Job, _ *scheduler.Ctx) (interface{}, error) {
 
 	ovv, err := s.systemSource.Overview()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to app.Overview")
+		return errors.Wrap(err, "failed to app.Overview")
 	}
 
 	// mount each handler into the handler group.
@@ -116,7 +164,18 @@ func (s *syncJob) Run(_ scheduler.Job, _ *scheduler.Ctx) (interface{}, error) {
 
 		tnt, err := s.systemSource.TenantOverview(ident)
 		if err != nil {
-			return nil, errors.Wrapf(err, "failed to app.TenantOverview for %s", ident)
+			return errors.Wrapf(err, "failed to app.TenantOverview for %s", ident)
+		}
+
+		// not every system source can provide module metadata, in which case the modules have none. It is fetched
+		// before the overview is stored so that a failure is retried by the next sync.
+		if mdSource, ok := s.systemSource.(metadata.Source); ok {
+			md, err := mdSource.ModuleMetadata(ident, tnt.Version)
+			if err != nil {
+				return errors.Wrapf(err, "failed to ModuleMetadata for %s", ident)
+			}
+
+			s.metadata[ident] = md
 		}
 
 		if tnt.Config.Modules == nil {
@@ -133,6 +192,10 @@ func (s *syncJob) Run(_ scheduler.Job, _ *scheduler.Ctx) (interface{}, error) {
 				Str("moduleNamespace", m.Namespace).
 				Msg("syncing module")
 
+			if _, seen := s.modules[m.Ref]; !seen {
+				changed = append(changed, changedModule{ident: ident, mod: m})
+			}
+
 			s.modules[m.Ref] = tnt.Config.Modules[i]
 		}
 
@@ -144,11 +207,51 @@ func (s *syncJob) Run(_ scheduler.Job, _ *scheduler.Ctx) (interface{}, error) {
 	s.state = state
 	s.tenantIdents = ovv.TenantRefs.Identifiers
 
-	return nil, nil
+	metrics.Synced(state.SystemVersion)
+
+	return nil
 }
 
 func (s *syncJob) OnChange(_ scheduler.ChangeEvent) error { return nil }
 
+type changedModule struct {
+	ident string
+	mod   tenant.Module
+}
+
+func (s *syncJob) notify(changed []changedModule) {
+	if len(changed) == 0 {
+		return
+	}
+
+	s.lock.RLock()
+	listeners := s.listeners
+	s.lock.RUnlock()
+
+	for _, c := range changed {
+		for _, l := range listeners {
+			l(c.ident, c.mod)
+		}
+	}
+}
+
+// OnModuleChange registers a listener that is called for every module whose ref the syncer has not seen before, such
+// as a module that was just created or updated, once the sync that found it has completed.
+func (s *Syncer) OnModuleChange(l ModuleListener) {
+	s.job.lock.Lock()
+	defer s.job.lock.Unlock()
+
+	s.job.listeners = append(s.job.listeners, l)
+}
+
+// Status returns how syncing with the system source has gone.
+func (s *Syncer) Status() Status {
+	s.job.lock.RLock()
+	defer s.job.lock.RUnlock()
+
+	return s.job.status
+}
+
 // State returns the current system state
 func (s *Syncer) State() *system.State {
 	s.job.lock.RLock()
@@ -196,6 +299,14 @@ func (s *Syncer) GetModuleByName(ident, namespace, name string) *tenant.Module {
 	return mod
 }
 
+// ModuleMetadata returns the metadata of a module, which is empty if it has none.
+func (s *Syncer) ModuleMetadata(ident, namespace, name string) metadata.Module {
+	s.job.lock.RLock()
+	defer s.job.lock.RUnlock()
+
+	return s.job.metadata[ident].Module(namespace, name)
+}
+
 // GetModuleByRef gets a module by its ref
 func (s *Syncer) GetModuleByRef(ref string) *tenant.Module {
 	s.job.lock.RLock()
@@ -205,3 +316,40 @@ func (s *Syncer) GetModuleByRef(ref string) *tenant.Module {
 
 	return &mod
 }
+
+// GetWorkflowByName gets a workflow by its name from the given tenant namespace
+func (s *Syncer) GetWorkflowByName(ident, namespace, name string) *tenant.Workflow {
+	s.job.lock.RLock()
+	defer s.job.lock.RUnlock()
+
+	tnt := s.job.overviews[ident]
+	if tnt == nil {
+		return nil
+	}
+
+	nsConfig := &tnt.Config.DefaultNamespace
+	if namespace != fqmn.NamespaceDefault {
+		nsConfig = nil
+
+		for i, ns := range tnt.Config.Namespaces {
+			if ns.Name == namespace {
+				nsConfig = &tnt.Config.Namespaces[i]
+				break
+			}
+		}
+	}
+
+	if nsConfig == nil {
+		return nil
+	}
+
+	var wfl *tenant.Workflow
+	for i, w := range nsConfig.Workflows {
+		if w.Name == name {
+			wfl = &nsConfig.Workflows[i]
+			break
+		}
+	}
+
+	return wfl
+}
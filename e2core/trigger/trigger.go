@@ -0,0 +1,164 @@
+package trigger
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/suborbital/e2core/e2core/options"
+	"github.com/suborbital/systemspec/fqmn"
+	"github.com/suborbital/systemspec/tenant"
+)
+
+const (
+	SourceTenant = "tenant"
+	SourceFile   = "file"
+
+	// errorTopicSuffix is appended to a trigger's topic to name its error topic if it does not set one.
+	errorTopicSuffix = ".errors"
+)
+
+// File is the local triggers file, which holds triggers in addition to the ones in tenant config.
+type File struct {
+	Triggers []Definition `yaml:"triggers" json:"triggers"`
+}
+
+// Definition maps a bridge topic to a module or a workflow, exactly one of which must be set. Every message on Topic
+// is used as the body of an execution. The output is published to ReplyTopic if one is set, and a failed execution is
+// published to ErrorTopic, which defaults to the topic with ".errors" appended. Bridge limits the trigger to one kind
+// of bridge (nats or kafka); if it is empty, the trigger uses whichever bridge is configured.
+type Definition struct {
+	Name       string `yaml:"name" json:"name"`
+	Ident      string `yaml:"ident" json:"ident"`
+	Namespace  string `yaml:"namespace" json:"namespace"`
+	Module     string `yaml:"module,omitempty" json:"module,omitempty"`
+	Workflow   string `yaml:"workflow,omitempty" json:"workflow,omitempty"`
+	Bridge     string `yaml:"bridge,omitempty" json:"bridge,omitempty"`
+	Topic      string `yaml:"topic" json:"topic"`
+	ReplyTopic string `yaml:"replyTopic,omitempty" json:"replyTopic,omitempty"`
+	ErrorTopic string `yaml:"errorTopic,omitempty" json:"errorTopic,omitempty"`
+}
+
+// Load reads a YAML (or JSON) triggers file.
+func Load(path string) ([]Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.ReadFile")
+	}
+
+	f := &File{}
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, errors.Wrap(err, "yaml.Unmarshal")
+	}
+
+	names := map[string]struct{}{}
+
+	for i := range f.Triggers {
+		def := &f.Triggers[i]
+		def.setDefaults()
+
+		if err := def.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "trigger %d", i)
+		}
+
+		key := def.Ident + "/" + def.Name
+		if _, exists := names[key]; exists {
+			return nil, fmt.Errorf("trigger %d: %s is defined more than once for %s", i, def.Name, def.Ident)
+		}
+
+		names[key] = struct{}{}
+	}
+
+	return f.Triggers, nil
+}
+
+// FromOptions loads the triggers file configured in opts, returning no triggers if there is none.
+func FromOptions(opts *options.Options) ([]Definition, error) {
+	if opts.TriggersPath == "" {
+		return nil, nil
+	}
+
+	defs, err := Load(opts.TriggersPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Load %s", opts.TriggersPath)
+	}
+
+	return defs, nil
+}
+
+// FromTenant returns the triggers of the workflows in a tenant's config. They are named after their workflow and
+// topic, and publish their output to the trigger's sink topic. Triggers that are not valid are left out.
+func FromTenant(ident string, config *tenant.Config) []Definition {
+	if config == nil {
+		return nil
+	}
+
+	var defs []Definition
+
+	namespaces := append([]tenant.NamespaceConfig{config.DefaultNamespace}, config.Namespaces...)
+
+	for _, ns := range namespaces {
+		for _, wfl := range ns.Workflows {
+			for _, t := range wfl.Triggers {
+				def := Definition{
+					Name:       fmt.Sprintf("%s:%s", wfl.Name, t.Topic),
+					Ident:      ident,
+					Namespace:  ns.Name,
+					Workflow:   wfl.Name,
+					Bridge:     t.Source,
+					Topic:      t.Topic,
+					ReplyTopic: t.SinkTopic,
+				}
+
+				def.setDefaults()
+
+				if def.Validate() != nil {
+					continue
+				}
+
+				defs = append(defs, def)
+			}
+		}
+	}
+
+	return defs
+}
+
+// Validate checks that the definition says what to execute and which topics to use.
+func (d Definition) Validate() error {
+	if d.Name == "" || d.Ident == "" {
+		return errors.New("name and ident must be set")
+	}
+
+	if (d.Module == "") == (d.Workflow == "") {
+		return errors.New("exactly one of module and workflow must be set")
+	}
+
+	if d.Topic == "" {
+		return errors.New("topic must be set")
+	}
+
+	// publishing to the trigger's own topic would trigger it again, forever.
+	if d.ReplyTopic == d.Topic || d.ErrorTopic == d.Topic {
+		return errors.New("replyTopic and errorTopic must not be the same as topic")
+	}
+
+	return nil
+}
+
+// UsesBridge returns true if the trigger should run on the given kind of bridge.
+func (d Definition) UsesBridge(bridge string) bool {
+	return d.Bridge == "" || d.Bridge == bridge
+}
+
+func (d *Definition) setDefaults() {
+	if d.Namespace == "" {
+		d.Namespace = fqmn.NamespaceDefault
+	}
+
+	if d.ErrorTopic == "" && d.Topic != "" {
+		d.ErrorTopic = d.Topic + errorTopicSuffix
+	}
+}
@@ -0,0 +1,109 @@
+package trigger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/systemspec/tenant"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "triggers.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+triggers:
+  - name: resize
+    ident: com.suborbital.test
+    module: resize
+    topic: images
+    replyTopic: images.resized
+  - name: orders
+    ident: com.suborbital.test
+    namespace: shop
+    workflow: process
+    bridge: kafka
+    topic: orders
+    errorTopic: orders.failed
+`), 0600))
+
+	defs, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, defs, 2)
+
+	assert.Equal(t, Definition{
+		Name:       "resize",
+		Ident:      "com.suborbital.test",
+		Namespace:  "default",
+		Module:     "resize",
+		Topic:      "images",
+		ReplyTopic: "images.resized",
+		ErrorTopic: "images.errors",
+	}, defs[0])
+
+	assert.Equal(t, "orders.failed", defs[1].ErrorTopic)
+	assert.True(t, defs[1].UsesBridge("kafka"))
+	assert.False(t, defs[1].UsesBridge("nats"))
+	assert.True(t, defs[0].UsesBridge("nats"))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		def  Definition
+	}{
+		{name: "no name", def: Definition{Ident: "a", Module: "m", Topic: "t"}},
+		{name: "module and workflow", def: Definition{Name: "n", Ident: "a", Module: "m", Workflow: "w", Topic: "t"}},
+		{name: "nothing to execute", def: Definition{Name: "n", Ident: "a", Topic: "t"}},
+		{name: "no topic", def: Definition{Name: "n", Ident: "a", Module: "m"}},
+		{name: "replies to itself", def: Definition{Name: "n", Ident: "a", Module: "m", Topic: "t", ReplyTopic: "t"}},
+		{name: "errors to itself", def: Definition{Name: "n", Ident: "a", Module: "m", Topic: "t", ErrorTopic: "t"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.def.Validate())
+		})
+	}
+}
+
+func TestFromTenant(t *testing.T) {
+	config := &tenant.Config{
+		DefaultNamespace: tenant.NamespaceConfig{
+			Name: "default",
+			Workflows: []tenant.Workflow{
+				{Name: "untriggered"},
+				{Name: "signup", Triggers: []tenant.Trigger{
+					{Source: "nats", Topic: "user-created", SinkTopic: "user-welcomed"},
+					{Topic: ""},
+				}},
+			},
+		},
+		Namespaces: []tenant.NamespaceConfig{
+			{Name: "billing", Workflows: []tenant.Workflow{
+				{Name: "invoice", Triggers: []tenant.Trigger{{Topic: "orders"}}},
+			}},
+		},
+	}
+
+	defs := FromTenant("com.suborbital.test", config)
+	require.Len(t, defs, 2)
+
+	assert.Equal(t, Definition{
+		Name:       "signup:user-created",
+		Ident:      "com.suborbital.test",
+		Namespace:  "default",
+		Workflow:   "signup",
+		Bridge:     "nats",
+		Topic:      "user-created",
+		ReplyTopic: "user-welcomed",
+		ErrorTopic: "user-created.errors",
+	}, defs[0])
+
+	assert.Equal(t, "billing", defs[1].Namespace)
+	assert.Equal(t, "orders", defs[1].Topic)
+	assert.Empty(t, defs[1].ReplyTopic)
+}
@@ -74,6 +74,11 @@ func (b *Bus) Tunnel(capability string, msg Message) error {
 	return b.hub.sendTunneledMessage(capability, msg)
 }
 
+// HasCapability returns true if a connection that a message can be tunneled to has advertised the capability.
+func (b *Bus) HasCapability(capability string) bool {
+	return b.hub.hasCapability(capability)
+}
+
 // Withdraw cancels discovery, sends withdraw messages to all peers,
 // and returns when all peers have acknowledged the withdraw
 func (b *Bus) Withdraw() error {
@@ -328,6 +328,16 @@ func (h *hub) removeMeshConnection(uuid string) {
 	delete(h.meshConnections, uuid)
 }
 
+// hasCapability returns true if at least one connection has advertised the capability.
+func (h *hub) hasCapability(capability string) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	balancer, exists := h.capabilityBalancers[capability]
+
+	return exists && balancer.Len() > 0
+}
+
 func (h *hub) connectionExists(uuid string) bool {
 	h.lock.RLock()
 	defer h.lock.RUnlock()
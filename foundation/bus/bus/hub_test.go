@@ -0,0 +1,56 @@
+package bus
+
+import (
+	"testing"
+)
+
+// idleConnection is a Connection that never receives anything.
+type idleConnection struct {
+	closed chan struct{}
+}
+
+func (c *idleConnection) SendMsg(Message) error { return nil }
+
+func (c *idleConnection) ReadMsg() (Message, *Withdraw, error) {
+	<-c.closed
+	return nil, &Withdraw{}, nil
+}
+
+func (c *idleConnection) OutgoingHandshake(*TransportHandshake) (*TransportHandshakeAck, error) {
+	return &TransportHandshakeAck{}, nil
+}
+
+func (c *idleConnection) IncomingHandshake(HandshakeCallback) error { return nil }
+
+func (c *idleConnection) SendWithdraw(*Withdraw) error { return nil }
+
+func (c *idleConnection) Close() error { return nil }
+
+func TestHasCapability(t *testing.T) {
+	g := New()
+
+	capability := "fqmn://com.suborbital.app/default/hello@v1"
+
+	if g.HasCapability(capability) {
+		t.Error("expected no capability before any connection")
+	}
+
+	conn := &idleConnection{closed: make(chan struct{})}
+	defer close(conn.closed)
+
+	g.hub.addConnection(conn, "peer", "group", []string{capability})
+
+	if !g.HasCapability(capability) {
+		t.Error("expected the capability once a connection advertised it")
+	}
+
+	if g.HasCapability("fqmn://com.suborbital.app/default/other@v1") {
+		t.Error("expected no capability that no connection advertised")
+	}
+
+	g.hub.removeMeshConnection("peer")
+
+	if g.HasCapability(capability) {
+		t.Error("expected no capability once the connection was removed")
+	}
+}
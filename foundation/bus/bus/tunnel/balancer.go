@@ -54,6 +54,14 @@ func (b *Balancer) Remove(uuid string) {
 	}
 }
 
+// Len returns the number of UUIDs in the list
+func (b *Balancer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return len(b.uuids)
+}
+
 // Next returns the next round-robin UUID from the list
 func (b *Balancer) Next() string {
 	b.lock.Lock()
@@ -104,6 +104,10 @@ func (c *Conn) Start(pod *bus.Pod) {
 	go func() {
 		for {
 			fetches := c.conn.PollFetches(context.Background())
+			if fetches.IsClientClosed() {
+				return
+			}
+
 			if errs := fetches.Errors(); len(errs) > 0 {
 				ll.Err(errs[0].Err).Msg("fetches.Errors()")
 				continue
@@ -10,6 +10,8 @@ import (
 	"github.com/suborbital/e2core/foundation/bus/bus"
 )
 
+const busMetadataHeaderKey = "bus.metadata"
+
 // Transport is a transport that connects Grav nodes via NATS
 type Transport struct {
 	opts *bus.BridgeOptions
@@ -25,7 +27,7 @@ type Conn struct {
 	pod   *bus.Pod
 
 	sub   *nats.Subscription
-	pubFn func(data []byte) error
+	pubFn func(msg *nats.Msg) error
 }
 
 // New creates a new NATS transport
@@ -57,8 +59,8 @@ func (t *Transport) ConnectTopic(topic string) (bus.BridgeConnection, error) {
 		return nil, errors.Wrap(err, "failed to SubscribeSync")
 	}
 
-	pubFn := func(data []byte) error {
-		return t.serverConn.Publish(topic, data)
+	pubFn := func(msg *nats.Msg) error {
+		return t.serverConn.PublishMsg(msg)
 	}
 
 	conn := &Conn{
@@ -78,12 +80,17 @@ func (c *Conn) Start(pod *bus.Pod) {
 	c.pod = pod
 
 	c.pod.OnType(c.topic, func(msg bus.Message) error {
-		msgBytes, err := msg.Marshal()
+		metadataBytes, err := msg.MarshalMetadata()
 		if err != nil {
-			return errors.Wrap(err, "failed to Marshal message")
+			return errors.Wrap(err, "failed to MarshalMetadata message")
 		}
 
-		if err := c.pubFn(msgBytes); err != nil {
+		// publish the message payload as-is and store the Bus metadata (message UUID, etc) in a header
+		natsMsg := nats.NewMsg(c.topic)
+		natsMsg.Data = msg.Data()
+		natsMsg.Header.Set(busMetadataHeaderKey, string(metadataBytes))
+
+		if err := c.pubFn(natsMsg); err != nil {
 			return errors.Wrap(err, "failed to pubFn")
 		}
 
@@ -105,12 +112,7 @@ func (c *Conn) Start(pod *bus.Pod) {
 
 			ll.Debug().Msg("received message from topic")
 
-			msg, err := bus.MsgFromBytes(message.Data)
-			if err != nil {
-				ll.Err(err).Msg("bus.MsgFromBytes, falling back to raw data")
-
-				msg = bus.NewMsg(c.topic, message.Data)
-			}
+			msg := c.messageFrom(message)
 
 			// send to the Grav instance
 			c.pod.Send(msg)
@@ -118,6 +120,24 @@ func (c *Conn) Start(pod *bus.Pod) {
 	}()
 }
 
+// messageFrom reconstructs the Bus message from a NATS message. Messages without the metadata header were not
+// published by a Bus, so a brand new message is created for their data.
+func (c *Conn) messageFrom(message *nats.Msg) bus.Message {
+	metaHeader := message.Header.Get(busMetadataHeaderKey)
+	if metaHeader == "" {
+		return bus.NewMsg(c.topic, message.Data)
+	}
+
+	msg, err := bus.MsgFromDataAndMeta(message.Data, []byte(metaHeader))
+	if err != nil {
+		c.log.Err(err).Msg("bus.MsgFromDataAndMeta, falling back to raw data")
+
+		return bus.NewMsg(c.topic, message.Data)
+	}
+
+	return msg
+}
+
 // Close closes the underlying connection
 func (c *Conn) Close() {
 	ll := c.log.With().Str("method", "Close").Logger()
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NonceHeader carries the nonce that each end of a connection contributes to the challenges that both sign.
+	NonceHeader = "X-Bus-Nonce"
+	// CredentialHeader and SignatureHeader carry the credential of the node accepting a connection, and its signature
+	// over the challenge, to the node that opened it.
+	CredentialHeader = "X-Bus-Credential"
+	SignatureHeader  = "X-Bus-Signature"
+
+	// authTimeout is how long the node accepting a connection waits for the other to prove itself.
+	authTimeout = 10 * time.Second
+
+	incomingRole = "bus-accept"
+	outgoingRole = "bus-connect"
+)
+
+// Authenticator proves a node's membership of the mesh to its peers, and verifies theirs, when connections are
+// opened. A node proves itself by presenting its credential along with its signature over a challenge that is made of
+// fresh nonces from both ends of the connection, so that neither can be replayed on another connection.
+type Authenticator interface {
+	// Credential returns the credential that the node presents to its peers.
+	Credential() (string, error)
+	// Sign signs a challenge with the key that the node's credential was issued for.
+	Sign(challenge []byte) []byte
+	// Verify checks a peer's credential and its signature over the challenge, and returns the BelongsTo value that the
+	// credential was issued for, or "*" if the peer may belong to any.
+	Verify(credential string, challenge, signature []byte) (string, error)
+}
+
+// proof is the message that the node opening a connection proves itself with, once it has verified the other node.
+type proof struct {
+	Credential string `json:"credential"`
+	Signature  []byte `json:"signature"`
+}
+
+// proveIncoming returns the nonce that the accepting node contributes to the connection, and the headers that prove
+// its membership to the node that opened it.
+func (t *Transport) proveIncoming(peerNonce string) (string, http.Header, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "newNonce")
+	}
+
+	credential, err := t.auth.Credential()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "auth.Credential")
+	}
+
+	signature := t.auth.Sign(challenge(incomingRole, peerNonce, nonce))
+
+	header := http.Header{
+		NonceHeader:      {nonce},
+		CredentialHeader: {credential},
+		SignatureHeader:  {base64.StdEncoding.EncodeToString(signature)},
+	}
+
+	return nonce, header, nil
+}
+
+// authenticateOutgoing verifies the node that accepted the connection from the headers of its response, and only then
+// proves membership to it.
+func (t *Transport) authenticateOutgoing(c *websocket.Conn, header http.Header, nonce string) (string, error) {
+	peerNonce := header.Get(NonceHeader)
+
+	signature, err := base64.StdEncoding.DecodeString(header.Get(SignatureHeader))
+	if err != nil {
+		return "", errors.Wrap(err, "base64.StdEncoding.DecodeString")
+	}
+
+	belongsTo, err := t.auth.Verify(header.Get(CredentialHeader), challenge(incomingRole, nonce, peerNonce), signature)
+	if err != nil {
+		return "", errors.Wrap(err, "auth.Verify")
+	}
+
+	credential, err := t.auth.Credential()
+	if err != nil {
+		return "", errors.Wrap(err, "auth.Credential")
+	}
+
+	proofJSON, err := json.Marshal(proof{Credential: credential, Signature: t.auth.Sign(challenge(outgoingRole, nonce, peerNonce))})
+	if err != nil {
+		return "", errors.Wrap(err, "json.Marshal")
+	}
+
+	if err := c.WriteMessage(websocket.TextMessage, proofJSON); err != nil {
+		return "", errors.Wrap(err, "WriteMessage")
+	}
+
+	return belongsTo, nil
+}
+
+// authenticateIncoming reads the proof of the node that opened the connection and verifies it.
+func (t *Transport) authenticateIncoming(c *websocket.Conn, peerNonce, nonce string) (string, error) {
+	if err := c.SetReadDeadline(time.Now().Add(authTimeout)); err != nil {
+		return "", errors.Wrap(err, "SetReadDeadline")
+	}
+
+	_, proofJSON, err := c.ReadMessage()
+	if err != nil {
+		return "", errors.Wrap(err, "ReadMessage")
+	}
+
+	p := proof{}
+	if err := json.Unmarshal(proofJSON, &p); err != nil {
+		return "", errors.Wrap(err, "json.Unmarshal")
+	}
+
+	belongsTo, err := t.auth.Verify(p.Credential, challenge(outgoingRole, peerNonce, nonce), p.Signature)
+	if err != nil {
+		return "", errors.Wrap(err, "auth.Verify")
+	}
+
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		return "", errors.Wrap(err, "SetReadDeadline")
+	}
+
+	return belongsTo, nil
+}
+
+// challenge returns what the node in role signs for a connection. The role keeps the signature of one end from being
+// reflected back as that of the other.
+func challenge(role, outgoingNonce, incomingNonce string) []byte {
+	return []byte(role + "\n" + outgoingNonce + "\n" + incomingNonce)
+}
+
+func newNonce() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "rand.Read")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(nonce), nil
+}
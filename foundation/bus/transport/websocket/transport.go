@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -24,10 +25,14 @@ const (
 
 var upgrader = websocket.Upgrader{}
 
+// Option configures a Transport.
+type Option func(*Transport)
+
 // Transport is a transport that connects Grav nodes via standard websockets
 type Transport struct {
 	opts *bus.MeshOptions
 	log  zerolog.Logger
+	auth Authenticator
 
 	connectionFunc bus.ConnectFunc
 }
@@ -36,18 +41,35 @@ type Transport struct {
 type Conn struct {
 	nodeUUID string
 	log      zerolog.Logger
+	// peerBelongsTo is the BelongsTo that the peer's credential was issued for, or empty if peers are not
+	// authenticated.
+	peerBelongsTo string
 
 	conn *websocket.Conn
 	lock sync.Mutex
 }
 
 // New creates a new websocket transport
-func New() *Transport {
+func New(opts ...Option) *Transport {
 	t := &Transport{}
 
+	for _, opt := range opts {
+		opt(t)
+	}
+
 	return t
 }
 
+// UseAuthenticator makes the transport authenticate peers with auth when connections are opened in either direction,
+// and reject the ones that fail, or that claim to belong to something other than what their credential was issued
+// for. The node that accepts a connection proves itself first, so that the node opening it never presents its proof to
+// a peer that it has not verified.
+func UseAuthenticator(auth Authenticator) Option {
+	return func(t *Transport) {
+		t.auth = auth
+	}
+}
+
 // Setup sets up the transport
 func (t *Transport) Setup(opts *bus.MeshOptions, connFunc bus.ConnectFunc) error {
 	// independent serving is not yet implemented, use the HTTP handler
@@ -70,7 +92,19 @@ func (t *Transport) Connect(endpoint string) (bus.Connection, error) {
 		return nil, err
 	}
 
-	c, _, err := websocket.DefaultDialer.Dial(endpointURL.String(), nil)
+	var header http.Header
+	var nonce string
+
+	if t.auth != nil {
+		nonce, err = newNonce()
+		if err != nil {
+			return nil, errors.Wrap(err, "[transport-websocket] failed to newNonce")
+		}
+
+		header = http.Header{NonceHeader: {nonce}}
+	}
+
+	c, resp, err := websocket.DefaultDialer.Dial(endpointURL.String(), header)
 	if err != nil {
 		return nil, errors.Wrapf(err, "[transport-websocket] failed to Dial endpoint")
 	}
@@ -81,6 +115,16 @@ func (t *Transport) Connect(endpoint string) (bus.Connection, error) {
 		lock: sync.Mutex{},
 	}
 
+	if t.auth != nil {
+		belongsTo, err := t.authenticateOutgoing(c, resp.Header, nonce)
+		if err != nil {
+			c.Close()
+			return nil, errors.Wrap(err, "[transport-websocket] failed to authenticate peer")
+		}
+
+		conn.peerBelongsTo = belongsTo
+	}
+
 	return conn, nil
 }
 
@@ -93,17 +137,51 @@ func (t *Transport) HTTPHandlerFunc() http.HandlerFunc {
 			return
 		}
 
-		c, err := upgrader.Upgrade(w, r, nil)
+		var header http.Header
+		var peerNonce, nonce, peerBelongsTo string
+
+		if t.auth != nil {
+			peerNonce = r.Header.Get(NonceHeader)
+			if peerNonce == "" {
+				t.log.Warn().Str("remoteAddr", r.RemoteAddr).Msg("rejecting connection without a nonce")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var err error
+
+			nonce, header, err = t.proveIncoming(peerNonce)
+			if err != nil {
+				t.log.Err(err).Msg("could not prove membership of the mesh")
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		c, err := upgrader.Upgrade(w, r, header)
 		if err != nil {
 			t.log.Err(err).Msg("could not upgrade connection to websocket")
 			return
 		}
 
+		if t.auth != nil {
+			belongsTo, err := t.authenticateIncoming(c, peerNonce, nonce)
+			if err != nil {
+				t.log.Warn().Err(err).Str("remoteAddr", r.RemoteAddr).Msg("rejecting unauthenticated connection")
+				_ = c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ""), time.Now().Add(time.Second))
+				c.Close()
+				return
+			}
+
+			peerBelongsTo = belongsTo
+		}
+
 		t.log.Debug().Str("connectionURL", r.URL.String()).Msg("upgraded connection")
 
 		conn := &Conn{
-			conn: c,
-			log:  t.log,
+			conn:          c,
+			log:           t.log,
+			peerBelongsTo: peerBelongsTo,
 		}
 
 		t.connectionFunc(conn)
@@ -197,6 +275,10 @@ func (c *Conn) OutgoingHandshake(handshake *bus.TransportHandshake) (*bus.Transp
 		return nil, errors.Wrap(err, "failed to Unmarshal handshake ack")
 	}
 
+	if ack.Accept && !c.peerMayBelongTo(ack.BelongsTo) {
+		return nil, fmt.Errorf("peer's credential was not issued for %q", ack.BelongsTo)
+	}
+
 	c.nodeUUID = ack.UUID
 
 	return &ack, nil
@@ -221,6 +303,10 @@ func (c *Conn) IncomingHandshake(handshakeCallback bus.HandshakeCallback) error
 		return errors.Wrap(err, "failed to Unmarshal handshake")
 	}
 
+	if !c.peerMayBelongTo(handshake.BelongsTo) {
+		return fmt.Errorf("peer's credential was not issued for %q", handshake.BelongsTo)
+	}
+
 	ack := handshakeCallback(handshake)
 
 	ackJSON, err := json.Marshal(ack)
@@ -266,6 +352,11 @@ func (c *Conn) Close() error {
 	return nil
 }
 
+// peerMayBelongTo returns true if the peer is not authenticated, or its credential was issued for belongsTo.
+func (c *Conn) peerMayBelongTo(belongsTo string) bool {
+	return c.peerBelongsTo == "" || c.peerBelongsTo == "*" || c.peerBelongsTo == belongsTo
+}
+
 // WriteMessage is a concurrent-safe wrapper around the websocket WriteMessage
 func (c *Conn) WriteMessage(messageType int, data []byte) error {
 	c.lock.Lock()
@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/suborbital/e2core/foundation/bus/bus"
+)
+
+// testAuthenticator accepts the credentials in its known map, which holds the BelongsTo each was issued for. Its
+// signatures are the credential followed by the challenge, or replay if it is set.
+type testAuthenticator struct {
+	credential string
+	known      map[string]string
+	replay     []byte
+}
+
+func (a testAuthenticator) Credential() (string, error) {
+	return a.credential, nil
+}
+
+func (a testAuthenticator) Sign(challenge []byte) []byte {
+	if a.replay != nil {
+		return a.replay
+	}
+
+	return append([]byte(a.credential+"|"), challenge...)
+}
+
+func (a testAuthenticator) Verify(credential string, challenge, signature []byte) (string, error) {
+	belongsTo, ok := a.known[credential]
+	if !ok {
+		return "", errors.New("unknown credential")
+	}
+
+	if string(signature) != credential+"|"+string(challenge) {
+		return "", errors.New("bad signature")
+	}
+
+	return belongsTo, nil
+}
+
+func TestTransport_Authenticates(t *testing.T) {
+	known := map[string]string{"e2core": "*", "sat-a": "tenant-a", "sat-b": "tenant-b"}
+
+	conns := make(chan bus.Connection, 1)
+
+	server := New(UseAuthenticator(testAuthenticator{credential: "sat-a", known: known}))
+	require.NoError(t, server.Setup(&bus.MeshOptions{Logger: zerolog.Nop()}, func(c bus.Connection) { conns <- c }))
+
+	ts := httptest.NewServer(server.HTTPHandlerFunc())
+	defer ts.Close()
+
+	endpoint := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	dial := func(auth Authenticator) (*Conn, error) {
+		var opts []Option
+		if auth != nil {
+			opts = append(opts, UseAuthenticator(auth))
+		}
+
+		client := New(opts...)
+		require.NoError(t, client.Setup(&bus.MeshOptions{Logger: zerolog.Nop()}, nil))
+
+		conn, err := client.Connect(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		return conn.(*Conn), nil
+	}
+
+	// rejected asserts that the server closed the connection without handing it to the hub.
+	rejected := func(t *testing.T, conn *Conn) {
+		defer conn.Close()
+
+		_, _, err := conn.conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+		assert.Empty(t, conns)
+	}
+
+	t.Run("unauthenticated peers are rejected", func(t *testing.T) {
+		_, err := dial(nil)
+		assert.ErrorContains(t, err, "bad handshake")
+
+		conn, err := dial(testAuthenticator{credential: "intruder", known: known})
+		require.NoError(t, err)
+
+		rejected(t, conn)
+	})
+
+	t.Run("replayed proofs are rejected", func(t *testing.T) {
+		replay := append([]byte("e2core|"), challenge(outgoingRole, "earlier", "connection")...)
+
+		conn, err := dial(testAuthenticator{credential: "e2core", known: known, replay: replay})
+		require.NoError(t, err)
+
+		rejected(t, conn)
+	})
+
+	t.Run("peers verify each other", func(t *testing.T) {
+		conn, err := dial(testAuthenticator{credential: "e2core", known: known})
+		require.NoError(t, err)
+
+		defer conn.Close()
+
+		accepted := <-conns
+		defer accepted.Close()
+
+		assert.Equal(t, "tenant-a", conn.peerBelongsTo)
+		assert.True(t, conn.peerMayBelongTo("tenant-a"))
+		assert.False(t, conn.peerMayBelongTo("tenant-b"))
+
+		// e2core's credential lets it join the mesh of any tenant.
+		assert.True(t, accepted.(*Conn).peerMayBelongTo("tenant-b"))
+	})
+
+	t.Run("servers that fail verification are rejected", func(t *testing.T) {
+		_, err := dial(testAuthenticator{credential: "sat-b", known: map[string]string{"sat-b": "tenant-b"}})
+		assert.ErrorContains(t, err, "failed to authenticate peer")
+
+		// the client did not prove itself to the server it could not verify, so the server never accepted it.
+		select {
+		case <-conns:
+			t.Error("server accepted a connection that never proved itself")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestHTTPHandlerFunc_Unauthorized(t *testing.T) {
+	transport := New(UseAuthenticator(testAuthenticator{credential: "sat-a"}))
+	require.NoError(t, transport.Setup(&bus.MeshOptions{Logger: zerolog.Nop()}, func(bus.Connection) {}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/meta/message", nil)
+
+	transport.HTTPHandlerFunc()(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -53,6 +53,7 @@ func (d *defaultAPI) HostFunctions() []HostFn {
 		d.RequestGetFieldHandler(),
 		d.RequestSetFieldHandler(),
 		d.RespSetHeaderHandler(),
+		d.RespSetStatusHandler(),
 	}
 
 	return fns
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"strconv"
+
+	"github.com/suborbital/e2core/e2core/sequence"
 	"github.com/suborbital/e2core/sat/engine2/runtime/instance"
 	"github.com/suborbital/systemspec/capabilities"
 )
@@ -56,3 +59,53 @@ func (d *defaultAPI) responseSetHeader(keyPointer int32, keySize int32, valPoint
 
 	return 0
 }
+
+func (d *defaultAPI) RespSetStatusHandler() HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		status := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := d.responseSetStatus(status, ident)
+
+		return ret, nil
+	}
+
+	return NewHostFn("resp_set_status", 2, true, fn)
+}
+
+// responseSetStatus sets the HTTP status code of the response by way of the reserved status header.
+func (d *defaultAPI) responseSetStatus(status int32, ident int32) int32 {
+	ll := d.logger.With().Str("method", "responseSetStatus").Logger()
+
+	if !sequence.ValidStatus(int(status)) {
+		ll.Error().Int32("status", status).Msg("invalid status code")
+		return -5
+	}
+
+	inst, err := instance.ForIdentifier(ident, false)
+	if err != nil {
+		ll.Err(err).Msg("instance.ForIdentifier")
+		return -1
+	}
+
+	req := RequestFromContext(inst.Ctx().Context)
+
+	if req == nil {
+		ll.Error().Msg("request is not set")
+		return -2
+	}
+
+	handler := capabilities.NewRequestHandler(*d.capabilities.RequestConfig, req)
+
+	if err := handler.SetResponseHeader(sequence.StatusHeader, strconv.Itoa(int(status))); err != nil {
+		ll.Err(err).Msg("handler.SetResponseHeader")
+
+		if err == capabilities.ErrReqNotSet {
+			return -2
+		} else {
+			return -5
+		}
+	}
+
+	return 0
+}
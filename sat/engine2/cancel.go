@@ -0,0 +1,86 @@
+package engine2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/suborbital/e2core/foundation/common"
+)
+
+// canceledRetention is how long a cancellation is remembered for, so that jobs for the request that have not started
+// yet (or that arrive late) are dropped too.
+const canceledRetention = time.Minute
+
+// cancellations tracks the requests that the coordinator has given up on.
+type cancellations struct {
+	running  map[string]context.CancelFunc
+	canceled map[string]time.Time
+	lock     sync.Mutex
+}
+
+func newCancellations() *cancellations {
+	return &cancellations{
+		running:  map[string]context.CancelFunc{},
+		canceled: map[string]time.Time{},
+	}
+}
+
+// start returns a context for a job working on the request that is canceled along with the request, and a function
+// to call once the job has finished. If the request has already been canceled, an error is returned instead.
+func (c *cancellations) start(ctx context.Context, requestID string) (context.Context, func(), error) {
+	// without an ID there is nothing the coordinator could cancel the job by.
+	if requestID == "" {
+		return ctx, func() {}, nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, canceled := c.canceled[requestID]; canceled {
+		return nil, nil, common.Error(common.ErrCanceled, "request %s", requestID)
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	c.running[requestID] = cancel
+
+	done := func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		delete(c.running, requestID)
+		cancel()
+	}
+
+	return jobCtx, done, nil
+}
+
+// cancel cancels the running job for the request, if any, and prevents new ones from starting.
+func (c *cancellations) cancel(requestID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+
+	for id, at := range c.canceled {
+		if now.Sub(at) > canceledRetention {
+			delete(c.canceled, id)
+		}
+	}
+
+	c.canceled[requestID] = now
+
+	if cancel, running := c.running[requestID]; running {
+		cancel()
+	}
+}
+
+// isCanceled returns true if the request has been canceled.
+func (c *cancellations) isCanceled(requestID string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, canceled := c.canceled[requestID]
+
+	return canceled
+}
@@ -16,16 +16,19 @@ import (
 // Engine is a Webassembly job scheduler with configurable host APIs
 type Engine struct {
 	*scheduler.Scheduler
+
+	runner *wasmRunner
 }
 
 // New creates a new Engine with the default API
 func New(name string, ref *tenant.WasmModuleRef, api api.HostAPI) *Engine {
+	runner := newRunnerFromRef(ref, api)
+
 	e := &Engine{
 		Scheduler: scheduler.New(),
+		runner:    runner,
 	}
 
-	runner := newRunnerFromRef(ref, api)
-
 	e.Scheduler.Register(
 		name,
 		runner,
@@ -38,6 +41,22 @@ func New(name string, ref *tenant.WasmModuleRef, api api.HostAPI) *Engine {
 	return e
 }
 
+// Cancel stops the job working on the request with the given ID, if there is one, and prevents jobs for the request
+// that have not started yet from running.
+func (e *Engine) Cancel(requestID string) {
+	e.runner.cancellations.cancel(requestID)
+}
+
+// Canceled returns true if the request with the given ID was canceled.
+func (e *Engine) Canceled(requestID string) bool {
+	return e.runner.cancellations.isCanceled(requestID)
+}
+
+// Close stops the engine's background work. Jobs must not be run once it is closed.
+func (e *Engine) Close() {
+	e.runner.pool.Close()
+}
+
 func WasmRefFromFile(filename string) (*tenant.WasmModuleRef, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/suborbital/e2core/foundation/common"
 	"github.com/suborbital/e2core/foundation/scheduler"
 	"github.com/suborbital/e2core/sat/engine2"
 	"github.com/suborbital/e2core/sat/engine2/api"
@@ -161,3 +162,31 @@ func TestEngineFetch(t *testing.T) {
 		t.Errorf("expected 1password homepage response, got %q", string(res.([]byte))[:1000])
 	}
 }
+
+func TestEngineCanceledRequest(t *testing.T) {
+	ref, err := engine2.WasmRefFromFile("./testdata/log/log.wasm")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	e := engine2.New("log", ref, api.New(zerolog.Nop()))
+
+	req := &request.CoordinatedRequest{
+		Method: "GET",
+		URL:    "/hello/world",
+		ID:     uuid.New().String(),
+		Body:   []byte{},
+	}
+
+	e.Cancel(req.ID)
+
+	if !e.Canceled(req.ID) {
+		t.Error("expected request to be canceled")
+	}
+
+	_, err = e.Do(scheduler.NewJob("log", req)).Then()
+	if !common.IsError(err, common.ErrCanceled) {
+		t.Errorf("expected ErrCanceled, got %v", err)
+	}
+}
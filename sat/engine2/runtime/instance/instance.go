@@ -46,6 +46,11 @@ func (w *Instance) Call(fn string, args ...interface{}) (interface{}, error) {
 	return wasmResult, nil
 }
 
+// SetDeadline sets the number of epochs that calls into the instance may run for before they are interrupted.
+func (w *Instance) SetDeadline(ticks uint64) {
+	w.store.SetEpochDeadline(ticks)
+}
+
 // ReadMemory reads memory from the instance
 func (w *Instance) ReadMemory(pointer int32, size int32) []byte {
 	memory := w.inst.GetExport(w.store, "memory").Memory()
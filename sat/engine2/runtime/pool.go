@@ -1,7 +1,9 @@
 package runtime
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/bytecodealliance/wasmtime-go/v7"
 	"github.com/pkg/errors"
@@ -14,6 +16,23 @@ import (
 
 var i32Type = wasmtime.NewValType(wasmtime.KindI32)
 
+const (
+	// epochInterval is how often the epoch of each engine is incremented, and so the granularity of deadlines.
+	epochInterval = 10 * time.Millisecond
+
+	// noDeadline is used for calls that do not have a timeout, and is long enough to never be reached.
+	noDeadline = uint64(1 << 40)
+)
+
+// DeadlineTicks converts a timeout into the number of epochs an instance may run for, see Instance.SetDeadline.
+func DeadlineTicks(timeout time.Duration) uint64 {
+	if timeout <= 0 {
+		return noDeadline
+	}
+
+	return uint64(timeout/epochInterval) + 1
+}
+
 // InstancePool is a factory for Wasm instances
 type InstancePool struct {
 	availableInstances chan *instance.Instance
@@ -24,6 +43,10 @@ type InstancePool struct {
 	engine  *wasmtime.Engine
 	linker  *wasmtime.Linker
 	lock    sync.RWMutex
+
+	// stop ends the ticking of the engine's epoch once the pool is closed.
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 // NewInstancePool creates a new InstancePool
@@ -32,6 +55,7 @@ func NewInstancePool(ref *tenant.WasmModuleRef, api api.HostAPI) *InstancePool {
 		availableInstances: make(chan *instance.Instance, 64),
 		ref:                ref,
 		hostFns:            api.HostFunctions(),
+		stop:               make(chan struct{}),
 	}
 
 	return b
@@ -110,6 +134,7 @@ func (ip *InstancePool) new() (*instance.Instance, error) {
 	}
 
 	store := wasmtime.NewStore(engine)
+	store.SetEpochDeadline(noDeadline)
 
 	wasiConfig := wasmtime.NewWasiConfig()
 	store.SetWasi(wasiConfig)
@@ -134,7 +159,11 @@ func (ip *InstancePool) new() (*instance.Instance, error) {
 
 func (ip *InstancePool) internals() (*wasmtime.Module, *wasmtime.Engine, *wasmtime.Linker, error) {
 	if ip.module == nil {
-		engine := wasmtime.NewEngine()
+		// epoch interruption allows calls into the module to be stopped once their deadline has passed.
+		config := wasmtime.NewConfig()
+		config.SetEpochInterruption(true)
+
+		engine := wasmtime.NewEngineWithConfig(config)
 
 		// Compiles the module
 		mod, err := wasmtime.NewModule(engine, ip.ref.Data)
@@ -154,11 +183,35 @@ func (ip *InstancePool) internals() (*wasmtime.Module, *wasmtime.Engine, *wasmti
 		ip.module = mod
 		ip.engine = engine
 		ip.linker = linker
+
+		go tickEpochs(engine, ip.stop)
 	}
 
 	return ip.module, ip.engine, ip.linker, nil
 }
 
+// Close stops the background work of the pool. Instances must not be used once it is closed.
+func (ip *InstancePool) Close() {
+	ip.closeOnce.Do(func() {
+		close(ip.stop)
+	})
+}
+
+// tickEpochs increments the engine's epoch until stop is closed.
+func tickEpochs(engine *wasmtime.Engine, stop chan struct{}) {
+	ticker := time.NewTicker(epochInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			engine.IncrementEpoch()
+		case <-stop:
+			return
+		}
+	}
+}
+
 // addHostFns adds a list of host functions to an import object
 func addHostFns(linker *wasmtime.Linker, fns ...api.HostFn) {
 	for i := range fns {
@@ -189,6 +242,12 @@ func addHostFns(linker *wasmtime.Linker, fns ...api.HostFn) {
 				hostArgs[i] = ha
 			}
 
+			// the instance ident is the last argument of every host function, which allows a job that has been
+			// canceled to be stopped the next time it calls into the host.
+			if len(hostArgs) > 0 && jobCanceled(hostArgs[len(hostArgs)-1].(int32)) {
+				return nil, wasmtime.NewTrap(fmt.Sprintf("job canceled, aborted during call to %s", fn.Name))
+			}
+
 			result, err := fn.HostFn(hostArgs...)
 			if err != nil {
 				return nil, wasmtime.NewTrap(errors.Wrapf(err, "failed to HostFn for %s", fn.Name).Error())
@@ -207,3 +266,15 @@ func addHostFns(linker *wasmtime.Linker, fns ...api.HostFn) {
 		_ = linker.FuncNew("env", fn.Name, fnType, wasmtimeFunc)
 	}
 }
+
+// jobCanceled returns true if the instance with the given ident is running a job whose context has been canceled.
+func jobCanceled(ident int32) bool {
+	inst, err := instance.ForIdentifier(ident, false)
+	if err != nil {
+		return false
+	}
+
+	ctx := inst.Ctx()
+
+	return ctx != nil && ctx.Context != nil && ctx.Context.Err() != nil
+}
@@ -1,6 +1,8 @@
 package engine2
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
 
 	"github.com/suborbital/e2core/e2core/sequence"
@@ -18,7 +20,8 @@ var (
 
 // wasmRunner represents a Wasm module
 type wasmRunner struct {
-	pool *runtime.InstancePool
+	pool          *runtime.InstancePool
+	cancellations *cancellations
 }
 
 // newRunnerFromRef creates a wasmRunner from a moduleRef
@@ -26,7 +29,8 @@ func newRunnerFromRef(ref *tenant.WasmModuleRef, api api.HostAPI) *wasmRunner {
 	pool := runtime.NewInstancePool(ref, api)
 
 	r := &wasmRunner{
-		pool: pool,
+		pool:          pool,
+		cancellations: newCancellations(),
 	}
 
 	return r
@@ -48,6 +52,8 @@ func (w *wasmRunner) Run(job scheduler.Job, ctx *scheduler.Ctx) (interface{}, er
 		return nil, errors.New("job data is not a CoordinatedRequest")
 	}
 
+	var timeout time.Duration
+
 	if req.SequenceJSON != nil && len(req.SequenceJSON) > 0 {
 		seq, err := sequence.FromJSON(req.SequenceJSON, req)
 		if err != nil {
@@ -59,11 +65,20 @@ func (w *wasmRunner) Run(job scheduler.Job, ctx *scheduler.Ctx) (interface{}, er
 		if step == nil {
 			return nil, errors.New("got nil NextStep")
 		}
+
+		timeout = step.Timeout
 	}
 
+	jobCtx, done, err := w.cancellations.start(ctx.Context, req.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start job")
+	}
+
+	defer done()
+
 	// save the coordinated request into the
 	// job context for use by the API package
-	ctx.Context = api.ContextWithRequest(ctx.Context, req)
+	ctx.Context = api.ContextWithRequest(jobCtx, req)
 
 	jobBytes = req.Body
 
@@ -78,6 +93,9 @@ func (w *wasmRunner) Run(job scheduler.Job, ctx *scheduler.Ctx) (interface{}, er
 			return
 		}
 
+		// the coordinator stops waiting for the result once the step's timeout passes, so stop the module then too.
+		instance.SetDeadline(runtime.DeadlineTicks(timeout))
+
 		// execute the module's Run function, passing the input data and ident
 		// set runErr but don't return because the ExecutionResult error should also be grabbed
 		_, callErr = instance.Call("run_e", inPointer, int32(len(jobBytes)), ident)
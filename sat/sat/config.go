@@ -36,6 +36,9 @@ type Config struct {
 	ProcUUID        string
 	TracerConfig    satOptions.TracerConfig
 	MetricsConfig   satOptions.MetricsConfig
+	MeshKey         string
+	MeshPrivateKey  string
+	MeshTokenPath   string
 }
 
 func ConfigFromArgs(l zerolog.Logger) (*Config, error) {
@@ -169,6 +172,9 @@ func ConfigFromModuleArg(logger zerolog.Logger, moduleArg string) (*Config, erro
 		TracerConfig:    opts.TracerConfig,
 		MetricsConfig:   opts.MetricsConfig,
 		ProcUUID:        string(opts.ProcUUID),
+		MeshKey:         opts.MeshKey,
+		MeshPrivateKey:  opts.MeshPrivateKey,
+		MeshTokenPath:   opts.MeshTokenPath,
 	}
 
 	return c, nil
@@ -10,6 +10,7 @@ import (
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/suborbital/e2core/e2core/sequence"
 	"github.com/suborbital/e2core/foundation/scheduler"
 	"github.com/suborbital/e2core/sat/engine2"
 	"github.com/suborbital/e2core/sat/sat/metrics"
@@ -65,10 +66,16 @@ func (s *Sat) handler(engine *engine2.Engine) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(errors.New("result from engine.Do was not a coordinated response struct"))
 		}
 
-		for headerKey, headerValue := range resp.RespHeaders {
+		meta := sequence.NewResponseMeta(resp.RespHeaders)
+
+		for headerKey, headerValue := range meta.Headers {
 			c.Response().Header().Add(headerKey, headerValue)
 		}
 
-		return c.Blob(http.StatusOK, "application/octet-stream", resp.Output)
+		if !meta.HasBody() {
+			return c.NoContent(meta.Status)
+		}
+
+		return c.Blob(meta.Status, meta.ContentType, resp.Output)
 	}
 }
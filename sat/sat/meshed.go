@@ -28,6 +28,12 @@ func (s *Sat) handleFnResult(msg bus.Message, result interface{}, fnErr error) {
 		return
 	}
 
+	// the coordinator is no longer waiting for this request, so neither its result nor the next step are needed.
+	if s.engine.Canceled(req.ID) {
+		ll.Debug().Str("requestID", req.ID).Msg("request was canceled, dropping result")
+		return
+	}
+
 	ctx := context.WithValue(context.Background(), "requestID", req.ID)
 
 	spanCtx, span := s.tracer.Start(ctx, "handleFnResult", trace.WithAttributes(
@@ -83,6 +89,13 @@ func (s *Sat) handleFnResult(msg bus.Message, result interface{}, fnErr error) {
 		return
 	}
 
+	// group steps are fanned out and collected by the coordinator (e2core), which merges the results of every
+	// member before moving on, so a group member only ever reports its own result.
+	if step.IsGroup() {
+		ll.Debug().Str("messageType", msg.Type()).Msg("executed group step member, leaving the rest of the sequence to the coordinator")
+		return
+	}
+
 	// determine if we ourselves should continue or halt the sequence
 	if execErr != nil {
 		ll.Err(execErr).Str("messageType", msg.Type()).Msg("stopping execution after exec error")
@@ -106,6 +119,19 @@ func (s *Sat) handleFnResult(msg bus.Message, result interface{}, fnErr error) {
 	s.sendNextStep(msg, seq, req, spanCtx)
 }
 
+// handleCancel is mounted onto the bus to receive cancellations from the coordinator for requests that have timed out.
+func (s *Sat) handleCancel(msg bus.Message) error {
+	if string(msg.Data()) != s.config.JobType {
+		return nil
+	}
+
+	s.logger.Debug().Str("method", "handleCancel").Str("requestID", msg.ParentID()).Msg("canceling request")
+
+	s.engine.Cancel(msg.ParentID())
+
+	return nil
+}
+
 func (s *Sat) sendFnResult(result *sequence.ExecResult, ctx context.Context) error {
 	span := trace.SpanFromContext(ctx)
 	defer span.End()
@@ -147,6 +173,11 @@ func (s *Sat) sendNextStep(_ bus.Message, seq *sequence.Sequence, req *request.C
 		return
 	}
 
+	if nextStep.IsGroup() {
+		ll.Debug().Msg("next step is a group, leaving its dispatch to the coordinator")
+		return
+	}
+
 	reqJSON, err := json.Marshal(req)
 	if err != nil {
 		ll.Err(err).Msg("json.Marshal request")
@@ -20,6 +20,12 @@ type Options struct {
 	MetricsConfig MetricsConfig `env:",prefix=SAT_METRICS_"`
 
 	Connections string `env:"SAT_CONNECTIONS"`
+
+	// MeshKey is the public key that e2core signs join tokens with, MeshPrivateKey the key that the instance proves its
+	// membership with, and MeshTokenPath the file that e2core keeps the instance's current join token in.
+	MeshKey        string `env:"SAT_MESH_KEY"`
+	MeshPrivateKey string `env:"SAT_MESH_PRIVATE_KEY"`
+	MeshTokenPath  string `env:"SAT_MESH_TOKEN_PATH"`
 }
 
 // ControlPlane is a struct, so we can use a pointer, so we can check whether it's been set in config. If set, it holds
@@ -14,6 +14,8 @@ import (
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/suborbital/e2core/e2core/mesh"
+	"github.com/suborbital/e2core/e2core/server"
 	"github.com/suborbital/e2core/foundation/bus/bus"
 	"github.com/suborbital/e2core/foundation/bus/discovery/local"
 	"github.com/suborbital/e2core/foundation/bus/transport/websocket"
@@ -82,7 +84,19 @@ func New(config *Config, logger zerolog.Logger, traceProvider trace.TracerProvid
 
 	// if a "transport" is configured, enable bus and metrics endpoints, otherwise enable server mode
 	if config.ControlPlaneUrl != "" {
-		sat.transport = websocket.New()
+		var transportOpts []websocket.Option
+
+		// only the peers that were granted membership by the same e2core can connect when it gave us a key.
+		if config.MeshKey != "" {
+			member, err := mesh.NewMember(config.MeshKey, config.MeshPrivateKey, config.MeshTokenPath)
+			if err != nil {
+				return nil, errors.Wrap(err, "mesh.NewMember")
+			}
+
+			transportOpts = append(transportOpts, websocket.UseAuthenticator(member))
+		}
+
+		sat.transport = websocket.New(transportOpts...)
 
 		sat.server.GET("/meta/message", echo.WrapHandler(sat.transport.HTTPHandlerFunc()))
 		sat.server.GET("/meta/metrics", sat.workerMetricsHandler())
@@ -155,7 +169,12 @@ func (s *Sat) Shutdown() error {
 	defer cxl()
 
 	ll.Info().Msg("shutting down echo server")
-	if err := s.server.Shutdown(stopCtx); err != nil {
+	err := s.server.Shutdown(stopCtx)
+
+	// the engine is closed once no more requests can reach it, whether or not the server shut down cleanly.
+	s.engine.Close()
+
+	if err != nil {
 		return errors.Wrap(err, "failed to echo.Shutdown()")
 	}
 
@@ -180,6 +199,8 @@ func (s *Sat) setupBus() {
 	s.pod = s.bus.Connect()
 
 	s.engine.ListenAndRun(s.bus.Connect(), s.config.JobType, s.handleFnResult)
+
+	s.bus.Connect().OnType(server.MsgTypeSuborbitalCancel, s.handleCancel)
 }
 
 func refFromFilename(name, fqmn, filename string) (*tenant.WasmModuleRef, error) {
@@ -1,15 +1,30 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+type streamResponse struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Output []byte `json:"output"`
+	Error  string `json:"error"`
+}
+
 func main() {
-	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8080/stream", nil)
+	header := http.Header{}
+	if token := os.Getenv("E2CORE_TOKEN"); token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8080/stream/com.suborbital.app/default/helloworld-rs", header)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -33,7 +48,16 @@ func main() {
 			log.Fatal(err)
 		}
 
-		fmt.Println(string(response))
+		resp := streamResponse{}
+		if err := json.Unmarshal(response, &resp); err != nil {
+			log.Fatal(err)
+		}
+
+		if resp.Error != "" {
+			fmt.Printf("%s: %d %s\n", resp.ID, resp.Status, resp.Error)
+		} else {
+			fmt.Printf("%s: %s\n", resp.ID, string(resp.Output))
+		}
 
 		time.Sleep(time.Second * 3)
 	}